@@ -3,19 +3,23 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/santiagocorredoira/agent/agent/cache"
 	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/guardrails"
 	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/mcp"
 	"github.com/santiagocorredoira/agent/agent/memory"
+	"github.com/santiagocorredoira/agent/agent/metrics"
 	"github.com/santiagocorredoira/agent/agent/planner"
 	"github.com/santiagocorredoira/agent/agent/prompts"
 	"github.com/santiagocorredoira/agent/agent/tools"
+	"github.com/santiagocorredoira/agent/agent/tracing"
 )
 
 // V3Agent represents the core agent instance for library usage
@@ -33,6 +37,43 @@ type V3Agent struct {
 	contextAdded   bool                   // Track if context has been added to avoid duplicates
 	logger         *llm.InteractionLogger // Optional interaction logger
 	promptCache    *cache.PromptCache     // Cache for system prompts
+
+	confirmationHandler ConfirmationHandler // Asks the user before running tools that require confirmation
+
+	turnQuery       string               // User message of the turn in progress, used to pick relevant result sections
+	turnResultChars int                  // Tool result characters already added to the context in this turn
+	turnTrace       []llm.Message        // Assistant tool calls and tool results of the turn in progress
+	turnUser        *ConversationContext // User context of the turn in progress, exposed to hooks
+	turnToolCalls   int                  // Tool calls executed in this turn
+	turnToolErrors  int                  // Tool calls of this turn that failed
+	turnToolErr     error                // Last tool failure of this turn
+	turnSources     []llm.Source         // Documents surfaced or read by tools in this turn
+	turnPlan        *planner.Plan        // Step plan of the turn in progress (plan mode)
+	lastPlan        *planner.Plan        // Step plan of the last turn run in plan mode
+	turnBudget      config.BudgetConfig  // Budget limits of the turn in progress
+	turnStart       time.Time            // Start of the turn in progress, for the processing time budget
+	turnAnswerNow   bool                 // A soft budget is spent: answer without more tools
+	turnSpan        *tracing.Span        // Trace span of the turn in progress
+	turnConfirm     ConfirmationHandler  // Confirmation handler of the turn in progress, passed on to sub-agents
+
+	hooks         []Hook               // Middleware chain around messages, LLM calls and tool executions
+	guardrails    *guardrails.Pipeline // Input, tool result and output checks (nil when disabled)
+	eventHandlers []EventHandler       // Receivers of agent events
+	tracer        *tracing.Tracer      // Span recorder for turns (nil when tracing is disabled)
+	metrics       *agentMetrics        // Counters and latencies for /metrics
+	mcp           *mcp.Manager         // Connections to MCP servers (nil when none are configured)
+
+	profileName       string                  // Profile of the current session, "" for none
+	profile           *config.Profile         // Settings of the current profile
+	profilePrompts    []string                // System prompt templates of the current profile
+	routedProvider    llm.Provider            // LLM provider routed by the current profile, nil for the default
+	profileProviders  map[string]llm.Provider // Routed providers built so far, by profile
+	fixedProvider     bool                    // Provider supplied in AgentConfig, profiles do not route
+	baseToolsOnlyMode bool                    // Tools-only mode outside profiles
+
+	parent         *V3Agent       // Agent that delegated this run, nil for top-level agents
+	usage          llm.TokenUsage // Tokens used by this agent and its sub-agents
+	delegatedTasks int            // Sub-agent runs started through the delegate tool
 }
 
 // AgentConfig provides configuration options for the agent
@@ -44,6 +85,12 @@ type AgentConfig struct {
 	CustomTools      []tools.Tool
 	ContextProviders []memory.ContextProvider
 	ToolsOnlyMode    bool // If true, only respond to questions requiring tools (default: true)
+
+	ConfirmationHandler ConfirmationHandler // Optional handler for tools that require confirmation
+	Hooks               []Hook              // Optional middleware chain, run in order
+	EventHandlers       []EventHandler      // Optional receivers of agent events (guardrail verdicts...)
+	Metrics             *metrics.Registry   // Optional registry to report metrics to (default: a new one)
+	Provider            llm.Provider        // Optional LLM provider used instead of the configured ones, including profile routes
 }
 
 // ConversationContext provides contextual information about the user/session
@@ -53,6 +100,7 @@ type ConversationContext struct {
 	Role         string            `json:"role,omitempty"`         // User's role (admin, developer, etc.)
 	Preferences  map[string]string `json:"preferences,omitempty"`  // Custom preferences (timezone, language, etc.)
 	Metadata     map[string]any    `json:"metadata,omitempty"`     // Additional contextual data
+	Profile      string            `json:"profile,omitempty"`      // Agent profile of the session, defaults to agent.profile
 }
 
 // StatusCallback is called with status messages during processing
@@ -66,8 +114,26 @@ type ConversationOptions struct {
 	ContextLimit   int
 	Context        *ConversationContext // Optional context for personalization
 	StatusCallback StatusCallback       // Optional callback for status messages
+
+	ConfirmationHandler ConfirmationHandler // Optional per-call override of the agent confirmation handler
+
+	MaxToolIterations int // Maximum tool-calling rounds per turn (0 = profile value, default 20)
+	MinSearches       int // Searches to attempt before accepting thin results (0 = profile value, default 8)
+
+	ErrorPolicy string // "friendly" or "strict", overrides the configured agent.error_policy
+
+	Mode         string       // "loop" or "plan", overrides the profile and the configured agent.mode
+	PlanCallback PlanCallback // Optional callback with a copy of the plan each time it changes (plan mode)
+
+	Budget *config.BudgetConfig // Optional soft and hard limits for the conversation, overrides the configured budget
 }
 
+// Default tool loop limits
+const (
+	defaultMaxToolIterations = 20 // Allow up to 20 tool calls to find information thoroughly
+	defaultMinSearches       = 8  // Minimum searches required - especially for synonym searches like bonos→vouchers
+)
+
 // DefaultConversationOptions returns sensible defaults
 func DefaultConversationOptions() ConversationOptions {
 	return ConversationOptions{
@@ -87,10 +153,14 @@ func NewV3Agent(cfg AgentConfig) (*V3Agent, error) {
 	}
 	agentConfig := config.LoadConfigOrDefault(configPath)
 
-	// Create LLM provider
-	provider, err := createLLMProvider(agentConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create LLM provider: %w", err)
+	// Create LLM provider unless the caller supplies one
+	var err error
+	provider := cfg.Provider
+	if provider == nil {
+		provider, err = createLLMProvider(agentConfig, agentConfig.LLM.FallbackOrder, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create LLM provider: %w", err)
+		}
 	}
 
 	// Create memory manager
@@ -102,10 +172,14 @@ func NewV3Agent(cfg AgentConfig) (*V3Agent, error) {
 	if err := memoryManager.Initialize(); err != nil {
 		return nil, fmt.Errorf("failed to initialize memory: %w", err)
 	}
+	memoryManager.SetTraceContextMode(agentConfig.Agent.TraceContext)
+
+	// Tools and guardrails call the LLM through the agent, which charges the calls
+	charged := &chargedProvider{}
 
 	// Create tool registry and register basic tools
 	toolRegistry := tools.NewToolRegistry()
-	if err := registerBasicTools(toolRegistry, agentConfig, provider); err != nil {
+	if err := registerBasicTools(toolRegistry, agentConfig, charged); err != nil {
 		return nil, fmt.Errorf("failed to register basic tools: %w", err)
 	}
 
@@ -124,6 +198,27 @@ func NewV3Agent(cfg AgentConfig) (*V3Agent, error) {
 	// Create task planner
 	taskPlanner := planner.NewTaskPlanner(toolRegistry)
 
+	// Create guardrail pipeline from configuration
+	var guardrailPipeline *guardrails.Pipeline
+	if agentConfig.Guardrails.Enabled {
+		guardrailPipeline, err = guardrails.NewPipeline(agentConfig.Guardrails, charged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create guardrails: %w", err)
+		}
+	}
+
+	// Create tracer from configuration
+	tracer, err := tracing.New(agentConfig.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracer: %w", err)
+	}
+
+	// Create metrics registry
+	metricsRegistry := cfg.Metrics
+	if metricsRegistry == nil {
+		metricsRegistry = metrics.NewRegistry()
+	}
+
 	// Create context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -141,6 +236,34 @@ func NewV3Agent(cfg AgentConfig) (*V3Agent, error) {
 		cancel:        cancel,
 		toolsOnlyMode: cfg.ToolsOnlyMode, // Use the configuration value
 		promptCache:   promptCache,
+
+		baseToolsOnlyMode: cfg.ToolsOnlyMode,
+		profileProviders:  make(map[string]llm.Provider),
+		fixedProvider:     cfg.Provider != nil,
+
+		confirmationHandler: cfg.ConfirmationHandler,
+		hooks:               cfg.Hooks,
+		guardrails:          guardrailPipeline,
+		eventHandlers:       cfg.EventHandlers,
+		tracer:              tracer,
+		metrics:             newAgentMetrics(metricsRegistry),
+		turnBudget:          agentConfig.Budget,
+	}
+
+	charged.agent = agent
+	agent.collectMetrics()
+
+	// Register the delegate tool, which needs the agent to start sub-agents
+	if tools.ToolEnabled(agentConfig, delegateToolName) {
+		if err := toolRegistry.RegisterTool(NewDelegateTool(agent)); err != nil {
+			return nil, fmt.Errorf("failed to register delegate tool: %w", err)
+		}
+	}
+
+	// Connect MCP servers and register their tools
+	if len(agentConfig.MCP.Servers) > 0 {
+		agent.mcp = mcp.NewManager(agentConfig.MCP, toolRegistry)
+		agent.mcp.Start(ctx)
 	}
 
 	return agent, nil
@@ -151,12 +274,27 @@ func (a *V3Agent) StartConversation() (*memory.ConversationMemory, error) {
 	return a.StartConversationWithContext(nil)
 }
 
-// StartConversationWithContext starts a new conversation session with optional context
+// StartConversationWithContext starts a new conversation session with optional context.
+// The session uses context.Profile, or the configured default profile.
 func (a *V3Agent) StartConversationWithContext(context *ConversationContext) (*memory.ConversationMemory, error) {
+	profile := a.config.Agent.Profile
+	if context != nil && context.Profile != "" {
+		profile = context.Profile
+	}
+	return a.startConversation(context, profile)
+}
+
+// startConversation starts a new conversation session with a profile
+func (a *V3Agent) startConversation(context *ConversationContext, profile string) (*memory.ConversationMemory, error) {
+	if err := a.applyProfile(profile); err != nil {
+		return nil, fmt.Errorf("failed to start conversation: %w", err)
+	}
+
 	session, err := a.memoryManager.StartNewSession()
 	if err != nil {
 		return nil, fmt.Errorf("failed to start conversation: %w", err)
 	}
+	session.Profile = a.profileName
 
 	// Set this as current session
 	a.currentSession = session
@@ -175,6 +313,11 @@ func (a *V3Agent) LoadConversation(sessionID string) (*memory.ConversationMemory
 		return nil, fmt.Errorf("failed to load conversation %s: %w", sessionID, err)
 	}
 	a.currentSession = session
+
+	if err := a.applyProfile(session.Profile); err != nil {
+		log.Printf("Conversation %s: %v, using the default settings", sessionID, err)
+		a.applyProfile("")
+	}
 	return session, nil
 }
 
@@ -209,18 +352,24 @@ func (a *V3Agent) GetConfig() *config.Config {
 	return a.config
 }
 
+// GetToolRegistry returns the registry of the agent tools
+func (a *V3Agent) GetToolRegistry() *tools.ToolRegistry {
+	return a.toolRegistry
+}
+
 // SendMessage sends a message to the agent and returns the response
 func (a *V3Agent) SendMessage(message string, options ...ConversationOptions) (*llm.CompletionResponse, error) {
-	return a.sendMessageInternal(message, false, options...)
+	return a.sendMessageInternal(message, false, true, options...)
 }
 
 // SendMessageWithStreaming sends a message with real-time progress feedback
 func (a *V3Agent) SendMessageWithStreaming(message string, options ...ConversationOptions) (*llm.CompletionResponse, error) {
-	return a.sendMessageInternal(message, true, options...)
+	return a.sendMessageInternal(message, true, true, options...)
 }
 
-// sendMessageInternal is the internal implementation that handles both streaming and non-streaming
-func (a *V3Agent) sendMessageInternal(message string, enableStreaming bool, options ...ConversationOptions) (*llm.CompletionResponse, error) {
+// sendMessageInternal is the internal implementation that handles both streaming and non-streaming.
+// When addUserMessage is false the user message is expected to be the active leaf already (regeneration).
+func (a *V3Agent) sendMessageInternal(message string, enableStreaming bool, addUserMessage bool, options ...ConversationOptions) (*llm.CompletionResponse, error) {
 	if a.currentSession == nil {
 		return nil, fmt.Errorf("no active conversation session")
 	}
@@ -231,10 +380,42 @@ func (a *V3Agent) sendMessageInternal(message string, enableStreaming bool, opti
 		opts = options[0]
 	}
 
-	// DEBUG: Log provider state at start of message processing
-	log.Printf("🔍 sendMessageInternal START - Provider: %s", a.llmProvider.GetName())
-	log.Printf("🔍 Provider available check: %t", a.llmProvider.IsAvailable(a.ctx))
+	// Trace the turn; LLM and tool call spans hang from it
+	provider := a.provider()
+	_, span := a.tracer.Start(a.ctx, "agent.turn", map[string]interface{}{
+		"session_id":         a.currentSession.SessionID,
+		"profile":            a.profileName,
+		"provider":           provider.GetName(),
+		"provider_available": provider.IsAvailable(a.ctx),
+		"message_chars":      len(message),
+		"streaming":          enableStreaming,
+		"regenerate":         !addUserMessage,
+		"mode":               a.mode(opts),
+	})
+	a.turnSpan = span
+	usage := a.usage
+
+	resp, err := a.runTurn(message, enableStreaming, addUserMessage, opts)
 
+	span.SetAttributes(map[string]interface{}{
+		"tool_calls":        a.turnToolCalls,
+		"tool_errors":       a.turnToolErrors,
+		"prompt_tokens":     a.usage.PromptTokens - usage.PromptTokens,
+		"completion_tokens": a.usage.CompletionTokens - usage.CompletionTokens,
+	})
+	if resp != nil {
+		span.SetAttribute("response_chars", len(resp.Content))
+	}
+	span.SetError(err)
+	span.End()
+	a.turnSpan = nil
+
+	return resp, err
+}
+
+// runTurn processes one user message: hooks, guardrails, budget, the LLM and
+// tool loop, and memory updates
+func (a *V3Agent) runTurn(message string, enableStreaming bool, addUserMessage bool, opts ConversationOptions) (*llm.CompletionResponse, error) {
 	// Show initial status if streaming enabled
 	if enableStreaming {
 		if opts.StatusCallback != nil {
@@ -248,12 +429,150 @@ func (a *V3Agent) sendMessageInternal(message string, enableStreaming bool, opti
 	// No need to add as separate message
 	a.contextAdded = true
 
+	// Reset per-turn state
+	a.turnQuery = message
+	a.turnResultChars = 0
+	a.turnTrace = nil
+	a.turnToolCalls = 0
+	a.turnToolErrors = 0
+	a.turnToolErr = nil
+	a.turnSources = nil
+	a.turnPlan = nil
+	a.turnConfirm = a.confirmationHandlerFor(opts)
+	a.turnUser = a.contextInfo
+	if opts.Context != nil {
+		a.turnUser = opts.Context
+	}
+
+	// Let hooks rewrite the message or answer it directly
+	message, canned, err := a.runBeforeUserMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the user message before it reaches the LLM or memory
+	guarded := a.applyGuardrails(guardrails.StageInput, message)
+	if guarded.Blocked {
+		return &llm.CompletionResponse{Content: guarded.Content}, nil
+	}
+	message = guarded.Content
+	a.turnQuery = message
+
+	// Remember the branch position so a failed turn leaves no trace in memory
+	checkpoint := a.currentSession.Checkpoint()
+
+	// Check the conversation budget before spending anything on this turn
+	a.startTurnBudget(opts)
+	defer a.endTurnBudget()
+	if err := a.checkBudget(); err != nil {
+		return a.failTurn(err, opts, checkpoint)
+	}
+
 	// Add user message to memory
-	userMessage := llm.Message{Role: "user", Content: message}
-	if err := a.memoryManager.AddMessageToCurrentSession(userMessage); err != nil {
-		return nil, fmt.Errorf("failed to add message to session: %w", err)
+	if addUserMessage {
+		userMessage := llm.Message{Role: "user", Content: message}
+		if err := a.memoryManager.AddMessageToCurrentSession(userMessage); err != nil {
+			return nil, fmt.Errorf("failed to add message to session: %w", err)
+		}
+	}
+
+	resp := canned
+	if resp == nil {
+		if a.mode(opts) == ModePlan {
+			resp, err = a.generatePlannedResponse(message, enableStreaming, opts)
+		} else {
+			resp, err = a.generateResponse(message, enableStreaming, opts)
+		}
+		if err != nil {
+			return a.failTurn(err, opts, checkpoint)
+		}
+	}
+	if len(a.turnSources) > 0 {
+		resp.Sources = a.turnSources
+	}
+
+	if err := a.runAfterTurn(resp); err != nil {
+		a.currentSession.Rollback(checkpoint)
+		return nil, err
 	}
 
+	// Check the final answer before it is returned or saved
+	resp.Content = a.applyGuardrails(guardrails.StageOutput, resp.Content).Content
+
+	// Persist the tool-call trace so reloaded sessions keep the evidence behind the answer
+	for _, traceMessage := range a.turnTrace {
+		traceMessage.Trace = true
+		if err := a.memoryManager.AddMessageToCurrentSession(traceMessage); err != nil {
+			a.currentSession.Rollback(checkpoint)
+			return nil, fmt.Errorf("failed to add tool trace to session: %w", err)
+		}
+	}
+	a.turnTrace = nil
+
+	// Add assistant response to memory
+	assistantMessage := llm.Message{Role: "assistant", Content: resp.Content, Sources: resp.Sources}
+	if err := a.memoryManager.AddMessageToCurrentSession(assistantMessage); err != nil {
+		a.currentSession.Rollback(checkpoint)
+		return nil, fmt.Errorf("failed to add response to session: %w", err)
+	}
+
+	// Generate AI summary asynchronously once the conversation has three
+	// exchanges; the tool-call trace does not count
+	if a.parent == nil && a.currentSession != nil && len(a.currentSession.ConversationMessages()) >= 6 {
+		// Check if we need to generate/update the summary
+		needsSummary := a.currentSession.Summary == "" ||
+			strings.Contains(a.currentSession.Summary, "(comprimida)") ||
+			strings.Contains(a.currentSession.Summary, "conversación general")
+
+		if needsSummary {
+			go func() {
+				if err := a.GenerateConversationSummary(a.currentSession.SessionID); err != nil {
+					log.Printf("Failed to generate conversation summary: %v", err)
+				}
+			}()
+		}
+	}
+
+	return resp, nil
+}
+
+// failTurn removes the failed turn from memory, reports it and applies the error
+// policy: strict returns the error, friendly returns an explanatory response
+// that is not saved. Errors other than *TurnError are always returned.
+func (a *V3Agent) failTurn(err error, opts ConversationOptions, checkpoint memory.Checkpoint) (*llm.CompletionResponse, error) {
+	a.currentSession.Rollback(checkpoint)
+	a.turnTrace = nil
+
+	policy := a.errorPolicy(opts)
+	var turnErr *TurnError
+	isTurnErr := errors.As(err, &turnErr)
+
+	data := map[string]interface{}{
+		"error":  err.Error(),
+		"policy": policy,
+	}
+	if isTurnErr {
+		data["code"] = ErrorCode(turnErr)
+	}
+	a.emit(EventTurnFailed, data)
+
+	a.turnSpan.SetError(err)
+	a.turnSpan.SetAttribute("error_policy", policy)
+	if isTurnErr {
+		a.turnSpan.SetAttribute("error_code", ErrorCode(turnErr))
+	}
+
+	if policy == ErrorPolicyStrict || !isTurnErr {
+		return nil, err
+	}
+
+	log.Printf("Turn failed, answering with friendly message: %v", err)
+	return &llm.CompletionResponse{Content: friendlyErrorMessage(turnErr)}, nil
+}
+
+// generateResponse runs the LLM and tool-calling loop for one user message.
+// Failures are returned as *TurnError.
+func (a *V3Agent) generateResponse(message string, enableStreaming bool, opts ConversationOptions) (*llm.CompletionResponse, error) {
 	// Build tools list for LLM function calling
 	if enableStreaming {
 		if opts.StatusCallback != nil {
@@ -263,6 +582,9 @@ func (a *V3Agent) sendMessageInternal(message string, enableStreaming bool, opti
 		}
 	}
 	availableTools := a.buildToolsForLLM()
+	if a.turnAnswerNow {
+		availableTools = nil // A soft budget is spent, answer without tools
+	}
 
 	var toolContext string
 
@@ -309,69 +631,31 @@ func (a *V3Agent) sendMessageInternal(message string, enableStreaming bool, opti
 		}
 	}
 
-	// DEBUG: Log before calling Complete
-	log.Printf("🔍 About to call Complete - Provider: %s", a.llmProvider.GetName())
-
-	resp, err := a.llmProvider.Complete(a.ctx, req)
-
-	// DEBUG: Log after calling Complete
-	log.Printf("🔍 Complete returned - Error: %v", err)
-	if resp != nil {
-		log.Printf("🔍 Response content preview: %.100s", resp.Content)
+	resp, err := a.complete(a.ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
-	if err != nil {
-		// Simple fallback response instead of failing
-		log.Printf("🔍 Using fallback response due to error: %v", err)
-		resp = &llm.CompletionResponse{
-			Content: fmt.Sprintf("I'm experiencing technical difficulties. Error: %v\n\nPlease try rephrasing your question or ask something simpler.", err),
-			Usage: llm.TokenUsage{
-				PromptTokens:     0,
-				CompletionTokens: 0,
-				TotalTokens:      0,
-			},
-		}
-	} else {
-		// Handle tool calls if LLM requested them
-		if len(resp.ToolCalls) > 0 {
-			if enableStreaming {
-				message := fmt.Sprintf("Searching documentation (%d searches)...", len(resp.ToolCalls))
-				if opts.StatusCallback != nil {
-					opts.StatusCallback(message)
-				} else {
-					fmt.Printf("%s\n", message)
-				}
-			}
-			toolResp, toolErr := a.handleToolCallsWithDepthLimitStreaming(resp, contextMessages, opts, 0, enableStreaming)
-			if toolErr != nil {
-				// If tool calls fail, provide a fallback response with the original content
-				resp.Content = fmt.Sprintf("%s\n\n⚠️ I attempted to use tools but encountered an issue: %v\nI can help with general questions without external data.", resp.Content, toolErr)
-			} else {
-				resp = toolResp
-			}
+	// Handle tool calls if LLM requested them
+	if len(resp.ToolCalls) == 0 {
+		return resp, nil
+	}
+	if enableStreaming {
+		message := fmt.Sprintf("Searching documentation (%d searches)...", len(resp.ToolCalls))
+		if opts.StatusCallback != nil {
+			opts.StatusCallback(message)
+		} else {
+			fmt.Printf("%s\n", message)
 		}
 	}
-
-	// Add assistant response to memory
-	assistantMessage := llm.Message{Role: "assistant", Content: resp.Content}
-	if err := a.memoryManager.AddMessageToCurrentSession(assistantMessage); err != nil {
-		return nil, fmt.Errorf("failed to add response to session: %w", err)
+	resp, err = a.handleToolCallsWithDepthLimitStreaming(resp, contextMessages, opts, 0, enableStreaming)
+	if err != nil {
+		return nil, err
 	}
 
-	// Generate AI summary asynchronously if conversation has enough messages
-	if a.currentSession != nil && len(a.currentSession.Messages) >= 6 {
-		// Check if we need to generate/update the summary
-		needsSummary := a.currentSession.Summary == "" ||
-			strings.Contains(a.currentSession.Summary, "(comprimida)") ||
-			strings.Contains(a.currentSession.Summary, "conversación general")
-
-		if needsSummary {
-			go func() {
-				if err := a.GenerateConversationSummary(a.currentSession.SessionID); err != nil {
-					log.Printf("Failed to generate conversation summary: %v", err)
-				}
-			}()
-		}
+	// Under the strict policy an answer built without a single working tool call is a failure
+	if a.errorPolicy(opts) == ErrorPolicyStrict && a.turnToolCalls > 0 && a.turnToolErrors == a.turnToolCalls {
+		return nil, &TurnError{Kind: ErrToolFailed, Err: a.turnToolErr}
 	}
 
 	return resp, nil
@@ -390,7 +674,7 @@ func (a *V3Agent) ExecuteTool(toolName string, parameters map[string]interface{}
 		execution.SessionID = a.currentSession.SessionID
 	}
 
-	result, err := a.toolRegistry.ExecuteTool(a.ctx, execution)
+	result, err := a.toolRegistry.ExecuteTool(tools.WithAPIHost(a.ctx, a.apiHost()), execution)
 	if err != nil {
 		return nil, fmt.Errorf("tool execution failed: %w", err)
 	}
@@ -463,8 +747,12 @@ func (a *V3Agent) GetStats() AgentStats {
 		AvailableTools:   toolStats.AvailableTools,
 		ToolExecutions:   toolStats.TotalExecutions,
 		ToolSuccessRate:  toolStats.OverallSuccessRate,
-		LLMProvider:      a.llmProvider.GetName(),
-		LLMAvailable:     a.llmProvider.IsAvailable(a.ctx),
+		LLMProvider:      a.provider().GetName(),
+		LLMAvailable:     a.provider().IsAvailable(a.ctx),
+		TokenUsage:       a.usage,
+		DelegatedTasks:   a.delegatedTasks,
+		Budget:           a.GetBudgetStatus(),
+		Profile:          a.profileName,
 	}
 }
 
@@ -479,6 +767,11 @@ type AgentStats struct {
 	ToolSuccessRate  float64 `json:"tool_success_rate"`
 	LLMProvider      string  `json:"llm_provider"`
 	LLMAvailable     bool    `json:"llm_available"`
+
+	TokenUsage     llm.TokenUsage `json:"token_usage"`       // Includes tokens used by sub-agents
+	DelegatedTasks int            `json:"delegated_tasks"`   // Sub-agent runs started with the delegate tool
+	Budget         BudgetStatus   `json:"budget"`            // Consumption of the current conversation
+	Profile        string         `json:"profile,omitempty"` // Agent profile of the current conversation
 }
 
 // AddBusinessContext adds a business-specific context provider
@@ -651,6 +944,18 @@ func (a *V3Agent) Shutdown() error {
 	// Cancel context to stop any ongoing operations
 	a.cancel()
 
+	// Flush pending traces
+	if a.parent == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := a.tracer.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shut down tracer: %v", err)
+		}
+		if a.mcp != nil {
+			a.mcp.Close()
+		}
+	}
+
 	// Save current session if exists
 	if a.currentSession != nil {
 		if err := a.currentSession.Save(); err != nil {
@@ -663,11 +968,13 @@ func (a *V3Agent) Shutdown() error {
 
 // Helper functions
 
-func createLLMProvider(cfg *config.Config) (llm.Provider, error) {
+// createLLMProvider creates the providers of a route in fallback order. A model,
+// when given, overrides the configured model of the first provider.
+func createLLMProvider(cfg *config.Config, route []string, model string) (llm.Provider, error) {
 	var providers []llm.Provider
 
 	// Create providers in fallback order without testing availability
-	for _, providerName := range cfg.LLM.FallbackOrder {
+	for _, providerName := range route {
 		if !cfg.LLM.Providers[providerName].Enabled {
 			continue
 		}
@@ -676,18 +983,12 @@ func createLLMProvider(cfg *config.Config) (llm.Provider, error) {
 		if llmConfig == nil {
 			continue
 		}
+		if model != "" && len(providers) == 0 {
+			llmConfig.Model = model
+		}
 
-		var provider llm.Provider
-		switch providerName {
-		case "anthropic":
-			provider = llm.NewAnthropicProvider(llmConfig)
-		case "openai":
-			provider = llm.NewOpenAIProvider(llmConfig)
-		case "gemini":
-			provider = llm.NewGeminiProvider(llmConfig)
-		case "mock":
-			provider = llm.NewMockProvider(llmConfig)
-		default:
+		provider, err := llm.NewProvider(providerName, llmConfig)
+		if err != nil {
 			continue
 		}
 
@@ -703,32 +1004,26 @@ func createLLMProvider(cfg *config.Config) (llm.Provider, error) {
 }
 
 func registerBasicTools(registry *tools.ToolRegistry, config *config.Config, llmProvider llm.Provider) error {
-	// Only register knowledge base tools if path is configured and exists
-	if config.KnowledgeBase.Path != "" {
-		// Check if path exists
-		if _, err := os.Stat(config.KnowledgeBase.Path); err == nil {
-			// Create restricted filesystem for knowledge base
-			restrictedFS, err := tools.NewRestrictedFS(config.KnowledgeBase.Path)
-			if err != nil {
-				return fmt.Errorf("failed to create restricted filesystem: %w", err)
-			}
+	// Build the built-in tools enabled in the configuration
+	builtins, notes, err := tools.BuildTools(config, llmProvider)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		log.Print(note)
+	}
 
-			// Register the new search engine tool with LLM provider
-			searchEngineTool := tools.NewSearchEngineToolWithLLM(restrictedFS, llmProvider)
-			if err := registry.RegisterTool(searchEngineTool); err != nil {
-				return fmt.Errorf("failed to register search engine tool: %w", err)
-			}
-		} else {
-			log.Printf("Knowledge base path %s does not exist, skipping knowledge base tools", config.KnowledgeBase.Path)
+	for _, tool := range builtins {
+		if err := registry.RegisterTool(tool); err != nil {
+			return fmt.Errorf("failed to register %s tool: %w", tool.GetName(), err)
 		}
 	}
-
 	return nil
 }
 
 // buildToolsForLLM builds the list of available tools for LLM function calling
 func (a *V3Agent) buildToolsForLLM() []llm.FunctionTool {
-	availableTools := a.toolRegistry.ListAvailableTools(a.ctx)
+	availableTools := a.enabledTools()
 	tools := make([]llm.FunctionTool, 0, len(availableTools))
 
 	for _, toolInfo := range availableTools {
@@ -748,115 +1043,16 @@ func (a *V3Agent) buildToolsForLLM() []llm.FunctionTool {
 	return tools
 }
 
-// handleToolCalls executes tools requested by the LLM and gets a final response
-func (a *V3Agent) handleToolCalls(initialResp *llm.CompletionResponse, messages []llm.Message, opts ConversationOptions) (*llm.CompletionResponse, error) {
-	// Add the assistant message with tool calls (ensure content is never null)
-	content := initialResp.Content
-	if content == "" {
-		content = "I'll use some tools to help answer your question."
-	}
-	messages = append(messages, llm.Message{
-		Role:      "assistant",
-		Content:   content,
-		ToolCalls: initialResp.ToolCalls,
-	})
-
-	// Execute each tool call
-	for _, toolCall := range initialResp.ToolCalls {
-		result, err := a.executeToolCall(toolCall)
-
-		var toolContent string
-		if err != nil {
-			toolContent = fmt.Sprintf("Error executing %s: %v", toolCall.Function.Name, err)
-		} else {
-			toolContent = result
-			if toolContent == "" {
-				toolContent = "Tool executed successfully with no output."
-			}
-		}
-
-		// Add tool result with proper tool_call_id
-		messages = append(messages, llm.Message{
-			Role:       "tool",
-			Content:    toolContent,
-			ToolCallID: toolCall.ID,
-		})
-	}
-
-	// Get final response from LLM with tool results - Allow tools but limit depth
-	finalReq := &llm.CompletionRequest{
-		Messages:    messages,
-		MaxTokens:   opts.MaxTokens, // Use full configured token limit for detailed responses
-		Temperature: opts.Temperature,
-		Tools:       a.buildToolsForLLM(), // Allow tools for complete responses
-		ToolChoice:  "auto",
-	}
-
-	// Hard timeout - if this doesn't work, we return tool results directly
-	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
-	defer cancel()
-
-	finalResp, err := a.llmProvider.Complete(ctx, finalReq)
-	if err != nil {
-		// Extract tool results and return them directly
-		var toolResults []string
-		for i := len(messages) - 1; i >= 0; i-- {
-			if messages[i].Role == "tool" && messages[i].Content != "" {
-				toolResults = append(toolResults, messages[i].Content)
-			}
-		}
-
-		fallbackContent := "I found this information using the available tools:"
-		if len(toolResults) > 0 {
-			fallbackContent += "\n\n" + strings.Join(toolResults, "\n\n")
-		} else {
-			fallbackContent = "I attempted to use tools to help answer your question, but encountered technical difficulties. Please try rephrasing your question or ask for specific parts of the information you need."
-		}
-
-		return &llm.CompletionResponse{
-			Content: fallbackContent,
-			Usage: llm.TokenUsage{
-				PromptTokens:     0,
-				CompletionTokens: 0,
-				TotalTokens:      0,
-			},
-		}, nil
-	}
-
-	// Handle nested tool calls if the response includes them, but with strict depth limit
-	if len(finalResp.ToolCalls) > 0 {
-		// Recursive tool calls with max depth 1 (only one more level)
-		nestedResp, nestedErr := a.handleToolCallsWithDepthLimit(finalResp, messages, opts, 1)
-		if nestedErr != nil {
-			// If nested tools fail, return the current response with tool results
-			return finalResp, nil
-		}
-		return nestedResp, nil
-	}
-
-	return finalResp, nil
-}
-
-// handleToolCallsWithDepthLimit handles tool calls with depth limiting to prevent infinite loops
-func (a *V3Agent) handleToolCallsWithDepthLimit(initialResp *llm.CompletionResponse, messages []llm.Message, opts ConversationOptions, depth int) (*llm.CompletionResponse, error) {
-	return a.handleToolCallsWithDepthLimitStreaming(initialResp, messages, opts, depth, false)
-}
-
 // handleToolCallsWithDepthLimitStreaming handles tool calls with optional progress streaming
 func (a *V3Agent) handleToolCallsWithDepthLimitStreaming(initialResp *llm.CompletionResponse, messages []llm.Message, opts ConversationOptions, depth int, enableStreaming bool) (*llm.CompletionResponse, error) {
-	maxDepth := 20   // Allow up to 20 tool calls to find information thoroughly
-	minSearches := 8 // Minimum searches required - especially for synonym searches like bonos→vouchers
+	maxDepth := a.maxToolIterations(opts)
+	minSearches := a.minSearches(opts)
 
 	// Count search attempts from messages
 	searchCount := a.countSearchAttempts(messages)
 
 	if depth >= maxDepth {
-		// Force a complete response based on gathered information
-		trimmedContent := strings.TrimSpace(initialResp.Content)
-		if initialResp.Content == "" || strings.HasSuffix(trimmedContent, ":") || len(trimmedContent) < 100 {
-			initialResp.Content = fmt.Sprintf("After exhaustive search (%d attempts), I could not find the specific information you requested in the available documentation. This may indicate:\n\n1. The information might be in a different location or format\n2. The documentation might be incomplete for this specific query\n3. The feature might not be documented yet\n\nPlease:\n- Try rephrasing your question with different keywords\n- Specify the exact API operation you need\n- Check if there are additional documentation sources\n\nSearch attempts made: %d", searchCount, searchCount)
-		}
-		return initialResp, nil
+		return loopExhausted(initialResp, messages, searchCount)
 	}
 
 	// Note: The forcing of additional searches is now handled later in the finalReq logic
@@ -866,11 +1062,18 @@ func (a *V3Agent) handleToolCallsWithDepthLimitStreaming(initialResp *llm.Comple
 	if content == "" {
 		content = "I'll use some tools to help answer your question."
 	}
-	messages = append(messages, llm.Message{
+	toolCallMessage := llm.Message{
 		Role:      "assistant",
 		Content:   content,
 		ToolCalls: initialResp.ToolCalls,
-	})
+	}
+	messages = append(messages, toolCallMessage)
+	a.turnTrace = append(a.turnTrace, toolCallMessage)
+
+	// Stop before running more tools if a hard budget is spent
+	if err := a.checkBudget(); err != nil {
+		return nil, err
+	}
 
 	// Execute each tool call
 	for i, toolCall := range initialResp.ToolCalls {
@@ -882,10 +1085,13 @@ func (a *V3Agent) handleToolCallsWithDepthLimitStreaming(initialResp *llm.Comple
 				fmt.Printf("%s\n", message)
 			}
 		}
-		result, err := a.executeToolCall(toolCall)
+		result, _, err := a.executeToolCall(toolCall, opts)
 
+		a.chargeToolCall()
 		var toolContent string
 		if err != nil {
+			a.turnToolErrors++
+			a.turnToolErr = fmt.Errorf("%s: %w", toolCall.Function.Name, err)
 			toolContent = fmt.Sprintf("Error executing %s: %v", toolCall.Function.Name, err)
 		} else {
 			toolContent = result
@@ -895,11 +1101,13 @@ func (a *V3Agent) handleToolCallsWithDepthLimitStreaming(initialResp *llm.Comple
 		}
 
 		// Add tool result
-		messages = append(messages, llm.Message{
+		toolMessage := llm.Message{
 			Role:       "tool",
 			Content:    toolContent,
 			ToolCallID: toolCall.ID,
-		})
+		}
+		messages = append(messages, toolMessage)
+		a.turnTrace = append(a.turnTrace, toolMessage)
 	}
 
 	// Get final response from LLM with tool results
@@ -919,8 +1127,28 @@ func (a *V3Agent) handleToolCallsWithDepthLimitStreaming(initialResp *llm.Comple
 	// Re-check search count for forcing logic
 	searchCount = a.countSearchAttempts(messages)
 
-	// If we're at max depth, disable tools and add instruction to provide final answer
-	if depth >= maxDepth-1 {
+	if err := a.checkBudget(); err != nil {
+		return nil, err
+	}
+
+	if a.turnAnswerNow {
+		// A soft budget is spent: disable tools and answer with what we have
+		finalReq.Tools = nil
+		finalReq.ToolChoice = ""
+		messages = append(messages, llm.Message{
+			Role:    "system",
+			Content: "IMPORTANT: The usage budget for this conversation is nearly spent. Provide a complete final answer now based on the information you've already gathered. Do not promise further searches.",
+		})
+		finalReq.Messages = messages
+		if enableStreaming {
+			if opts.StatusCallback != nil {
+				opts.StatusCallback("Budget limit reached, answering now...")
+			} else {
+				fmt.Printf("Budget limit reached, answering now...\n")
+			}
+		}
+	} else if depth >= maxDepth-1 {
+		// If we're at max depth, disable tools and add instruction to provide final answer
 		finalReq.Tools = nil
 		finalReq.ToolChoice = ""
 		// Add instruction to provide final answer based on information already gathered
@@ -1004,51 +1232,23 @@ func (a *V3Agent) handleToolCallsWithDepthLimitStreaming(initialResp *llm.Comple
 	ctx, cancel := context.WithTimeout(a.ctx, timeout)
 	defer cancel()
 
-	finalResp, err := a.llmProvider.Complete(ctx, finalReq)
+	finalResp, err := a.complete(ctx, finalReq)
 	if err != nil {
-		// If we haven't reached minimum searches, continue trying instead of giving up
-		searchCount = a.countSearchAttempts(messages)
-		if searchCount < minSearches && depth < maxDepth-2 {
-			// Force continuation with a simple response that includes tool calls
-			return &llm.CompletionResponse{
-				Content: fmt.Sprintf("Continuing search... (%d/%d attempts made)", searchCount, minSearches),
-				ToolCalls: []llm.ToolCall{{
-					ID:   fmt.Sprintf("retry_search_%d", depth),
-					Type: "function",
-					Function: llm.FunctionCall{
-						Name:      "kbase",
-						Arguments: `{"query": "alternative search terms"}`,
-					},
-				}},
-				Usage: llm.TokenUsage{},
-			}, nil
-		}
-
-		// Extract tool results and return them directly only if we've done enough searches
-		var toolResults []string
-		for i := len(messages) - 1; i >= 0; i-- {
-			if messages[i].Role == "tool" && messages[i].Content != "" {
-				toolResults = append(toolResults, messages[i].Content)
-			}
-		}
-
-		fallbackContent := fmt.Sprintf("After %d search attempts, I'm experiencing technical difficulties. Please try rephrasing your question.", searchCount)
-		if len(toolResults) > 0 {
-			fallbackContent = fmt.Sprintf("After %d searches, I found some information but am having trouble presenting it properly. Could you please rephrase your question?", searchCount)
+		var turnErr *TurnError
+		if errors.As(err, &turnErr) {
+			turnErr.Searches = a.countSearchAttempts(messages)
+			turnErr.ToolResults = toolResults(messages)
 		}
+		return nil, err
+	}
 
-		return &llm.CompletionResponse{
-			Content: fallbackContent,
-			Usage: llm.TokenUsage{
-				PromptTokens:     0,
-				CompletionTokens: 0,
-				TotalTokens:      0,
-			},
-		}, nil
+	// The model still wants tools after the last allowed round
+	if len(finalResp.ToolCalls) > 0 && (depth >= maxDepth-1 || a.turnAnswerNow) {
+		return loopExhausted(finalResp, messages, a.countSearchAttempts(messages))
 	}
 
 	// Handle nested tool calls recursively with increased depth
-	if len(finalResp.ToolCalls) > 0 && depth < maxDepth-1 {
+	if len(finalResp.ToolCalls) > 0 {
 		if enableStreaming {
 			message := fmt.Sprintf("Continuing search (depth %d)...", depth+1)
 			if opts.StatusCallback != nil {
@@ -1063,43 +1263,125 @@ func (a *V3Agent) handleToolCallsWithDepthLimitStreaming(initialResp *llm.Comple
 	return finalResp, nil
 }
 
-// executeToolCall executes a single tool call
-func (a *V3Agent) executeToolCall(toolCall llm.ToolCall) (string, error) {
+// loopExhausted accepts the last response of a tool loop that ran out of rounds
+// if it still carries a usable answer, and fails with ErrLoopExhausted otherwise
+func loopExhausted(resp *llm.CompletionResponse, messages []llm.Message, searchCount int) (*llm.CompletionResponse, error) {
+	trimmedContent := strings.TrimSpace(resp.Content)
+	if trimmedContent == "" || strings.HasSuffix(trimmedContent, ":") || len(trimmedContent) < 100 {
+		return nil, &TurnError{Kind: ErrLoopExhausted, Searches: searchCount, ToolResults: toolResults(messages)}
+	}
+	return resp, nil
+}
+
+// executeToolCall executes a single tool call. When a hook vetoes the call or
+// the user denies it, it returns the message for the model and true.
+func (a *V3Agent) executeToolCall(toolCall llm.ToolCall, opts ConversationOptions) (string, bool, error) {
 	// Parse function arguments
 	var args map[string]interface{}
 	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-		return "", fmt.Errorf("failed to parse arguments: %w", err)
+		return "", false, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+
+	tool, exists := a.toolRegistry.GetTool(toolCall.Function.Name)
+	if !exists {
+		return "", false, fmt.Errorf("tool '%s' not found", toolCall.Function.Name)
+	}
+	if !a.toolEnabled(toolCall.Function.Name) {
+		return "", false, fmt.Errorf("tool '%s' is not enabled for profile %s", toolCall.Function.Name, a.profileName)
+	}
+
+	ctx, span := a.startSpan(a.ctx, "tool.call", map[string]interface{}{
+		"tool":      toolCall.Function.Name,
+		"args_size": len(toolCall.Function.Arguments),
+	})
+	defer span.End()
+
+	// Let hooks veto the call or rewrite its arguments
+	hookCall := &HookToolCall{ID: toolCall.ID, Name: toolCall.Function.Name, Arguments: args}
+	if veto, err := a.runBeforeToolCall(hookCall); err != nil {
+		span.SetError(err)
+		return "", false, err
+	} else if veto != "" {
+		span.SetAttribute("vetoed", true)
+		return veto, true, nil
+	}
+	args = hookCall.Arguments
+
+	ctx = tools.WithAPIHost(withTurnAgent(ctx, a), a.apiHost())
+	output, denied, err := a.runTool(ctx, tool, toolCall, args, opts)
+	output, err = a.runAfterToolCall(hookCall, output, err)
+	span.SetAttribute("result_size", len(output))
+	span.SetError(err)
+	return output, denied, err
+}
+
+// apiHost returns the API host of the turn context (ConversationOptions.Context),
+// else of the conversation context, or ""
+func (a *V3Agent) apiHost() string {
+	for _, ctx := range []*ConversationContext{a.turnUser, a.contextInfo} {
+		if ctx == nil || ctx.Metadata == nil {
+			continue
+		}
+		if host, ok := ctx.Metadata["api_host"]; ok {
+			return fmt.Sprintf("%v", host)
+		}
+	}
+	return ""
+}
+
+// runTool confirms (when required) and executes a tool call, returning the
+// size-limited output, or the denial message and true when the user denies it
+func (a *V3Agent) runTool(ctx context.Context, tool tools.Tool, toolCall llm.ToolCall, args map[string]interface{}, opts ConversationOptions) (string, bool, error) {
+	// Ask the user before running tools that require confirmation
+	if a.requiresConfirmation(tool, args) {
+		confirmedArgs, denial, err := a.confirmToolCall(tool, toolCall.ID, args, opts)
+		if err != nil {
+			return "", false, fmt.Errorf("confirmation failed: %w", err)
+		}
+		if denial != "" {
+			return denial, true, nil
+		}
+		args = confirmedArgs
 	}
 
 	// Execute the tool
 	execution := tools.ToolExecution{
 		ToolName:   toolCall.Function.Name,
 		Parameters: args,
-		Confirmed:  true, // Auto-confirm for LLM-requested tools
+		Confirmed:  true, // Either confirmed above or confirmation is not required
 		Timestamp:  time.Now(),
 	}
+	if a.currentSession != nil {
+		execution.SessionID = a.currentSession.SessionID
+	}
 
-	result, err := a.toolRegistry.ExecuteTool(a.ctx, execution)
+	result, err := a.toolRegistry.ExecuteTool(ctx, execution)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	if !result.Success {
-		return "", fmt.Errorf("tool execution failed: %s", result.Error)
+		return "", false, fmt.Errorf("tool execution failed: %s", result.Error)
 	}
+	a.addSources(result.Sources)
 
 	// For file_read tool, return the actual content instead of just the success message
+	output := result.Message
 	if toolCall.Function.Name == "file_read" && result.Data != nil {
 		if dataMap, ok := result.Data.(map[string]interface{}); ok {
 			if content, exists := dataMap["content"]; exists {
 				if contentStr, ok := content.(string); ok {
-					return contentStr, nil
+					output = contentStr
 				}
 			}
 		}
 	}
 
-	return result.Message, nil
+	// Catch instructions smuggled into documents or API responses
+	output = a.applyGuardrails(guardrails.StageToolResult, output).Content
+
+	// Keep oversize results from blowing up the context of later iterations
+	return a.limitToolResult(toolCall.Function.Name, output, result.ExecutionID), false, nil
 }
 
 // buildSystemPromptCached creates a dynamic system prompt with caching
@@ -1107,7 +1389,7 @@ func (a *V3Agent) buildSystemPromptCached(hasTools bool) string {
 	// Generate cache key based on prompt configuration AND context
 	toolCount := 0
 	if hasTools {
-		toolCount = len(a.toolRegistry.ListAvailableTools(a.ctx))
+		toolCount = len(a.enabledTools())
 	}
 
 	// Include context in cache key for proper API host handling
@@ -1124,7 +1406,7 @@ func (a *V3Agent) buildSystemPromptCached(hasTools bool) string {
 		contextKey = a.promptCache.GenerateContextKey(userName, organization, apiHost)
 	}
 
-	cacheKey := a.promptCache.GeneratePromptKey(hasTools, a.toolsOnlyMode, toolCount) + "_" + contextKey
+	cacheKey := a.promptCache.GeneratePromptKey(hasTools, a.toolsOnlyMode, toolCount) + "_" + contextKey + "_" + a.profileName
 
 	// Try to get from cache first
 	if cached, found := a.promptCache.Get(cacheKey); found {
@@ -1152,8 +1434,15 @@ func (a *V3Agent) buildSystemPromptCached(hasTools bool) string {
 func (a *V3Agent) buildSystemPrompt(hasTools bool) string {
 	var prompt string
 
-	if hasTools {
-		toolCount := len(a.toolRegistry.ListAvailableTools(a.ctx))
+	if len(a.profilePrompts) > 0 {
+		// The session profile brings its own template chain
+		toolCount := 0
+		if hasTools {
+			toolCount = len(a.enabledTools())
+		}
+		prompt = a.buildProfilePrompt(toolCount)
+	} else if hasTools {
+		toolCount := len(a.enabledTools())
 
 		// Build prompt from templates
 		prompt = prompts.RenderSystemBasePrompt(prompts.PromptData{
@@ -1178,6 +1467,10 @@ func (a *V3Agent) buildSystemPrompt(hasTools bool) string {
 		prompt += "\n\n" + prompts.GetToolsOnlyModePrompt()
 	}
 
+	if a.profile != nil && a.profile.Instructions != "" {
+		prompt += "\n\n" + a.profile.Instructions
+	}
+
 	return prompt
 }
 
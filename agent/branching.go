@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/memory"
+)
+
+// RegenerateLastResponse discards the last answer from the active branch and asks
+// the LLM again for the same user message. The previous answer stays available as
+// an alternative branch.
+func (a *V3Agent) RegenerateLastResponse(options ...ConversationOptions) (*llm.CompletionResponse, error) {
+	if a.currentSession == nil {
+		return nil, fmt.Errorf("no active conversation session")
+	}
+
+	lastUser, ok := lastUserMessage(a.currentSession.Messages)
+	if !ok {
+		return nil, fmt.Errorf("no user message to regenerate a response for")
+	}
+
+	return a.rewindAndSend(lastUser.ID, lastUser.Content, false, options...)
+}
+
+// EditMessage replaces a user message with new content and re-runs the
+// conversation from there on a new branch
+func (a *V3Agent) EditMessage(messageID, content string, options ...ConversationOptions) (*llm.CompletionResponse, error) {
+	if a.currentSession == nil {
+		return nil, fmt.Errorf("no active conversation session")
+	}
+
+	parentID, err := a.userMessageParent(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.rewindAndSend(parentID, content, true, options...)
+}
+
+// rewindAndSend rewinds the active branch to messageID and runs a turn from
+// there. When the turn saves nothing (it failed, or a hook or guardrail stopped
+// it) the branch that was active before is restored.
+func (a *V3Agent) rewindAndSend(messageID, message string, addUserMessage bool, options ...ConversationOptions) (*llm.CompletionResponse, error) {
+	session := a.currentSession
+	checkpoint := session.Checkpoint()
+
+	if err := session.RewindTo(messageID); err != nil {
+		return nil, err
+	}
+
+	resp, err := a.sendMessageInternal(message, true, addUserMessage, options...)
+	if err != nil || !session.AddedSince(checkpoint) {
+		session.Rollback(checkpoint)
+	}
+	return resp, err
+}
+
+// ForkConversation starts a new session containing the active branch up to and
+// including messageID, and makes it the current session
+func (a *V3Agent) ForkConversation(messageID string) (*memory.ConversationMemory, error) {
+	fork, err := a.memoryManager.ForkSession(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fork conversation: %w", err)
+	}
+
+	a.currentSession = fork
+	return fork, nil
+}
+
+// SwitchBranch makes the branch containing messageID the active one
+func (a *V3Agent) SwitchBranch(messageID string) error {
+	if a.currentSession == nil {
+		return fmt.Errorf("no active conversation session")
+	}
+	return a.currentSession.SwitchBranch(messageID)
+}
+
+// GetBranches returns the alternatives available for a message
+func (a *V3Agent) GetBranches(messageID string) (memory.BranchInfo, error) {
+	if a.currentSession == nil {
+		return memory.BranchInfo{}, fmt.Errorf("no active conversation session")
+	}
+	return a.currentSession.GetBranches(messageID)
+}
+
+// userMessageParent validates that messageID is a user message and returns its parent
+func (a *V3Agent) userMessageParent(messageID string) (string, error) {
+	message, ok := a.currentSession.GetMessage(messageID)
+	if !ok {
+		return "", fmt.Errorf("message %s not found", messageID)
+	}
+	if message.Role != "user" || message.Trace {
+		return "", fmt.Errorf("only user messages can be edited")
+	}
+
+	for _, node := range a.currentSession.Nodes {
+		if node.Message.ID == messageID {
+			return node.ParentID, nil
+		}
+	}
+	return "", fmt.Errorf("message %s not found", messageID)
+}
+
+// lastUserMessage returns the last user message of a branch
+func lastUserMessage(messages []llm.Message) (llm.Message, bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" && !messages[i].Trace {
+			return messages[i], true
+		}
+	}
+	return llm.Message{}, false
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/memory"
+)
+
+// BudgetStatus reports the budget consumption of the current conversation
+type BudgetStatus struct {
+	Usage       memory.SessionUsage `json:"usage"`
+	Soft        config.BudgetLimits `json:"soft"`
+	Hard        config.BudgetLimits `json:"hard"`
+	SoftReached bool                `json:"soft_reached"`
+	HardReached bool                `json:"hard_reached"`
+}
+
+// GetBudgetStatus returns the budget consumption of the current conversation
+// against the limits of the last turn (the configured limits before any turn)
+func (a *V3Agent) GetBudgetStatus() BudgetStatus {
+	budget := a.turnBudget
+	status := BudgetStatus{Soft: budget.Soft, Hard: budget.Hard}
+	if a.currentSession == nil {
+		return status
+	}
+
+	status.Usage = a.sessionUsage()
+	status.SoftReached = overBudget(status.Usage, budget.Soft) != ""
+	status.HardReached = overBudget(status.Usage, budget.Hard) != ""
+	return status
+}
+
+// turnBudgetFor returns the budget of a turn: the per-call limits, then the
+// session profile's, then the configured ones. Pricing defaults to the
+// configured table.
+func (a *V3Agent) turnBudgetFor(opts ConversationOptions) config.BudgetConfig {
+	var budget config.BudgetConfig
+	switch {
+	case opts.Budget != nil:
+		budget = *opts.Budget
+	case a.profile != nil && a.profile.Budget != nil:
+		budget = *a.profile.Budget
+	default:
+		return a.config.Budget
+	}
+	if budget.Pricing == nil {
+		budget.Pricing = a.config.Budget.Pricing
+	}
+	return budget
+}
+
+// startTurnBudget starts timing a turn for the processing time budget
+func (a *V3Agent) startTurnBudget(opts ConversationOptions) {
+	a.turnBudget = a.turnBudgetFor(opts)
+	a.turnStart = time.Now()
+	a.turnAnswerNow = false
+}
+
+// endTurnBudget adds the turn processing time to the conversation usage and
+// reports the conversation consumption
+func (a *V3Agent) endTurnBudget() {
+	if a.currentSession == nil || a.turnStart.IsZero() {
+		return
+	}
+	a.currentSession.Usage.ProcessingTime += time.Since(a.turnStart)
+	a.turnStart = time.Time{}
+
+	usage := a.currentSession.Usage
+	a.emit(EventBudget, map[string]interface{}{
+		"level":           "usage",
+		"total_tokens":    usage.TotalTokens,
+		"cost":            usage.Cost,
+		"processing_time": usage.ProcessingTime.Seconds(),
+		"tool_calls":      usage.ToolCalls,
+	})
+}
+
+// sessionUsage returns the conversation usage including the turn in progress
+func (a *V3Agent) sessionUsage() memory.SessionUsage {
+	usage := a.currentSession.Usage
+	if !a.turnStart.IsZero() {
+		usage.ProcessingTime += time.Since(a.turnStart)
+	}
+	return usage
+}
+
+// checkBudget fails the turn when a hard limit is reached, and switches the turn
+// to answer-now mode (no more tools) when a soft limit is reached
+func (a *V3Agent) checkBudget() error {
+	if a.currentSession == nil || a.turnStart.IsZero() {
+		return nil
+	}
+	usage := a.sessionUsage()
+
+	if reason := overBudget(usage, a.turnBudget.Hard); reason != "" {
+		a.emit(EventBudget, map[string]interface{}{"level": "hard", "reason": reason})
+		return &TurnError{Kind: ErrBudgetExceeded, Err: fmt.Errorf("hard limit reached: %s", reason)}
+	}
+
+	if !a.turnAnswerNow {
+		if reason := overBudget(usage, a.turnBudget.Soft); reason != "" {
+			a.turnAnswerNow = true
+			a.emit(EventBudget, map[string]interface{}{"level": "soft", "reason": reason})
+		}
+	}
+	return nil
+}
+
+// overBudget describes the first limit the usage has reached, or returns ""
+func overBudget(usage memory.SessionUsage, limits config.BudgetLimits) string {
+	switch {
+	case limits.Tokens > 0 && usage.TotalTokens >= limits.Tokens:
+		return fmt.Sprintf("%d of %d tokens", usage.TotalTokens, limits.Tokens)
+	case limits.Cost > 0 && usage.Cost >= limits.Cost:
+		return fmt.Sprintf("$%.4f of $%.4f estimated cost", usage.Cost, limits.Cost)
+	case limits.Seconds > 0 && usage.ProcessingTime >= time.Duration(limits.Seconds)*time.Second:
+		return fmt.Sprintf("%.0fs of %ds processing time", usage.ProcessingTime.Seconds(), limits.Seconds)
+	case limits.ToolCalls > 0 && usage.ToolCalls >= limits.ToolCalls:
+		return fmt.Sprintf("%d of %d tool calls", usage.ToolCalls, limits.ToolCalls)
+	default:
+		return ""
+	}
+}
+
+// chargeLLM adds the tokens and estimated cost of an LLM response to the agent
+// and conversation usage
+func (a *V3Agent) chargeLLM(resp *llm.CompletionResponse) {
+	a.addUsage(resp.Usage)
+	if a.currentSession == nil {
+		return
+	}
+
+	a.currentSession.Usage.Add(memory.SessionUsage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+		Cost:             a.llmCost(resp),
+	})
+}
+
+// llmCost estimates the cost of an LLM response with the pricing of the turn
+func (a *V3Agent) llmCost(resp *llm.CompletionResponse) float64 {
+	pricing := a.config.Budget
+	if a.turnBudget.Pricing != nil {
+		pricing = a.turnBudget
+	}
+	price := pricing.PriceFor(resp.Model)
+	return float64(resp.Usage.PromptTokens)/1000*price.PromptPer1K +
+		float64(resp.Usage.CompletionTokens)/1000*price.CompletionPer1K
+}
+
+// chargeToolCall counts a tool call against the conversation budget
+func (a *V3Agent) chargeToolCall() {
+	a.turnToolCalls++
+	if a.currentSession != nil {
+		a.currentSession.Usage.ToolCalls++
+	}
+}
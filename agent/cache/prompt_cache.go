@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/santiagocorredoira/agent/agent/tools"
@@ -21,6 +22,8 @@ type PromptCache struct {
 	cache  map[string]*PromptCacheEntry
 	mutex  sync.RWMutex
 	maxAge time.Duration
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
 // NewPromptCache creates a new prompt cache
@@ -54,15 +57,18 @@ func (pc *PromptCache) Get(key string) (string, bool) {
 	
 	entry, exists := pc.cache[key]
 	if !exists {
+		pc.misses.Add(1)
 		return "", false
 	}
 	
 	// Check if cache entry is still valid
 	if time.Since(entry.Timestamp) > pc.maxAge {
 		// Cache expired, will be cleaned up later
+		pc.misses.Add(1)
 		return "", false
 	}
 	
+	pc.hits.Add(1)
 	return entry.Prompt, true
 }
 
@@ -125,9 +131,18 @@ func (pc *PromptCache) GetStats() map[string]interface{} {
 	pc.mutex.RLock()
 	defer pc.mutex.RUnlock()
 	
+	hits, misses := pc.hits.Load(), pc.misses.Load()
+	hitRatio := 0.0
+	if hits+misses > 0 {
+		hitRatio = float64(hits) / float64(hits+misses)
+	}
+
 	return map[string]interface{}{
 		"total_entries": len(pc.cache),
 		"max_age_minutes": int(pc.maxAge.Minutes()),
+		"hits":          hits,
+		"misses":        misses,
+		"hit_ratio":     hitRatio,
 	}
 }
 
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// chargedProvider is the LLM provider handed to tools and guardrails. Their
+// calls go through complete of the agent running the turn, so they count
+// against its usage and budget like the calls of the tool loop.
+type chargedProvider struct {
+	agent *V3Agent // Set once the agent is created; runs calls made outside a turn
+}
+
+type turnAgentKey struct{}
+
+// withTurnAgent records in ctx the agent whose turn a tool or guardrail runs in,
+// which is a sub-agent when the tool registry is shared with one
+func withTurnAgent(ctx context.Context, a *V3Agent) context.Context {
+	return context.WithValue(ctx, turnAgentKey{}, a)
+}
+
+// agentFor returns the agent of the turn in ctx, or the agent that created p
+func (p *chargedProvider) agentFor(ctx context.Context) *V3Agent {
+	if a, ok := ctx.Value(turnAgentKey{}).(*V3Agent); ok {
+		return a
+	}
+	return p.agent
+}
+
+func (p *chargedProvider) GetName() string {
+	return p.agent.provider().GetName()
+}
+
+func (p *chargedProvider) IsAvailable(ctx context.Context) bool {
+	return p.agentFor(ctx).provider().IsAvailable(ctx)
+}
+
+func (p *chargedProvider) Complete(ctx context.Context, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	return p.agentFor(ctx).complete(ctx, req)
+}
+
+func (p *chargedProvider) Stream(ctx context.Context, req *llm.CompletionRequest) (<-chan llm.StreamChunk, error) {
+	return p.agentFor(ctx).provider().Stream(ctx, req)
+}
+
+func (p *chargedProvider) GetModels() []string {
+	return p.agent.provider().GetModels()
+}
+
+func (p *chargedProvider) GetDefaultModel() string {
+	return p.agent.provider().GetDefaultModel()
+}
+
+func (p *chargedProvider) ValidateConfig() error {
+	return p.agent.provider().ValidateConfig()
+}
+
+func (p *chargedProvider) SupportsFunctionCalling() bool {
+	return p.agent.provider().SupportsFunctionCalling()
+}
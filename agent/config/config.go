@@ -19,6 +19,11 @@ type Config struct {
 	Search        SearchConfig        `json:"search"`
 	Security      SecurityConfig      `json:"security"`
 	KnowledgeBase KnowledgeBaseConfig `json:"kbase"`
+	Guardrails    GuardrailsConfig    `json:"guardrails"`
+	Budget        BudgetConfig        `json:"budget"`
+	Profiles      map[string]Profile  `json:"profiles,omitempty"`
+	Tracing       TracingConfig       `json:"tracing"`
+	MCP           MCPConfig           `json:"mcp"`
 }
 
 // LLMConfig configuración de proveedores LLM
@@ -47,6 +52,23 @@ type AgentConfig struct {
 	AutoMode    bool   `json:"auto_mode"`
 	Interactive bool   `json:"interactive"`
 	LogLevel    string `json:"log_level"`
+
+	// TraceContext controla si la traza de herramientas guardada se usa como
+	// contexto: "exclude" (por defecto) o "compact"
+	TraceContext string `json:"trace_context,omitempty"`
+
+	// ErrorPolicy controla cómo se comunican los turnos fallidos: "friendly"
+	// (por defecto, se devuelve un mensaje explicativo) o "strict" (se devuelve
+	// un error tipado al llamador)
+	ErrorPolicy string `json:"error_policy,omitempty"`
+
+	// Mode controla cómo se resuelve cada turno: "loop" (por defecto, el modelo
+	// llama a herramientas hasta responder) o "plan" (el modelo escribe un plan
+	// de pasos, el agente lo ejecuta y el modelo responde con los resultados)
+	Mode string `json:"mode,omitempty"`
+
+	// Profile es el perfil usado por las sesiones que no indican ninguno
+	Profile string `json:"profile,omitempty"`
 }
 
 // ChatConfig configuración del chat web
@@ -65,9 +87,109 @@ type CLIConfig struct {
 
 // ToolsConfig configuración de herramientas
 type ToolsConfig struct {
-	EnabledTools []string          `json:"enabled_tools"`
-	APIEndpoints map[string]string `json:"api_endpoints"`
-	MaxRetries   int               `json:"max_retries"`
+	EnabledTools []string                 `json:"enabled_tools"`        // Herramientas integradas a registrar (sin definir = kbase y, con acceso a APIs, http_request)
+	FileRoots    []string                 `json:"file_roots,omitempty"` // Directorios a los que acceden file_read y file_write (por defecto kbase.path)
+	APIEndpoints map[string]string        `json:"api_endpoints"`
+	MaxRetries   int                      `json:"max_retries"`
+	ResultLimits ResultLimitsConfig       `json:"result_limits"`
+	Delegate     DelegateConfig           `json:"delegate"`
+	HTTP         HTTPConfig               `json:"http"`
+	OpenAPI      map[string]OpenAPIConfig `json:"openapi,omitempty"`
+	Shell        ShellConfig              `json:"shell"`
+}
+
+// ShellConfig herramienta shell_exec: comandos permitidos, directorio de
+// trabajo, entorno y límites. Los comandos se ejecutan sin shell
+type ShellConfig struct {
+	Commands       map[string]ShellCommandConfig `json:"commands,omitempty"`         // Comandos permitidos por nombre
+	WorkDir        string                        `json:"work_dir,omitempty"`         // Directorio del que no pueden salir ni el cwd ni los argumentos de ruta (por defecto ".")
+	PassEnv        []string                      `json:"pass_env,omitempty"`         // Variables heredadas del agente (por defecto PATH, HOME, LANG y TZ)
+	Env            map[string]string             `json:"env,omitempty"`              // Variables añadidas (p. ej. KUBECONFIG)
+	TimeoutSeconds int                           `json:"timeout_seconds,omitempty"`  // Tiempo máximo por comando
+	MaxOutputBytes int                           `json:"max_output_bytes,omitempty"` // Bytes máximos guardados de stdout y de stderr
+	MaxMemoryMB    int                           `json:"max_memory_mb,omitempty"`    // Memoria virtual máxima del proceso (Linux)
+	MaxCPUSeconds  int                           `json:"max_cpu_seconds,omitempty"`  // Tiempo de CPU máximo (Linux, por defecto timeout_seconds)
+	MaxFileSizeMB  int                           `json:"max_file_size_mb,omitempty"` // Tamaño máximo de los ficheros que escribe (Linux, 0 = sin límite)
+}
+
+// ShellCommandConfig reglas de un comando de shell_exec. Los patrones admiten
+// * y ? como comodines
+type ShellCommandConfig struct {
+	Path        string   `json:"path,omitempty"`        // Ejecutable (por defecto el nombre del comando buscado en PATH)
+	Subcommands []string `json:"subcommands,omitempty"` // Primer argumento que no es una opción (p. ej. "log", "get"); vacío = cualquiera
+	Args        []string `json:"args,omitempty"`        // Patrones que debe cumplir cada argumento salvo el subcomando; vacío = cualquiera
+	DenyArgs    []string `json:"deny_args,omitempty"`   // Patrones de argumentos prohibidos
+}
+
+// HTTPConfig herramienta http_request: hosts permitidos, credenciales y límites
+type HTTPConfig struct {
+	AllowedHosts     []string                    `json:"allowed_hosts,omitempty"`      // Hosts permitidos además de los de api_endpoints y el api_host de la conversación ("*.example.com" admite subdominios)
+	Credentials      map[string]CredentialConfig `json:"credentials,omitempty"`        // Perfiles de credenciales por nombre; el modelo solo ve los nombres
+	MaxResponseBytes int                         `json:"max_response_bytes,omitempty"` // Bytes máximos leídos de cada respuesta
+	TimeoutSeconds   int                         `json:"timeout_seconds,omitempty"`    // Tiempo máximo por petición
+	ConfirmMethods   []string                    `json:"confirm_methods,omitempty"`    // Métodos que piden confirmación antes de enviarse
+}
+
+// CredentialConfig perfil de credenciales de http_request. Los valores admiten
+// ${VAR} para leerlos de variables de entorno
+type CredentialConfig struct {
+	Type     string   `json:"type"`               // "bearer", "basic", "header" o "query"
+	Token    string   `json:"token,omitempty"`    // Token de bearer
+	Username string   `json:"username,omitempty"` // Usuario de basic
+	Password string   `json:"password,omitempty"` // Contraseña de basic
+	Name     string   `json:"name,omitempty"`     // Cabecera (header) o parámetro (query)
+	Value    string   `json:"value,omitempty"`    // Valor de header y query
+	Hosts    []string `json:"hosts,omitempty"`    // Hosts a los que se puede enviar (vacío = cualquier host permitido)
+}
+
+// OpenAPIConfig especificación OpenAPI 3 cuyas operaciones se registran como
+// herramientas. Las peticiones usan el cliente de http_request (hosts
+// permitidos, credenciales y límites de tools.http)
+type OpenAPIConfig struct {
+	Enabled    bool              `json:"enabled"`
+	Spec       string            `json:"spec"`                  // Fichero de la especificación (JSON o YAML)
+	BaseURL    string            `json:"base_url,omitempty"`    // URL base de la API (por defecto el primer servidor de la especificación)
+	ToolPrefix string            `json:"tool_prefix,omitempty"` // Prefijo de los nombres de herramienta (por defecto "<nombre>_")
+	Tags       []string          `json:"tags,omitempty"`        // Registrar solo las operaciones con alguna de estas etiquetas
+	Methods    []string          `json:"methods,omitempty"`     // Registrar solo estos métodos (p. ej. ["GET"])
+	Operations []string          `json:"operations,omitempty"`  // Registrar solo estos operationId
+	Security   map[string]string `json:"security,omitempty"`    // Esquema de seguridad de la especificación -> perfil de tools.http.credentials
+	Credential string            `json:"credential,omitempty"`  // Perfil usado por las operaciones sin esquema asignado
+}
+
+// DelegateConfig límites de los sub-agentes lanzados con la herramienta delegate
+type DelegateConfig struct {
+	MaxIterations int      `json:"max_iterations"` // Rondas de herramientas por defecto del sub-agente
+	MinSearches   int      `json:"min_searches"`   // Búsquedas mínimas del sub-agente
+	MaxTokens     int      `json:"max_tokens"`     // Tokens máximos del informe final
+	Tools         []string `json:"tools"`          // Herramientas permitidas por defecto (vacío = todas)
+}
+
+// ResultLimitsConfig límites de tamaño para los resultados de herramientas
+// antes de devolverlos al LLM
+type ResultLimitsConfig struct {
+	MaxChars   int            `json:"max_chars"`   // Límite por resultado (por defecto 8000, 0 = sin límite)
+	PerTool    map[string]int `json:"per_tool"`    // Límite específico por herramienta
+	TotalChars int            `json:"total_chars"` // Presupuesto total de resultados por turno (por defecto 40000, 0 = sin límite)
+	Strategy   string         `json:"strategy"`    // "head_tail" o "relevant"
+	Summarize  bool           `json:"summarize"`   // Resumir con el LLM los resultados que exceden el límite
+}
+
+// defaultResultLimits devuelve los límites de resultados por defecto
+func defaultResultLimits() ResultLimitsConfig {
+	return ResultLimitsConfig{
+		MaxChars:   8000,
+		TotalChars: 40000,
+		Strategy:   "relevant",
+	}
+}
+
+// LimitFor devuelve el límite de caracteres aplicable a una herramienta
+func (r ResultLimitsConfig) LimitFor(toolName string) int {
+	if limit, ok := r.PerTool[toolName]; ok {
+		return limit
+	}
+	return r.MaxChars
 }
 
 // SearchConfig configuración del motor de búsqueda
@@ -81,10 +203,110 @@ type SearchConfig struct {
 type SecurityConfig struct {
 	AllowAPIAccess  bool     `json:"allow_api_access"`
 	AllowFileAccess bool     `json:"allow_file_access"`
+	AllowShell      bool     `json:"allow_shell"` // Permite la herramienta shell_exec
 	RestrictedPaths []string `json:"restricted_paths"`
 	RequireConfirm  bool     `json:"require_confirm"`
 }
 
+// GuardrailsConfig reglas que se aplican a la entrada del usuario, a los
+// resultados de herramientas y a la respuesta final
+type GuardrailsConfig struct {
+	Enabled bool            `json:"enabled"`
+	Rules   []GuardrailRule `json:"rules"`
+}
+
+// GuardrailRule una comprobación y la acción a tomar cuando se activa
+type GuardrailRule struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`                  // "regex", "blocklist", "max_length", "prompt_injection" o "llm_judge"
+	Stages      []string `json:"stages"`                // "input", "output" y/o "tool_result"
+	Action      string   `json:"action"`                // "block", "rewrite" o "annotate"
+	Patterns    []string `json:"patterns,omitempty"`    // Expresiones regulares (regex, prompt_injection)
+	Terms       []string `json:"terms,omitempty"`       // Términos prohibidos (blocklist)
+	MaxLength   int      `json:"max_length,omitempty"`  // Longitud máxima en caracteres (max_length)
+	Criteria    string   `json:"criteria,omitempty"`    // Qué debe evaluar el juez (llm_judge)
+	Replacement string   `json:"replacement,omitempty"` // Texto de sustitución al reescribir
+	Message     string   `json:"message,omitempty"`     // Mensaje mostrado al bloquear o anotar
+}
+
+// Profile perfil de agente (persona) seleccionable por sesión. Los campos
+// vacíos mantienen la configuración general.
+type Profile struct {
+	Description       string        `json:"description,omitempty"`
+	SystemPrompts     []string      `json:"system_prompts,omitempty"`      // Plantillas del prompt de sistema en orden: nombres de prompts embebidos ("system_base", "search_strategy"...) o rutas a ficheros
+	Instructions      string        `json:"instructions,omitempty"`        // Instrucciones adicionales al final del prompt de sistema
+	Tools             []string      `json:"tools,omitempty"`               // Herramientas habilitadas (vacío = todas)
+	ToolsOnlyMode     *bool         `json:"tools_only_mode,omitempty"`     // Responder solo preguntas que requieren herramientas
+	ProviderRoute     []string      `json:"provider_route,omitempty"`      // Proveedores LLM en orden de fallback
+	Model             string        `json:"model,omitempty"`               // Modelo del primer proveedor de la ruta
+	MaxToolIterations int           `json:"max_tool_iterations,omitempty"` // Rondas de herramientas por turno
+	MinSearches       int           `json:"min_searches,omitempty"`        // Búsquedas mínimas antes de aceptar resultados pobres
+	ContextProviders  []string      `json:"context_providers,omitempty"`   // Proveedores de contexto activos (vacío = todos)
+	Mode              string        `json:"mode,omitempty"`                // Modo de los turnos: "loop" o "plan"
+	Budget            *BudgetConfig `json:"budget,omitempty"`              // Presupuesto de las conversaciones del perfil (sin precios usa los generales)
+}
+
+// BudgetConfig límites de consumo por conversación
+type BudgetConfig struct {
+	Soft    BudgetLimits            `json:"soft"`              // Al alcanzarlos el agente responde con lo que ya tiene
+	Hard    BudgetLimits            `json:"hard"`              // Al alcanzarlos el turno se detiene con un error
+	Pricing map[string]ModelPricing `json:"pricing,omitempty"` // Precio por modelo ("default" para el resto)
+}
+
+// BudgetLimits límites de un presupuesto (0 = sin límite)
+type BudgetLimits struct {
+	Tokens    int     `json:"tokens,omitempty"`     // Tokens totales
+	Cost      float64 `json:"cost,omitempty"`       // Coste estimado en USD
+	Seconds   int     `json:"seconds,omitempty"`    // Tiempo de procesamiento acumulado
+	ToolCalls int     `json:"tool_calls,omitempty"` // Llamadas a herramientas
+}
+
+// ModelPricing precio de un modelo en USD por cada 1000 tokens
+type ModelPricing struct {
+	PromptPer1K     float64 `json:"prompt_per_1k"`
+	CompletionPer1K float64 `json:"completion_per_1k"`
+}
+
+// PriceFor devuelve el precio de un modelo, o el precio "default" si no está configurado
+func (b BudgetConfig) PriceFor(model string) ModelPricing {
+	if price, ok := b.Pricing[model]; ok {
+		return price
+	}
+	return b.Pricing["default"]
+}
+
+// TracingConfig exportación de trazas de los turnos (turno, llamadas LLM,
+// herramientas y evaluaciones de relevancia)
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled"`
+	Exporter    string            `json:"exporter"`               // "jsonl" u "otlp"
+	Path        string            `json:"path,omitempty"`         // Fichero del exportador jsonl
+	Endpoint    string            `json:"endpoint,omitempty"`     // Colector OTLP HTTP, p. ej. http://localhost:4318
+	Headers     map[string]string `json:"headers,omitempty"`      // Cabeceras extra para el colector OTLP
+	ServiceName string            `json:"service_name,omitempty"` // Nombre del servicio en las trazas
+}
+
+// MCPConfig servidores MCP (Model Context Protocol) cuyas herramientas se
+// registran en el agente
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `json:"servers,omitempty"`
+}
+
+// MCPServerConfig un servidor MCP lanzado por stdio (command) o accesible por
+// streamable HTTP (url)
+type MCPServerConfig struct {
+	Enabled        bool              `json:"enabled"`
+	Command        string            `json:"command,omitempty"`         // Ejecutable del servidor stdio
+	Args           []string          `json:"args,omitempty"`            // Argumentos del ejecutable
+	Env            map[string]string `json:"env,omitempty"`             // Variables añadidas al entorno del proceso
+	URL            string            `json:"url,omitempty"`             // Endpoint streamable HTTP
+	Headers        map[string]string `json:"headers,omitempty"`         // Cabeceras HTTP (p. ej. Authorization)
+	ToolPrefix     string            `json:"tool_prefix,omitempty"`     // Prefijo de los nombres de herramienta (por defecto "<servidor>_")
+	Tools          []string          `json:"tools,omitempty"`           // Herramientas del servidor a registrar (vacío = todas)
+	Confirm        bool              `json:"confirm,omitempty"`         // Pedir confirmación antes de cada llamada
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // Tiempo máximo por petición (por defecto 60)
+}
+
 // KnowledgeBaseConfig configuración de la base de conocimiento
 type KnowledgeBaseConfig struct {
 	Path              string `json:"path"`
@@ -103,7 +325,9 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file %s: %w", filename, err)
 	}
 
-	var config Config
+	// Los límites de resultados se rellenan antes de leer el fichero: así un
+	// campo ausente toma el valor por defecto y un 0 explícito quita el límite
+	config := Config{Tools: ToolsConfig{ResultLimits: defaultResultLimits()}}
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file %s: %w", filename, err)
 	}
@@ -181,6 +405,10 @@ func DefaultConfig() *Config {
 			AutoMode:    false,
 			Interactive: true,
 			LogLevel:    "info",
+
+			TraceContext: "exclude",
+			ErrorPolicy:  "friendly",
+			Mode:         "loop",
 		},
 		CLI: CLIConfig{
 			Prompt:       "🧑 You: ",
@@ -190,11 +418,27 @@ func DefaultConfig() *Config {
 			EnableColors: true,
 		},
 		Tools: ToolsConfig{
-			EnabledTools: []string{"api_call", "file_read", "search_docs"},
+			EnabledTools: []string{"kbase", "http_request"},
 			APIEndpoints: map[string]string{
 				"your_api": "https://api.example.com",
 			},
-			MaxRetries: 3,
+			MaxRetries:   3,
+			ResultLimits: defaultResultLimits(),
+			Delegate: DelegateConfig{
+				MaxIterations: 8,
+				MinSearches:   3,
+				MaxTokens:     2000,
+			},
+			HTTP: HTTPConfig{
+				MaxResponseBytes: 64 * 1024,
+				TimeoutSeconds:   30,
+				ConfirmMethods:   []string{"POST", "PUT", "PATCH", "DELETE"},
+			},
+			Shell: ShellConfig{
+				TimeoutSeconds: 30,
+				MaxOutputBytes: 32 * 1024,
+				MaxMemoryMB:    2048,
+			},
 		},
 		Search: SearchConfig{
 			DocumentsPath: "./docs",
@@ -211,6 +455,11 @@ func DefaultConfig() *Config {
 			Path:              "./kbase",
 			MaxSearchAttempts: 20,
 		},
+		Tracing: TracingConfig{
+			Exporter:    "jsonl",
+			Path:        "./logs/traces.jsonl",
+			ServiceName: "v3-agent",
+		},
 	}
 }
 
@@ -250,12 +499,51 @@ func (c *Config) applyDefaults() {
 	if c.LLM.Timeout == 0 {
 		c.LLM.Timeout = 30 * time.Second
 	}
+	if c.Agent.TraceContext == "" {
+		c.Agent.TraceContext = "exclude"
+	}
+	if c.Agent.ErrorPolicy == "" {
+		c.Agent.ErrorPolicy = "friendly"
+	}
+	if c.Agent.Mode == "" {
+		c.Agent.Mode = "loop"
+	}
 	if c.CLI.HistorySize == 0 {
 		c.CLI.HistorySize = 100
 	}
 	if c.Tools.MaxRetries == 0 {
 		c.Tools.MaxRetries = 3
 	}
+	if c.Tools.ResultLimits.Strategy == "" {
+		c.Tools.ResultLimits.Strategy = "relevant"
+	}
+	if c.Tools.Delegate.MaxIterations == 0 {
+		c.Tools.Delegate.MaxIterations = 8
+	}
+	if c.Tools.Delegate.MinSearches == 0 {
+		c.Tools.Delegate.MinSearches = 3
+	}
+	if c.Tools.Delegate.MaxTokens == 0 {
+		c.Tools.Delegate.MaxTokens = 2000
+	}
+	if c.Tools.HTTP.MaxResponseBytes == 0 {
+		c.Tools.HTTP.MaxResponseBytes = 64 * 1024
+	}
+	if c.Tools.HTTP.TimeoutSeconds == 0 {
+		c.Tools.HTTP.TimeoutSeconds = 30
+	}
+	if c.Tools.HTTP.ConfirmMethods == nil {
+		c.Tools.HTTP.ConfirmMethods = []string{"POST", "PUT", "PATCH", "DELETE"}
+	}
+	if c.Tools.Shell.TimeoutSeconds == 0 {
+		c.Tools.Shell.TimeoutSeconds = 30
+	}
+	if c.Tools.Shell.MaxOutputBytes == 0 {
+		c.Tools.Shell.MaxOutputBytes = 32 * 1024
+	}
+	if c.Tools.Shell.MaxMemoryMB == 0 {
+		c.Tools.Shell.MaxMemoryMB = 2048
+	}
 	if c.Search.MaxResults == 0 {
 		c.Search.MaxResults = 10
 	}
@@ -265,6 +553,15 @@ func (c *Config) applyDefaults() {
 	if c.KnowledgeBase.MaxSearchAttempts == 0 {
 		c.KnowledgeBase.MaxSearchAttempts = 20
 	}
+	if c.Tracing.Exporter == "" {
+		c.Tracing.Exporter = "jsonl"
+	}
+	if c.Tracing.Path == "" {
+		c.Tracing.Path = "./logs/traces.jsonl"
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "v3-agent"
+	}
 }
 
 // findConfigFile busca el archivo de configuración en ubicaciones estándar
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+// ConfirmationDecision is the outcome of a human-in-the-loop tool confirmation
+type ConfirmationDecision string
+
+const (
+	ConfirmationApprove ConfirmationDecision = "approve" // Execute the tool with the requested arguments
+	ConfirmationDeny    ConfirmationDecision = "deny"    // Do not execute, report the denial to the model
+	ConfirmationEdit    ConfirmationDecision = "edit"    // Execute the tool with the arguments supplied by the user
+)
+
+// ConfirmationRequest describes a tool call waiting for user approval
+type ConfirmationRequest struct {
+	ToolCallID    string                 `json:"tool_call_id"`
+	ToolName      string                 `json:"tool_name"`
+	Description   string                 `json:"description"`
+	Category      tools.ToolCategory     `json:"category"`
+	Arguments     map[string]interface{} `json:"arguments"`
+	EstimatedCost int                    `json:"estimated_cost"`
+	SessionID     string                 `json:"session_id,omitempty"`
+}
+
+// ConfirmationResponse is the user's answer to a ConfirmationRequest
+type ConfirmationResponse struct {
+	Decision  ConfirmationDecision   `json:"decision"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"` // Replacement arguments when Decision is "edit"
+	Reason    string                 `json:"reason,omitempty"`    // Optional explanation, forwarded to the model on deny
+}
+
+// ConfirmationHandler asks a human to approve, deny or edit a tool call
+type ConfirmationHandler interface {
+	ConfirmToolCall(ctx context.Context, req ConfirmationRequest) (*ConfirmationResponse, error)
+}
+
+// ConfirmationHandlerFunc adapts a function to the ConfirmationHandler interface
+type ConfirmationHandlerFunc func(ctx context.Context, req ConfirmationRequest) (*ConfirmationResponse, error)
+
+// ConfirmToolCall implements ConfirmationHandler
+func (f ConfirmationHandlerFunc) ConfirmToolCall(ctx context.Context, req ConfirmationRequest) (*ConfirmationResponse, error) {
+	return f(ctx, req)
+}
+
+// SetConfirmationHandler sets the default handler used for tools that require confirmation
+func (a *V3Agent) SetConfirmationHandler(handler ConfirmationHandler) {
+	a.confirmationHandler = handler
+}
+
+// GetConfirmationHandler returns the default confirmation handler
+func (a *V3Agent) GetConfirmationHandler() ConfirmationHandler {
+	return a.confirmationHandler
+}
+
+// confirmationHandlerFor returns the handler for a call: the per-call override,
+// or the agent default
+func (a *V3Agent) confirmationHandlerFor(opts ConversationOptions) ConfirmationHandler {
+	if opts.ConfirmationHandler != nil {
+		return opts.ConfirmationHandler
+	}
+	return a.confirmationHandler
+}
+
+// requiresConfirmation reports whether a tool call must be confirmed by the user.
+// Confirmation is only enforced when security.require_confirm is enabled.
+func (a *V3Agent) requiresConfirmation(tool tools.Tool, args map[string]interface{}) bool {
+	return a.config.Security.RequireConfirm && tools.NeedsConfirmation(tool, args)
+}
+
+// confirmToolCall runs the confirmation flow for a tool call. It returns the
+// arguments to execute with, or a non-empty denial message for the model.
+func (a *V3Agent) confirmToolCall(tool tools.Tool, toolCallID string, args map[string]interface{}, opts ConversationOptions) (map[string]interface{}, string, error) {
+	handler := a.confirmationHandlerFor(opts)
+	if handler == nil {
+		return nil, "No confirmation handler is configured, so the call was not executed. Answer without this tool or explain what the user should do manually.", nil
+	}
+
+	req := ConfirmationRequest{
+		ToolCallID:    toolCallID,
+		ToolName:      tool.GetName(),
+		Description:   tool.GetDescription(),
+		Category:      tool.GetCategory(),
+		Arguments:     args,
+		EstimatedCost: tool.GetEstimatedCost(),
+	}
+	if a.currentSession != nil {
+		req.SessionID = a.currentSession.SessionID
+	}
+
+	resp, err := handler.ConfirmToolCall(a.ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp == nil {
+		resp = &ConfirmationResponse{Decision: ConfirmationDeny}
+	}
+
+	switch resp.Decision {
+	case ConfirmationApprove:
+		return args, "", nil
+	case ConfirmationEdit:
+		if resp.Arguments == nil {
+			return args, "", nil
+		}
+		return resp.Arguments, "", nil
+	default:
+		message := "The user denied this tool call."
+		if resp.Reason != "" {
+			message += " Reason: " + resp.Reason
+		}
+		return nil, message + " Do not retry it; continue without this tool.", nil
+	}
+}
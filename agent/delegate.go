@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/memory"
+	"github.com/santiagocorredoira/agent/agent/planner"
+	"github.com/santiagocorredoira/agent/agent/prompts"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+// delegateToolName is the name of the built-in sub-agent tool
+const delegateToolName = "delegate"
+
+// DelegateTool runs a focused investigation in a child agent with its own message
+// history, tool subset and loop limits. Only the child's final report is returned.
+type DelegateTool struct {
+	*tools.BaseTool
+	parent *V3Agent
+}
+
+// NewDelegateTool creates the delegate tool for an agent. Sub-agents never get
+// this tool, so delegation is limited to one level.
+func NewDelegateTool(parent *V3Agent) *DelegateTool {
+	tool := &DelegateTool{
+		BaseTool: tools.NewBaseTool(
+			delegateToolName,
+			"Delegates a focused investigation (for example comparing several endpoints) to a sub-agent that searches on its own and returns only a final report. Use it for multi-step research that would otherwise need many searches in this conversation.",
+			tools.CategoryCustom,
+			false,
+			50,
+		),
+		parent: parent,
+	}
+
+	schema := &tools.ParameterSchema{
+		Type:        "object",
+		Description: "Parameters for delegating a task to a sub-agent",
+		Properties: map[string]tools.PropertySchema{
+			"task": {
+				Type:        "string",
+				Description: "Self-contained description of what the sub-agent must investigate and report",
+			},
+			"tools": {
+				Type:        "array",
+				Description: "Names of the tools the sub-agent may use (default: the configured delegate tools)",
+				Items:       &tools.PropertySchema{Type: "string"},
+			},
+			"max_iterations": {
+				Type:        "number",
+				Description: "Maximum tool-calling rounds for the sub-agent",
+				Minimum:     func() *float64 { v := 1.0; return &v }(),
+				Maximum:     func() *float64 { v := float64(defaultMaxToolIterations); return &v }(),
+			},
+		},
+		Required: []string{"task"},
+	}
+	tool.SetParameterSchema(schema)
+
+	return tool
+}
+
+func (d *DelegateTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return tools.DefaultGetFunctionDefinition(d)
+}
+
+func (d *DelegateTool) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+func (d *DelegateTool) Execute(ctx context.Context, params map[string]interface{}) (*tools.ToolResult, error) {
+	task, ok := params["task"].(string)
+	if !ok || strings.TrimSpace(task) == "" {
+		return d.CreateErrorResult(
+			&tools.ToolError{Type: "parameter_error", Message: "task must be a non-empty string", Code: "INVALID_TASK"},
+			"Invalid task parameter",
+		), nil
+	}
+
+	settings := d.parent.config.Tools.Delegate
+	toolNames := settings.Tools
+	if requested, ok := params["tools"].([]interface{}); ok && len(requested) > 0 {
+		toolNames = make([]string, 0, len(requested))
+		for _, name := range requested {
+			if s, ok := name.(string); ok {
+				toolNames = append(toolNames, s)
+			}
+		}
+	}
+
+	maxIterations := settings.MaxIterations
+	if v, ok := params["max_iterations"].(float64); ok && v >= 1 {
+		maxIterations = int(v)
+	}
+
+	// The sub-agent spends from the parent turn budget, so stop if it is gone
+	if reason := overBudget(d.parent.sessionUsage(), d.parent.turnBudget.Hard); reason != "" {
+		return d.CreateErrorResult(fmt.Errorf("hard limit reached: %s", reason), "Budget exhausted"), nil
+	}
+
+	child, err := d.parent.newSubAgent(ctx, toolNames)
+	if err != nil {
+		return d.CreateErrorResult(err, "Failed to start sub-agent"), nil
+	}
+	defer child.cancel()
+
+	opts := DefaultConversationOptions()
+	opts.SystemPrompt = prompts.RenderDelegateTaskPrompt(prompts.PromptData{Task: task})
+	opts.MaxTokens = settings.MaxTokens
+	opts.Temperature = 0.3
+	opts.MaxToolIterations = maxIterations
+	opts.MinSearches = settings.MinSearches
+	if opts.MinSearches > maxIterations {
+		opts.MinSearches = maxIterations
+	}
+	opts.Budget = d.parent.remainingBudget()
+
+	resp, err := child.SendMessage(task, opts)
+
+	// Roll the child's usage into the parent whatever the outcome. Its processing
+	// time is already part of the parent's turn.
+	d.parent.addUsage(child.usage)
+	d.parent.delegatedTasks++
+	if d.parent.currentSession != nil && child.currentSession != nil {
+		childUsage := child.currentSession.Usage
+		childUsage.ProcessingTime = 0
+		d.parent.currentSession.Usage.Add(childUsage)
+	}
+
+	if err != nil {
+		return d.CreateErrorResult(err, "Sub-agent failed"), nil
+	}
+
+	report := strings.TrimSpace(resp.Content)
+	if report == "" {
+		report = "The sub-agent finished without a report."
+	}
+
+	result := d.CreateSuccessResult(map[string]interface{}{
+		"report":          report,
+		"tool_executions": child.toolRegistry.GetToolStats().TotalExecutions,
+		"usage":           child.usage,
+	}, report)
+	result.Sources = resp.Sources // The parent answer cites what the sub-agent read
+	return result, nil
+}
+
+// newSubAgent creates a child agent that shares the provider, configuration and
+// hooks of a but keeps its own in-memory history and a subset of its tools.
+// An empty toolNames list gives the child every tool of the session profile
+// except delegate.
+func (a *V3Agent) newSubAgent(ctx context.Context, toolNames []string) (*V3Agent, error) {
+	registry := tools.NewToolRegistry()
+	if len(toolNames) == 0 {
+		for _, info := range a.toolRegistry.ListTools(ctx) {
+			if a.toolEnabled(info.Name) {
+				toolNames = append(toolNames, info.Name)
+			}
+		}
+	}
+	for _, name := range toolNames {
+		if name == delegateToolName {
+			continue
+		}
+		tool, ok := a.toolRegistry.GetTool(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		if !a.toolEnabled(name) {
+			return nil, fmt.Errorf("tool %q is not enabled for profile %s", name, a.profileName)
+		}
+		if err := registry.RegisterTool(tool); err != nil {
+			return nil, fmt.Errorf("failed to register tool %s for sub-agent: %w", name, err)
+		}
+	}
+
+	memoryManager := memory.NewEphemeralMemoryManager()
+	memoryManager.SetTraceContextMode(a.config.Agent.TraceContext)
+
+	childCtx, cancel := context.WithCancel(ctx)
+	child := &V3Agent{
+		config:        a.config,
+		llmProvider:   a.llmProvider,
+		memoryManager: memoryManager,
+		toolRegistry:  registry,
+		taskPlanner:   planner.NewTaskPlanner(registry),
+		ctx:           childCtx,
+		cancel:        cancel,
+		toolsOnlyMode: a.toolsOnlyMode,
+		contextInfo:   a.contextInfo,
+		logger:        a.logger,
+		promptCache:   a.promptCache,
+
+		confirmationHandler: a.turnConfirm, // The handler of the delegating turn, such as a websocket client
+		hooks:               a.hooks,
+		guardrails:          a.guardrails,
+		eventHandlers:       a.eventHandlers,
+		tracer:              a.tracer,
+		metrics:             a.metrics,
+		turnBudget:          a.config.Budget,
+		baseToolsOnlyMode:   a.baseToolsOnlyMode,
+		profileProviders:    a.profileProviders,
+		fixedProvider:       a.fixedProvider,
+		parent:              a,
+	}
+
+	if _, err := child.startConversation(a.contextInfo, a.profileName); err != nil {
+		cancel()
+		return nil, err
+	}
+	return child, nil
+}
+
+// remainingBudget returns what is left of the budget of the turn in progress,
+// for a sub-agent to spend. A limit already reached becomes the smallest one,
+// so the sub-agent wraps up after its first LLM call.
+func (a *V3Agent) remainingBudget() *config.BudgetConfig {
+	budget := a.turnBudget
+	if a.currentSession == nil {
+		return &budget
+	}
+	usage := a.sessionUsage()
+	budget.Soft = remainingLimits(budget.Soft, usage)
+	budget.Hard = remainingLimits(budget.Hard, usage)
+	return &budget
+}
+
+// remainingLimits subtracts usage from the limits that are set
+func remainingLimits(limits config.BudgetLimits, usage memory.SessionUsage) config.BudgetLimits {
+	if limits.Tokens > 0 {
+		limits.Tokens = max(limits.Tokens-usage.TotalTokens, 1)
+	}
+	if limits.Cost > 0 {
+		limits.Cost = math.Max(limits.Cost-usage.Cost, math.SmallestNonzeroFloat64)
+	}
+	if limits.Seconds > 0 {
+		limits.Seconds = max(limits.Seconds-int(usage.ProcessingTime/time.Second), 1)
+	}
+	if limits.ToolCalls > 0 {
+		limits.ToolCalls = max(limits.ToolCalls-usage.ToolCalls, 1)
+	}
+	return limits
+}
+
+// addUsage accumulates token usage into the agent stats
+func (a *V3Agent) addUsage(usage llm.TokenUsage) {
+	a.usage.PromptTokens += usage.PromptTokens
+	a.usage.CompletionTokens += usage.CompletionTokens
+	a.usage.TotalTokens += usage.TotalTokens
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// Error kinds of a failed turn. Use errors.Is to tell them apart.
+var (
+	ErrProviderUnavailable = errors.New("LLM provider unavailable")
+	ErrLoopExhausted       = errors.New("tool loop exhausted without an answer")
+	ErrToolFailed          = errors.New("tool execution failed")
+	ErrContextOverflow     = errors.New("conversation exceeds the model context window")
+	ErrBudgetExceeded      = errors.New("conversation budget exceeded")
+)
+
+// Error policies
+const (
+	ErrorPolicyFriendly = "friendly" // Failed turns return an explanatory message as the response
+	ErrorPolicyStrict   = "strict"   // Failed turns return a *TurnError to the caller
+)
+
+// contextOverflowMarkers are fragments of provider errors caused by oversize prompts
+var contextOverflowMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"input is too long",
+	"too many tokens",
+	"exceeds the maximum number of tokens",
+}
+
+// TurnError describes why a turn failed. It matches its kind (ErrProviderUnavailable,
+// ErrLoopExhausted, ErrToolFailed, ErrContextOverflow or ErrBudgetExceeded) and its
+// cause with errors.Is.
+type TurnError struct {
+	Kind        error    // One of the Err* kinds
+	Err         error    // Underlying cause, if any
+	Searches    int      // Knowledge base searches made before failing
+	ToolResults []string // Tool outputs gathered before failing
+}
+
+func (e *TurnError) Error() string {
+	if e.Err != nil {
+		return e.Kind.Error() + ": " + e.Err.Error()
+	}
+	return e.Kind.Error()
+}
+
+func (e *TurnError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// llmError wraps a provider failure with its kind
+func llmError(err error) *TurnError {
+	var turnErr *TurnError
+	if errors.As(err, &turnErr) {
+		return turnErr // Already classified, e.g. a budget stop
+	}
+
+	kind := ErrProviderUnavailable
+	lower := strings.ToLower(err.Error())
+	for _, marker := range contextOverflowMarkers {
+		if strings.Contains(lower, marker) {
+			kind = ErrContextOverflow
+			break
+		}
+	}
+	return &TurnError{Kind: kind, Err: err}
+}
+
+// ErrorCode returns a stable code for the kind of a turn error, or "" for other errors
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrProviderUnavailable):
+		return "provider_unavailable"
+	case errors.Is(err, ErrLoopExhausted):
+		return "loop_exhausted"
+	case errors.Is(err, ErrToolFailed):
+		return "tool_failed"
+	case errors.Is(err, ErrContextOverflow):
+		return "context_overflow"
+	case errors.Is(err, ErrBudgetExceeded):
+		return "budget_exceeded"
+	default:
+		return ""
+	}
+}
+
+// toolResults collects the tool outputs of a message list
+func toolResults(messages []llm.Message) []string {
+	var results []string
+	for _, msg := range messages {
+		if msg.Role == "tool" && msg.Content != "" {
+			results = append(results, msg.Content)
+		}
+	}
+	return results
+}
+
+// errorPolicy returns the error policy for a turn
+func (a *V3Agent) errorPolicy(opts ConversationOptions) string {
+	if opts.ErrorPolicy != "" {
+		return opts.ErrorPolicy
+	}
+	return a.config.Agent.ErrorPolicy
+}
+
+// friendlyErrorMessage turns a failed turn into the message shown under the friendly policy
+func friendlyErrorMessage(err *TurnError) string {
+	switch {
+	case errors.Is(err, ErrLoopExhausted):
+		return fmt.Sprintf("After exhaustive search (%d attempts), I could not find the specific information you requested in the available documentation. This may indicate:\n\n1. The information might be in a different location or format\n2. The documentation might be incomplete for this specific query\n3. The feature might not be documented yet\n\nPlease:\n- Try rephrasing your question with different keywords\n- Specify the exact API operation you need\n- Check if there are additional documentation sources\n\nSearch attempts made: %d", err.Searches, err.Searches)
+	case errors.Is(err, ErrBudgetExceeded):
+		return "I've reached the usage budget for this conversation, so I stopped before answering. Please start a new conversation to continue."
+	case errors.Is(err, ErrContextOverflow):
+		return "This conversation has grown too long for me to process. Please start a new conversation or ask a shorter, more specific question."
+	case len(err.ToolResults) > 0:
+		return fmt.Sprintf("After %d searches, I found some information but am having trouble presenting it properly. Could you please rephrase your question?", err.Searches)
+	case err.Searches > 0:
+		return fmt.Sprintf("After %d search attempts, I'm experiencing technical difficulties. Please try rephrasing your question.", err.Searches)
+	default:
+		return fmt.Sprintf("I'm experiencing technical difficulties. Error: %v\n\nPlease try rephrasing your question or ask something simpler.", err.Err)
+	}
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"time"
+)
+
+// EventType identifies an agent event
+type EventType string
+
+const (
+	EventGuardrail  EventType = "guardrail"   // A guardrail check triggered
+	EventTurnFailed EventType = "turn_failed" // A turn failed and was removed from memory
+	EventBudget     EventType = "budget"      // Budget consumption at the end of a turn, or a soft or hard limit reached
+)
+
+// Event reports something that happened during a turn
+type Event struct {
+	Type      EventType              `json:"type"`
+	SessionID string                 `json:"session_id,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventHandler receives agent events. Handlers run synchronously on the turn goroutine.
+type EventHandler func(Event)
+
+// OnEvent registers an event handler
+func (a *V3Agent) OnEvent(handler EventHandler) {
+	a.eventHandlers = append(a.eventHandlers, handler)
+}
+
+// emit sends an event to every registered handler
+func (a *V3Agent) emit(eventType EventType, data map[string]interface{}) {
+	if len(a.eventHandlers) == 0 {
+		return
+	}
+
+	event := Event{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+	if a.currentSession != nil {
+		event.SessionID = a.currentSession.SessionID
+	}
+
+	for _, handler := range a.eventHandlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"github.com/santiagocorredoira/agent/agent/guardrails"
+)
+
+// AddGuardrail adds a custom check to the agent guardrail pipeline
+func (a *V3Agent) AddGuardrail(name string, check guardrails.Check, action guardrails.Action, message string, stages ...guardrails.Stage) {
+	if a.guardrails == nil {
+		a.guardrails = &guardrails.Pipeline{}
+	}
+	a.guardrails.Add(name, check, action, message, stages...)
+}
+
+// applyGuardrails runs the guardrails of a stage and reports every triggered check as an event
+func (a *V3Agent) applyGuardrails(stage guardrails.Stage, content string) *guardrails.Result {
+	if a.guardrails == nil {
+		return &guardrails.Result{Content: content}
+	}
+
+	result := a.guardrails.Run(withTurnAgent(a.ctx, a), stage, content)
+	for _, verdict := range result.Verdicts {
+		a.emit(EventGuardrail, map[string]interface{}{
+			"rule":   verdict.Rule,
+			"check":  verdict.Check,
+			"stage":  string(verdict.Stage),
+			"action": string(verdict.Action),
+			"reason": verdict.Reason,
+		})
+	}
+	return result
+}
@@ -0,0 +1,233 @@
+package guardrails
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/prompts"
+)
+
+// defaultReplacement is used when a rewrite rule has no replacement configured
+const defaultReplacement = "[redacted]"
+
+// defaultInjectionPatterns are phrases commonly used to smuggle instructions into
+// documents or API responses
+var defaultInjectionPatterns = []string{
+	`(?i)ignore\s+(all\s+)?(the\s+)?(previous|prior|above|earlier)\s+(instructions|prompts|rules)`,
+	`(?i)disregard\s+(all\s+)?(the\s+)?(previous|prior|above|system)\s+(instructions|prompt|rules)`,
+	`(?i)forget\s+(all\s+)?(your|the)\s+(previous\s+)?instructions`,
+	`(?i)you\s+are\s+now\s+(a|an|in)\b`,
+	`(?i)new\s+(system\s+)?instructions\s*:`,
+	`(?i)reveal\s+(your|the)\s+system\s+prompt`,
+	`(?i)<\|?(im_start|im_end|system)\|?>`,
+	`(?i)^\s*#{1,3}\s*(system|instructions?)\s*:?\s*$`,
+}
+
+// RegexCheck triggers when any pattern matches
+type RegexCheck struct {
+	name        string
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// NewRegexCheck compiles the patterns of a regex rule
+func NewRegexCheck(patterns []string, replacement string) (*RegexCheck, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("at least one pattern is required")
+	}
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if replacement == "" {
+		replacement = defaultReplacement
+	}
+	return &RegexCheck{name: "regex", patterns: compiled, replacement: replacement}, nil
+}
+
+// NewBlocklistCheck matches whole terms case-insensitively
+func NewBlocklistCheck(terms []string, replacement string) (*RegexCheck, error) {
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("at least one term is required")
+	}
+	patterns := make([]string, len(terms))
+	for i, term := range terms {
+		patterns[i] = `(?i)\b` + regexp.QuoteMeta(term) + `\b`
+	}
+	check, err := NewRegexCheck(patterns, replacement)
+	if err != nil {
+		return nil, err
+	}
+	check.name = "blocklist"
+	return check, nil
+}
+
+func (c *RegexCheck) Name() string {
+	return c.name
+}
+
+func (c *RegexCheck) Check(ctx context.Context, content string) (*Finding, error) {
+	var matched []string
+	rewrite := content
+	for _, re := range c.patterns {
+		if match := re.FindString(rewrite); match != "" {
+			matched = append(matched, match)
+			rewrite = re.ReplaceAllLiteralString(rewrite, c.replacement)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	return &Finding{
+		Reason:  fmt.Sprintf("matched %q", strings.Join(matched, `", "`)),
+		Rewrite: rewrite,
+	}, nil
+}
+
+// MaxLengthCheck triggers when the content exceeds a number of characters
+type MaxLengthCheck struct {
+	max int
+}
+
+// NewMaxLengthCheck creates a length check
+func NewMaxLengthCheck(max int) *MaxLengthCheck {
+	return &MaxLengthCheck{max: max}
+}
+
+func (c *MaxLengthCheck) Name() string {
+	return "max_length"
+}
+
+func (c *MaxLengthCheck) Check(ctx context.Context, content string) (*Finding, error) {
+	length := utf8.RuneCountInString(content)
+	if length <= c.max {
+		return nil, nil
+	}
+	runes := []rune(content)
+	return &Finding{
+		Reason:  fmt.Sprintf("%d characters exceed the limit of %d", length, c.max),
+		Rewrite: string(runes[:c.max]),
+	}, nil
+}
+
+// PromptInjectionCheck looks for instruction-like markers, typically in tool
+// results. Rewriting drops the offending lines.
+type PromptInjectionCheck struct {
+	patterns []*regexp.Regexp
+}
+
+// NewPromptInjectionCheck uses the built-in markers plus any extra patterns
+func NewPromptInjectionCheck(extra []string) (*PromptInjectionCheck, error) {
+	patterns := append(append([]string{}, defaultInjectionPatterns...), extra...)
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &PromptInjectionCheck{patterns: compiled}, nil
+}
+
+func (c *PromptInjectionCheck) Name() string {
+	return "prompt_injection"
+}
+
+func (c *PromptInjectionCheck) Check(ctx context.Context, content string) (*Finding, error) {
+	var markers []string
+	var kept []string
+	for _, line := range strings.Split(content, "\n") {
+		injected := false
+		for _, re := range c.patterns {
+			if match := re.FindString(line); match != "" {
+				markers = append(markers, strings.TrimSpace(match))
+				injected = true
+				break
+			}
+		}
+		if !injected {
+			kept = append(kept, line)
+		}
+	}
+	if len(markers) == 0 {
+		return nil, nil
+	}
+
+	rewrite := strings.Join(kept, "\n")
+	if strings.TrimSpace(rewrite) == "" {
+		rewrite = "[content removed: possible prompt injection]"
+	}
+	return &Finding{
+		Reason:  fmt.Sprintf("possible prompt injection: %q", strings.Join(markers, `", "`)),
+		Rewrite: rewrite,
+	}, nil
+}
+
+// JudgeCheck asks the LLM whether the content violates the configured criteria
+type JudgeCheck struct {
+	provider llm.Provider
+	criteria string
+}
+
+// NewJudgeCheck creates an LLM judge. An empty criteria uses a generic safety policy.
+func NewJudgeCheck(provider llm.Provider, criteria string) *JudgeCheck {
+	if criteria == "" {
+		criteria = "The content must not contain harmful, abusive or confidential information (credentials, API keys, personal data)."
+	}
+	return &JudgeCheck{provider: provider, criteria: criteria}
+}
+
+func (c *JudgeCheck) Name() string {
+	return "llm_judge"
+}
+
+func (c *JudgeCheck) Check(ctx context.Context, content string) (*Finding, error) {
+	req := &llm.CompletionRequest{
+		Messages: []llm.Message{
+			{Role: "user", Content: prompts.RenderGuardrailJudgePrompt(prompts.PromptData{
+				Criteria: c.criteria,
+				Content:  content,
+			})},
+		},
+		MaxTokens:   100,
+		Temperature: 0,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	resp, err := c.provider.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	verdict := strings.TrimSpace(resp.Content)
+	upper := strings.ToUpper(verdict)
+	switch {
+	case strings.HasPrefix(upper, "SAFE"):
+		return nil, nil
+	case strings.HasPrefix(upper, "UNSAFE"):
+		reason := strings.TrimSpace(strings.TrimLeft(verdict[len("UNSAFE"):], ":- "))
+		if reason == "" {
+			reason = "judged unsafe"
+		}
+		return &Finding{Reason: reason}, nil
+	default:
+		return nil, fmt.Errorf("unexpected judge verdict: %.100s", verdict)
+	}
+}
+
+// compilePatterns compiles a list of regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
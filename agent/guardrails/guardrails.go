@@ -0,0 +1,226 @@
+package guardrails
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// Stage identifies where in the turn a guardrail runs
+type Stage string
+
+const (
+	StageInput      Stage = "input"       // User message, before the LLM sees it
+	StageToolResult Stage = "tool_result" // Tool output, before it is sent back to the LLM
+	StageOutput     Stage = "output"      // Final answer, before it is returned or saved
+)
+
+// Action is what happens when a check triggers
+type Action string
+
+const (
+	ActionBlock    Action = "block"    // Replace the content with the rule message and stop
+	ActionRewrite  Action = "rewrite"  // Replace the offending parts of the content
+	ActionAnnotate Action = "annotate" // Keep the content and append a note
+)
+
+// Finding is what a check reports when it triggers
+type Finding struct {
+	Reason  string
+	Rewrite string // Content with the offending parts removed, empty if the check cannot rewrite
+}
+
+// Check inspects a piece of content. It returns nil when the content passes.
+type Check interface {
+	Name() string
+	Check(ctx context.Context, content string) (*Finding, error)
+}
+
+// Verdict records a triggered check
+type Verdict struct {
+	Rule   string `json:"rule"`
+	Check  string `json:"check"`
+	Stage  Stage  `json:"stage"`
+	Action Action `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// Result is the content after all checks of a stage have run
+type Result struct {
+	Content  string    // Content to use from now on (the block message if Blocked)
+	Blocked  bool      // A block rule triggered
+	Verdicts []Verdict // Triggered checks, in order
+}
+
+// rule binds a check to the stages it runs on and the action to take
+type rule struct {
+	name    string
+	check   Check
+	action  Action
+	message string
+	stages  map[Stage]bool
+}
+
+// Pipeline runs guardrail rules in order
+type Pipeline struct {
+	rules []rule
+}
+
+// NewPipeline builds a pipeline from the guardrails configuration. The provider
+// is only used by llm_judge rules.
+func NewPipeline(cfg config.GuardrailsConfig, provider llm.Provider) (*Pipeline, error) {
+	p := &Pipeline{}
+	for i, r := range cfg.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("%s_%d", r.Type, i)
+		}
+
+		check, err := newCheck(r, provider)
+		if err != nil {
+			return nil, fmt.Errorf("guardrail %s: %w", name, err)
+		}
+
+		action := Action(r.Action)
+		switch action {
+		case ActionBlock, ActionRewrite, ActionAnnotate:
+		case "":
+			action = ActionBlock
+		default:
+			return nil, fmt.Errorf("guardrail %s: unknown action %q", name, r.Action)
+		}
+
+		stages := make([]Stage, 0, len(r.Stages))
+		for _, s := range r.Stages {
+			stage := Stage(s)
+			switch stage {
+			case StageInput, StageToolResult, StageOutput:
+			default:
+				return nil, fmt.Errorf("guardrail %s: unknown stage %q", name, s)
+			}
+			stages = append(stages, stage)
+		}
+		if len(stages) == 0 {
+			stages = defaultStages(r.Type)
+		}
+
+		p.Add(name, check, action, r.Message, stages...)
+	}
+	return p, nil
+}
+
+// newCheck creates the check for a configured rule
+func newCheck(r config.GuardrailRule, provider llm.Provider) (Check, error) {
+	switch r.Type {
+	case "regex":
+		return NewRegexCheck(r.Patterns, r.Replacement)
+	case "blocklist":
+		return NewBlocklistCheck(r.Terms, r.Replacement)
+	case "max_length":
+		if r.MaxLength <= 0 {
+			return nil, fmt.Errorf("max_length must be positive")
+		}
+		return NewMaxLengthCheck(r.MaxLength), nil
+	case "prompt_injection":
+		return NewPromptInjectionCheck(r.Patterns)
+	case "llm_judge":
+		if provider == nil {
+			return nil, fmt.Errorf("llm_judge requires an LLM provider")
+		}
+		return NewJudgeCheck(provider, r.Criteria), nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", r.Type)
+	}
+}
+
+// defaultStages returns the stages a rule type runs on when none are configured
+func defaultStages(checkType string) []Stage {
+	switch checkType {
+	case "prompt_injection":
+		return []Stage{StageToolResult}
+	case "llm_judge":
+		return []Stage{StageOutput}
+	default:
+		return []Stage{StageInput, StageOutput}
+	}
+}
+
+// Add registers a custom check. message is shown when the rule blocks or annotates.
+func (p *Pipeline) Add(name string, check Check, action Action, message string, stages ...Stage) {
+	r := rule{name: name, check: check, action: action, message: message, stages: make(map[Stage]bool)}
+	for _, stage := range stages {
+		r.stages[stage] = true
+	}
+	p.rules = append(p.rules, r)
+}
+
+// Len returns the number of rules in the pipeline
+func (p *Pipeline) Len() int {
+	return len(p.rules)
+}
+
+// Run applies the rules of a stage to content. Checks that fail to run are
+// logged and skipped so a broken judge does not take the agent down.
+func (p *Pipeline) Run(ctx context.Context, stage Stage, content string) *Result {
+	result := &Result{Content: content}
+	for _, r := range p.rules {
+		if !r.stages[stage] {
+			continue
+		}
+
+		finding, err := r.check.Check(ctx, result.Content)
+		if err != nil {
+			log.Printf("Guardrail %s failed: %v", r.name, err)
+			continue
+		}
+		if finding == nil {
+			continue
+		}
+
+		result.Verdicts = append(result.Verdicts, Verdict{
+			Rule:   r.name,
+			Check:  r.check.Name(),
+			Stage:  stage,
+			Action: r.action,
+			Reason: finding.Reason,
+		})
+
+		switch r.action {
+		case ActionBlock:
+			result.Content = r.blockMessage(stage, finding)
+			result.Blocked = true
+			return result
+		case ActionRewrite:
+			if finding.Rewrite != "" {
+				result.Content = finding.Rewrite
+			} else {
+				result.Content = r.blockMessage(stage, finding)
+			}
+		case ActionAnnotate:
+			note := r.message
+			if note == "" {
+				note = fmt.Sprintf("[Guardrail %s: %s]", r.name, finding.Reason)
+			}
+			result.Content += "\n\n" + note
+		}
+	}
+	return result
+}
+
+// blockMessage returns the text that replaces blocked content
+func (r rule) blockMessage(stage Stage, finding *Finding) string {
+	if r.message != "" {
+		return r.message
+	}
+	switch stage {
+	case StageInput:
+		return "Your message was blocked by a content policy and was not processed."
+	case StageToolResult:
+		return fmt.Sprintf("[Tool result withheld by guardrail %s: %s]", r.name, finding.Reason)
+	default:
+		return "The answer was withheld by a content policy."
+	}
+}
@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// HookContext describes the turn a hook is running in
+type HookContext struct {
+	Context   context.Context
+	SessionID string
+	User      *ConversationContext // Personalization context (user name, role, organization...)
+	Query     string               // User message of the turn, after BeforeUserMessage rewrites
+}
+
+// HookToolCall is a tool call as seen by BeforeToolCall and AfterToolCall hooks.
+// BeforeToolCall hooks may replace Arguments.
+type HookToolCall struct {
+	ID        string
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// Hook intercepts the agent loop. Embed BaseHook and override only the methods you need.
+//
+// Hooks run in registration order. Returning a non-nil *llm.CompletionResponse from
+// BeforeUserMessage or BeforeLLMRequest short-circuits the turn or the LLM call with a
+// canned response; returning an error aborts the turn.
+type Hook interface {
+	// BeforeUserMessage can rewrite the user message or answer it directly
+	BeforeUserMessage(hc *HookContext, message string) (string, *llm.CompletionResponse, error)
+
+	// BeforeLLMRequest can modify the request in place or replace the LLM call
+	BeforeLLMRequest(hc *HookContext, req *llm.CompletionRequest) (*llm.CompletionResponse, error)
+
+	// AfterLLMResponse can inspect or modify each LLM response
+	AfterLLMResponse(hc *HookContext, req *llm.CompletionRequest, resp *llm.CompletionResponse) error
+
+	// BeforeToolCall can rewrite the arguments or veto the call. A non-empty veto
+	// message is returned to the model instead of executing the tool.
+	BeforeToolCall(hc *HookContext, call *HookToolCall) (veto string, err error)
+
+	// AfterToolCall can inspect or rewrite the tool output sent back to the model
+	AfterToolCall(hc *HookContext, call *HookToolCall, result string, toolErr error) (string, error)
+
+	// AfterTurn runs on the final response before it is saved to memory
+	AfterTurn(hc *HookContext, resp *llm.CompletionResponse) error
+}
+
+// BaseHook provides no-op implementations of every Hook method
+type BaseHook struct{}
+
+func (BaseHook) BeforeUserMessage(hc *HookContext, message string) (string, *llm.CompletionResponse, error) {
+	return message, nil, nil
+}
+
+func (BaseHook) BeforeLLMRequest(hc *HookContext, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	return nil, nil
+}
+
+func (BaseHook) AfterLLMResponse(hc *HookContext, req *llm.CompletionRequest, resp *llm.CompletionResponse) error {
+	return nil
+}
+
+func (BaseHook) BeforeToolCall(hc *HookContext, call *HookToolCall) (string, error) {
+	return "", nil
+}
+
+func (BaseHook) AfterToolCall(hc *HookContext, call *HookToolCall, result string, toolErr error) (string, error) {
+	return result, nil
+}
+
+func (BaseHook) AfterTurn(hc *HookContext, resp *llm.CompletionResponse) error {
+	return nil
+}
+
+// AddHook appends a hook to the agent's middleware chain
+func (a *V3Agent) AddHook(hook Hook) {
+	a.hooks = append(a.hooks, hook)
+}
+
+// hookContext builds the HookContext for the turn in progress
+func (a *V3Agent) hookContext(ctx context.Context) *HookContext {
+	hc := &HookContext{
+		Context: ctx,
+		User:    a.turnUser,
+		Query:   a.turnQuery,
+	}
+	if a.currentSession != nil {
+		hc.SessionID = a.currentSession.SessionID
+	}
+	return hc
+}
+
+// runBeforeUserMessage applies BeforeUserMessage hooks, stopping at the first canned response
+func (a *V3Agent) runBeforeUserMessage(message string) (string, *llm.CompletionResponse, error) {
+	for _, hook := range a.hooks {
+		rewritten, canned, err := hook.BeforeUserMessage(a.hookContext(a.ctx), message)
+		if err != nil {
+			return message, nil, err
+		}
+		message = rewritten
+		if canned != nil {
+			return message, canned, nil
+		}
+	}
+	return message, nil, nil
+}
+
+// complete sends a request to the LLM provider through the BeforeLLMRequest and
+// AfterLLMResponse hooks. All LLM calls of the conversation loop go through here.
+// Provider failures are returned as a *TurnError; hook errors are returned as is.
+func (a *V3Agent) complete(ctx context.Context, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	hc := a.hookContext(ctx)
+
+	if err := a.checkBudget(); err != nil {
+		return nil, err
+	}
+
+	provider := a.provider()
+	ctx, span := a.startSpan(ctx, "llm.call", map[string]interface{}{
+		"provider":   provider.GetName(),
+		"messages":   len(req.Messages),
+		"tools":      len(req.Tools),
+		"max_tokens": req.MaxTokens,
+	})
+	defer span.End()
+
+	var resp *llm.CompletionResponse
+	for _, hook := range a.hooks {
+		canned, err := hook.BeforeLLMRequest(hc, req)
+		if err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		if canned != nil {
+			resp = canned
+			span.SetAttribute("canned", true)
+			break
+		}
+	}
+
+	if resp == nil {
+		var err error
+		start := time.Now()
+		resp, err = provider.Complete(ctx, req)
+		a.observeLLM(provider.GetName(), req, resp, err, time.Since(start))
+		if err != nil {
+			span.SetError(err)
+			return nil, llmError(err)
+		}
+		a.chargeLLM(resp)
+	}
+	span.SetAttributes(map[string]interface{}{
+		"model":             resp.Model,
+		"prompt_tokens":     resp.Usage.PromptTokens,
+		"completion_tokens": resp.Usage.CompletionTokens,
+		"tool_calls":        len(resp.ToolCalls),
+	})
+
+	for _, hook := range a.hooks {
+		if err := hook.AfterLLMResponse(hc, req, resp); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// runBeforeToolCall applies BeforeToolCall hooks, stopping at the first veto
+func (a *V3Agent) runBeforeToolCall(call *HookToolCall) (string, error) {
+	for _, hook := range a.hooks {
+		veto, err := hook.BeforeToolCall(a.hookContext(a.ctx), call)
+		if err != nil || veto != "" {
+			return veto, err
+		}
+	}
+	return "", nil
+}
+
+// runAfterToolCall applies AfterToolCall hooks to a tool output
+func (a *V3Agent) runAfterToolCall(call *HookToolCall, result string, toolErr error) (string, error) {
+	for _, hook := range a.hooks {
+		rewritten, err := hook.AfterToolCall(a.hookContext(a.ctx), call, result, toolErr)
+		if err != nil {
+			return result, err
+		}
+		result = rewritten
+	}
+	return result, toolErr
+}
+
+// runAfterTurn applies AfterTurn hooks to the final response
+func (a *V3Agent) runAfterTurn(resp *llm.CompletionResponse) error {
+	for _, hook := range a.hooks {
+		if err := hook.AfterTurn(a.hookContext(a.ctx), resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CassetteEntry es una interacción grabada en un cassette (una línea JSON)
+type CassetteEntry struct {
+	Key      string              `json:"key"`
+	Provider string              `json:"provider"`
+	Request  *CompletionRequest  `json:"request"`
+	Response *CompletionResponse `json:"response,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// RequestKey identifica una solicitud por su conversación, sin los mensajes de
+// sistema, que cambian entre ejecuciones (fecha, hora, caché)
+func RequestKey(req *CompletionRequest) string {
+	h := sha256.New()
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", msg.Role, msg.Content)
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(h, "%s\x00%s\x00", call.Function.Name, call.Function.Arguments)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// RecordingProvider graba en un cassette cada interacción con otro proveedor
+type RecordingProvider struct {
+	provider Provider
+	mu       sync.Mutex
+	file     *os.File
+}
+
+// NewRecordingProvider crea un proveedor que graba las interacciones en path
+func NewRecordingProvider(provider Provider, path string) (*RecordingProvider, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cassette: %w", err)
+	}
+	return &RecordingProvider{provider: provider, file: file}, nil
+}
+
+// Close cierra el cassette
+func (rp *RecordingProvider) Close() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.file.Close()
+}
+
+func (rp *RecordingProvider) record(req *CompletionRequest, resp *CompletionResponse, err error) {
+	entry := CassetteEntry{
+		Key:      RequestKey(req),
+		Provider: rp.provider.GetName(),
+		Request:  req,
+		Response: resp,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	data, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		log.Printf("Failed to record interaction: %v", marshalErr)
+		return
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if _, writeErr := rp.file.Write(append(data, '\n')); writeErr != nil {
+		log.Printf("Failed to record interaction: %v", writeErr)
+	}
+}
+
+func (rp *RecordingProvider) GetName() string {
+	return rp.provider.GetName()
+}
+
+func (rp *RecordingProvider) IsAvailable(ctx context.Context) bool {
+	return rp.provider.IsAvailable(ctx)
+}
+
+// Complete ejecuta la solicitud y graba la respuesta
+func (rp *RecordingProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	resp, err := rp.provider.Complete(ctx, req)
+	rp.record(req, resp, err)
+	return resp, err
+}
+
+// Stream reenvía los chunks y graba el contenido completo al terminar
+func (rp *RecordingProvider) Stream(ctx context.Context, req *CompletionRequest) (<-chan StreamChunk, error) {
+	start := time.Now()
+	streamCh, err := rp.provider.Stream(ctx, req)
+	if err != nil {
+		rp.record(req, nil, err)
+		return nil, err
+	}
+
+	out := make(chan StreamChunk)
+	go func() {
+		defer close(out)
+		var content strings.Builder
+		for chunk := range streamCh {
+			content.WriteString(chunk.Content)
+			out <- chunk
+		}
+		rp.record(req, &CompletionResponse{
+			Content:      content.String(),
+			Model:        req.Model,
+			ResponseTime: time.Since(start),
+		}, nil)
+	}()
+	return out, nil
+}
+
+func (rp *RecordingProvider) GetModels() []string {
+	return rp.provider.GetModels()
+}
+
+func (rp *RecordingProvider) GetDefaultModel() string {
+	return rp.provider.GetDefaultModel()
+}
+
+func (rp *RecordingProvider) ValidateConfig() error {
+	return rp.provider.ValidateConfig()
+}
+
+func (rp *RecordingProvider) SupportsFunctionCalling() bool {
+	return rp.provider.SupportsFunctionCalling()
+}
+
+// ReplayProvider responde con las interacciones de un cassette sin llamar a
+// ningún LLM. Cada solicitud recibe la respuesta grabada para la misma
+// conversación; si no hay ninguna, la siguiente sin usar en orden de grabación,
+// o un error en modo estricto.
+type ReplayProvider struct {
+	mu         sync.Mutex
+	entries    []CassetteEntry
+	used       []bool
+	strict     bool
+	mismatches int
+}
+
+// NewReplayProvider carga un cassette grabado con RecordingProvider
+func NewReplayProvider(path string) (*ReplayProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	var entries []CassetteEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry CassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid cassette entry at line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("cassette %s has no interactions", path)
+	}
+
+	return &ReplayProvider{entries: entries, used: make([]bool, len(entries))}, nil
+}
+
+// SetStrict hace que una solicitud sin interacción grabada falle en lugar de
+// recibir la siguiente en orden
+func (rp *ReplayProvider) SetStrict(strict bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.strict = strict
+}
+
+// Mismatches devuelve cuántas solicitudes no tenían interacción grabada
+func (rp *ReplayProvider) Mismatches() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.mismatches
+}
+
+// next devuelve la interacción grabada que corresponde a la solicitud
+func (rp *ReplayProvider) next(req *CompletionRequest) (*CassetteEntry, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	key := RequestKey(req)
+	match := -1
+	for i, entry := range rp.entries {
+		if rp.used[i] {
+			continue
+		}
+		if entry.Key == key {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, &ProviderError{Provider: "replay", Type: ErrorTypeInvalidReq, Message: "no recorded interactions left"}
+	}
+	if rp.entries[match].Key != key {
+		rp.mismatches++
+		if rp.strict {
+			return nil, &ProviderError{Provider: "replay", Type: ErrorTypeInvalidReq, Message: fmt.Sprintf("no recorded interaction matches the request (key %s)", key)}
+		}
+		log.Printf("Replay: no recorded interaction matches the request, using the next one in order")
+	}
+	rp.used[match] = true
+	return &rp.entries[match], nil
+}
+
+func (rp *ReplayProvider) GetName() string {
+	return "replay"
+}
+
+func (rp *ReplayProvider) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+// Complete devuelve la respuesta grabada
+func (rp *ReplayProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	entry, err := rp.next(req)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Error != "" {
+		return nil, &ProviderError{Provider: entry.Provider, Type: ErrorTypeServerError, Message: entry.Error}
+	}
+	resp := *entry.Response
+	return &resp, nil
+}
+
+// Stream devuelve la respuesta grabada en un único chunk
+func (rp *ReplayProvider) Stream(ctx context.Context, req *CompletionRequest) (<-chan StreamChunk, error) {
+	resp, err := rp.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan StreamChunk, 2)
+	ch <- StreamChunk{Content: resp.Content}
+	ch <- StreamChunk{Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func (rp *ReplayProvider) GetModels() []string {
+	return []string{"replay"}
+}
+
+func (rp *ReplayProvider) GetDefaultModel() string {
+	return "replay"
+}
+
+func (rp *ReplayProvider) ValidateConfig() error {
+	return nil
+}
+
+func (rp *ReplayProvider) SupportsFunctionCalling() bool {
+	return true
+}
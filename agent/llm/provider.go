@@ -2,15 +2,27 @@ package llm
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
 // Message representa un mensaje en la conversación
 type Message struct {
+	ID         string     `json:"id,omitempty"`         // Stable identifier within a conversation tree
 	Role       string     `json:"role"`                 // "user", "assistant", "system", "tool"
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"` // For assistant messages with tool calls
 	ToolCallID string     `json:"tool_call_id,omitempty"` // For tool response messages
+	Trace      bool       `json:"trace,omitempty"`        // Intermediate tool-call step, kept out of future context
+	Sources    []Source   `json:"sources,omitempty"`      // Documents behind an assistant answer
+}
+
+// Source representa un documento consultado para elaborar una respuesta
+type Source struct {
+	Path    string  `json:"path"`
+	Title   string  `json:"title,omitempty"`   // Título de los metadatos apidoc
+	Score   float64 `json:"score,omitempty"`   // Relevancia según la búsqueda, 0 si se leyó completo
+	Snippet string  `json:"snippet,omitempty"` // Fragmento relevante del documento
 }
 
 // CompletionRequest representa una solicitud de completado
@@ -31,6 +43,7 @@ type CompletionResponse struct {
 	Usage        TokenUsage    `json:"usage"`
 	ResponseTime time.Duration `json:"response_time"`
 	ToolCalls    []ToolCall    `json:"tool_calls,omitempty"` // Function calls requested by LLM
+	Sources      []Source      `json:"sources,omitempty"`    // Documents surfaced or read by tools during the turn
 }
 
 // TokenUsage representa el uso de tokens
@@ -93,6 +106,22 @@ const (
 	ProviderGemini    ProviderType = "gemini"
 )
 
+// NewProvider crea el proveedor con ese nombre ("anthropic", "openai", "gemini" o "mock")
+func NewProvider(name string, config *Config) (Provider, error) {
+	switch ProviderType(name) {
+	case ProviderAnthropic:
+		return NewAnthropicProvider(config), nil
+	case ProviderOpenAI:
+		return NewOpenAIProvider(config), nil
+	case ProviderGemini:
+		return NewGeminiProvider(config), nil
+	case "mock":
+		return NewMockProvider(config), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", name)
+	}
+}
+
 // ProviderError representa un error específico de un proveedor
 type ProviderError struct {
 	Provider string
@@ -0,0 +1,411 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+)
+
+const (
+	defaultTimeout      = 60 * time.Second
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// Client is a session with one MCP server. It reconnects in the background when
+// the connection drops and refreshes its tools when the server announces changes.
+type Client struct {
+	name    string
+	cfg     config.MCPServerConfig
+	timeout time.Duration
+
+	mu             sync.Mutex
+	transport      transport
+	generation     int // Bumped on each connection, so stale transports are ignored
+	connected      bool
+	closed         bool
+	reconnecting   bool
+	nextID         int64
+	pending        map[string]chan *Message
+	tools          []Tool
+	server         InitializeResult
+	onToolsChanged func([]Tool)
+}
+
+// NewClient creates a client for a configured server. Connect opens the session.
+func NewClient(name string, cfg config.MCPServerConfig) *Client {
+	timeout := defaultTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return &Client{
+		name:    name,
+		cfg:     cfg,
+		timeout: timeout,
+		pending: make(map[string]chan *Message),
+	}
+}
+
+// Name returns the server name from the configuration
+func (c *Client) Name() string {
+	return c.name
+}
+
+// OnToolsChanged sets a function called with the new tool list after a
+// reconnection or a tools/list_changed notification
+func (c *Client) OnToolsChanged(fn func([]Tool)) {
+	c.mu.Lock()
+	c.onToolsChanged = fn
+	c.mu.Unlock()
+}
+
+// Connect starts the transport, runs the initialize handshake and lists the tools
+func (c *Client) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return fmt.Errorf("MCP client %s is closed", c.name)
+	}
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+
+	t, err := startTransport(c.name, c.cfg,
+		func(msg *Message) { c.receive(generation, msg) },
+		func(err error) { c.connectionLost(generation, err) },
+	)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.transport = t
+	c.mu.Unlock()
+
+	if err := c.initialize(ctx); err != nil {
+		c.mu.Lock()
+		c.transport = nil
+		c.mu.Unlock()
+		t.close()
+		return err
+	}
+	tools, err := c.listTools(ctx)
+	if err != nil {
+		c.mu.Lock()
+		c.transport = nil
+		c.mu.Unlock()
+		t.close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.connected = true
+	c.tools = tools
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result InitializeResult
+	err := c.call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      Implementation{Name: "agent", Version: "1.0"},
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("MCP server %s: initialize failed: %w", c.name, err)
+	}
+	c.mu.Lock()
+	c.server = result
+	c.mu.Unlock()
+	return c.notify(ctx, "notifications/initialized", nil)
+}
+
+// listTools reads every page of tools/list
+func (c *Client) listTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var page ListToolsResult
+		if err := c.call(ctx, "tools/list", PaginatedParams{Cursor: cursor}, &page); err != nil {
+			return nil, fmt.Errorf("MCP server %s: tools/list failed: %w", c.name, err)
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// Tools returns the tools listed by the server
+func (c *Client) Tools() []Tool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Tool(nil), c.tools...)
+}
+
+// ServerInfo returns what the server reported on initialize
+func (c *Client) ServerInfo() InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// Connected reports whether the session is open
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// CallTool runs a tool on the server
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error) {
+	if !c.Connected() {
+		return nil, fmt.Errorf("MCP server %s is not connected", c.name)
+	}
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close ends the session and stops reconnecting
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.connected = false
+	t := c.transport
+	c.transport = nil
+	c.failPending(fmt.Errorf("MCP client %s closed", c.name))
+	c.mu.Unlock()
+
+	if t != nil {
+		return t.close()
+	}
+	return nil
+}
+
+// call sends a request and decodes the result, waiting up to the server timeout
+func (c *Client) call(ctx context.Context, method string, params, result interface{}) error {
+	msg := &Message{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+
+	c.mu.Lock()
+	t := c.transport
+	if t == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("MCP server %s is not connected", c.name)
+	}
+	c.nextID++
+	id := strconv.FormatInt(c.nextID, 10)
+	msg.ID = json.RawMessage(id)
+	ch := make(chan *Message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if err := t.send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("MCP server %s: %s timed out after %v", c.name, method, c.timeout)
+		}
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	msg := &Message{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	c.mu.Lock()
+	t := c.transport
+	c.mu.Unlock()
+	if t == nil {
+		return fmt.Errorf("MCP server %s is not connected", c.name)
+	}
+	return t.send(ctx, msg)
+}
+
+// receive dispatches a message from the server
+func (c *Client) receive(generation int, msg *Message) {
+	c.mu.Lock()
+	if generation != c.generation {
+		c.mu.Unlock()
+		return
+	}
+	if msg.IsResponse() {
+		ch, ok := c.pending[string(msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			select {
+			case ch <- msg:
+			default: // Already failed by a lost connection
+			}
+		}
+		return
+	}
+	t := c.transport
+	c.mu.Unlock()
+
+	switch {
+	case msg.IsRequest():
+		// Servers may ping; other requests (sampling, roots) are not supported
+		var resp *Message
+		if msg.Method == "ping" {
+			resp, _ = NewResponse(msg.ID, struct{}{})
+		} else {
+			resp = NewErrorResponse(msg.ID, CodeMethodNotFound, "method not supported: "+msg.Method)
+		}
+		if t != nil {
+			go t.send(context.Background(), resp)
+		}
+	case msg.Method == "notifications/tools/list_changed":
+		go c.refreshTools()
+	}
+}
+
+// refreshTools lists the tools again and hands them to the change callback
+func (c *Client) refreshTools() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	tools, err := c.listTools(ctx)
+	if err != nil {
+		log.Printf("MCP %s: refreshing tools failed: %v", c.name, err)
+		return
+	}
+	c.mu.Lock()
+	c.tools = tools
+	fn := c.onToolsChanged
+	c.mu.Unlock()
+	if fn != nil {
+		fn(tools)
+	}
+}
+
+// connectionLost fails the waiting requests and starts reconnecting
+func (c *Client) connectionLost(generation int, err error) {
+	c.mu.Lock()
+	if generation != c.generation || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	wasConnected := c.connected
+	c.connected = false
+	t := c.transport
+	c.transport = nil
+	c.failPending(err)
+	c.mu.Unlock()
+
+	if t != nil {
+		// Stop what is left of the connection, such as the HTTP event stream
+		go t.close()
+	}
+	if wasConnected {
+		log.Printf("MCP %s: %v", c.name, err)
+		c.Reconnect()
+	}
+}
+
+// Reconnect retries Connect in the background with exponential backoff until it
+// succeeds or the client is closed. It does nothing if a retry loop is running.
+func (c *Client) Reconnect() {
+	c.mu.Lock()
+	if c.reconnecting || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.reconnecting = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			c.reconnecting = false
+			c.mu.Unlock()
+		}()
+
+		backoff := minReconnectBackoff
+		for {
+			time.Sleep(backoff)
+			c.mu.Lock()
+			closed := c.closed
+			c.mu.Unlock()
+			if closed {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			err := c.Connect(ctx)
+			cancel()
+			if err == nil {
+				log.Printf("MCP %s: reconnected", c.name)
+				c.mu.Lock()
+				fn := c.onToolsChanged
+				tools := append([]Tool(nil), c.tools...)
+				c.mu.Unlock()
+				if fn != nil {
+					fn(tools)
+				}
+				return
+			}
+
+			if backoff < maxReconnectBackoff {
+				backoff *= 2
+				if backoff > maxReconnectBackoff {
+					backoff = maxReconnectBackoff
+				}
+			}
+		}
+	}()
+}
+
+// failPending ends every waiting request with an error. Callers hold c.mu.
+func (c *Client) failPending(err error) {
+	for id, ch := range c.pending {
+		ch <- &Message{JSONRPC: "2.0", ID: json.RawMessage(id), Error: &RPCError{Code: CodeInternalError, Message: err.Error()}}
+		delete(c.pending, id)
+	}
+}
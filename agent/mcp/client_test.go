@@ -0,0 +1,452 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+// fakeServer answers MCP requests for the client tests. Tools are listed one
+// per page, so every listing is paged.
+type fakeServer struct {
+	mu       sync.Mutex
+	tools    []Tool
+	methods  []string // Methods received, in order
+	session  string   // Current HTTP session; other session IDs get 404
+	sessions int
+
+	events  chan *Message // Sent to the client over the HTTP event stream
+	streams chan struct{} // Signalled when an event stream opens
+	done    chan struct{}
+}
+
+func newFakeServer(names ...string) *fakeServer {
+	s := &fakeServer{
+		events:  make(chan *Message, 10),
+		streams: make(chan struct{}, 10),
+		done:    make(chan struct{}),
+	}
+	s.setTools(names...)
+	return s
+}
+
+func (s *fakeServer) setTools(names ...string) {
+	list := make([]Tool, len(names))
+	for i, name := range names {
+		list[i] = Tool{Name: name, Description: name + " tool", InputSchema: map[string]interface{}{"type": "object"}}
+	}
+	s.mu.Lock()
+	s.tools = list
+	s.mu.Unlock()
+}
+
+func (s *fakeServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.methods...)
+}
+
+// handle returns the response to a request, or nil for notifications and responses
+func (s *fakeServer) handle(msg *Message) *Message {
+	s.mu.Lock()
+	if msg.Method != "" {
+		s.methods = append(s.methods, msg.Method)
+	}
+	list := s.tools
+	s.mu.Unlock()
+	if !msg.IsRequest() {
+		return nil
+	}
+
+	var result interface{}
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		json.Unmarshal(msg.Params, &params)
+		if params.ProtocolVersion != ProtocolVersion {
+			return NewErrorResponse(msg.ID, CodeInvalidParams, "unsupported protocol version "+params.ProtocolVersion)
+		}
+		result = InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{ListChanged: true}},
+			ServerInfo:      Implementation{Name: "fake", Version: "0.1"},
+		}
+	case "tools/list":
+		var params PaginatedParams
+		json.Unmarshal(msg.Params, &params)
+		page, _ := strconv.Atoi(params.Cursor)
+		tools := ListToolsResult{Tools: []Tool{}}
+		if page < len(list) {
+			tools.Tools = list[page : page+1]
+		}
+		if page+1 < len(list) {
+			tools.NextCursor = strconv.Itoa(page + 1)
+		}
+		result = tools
+	case "tools/call":
+		var params CallToolParams
+		json.Unmarshal(msg.Params, &params)
+		switch params.Name {
+		case "echo":
+			text, _ := params.Arguments["text"].(string)
+			result = CallToolResult{Content: []Content{{Type: "text", Text: text}}}
+		case "fail":
+			result = CallToolResult{Content: []Content{{Type: "text", Text: "boom"}}, IsError: true}
+		default:
+			return NewErrorResponse(msg.ID, CodeInvalidParams, "unknown tool "+params.Name)
+		}
+	default:
+		return NewErrorResponse(msg.ID, CodeMethodNotFound, "method not found: "+msg.Method)
+	}
+	resp, _ := NewResponse(msg.ID, result)
+	return resp
+}
+
+// ServeHTTP implements the streamable HTTP transport
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		flusher := w.(http.Flusher)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		s.streams <- struct{}{}
+		for {
+			select {
+			case msg := <-s.events:
+				data, _ := json.Marshal(msg)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-s.done:
+				return
+			}
+		}
+	case http.MethodDelete:
+		return
+	}
+
+	var msg Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	if msg.Method == "initialize" {
+		s.sessions++
+		s.session = fmt.Sprintf("session-%d", s.sessions)
+	} else if r.Header.Get("Mcp-Session-Id") != s.session {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	session := s.session
+	s.mu.Unlock()
+
+	resp := s.handle(&msg)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Mcp-Session-Id", session)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// expireSession forgets the HTTP session, as a restarted server would
+func (s *fakeServer) expireSession() {
+	s.mu.Lock()
+	s.session = ""
+	s.mu.Unlock()
+}
+
+func startHTTPFake(t *testing.T, s *fakeServer) config.MCPServerConfig {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() {
+		close(s.done)
+		srv.Close()
+	})
+	return config.MCPServerConfig{Enabled: true, URL: srv.URL, TimeoutSeconds: 5}
+}
+
+func connect(t *testing.T, cfg config.MCPServerConfig) *Client {
+	t.Helper()
+	client := NewClient("fake", cfg)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func toolNames(list []Tool) []string {
+	names := make([]string, len(list))
+	for i, tool := range list {
+		names[i] = tool.Name
+	}
+	return names
+}
+
+// waitFor polls cond until it holds or a few seconds pass
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestClientHTTPHandshake(t *testing.T) {
+	fake := newFakeServer("echo", "fail", "other")
+	client := connect(t, startHTTPFake(t, fake))
+
+	if info := client.ServerInfo(); info.ServerInfo.Name != "fake" || info.ProtocolVersion != ProtocolVersion {
+		t.Errorf("server info = %+v", info)
+	}
+	if got, want := toolNames(client.Tools()), []string{"echo", "fail", "other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tools = %v, want %v", got, want)
+	}
+	want := []string{"initialize", "notifications/initialized", "tools/list", "tools/list", "tools/list"}
+	if got := fake.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("methods = %v, want %v", got, want)
+	}
+}
+
+func TestClientCallTool(t *testing.T) {
+	fake := newFakeServer("echo", "fail")
+	client := connect(t, startHTTPFake(t, fake))
+	ctx := context.Background()
+
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "hello"})
+	if err != nil {
+		t.Fatalf("echo: %v", err)
+	}
+	if result.IsError || result.Text() != "hello" {
+		t.Errorf("echo = %+v", result)
+	}
+
+	result, err = client.CallTool(ctx, "fail", nil)
+	if err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if !result.IsError || result.Text() != "boom" {
+		t.Errorf("fail = %+v", result)
+	}
+
+	toolResult, err := NewRemoteTool("fake_fail", Tool{Name: "fail"}, client, false).Execute(ctx, nil)
+	if err != nil {
+		t.Fatalf("RemoteTool.Execute: %v", err)
+	}
+	if toolResult.Success || toolResult.Error != "boom" {
+		t.Errorf("remote tool result: success=%v error=%q", toolResult.Success, toolResult.Error)
+	}
+
+	if _, err := client.CallTool(ctx, "missing", nil); err == nil || !strings.Contains(err.Error(), "unknown tool missing") {
+		t.Errorf("unknown tool error = %v", err)
+	}
+}
+
+func TestManagerToolsListChanged(t *testing.T) {
+	fake := newFakeServer("echo", "fail")
+	cfg := config.MCPConfig{Servers: map[string]config.MCPServerConfig{"fake": startHTTPFake(t, fake)}}
+	registry := tools.NewToolRegistry()
+	manager := NewManager(cfg, registry)
+	manager.Start(context.Background())
+	defer manager.Close()
+
+	for _, name := range []string{"fake_echo", "fake_fail"} {
+		if _, ok := registry.GetTool(name); !ok {
+			t.Fatalf("%s not registered", name)
+		}
+	}
+
+	select {
+	case <-fake.streams:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client did not open the event stream")
+	}
+	fake.setTools("echo", "added")
+	fake.events <- &Message{JSONRPC: "2.0", Method: "notifications/tools/list_changed"}
+
+	waitFor(t, "the tools to be registered again", func() bool {
+		_, added := registry.GetTool("fake_added")
+		_, removed := registry.GetTool("fake_fail")
+		return added && !removed
+	})
+	if _, ok := registry.GetTool("fake_echo"); !ok {
+		t.Error("fake_echo unregistered after the list changed")
+	}
+}
+
+func TestClientReconnectsAfterSessionExpires(t *testing.T) {
+	fake := newFakeServer("echo")
+	client := connect(t, startHTTPFake(t, fake))
+	ctx := context.Background()
+
+	fake.expireSession()
+	if _, err := client.CallTool(ctx, "echo", nil); err == nil || !strings.Contains(err.Error(), "session expired") {
+		t.Fatalf("call on an expired session: err = %v", err)
+	}
+
+	waitFor(t, "the client to reconnect", client.Connected)
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "again"})
+	if err != nil || result.Text() != "again" {
+		t.Fatalf("call after reconnecting: %v %+v", err, result)
+	}
+	fake.mu.Lock()
+	sessions := fake.sessions
+	fake.mu.Unlock()
+	if sessions != 2 {
+		t.Errorf("sessions = %d, want 2", sessions)
+	}
+}
+
+// helperConfig starts this test binary as a stdio MCP server (see TestHelperProcess)
+func helperConfig() config.MCPServerConfig {
+	return config.MCPServerConfig{
+		Enabled:        true,
+		Command:        os.Args[0],
+		Args:           []string{"-test.run=TestHelperProcess", "--"},
+		Env:            map[string]string{"GO_WANT_MCP_HELPER": "1"},
+		TimeoutSeconds: 5,
+	}
+}
+
+// TestHelperProcess is not a real test: it serves MCP over stdin and stdout
+// when started by helperConfig.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_MCP_HELPER") != "1" {
+		return
+	}
+	serveStdio(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+// serveStdio runs the fake server over line-delimited JSON. Besides the tools of
+// fakeServer, "crash" exits without answering and "ping_me" pings the client
+// before answering.
+func serveStdio(r io.Reader, w io.Writer) {
+	fake := newFakeServer("echo", "crash", "ping_me")
+	in := bufio.NewScanner(r)
+	out := json.NewEncoder(w)
+	for in.Scan() {
+		var msg Message
+		if err := json.Unmarshal(in.Bytes(), &msg); err != nil {
+			out.Encode(NewErrorResponse(nil, CodeParseError, err.Error()))
+			continue
+		}
+		var params CallToolParams
+		if msg.Method == "tools/call" {
+			json.Unmarshal(msg.Params, &params)
+		}
+		switch params.Name {
+		case "crash":
+			os.Exit(3)
+		case "ping_me":
+			out.Encode(&Message{JSONRPC: "2.0", ID: json.RawMessage(`"server-ping"`), Method: "ping"})
+			text := "no answer to ping"
+			if in.Scan() {
+				var pong Message
+				json.Unmarshal(in.Bytes(), &pong)
+				if string(pong.ID) == `"server-ping"` && pong.Error == nil && len(pong.Result) > 0 {
+					text = "pong"
+				} else {
+					text = "bad answer to ping: " + in.Text()
+				}
+			}
+			resp, _ := NewResponse(msg.ID, CallToolResult{Content: []Content{{Type: "text", Text: text}}})
+			out.Encode(resp)
+		default:
+			if resp := fake.handle(&msg); resp != nil {
+				out.Encode(resp)
+			}
+		}
+	}
+}
+
+func TestClientStdio(t *testing.T) {
+	client := connect(t, helperConfig())
+	ctx := context.Background()
+
+	if got, want := toolNames(client.Tools()), []string{"echo", "crash", "ping_me"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tools = %v, want %v", got, want)
+	}
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "over stdio"})
+	if err != nil || result.Text() != "over stdio" {
+		t.Fatalf("echo: %v %+v", err, result)
+	}
+	result, err = client.CallTool(ctx, "ping_me", nil)
+	if err != nil || result.Text() != "pong" {
+		t.Fatalf("ping_me: %v %+v", err, result)
+	}
+}
+
+func TestClientStdioReconnectsAfterExit(t *testing.T) {
+	client := connect(t, helperConfig())
+	reconnected := make(chan []Tool, 1)
+	client.OnToolsChanged(func(list []Tool) { reconnected <- list })
+
+	// The server exits while the call waits for its answer
+	_, err := client.CallTool(context.Background(), "crash", nil)
+	if err == nil || !strings.Contains(err.Error(), errConnectionLost.Error()) {
+		t.Fatalf("in-flight call: err = %v, want the connection lost error", err)
+	}
+	if client.Connected() {
+		t.Error("client still connected after the server exited")
+	}
+
+	select {
+	case list := <-reconnected:
+		if len(list) != 3 {
+			t.Errorf("tools after reconnecting = %v", toolNames(list))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the client did not reconnect")
+	}
+	result, err := client.CallTool(context.Background(), "echo", map[string]interface{}{"text": "back"})
+	if err != nil || result.Text() != "back" {
+		t.Fatalf("call after reconnecting: %v %+v", err, result)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	cases := []struct {
+		server, prefix, remote string
+		want                   string
+	}{
+		{"github", "", "create_issue", "github_create_issue"},
+		{"my server", "", "list.files", "my_server_list_files"},
+		{"fs", "files-", "read/all", "files-read_all"},
+		{"docs", "", "búsqueda", "docs_b_squeda"},
+		{"srv", "", long, ("srv_" + long)[:maxToolNameLength]},
+	}
+	for _, tc := range cases {
+		got := toolName(tc.server, tc.prefix, tc.remote)
+		if got != tc.want {
+			t.Errorf("toolName(%q, %q, %q) = %q, want %q", tc.server, tc.prefix, tc.remote, got, tc.want)
+		}
+		if len(got) > maxToolNameLength {
+			t.Errorf("toolName(%q, %q, %q) is %d chars long", tc.server, tc.prefix, tc.remote, len(got))
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package mcp implements the Model Context Protocol: a client that registers the
+// tools of MCP servers (stdio or streamable HTTP) in a ToolRegistry, and the
+// JSON-RPC message types shared with the server side.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the MCP revision spoken by this package
+const ProtocolVersion = "2025-03-26"
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// IsRequest reports whether the message is a request that expects a response
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification reports whether the message is a notification
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse reports whether the message answers a request
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// RPCError is a JSON-RPC error object
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
+}
+
+// NewResponse builds the response to a request with a result
+func NewResponse(id json.RawMessage, result interface{}) (*Message, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{JSONRPC: "2.0", ID: id, Result: data}, nil
+}
+
+// NewErrorResponse builds the error response to a request
+func NewErrorResponse(id json.RawMessage, code int, message string) *Message {
+	if len(id) == 0 {
+		id = json.RawMessage("null") // Errors before the id could be read
+	}
+	return &Message{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: message}}
+}
+
+// Implementation names a client or server
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams are sent by the client to open a session
+type InitializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      Implementation         `json:"clientInfo"`
+}
+
+// InitializeResult is the server answer to initialize
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// ServerCapabilities lists the features a server offers
+type ServerCapabilities struct {
+	Tools     *ListChangedCapability `json:"tools,omitempty"`
+	Resources *ListChangedCapability `json:"resources,omitempty"`
+}
+
+// ListChangedCapability tells whether the server notifies list changes
+type ListChangedCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// PaginatedParams request a page of a list
+type PaginatedParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Tool describes a tool offered by a server
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// ListToolsResult is a page of tools
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// CallToolParams invoke a tool
+type CallToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// CallToolResult is the output of a tool. Tool failures come back with IsError
+// set rather than as JSON-RPC errors.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text joins the text content of the result
+func (r *CallToolResult) Text() string {
+	var text string
+	for _, content := range r.Content {
+		if content.Type != "text" {
+			continue
+		}
+		if text != "" {
+			text += "\n"
+		}
+		text += content.Text
+	}
+	return text
+}
+
+// Content is an item of a tool result
+type Content struct {
+	Type     string            `json:"type"` // "text", "image", "audio" or "resource"
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"` // Base64 for images and audio
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// Resource describes a document a server exposes
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// ListResourcesResult is a page of resources
+type ListResourcesResult struct {
+	Resources  []Resource `json:"resources"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// ReadResourceParams request the contents of a resource
+type ReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+// ResourceContents is the text (or base64 blob) of a resource
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// ReadResourceResult holds the contents of a resource
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
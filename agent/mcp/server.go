@@ -0,0 +1,425 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+// CodeResourceNotFound is the MCP error code for unknown resource URIs
+const CodeResourceNotFound = -32002
+
+const (
+	resourceScheme   = "kbase://"
+	resourcePageSize = 100
+)
+
+// Server serves tools and knowledge base documents to MCP clients. Tools come
+// from a ToolRegistry plus any tools added only to the server; documents are
+// read through a RestrictedFS.
+type Server struct {
+	info      Implementation
+	registry  *tools.ToolRegistry
+	allow     []string              // Registry tools to serve (empty serves all that need no confirmation)
+	extra     map[string]tools.Tool // Tools served but not registered in the agent
+	resources *tools.RestrictedFS
+
+	writeMu sync.Mutex
+}
+
+// NewServer creates a server for the tools of a registry
+func NewServer(name, version string, registry *tools.ToolRegistry) *Server {
+	return &Server{
+		info:     Implementation{Name: name, Version: version},
+		registry: registry,
+		extra:    make(map[string]tools.Tool),
+	}
+}
+
+// AllowTools limits the registry tools served to the given names. Tools that
+// need confirmation are only served when named here: the MCP client is then
+// trusted to ask its user, and their calls run as confirmed.
+func (s *Server) AllowTools(names []string) {
+	s.allow = names
+}
+
+// AddTool serves a tool that is not part of the registry
+func (s *Server) AddTool(tool tools.Tool) {
+	s.extra[tool.GetName()] = tool
+}
+
+// SetResources serves the documents under a restricted filesystem as resources
+func (s *Server) SetResources(rfs *tools.RestrictedFS) {
+	s.resources = rfs
+}
+
+// Serve reads newline-delimited JSON-RPC messages from r and writes the
+// responses to w until r ends or the context is cancelled. Requests run
+// concurrently, so a slow tool does not block pings or other calls.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for ctx.Err() == nil {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			wg.Add(1)
+			go func(line []byte) {
+				defer wg.Done()
+				if resp := s.handleLine(ctx, line); resp != nil {
+					s.write(w, resp)
+				}
+			}(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// write sends one response (or batch) per line
+func (s *Server) write(w io.Writer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	w.Write(append(data, '\n'))
+}
+
+// handleLine decodes a message or a batch and returns what to write back, or nil
+func (s *Server) handleLine(ctx context.Context, line []byte) interface{} {
+	if line[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(line, &batch); err != nil {
+			return NewErrorResponse(nil, CodeParseError, "parse error: "+err.Error())
+		}
+		if len(batch) == 0 {
+			return NewErrorResponse(nil, CodeInvalidRequest, "empty batch")
+		}
+		var responses []*Message
+		for _, raw := range batch {
+			if resp := s.handleRaw(ctx, raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return responses
+	}
+	if resp := s.handleRaw(ctx, line); resp != nil {
+		return resp
+	}
+	return nil
+}
+
+func (s *Server) handleRaw(ctx context.Context, raw []byte) *Message {
+	var msg Message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return NewErrorResponse(nil, CodeParseError, "parse error: "+err.Error())
+	}
+	if msg.JSONRPC != "2.0" || (msg.Method == "" && !msg.IsResponse()) {
+		return NewErrorResponse(msg.ID, CodeInvalidRequest, "invalid request")
+	}
+	if !msg.IsRequest() {
+		return nil // Notifications and responses need no answer
+	}
+	return s.Handle(ctx, &msg)
+}
+
+// Handle answers a request
+func (s *Server) Handle(ctx context.Context, msg *Message) *Message {
+	var result interface{}
+	var rpcErr *RPCError
+
+	switch msg.Method {
+	case "initialize":
+		result = s.initialize()
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result = ListToolsResult{Tools: s.listTools(ctx)}
+	case "tools/call":
+		result, rpcErr = s.callTool(ctx, msg.Params)
+	case "resources/list":
+		result, rpcErr = s.listResources(msg.Params)
+	case "resources/read":
+		result, rpcErr = s.readResource(msg.Params)
+	default:
+		rpcErr = &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+
+	if rpcErr != nil {
+		resp := NewErrorResponse(msg.ID, rpcErr.Code, rpcErr.Message)
+		resp.Error.Data = rpcErr.Data
+		return resp
+	}
+	resp, err := NewResponse(msg.ID, result)
+	if err != nil {
+		return NewErrorResponse(msg.ID, CodeInternalError, err.Error())
+	}
+	return resp
+}
+
+func (s *Server) initialize() InitializeResult {
+	result := InitializeResult{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{}},
+		ServerInfo:      s.info,
+	}
+	if s.resources != nil {
+		result.Capabilities.Resources = &ListChangedCapability{}
+	}
+	return result
+}
+
+// servedTool returns a served tool by name
+func (s *Server) servedTool(name string) (tools.Tool, bool) {
+	if tool, ok := s.extra[name]; ok {
+		return tool, true
+	}
+	if !allowed(s.allow, name) {
+		return nil, false
+	}
+	tool, ok := s.registry.GetTool(name)
+	if !ok || (tool.RequiresConfirmation() && !s.named(name)) {
+		return nil, false
+	}
+	return tool, true
+}
+
+// named reports whether AllowTools named the tool explicitly
+func (s *Server) named(name string) bool {
+	return len(s.allow) > 0 && allowed(s.allow, name)
+}
+
+// listTools returns the available tools, sorted by name
+func (s *Server) listTools(ctx context.Context) []Tool {
+	var list []Tool
+	add := func(tool tools.Tool) {
+		def := tool.GetFunctionDefinition()
+		list = append(list, Tool{Name: def.Name, Description: def.Description, InputSchema: def.Parameters})
+	}
+	for _, info := range s.registry.ListAvailableTools(ctx) {
+		if _, shadowed := s.extra[info.Name]; shadowed || !allowed(s.allow, info.Name) {
+			continue
+		}
+		if tool, ok := s.servedTool(info.Name); ok {
+			add(tool)
+		}
+	}
+	for _, tool := range s.extra {
+		if tool.IsAvailable(ctx) {
+			add(tool)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// callTool runs a tool. Unknown tools and malformed parameters are protocol
+// errors; failures of the tool itself are results with isError set, so the
+// client model can read them.
+func (s *Server) callTool(ctx context.Context, raw json.RawMessage) (*CallToolResult, *RPCError) {
+	var params CallToolParams
+	if err := json.Unmarshal(raw, &params); err != nil || params.Name == "" {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "tools/call needs a tool name"}
+	}
+	tool, ok := s.servedTool(params.Name)
+	if !ok {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	if params.Arguments == nil {
+		params.Arguments = map[string]interface{}{}
+	}
+
+	var result *tools.ToolResult
+	var err error
+	if _, isExtra := s.extra[params.Name]; isExtra {
+		result, err = tool.Execute(ctx, params.Arguments)
+	} else {
+		// Calls that need confirmation, such as a POST through http_request, only
+		// run for tools named explicitly, whose client asks its user
+		if tools.NeedsConfirmation(tool, params.Arguments) && !s.named(params.Name) {
+			return errorResult(fmt.Sprintf("%s needs confirmation for this call and is not explicitly allowed on this server", params.Name)), nil
+		}
+		result, err = s.registry.ExecuteTool(ctx, tools.ToolExecution{
+			ToolName:   params.Name,
+			Parameters: params.Arguments,
+			Confirmed:  true,
+			Timestamp:  time.Now(),
+		})
+	}
+	if err != nil {
+		return errorResult(err.Error()), nil
+	}
+	if !result.Success {
+		message := result.Error
+		if result.Message != "" {
+			message = result.Message + ": " + result.Error
+		}
+		return errorResult(message), nil
+	}
+	return &CallToolResult{Content: []Content{{Type: "text", Text: resultText(result)}}}, nil
+}
+
+func errorResult(message string) *CallToolResult {
+	return &CallToolResult{Content: []Content{{Type: "text", Text: message}}, IsError: true}
+}
+
+// resultText picks the text of a tool result: file contents when the tool
+// returns them, else the message, else the data as JSON. Sources are listed at
+// the end so clients can cite them.
+func resultText(result *tools.ToolResult) string {
+	text := result.Message
+	if data, ok := result.Data.(map[string]interface{}); ok {
+		if content, ok := data["content"].(string); ok {
+			text = content
+		}
+	}
+	if text == "" && result.Data != nil {
+		if data, err := json.MarshalIndent(result.Data, "", "  "); err == nil {
+			text = string(data)
+		}
+	}
+	if len(result.Sources) > 0 {
+		var b strings.Builder
+		b.WriteString(text)
+		b.WriteString("\n\nSources:\n")
+		for _, source := range result.Sources {
+			fmt.Fprintf(&b, "- %s%s", resourceScheme, source.Path)
+			if source.Title != "" {
+				fmt.Fprintf(&b, " (%s)", source.Title)
+			}
+			b.WriteString("\n")
+		}
+		text = b.String()
+	}
+	return text
+}
+
+// listResources returns a page of the documents under the resource root
+func (s *Server) listResources(raw json.RawMessage) (*ListResourcesResult, *RPCError) {
+	if s.resources == nil {
+		return &ListResourcesResult{Resources: []Resource{}}, nil
+	}
+	var params PaginatedParams
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+		}
+	}
+	offset := 0
+	if params.Cursor != "" {
+		n, err := strconv.Atoi(params.Cursor)
+		if err != nil || n < 0 {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: "invalid cursor"}
+		}
+		offset = n
+	}
+
+	var resources []Resource
+	err := s.resources.Walk(".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		if entry.IsDir() {
+			if name != "." && strings.HasPrefix(entry.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		resource := Resource{URI: resourceScheme + name, Name: name, MimeType: mimeType(name)}
+		if info, err := entry.Info(); err == nil {
+			resource.Size = info.Size()
+		}
+		resources = append(resources, resource)
+		return nil
+	})
+	if err != nil {
+		return nil, &RPCError{Code: CodeInternalError, Message: err.Error()}
+	}
+
+	result := &ListResourcesResult{Resources: []Resource{}}
+	if offset < len(resources) {
+		end := offset + resourcePageSize
+		if end < len(resources) {
+			result.NextCursor = strconv.Itoa(end)
+		} else {
+			end = len(resources)
+		}
+		result.Resources = resources[offset:end]
+	}
+	return result, nil
+}
+
+// readResource returns the contents of a document
+func (s *Server) readResource(raw json.RawMessage) (*ReadResourceResult, *RPCError) {
+	var params ReadResourceParams
+	if err := json.Unmarshal(raw, &params); err != nil || params.URI == "" {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "resources/read needs a uri"}
+	}
+	notFound := &RPCError{Code: CodeResourceNotFound, Message: "resource not found", Data: map[string]string{"uri": params.URI}}
+	if s.resources == nil || !strings.HasPrefix(params.URI, resourceScheme) {
+		return nil, notFound
+	}
+
+	name := path.Clean(strings.TrimPrefix(params.URI, resourceScheme))
+	data, err := fs.ReadFile(s.resources, name)
+	if err != nil {
+		return nil, notFound
+	}
+
+	contents := ResourceContents{URI: params.URI, MimeType: mimeType(name)}
+	if isText(contents.MimeType, data) {
+		contents.Text = string(data)
+	} else {
+		contents.Blob = base64.StdEncoding.EncodeToString(data)
+	}
+	return &ReadResourceResult{Contents: []ResourceContents{contents}}, nil
+}
+
+// mimeType guesses the type of a document from its extension
+func mimeType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md":
+		return "text/markdown"
+	case ".txt", "":
+		return "text/plain"
+	}
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func isText(mimeType string, data []byte) bool {
+	if strings.HasPrefix(mimeType, "text/") || strings.HasSuffix(mimeType, "json") || strings.HasSuffix(mimeType, "xml") {
+		return true
+	}
+	return !bytes.ContainsRune(data[:min(len(data), 512)], 0)
+}
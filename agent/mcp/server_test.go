@@ -0,0 +1,74 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+func TestServerConfirmationTools(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer api.Close()
+
+	root, err := tools.NewRestrictedFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := tools.NewToolRegistry()
+	registry.RegisterTool(tools.NewCalculateTool())
+	registry.RegisterTool(tools.NewFileWriteTool([]*tools.RestrictedFS{root}))
+	registry.RegisterTool(tools.NewHTTPRequestTool(tools.NewAPIClient(map[string]string{"api": api.URL}, config.HTTPConfig{}), []string{"POST"}))
+
+	listed := func(s *Server) string {
+		var names []string
+		for _, tool := range s.listTools(context.Background()) {
+			names = append(names, tool.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	call := func(s *Server, name string, args map[string]interface{}) *CallToolResult {
+		raw, _ := json.Marshal(CallToolParams{Name: name, Arguments: args})
+		result, rpcErr := s.callTool(context.Background(), raw)
+		if rpcErr != nil {
+			return &CallToolResult{IsError: true, Content: []Content{{Type: "text", Text: rpcErr.Message}}}
+		}
+		return result
+	}
+	post := map[string]interface{}{"method": "POST", "url": api.URL + "/items"}
+	write := map[string]interface{}{"path": "out.txt", "content": "x"}
+
+	// Without -tools, tools that need confirmation are left out
+	s := NewServer("test", "1", registry)
+	if got := listed(s); got != "calculate,http_request" {
+		t.Errorf("served tools = %s, want calculate,http_request", got)
+	}
+	if result := call(s, "file_write", write); !result.IsError {
+		t.Error("file_write ran without being allowed")
+	}
+	if result := call(s, "http_request", post); !result.IsError || !strings.Contains(result.Content[0].Text, "needs confirmation") {
+		t.Errorf("POST ran without being allowed: %+v", result)
+	}
+	if result := call(s, "http_request", map[string]interface{}{"url": api.URL + "/items"}); result.IsError {
+		t.Errorf("GET failed: %+v", result)
+	}
+
+	// Named tools are served and their calls run as confirmed
+	s.AllowTools([]string{"file_write", "http_request"})
+	if got := listed(s); got != "file_write,http_request" {
+		t.Errorf("served tools = %s, want file_write,http_request", got)
+	}
+	if result := call(s, "file_write", write); result.IsError {
+		t.Errorf("file_write failed: %+v", result)
+	}
+	if result := call(s, "http_request", post); result.IsError {
+		t.Errorf("POST failed: %+v", result)
+	}
+}
@@ -0,0 +1,266 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+const maxToolNameLength = 64 // Longest function name the LLM APIs accept
+
+// RemoteTool exposes a tool of an MCP server as a tools.Tool. Calls are proxied
+// with tools/call.
+type RemoteTool struct {
+	name    string
+	remote  Tool
+	client  *Client
+	confirm bool
+}
+
+// NewRemoteTool adapts a server tool, registering it under name
+func NewRemoteTool(name string, remote Tool, client *Client, confirm bool) *RemoteTool {
+	return &RemoteTool{name: name, remote: remote, client: client, confirm: confirm}
+}
+
+// GetName returns the registered name (the server prefix plus the remote name)
+func (t *RemoteTool) GetName() string {
+	return t.name
+}
+
+// GetDescription returns the description given by the server
+func (t *RemoteTool) GetDescription() string {
+	if t.remote.Description == "" {
+		return fmt.Sprintf("%s tool from the %s MCP server", t.remote.Name, t.client.Name())
+	}
+	return t.remote.Description
+}
+
+// GetParameterSchema converts the input schema to a ParameterSchema. Keywords
+// it cannot hold are kept by GetFunctionDefinition, which sends the raw schema.
+func (t *RemoteTool) GetParameterSchema() *tools.ParameterSchema {
+	schema := &tools.ParameterSchema{Type: "object"}
+	if data, err := json.Marshal(t.inputSchema()); err == nil {
+		json.Unmarshal(data, schema)
+	}
+	return schema
+}
+
+// GetFunctionDefinition sends the server input schema unchanged
+func (t *RemoteTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return llm.FunctionDefinition{
+		Name:        t.name,
+		Description: t.GetDescription(),
+		Parameters:  t.inputSchema(),
+	}
+}
+
+func (t *RemoteTool) inputSchema() map[string]interface{} {
+	schema := make(map[string]interface{}, len(t.remote.InputSchema)+1)
+	for key, value := range t.remote.InputSchema {
+		schema[key] = value
+	}
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	if _, ok := schema["properties"]; !ok {
+		schema["properties"] = map[string]interface{}{}
+	}
+	return schema
+}
+
+// Execute calls the tool on the server. Failures reported by the tool (isError)
+// are returned as unsuccessful results so the model can read them.
+func (t *RemoteTool) Execute(ctx context.Context, params map[string]interface{}) (*tools.ToolResult, error) {
+	start := time.Now()
+	result, err := t.client.CallTool(ctx, t.remote.Name, params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.name, err)
+	}
+
+	text := result.Text()
+	toolResult := &tools.ToolResult{
+		Success:   !result.IsError,
+		Data:      result.Content,
+		Message:   text,
+		Timestamp: time.Now(),
+		Duration:  time.Since(start),
+		Metadata: map[string]interface{}{
+			"mcp_server": t.client.Name(),
+			"mcp_tool":   t.remote.Name,
+		},
+	}
+	if result.IsError {
+		toolResult.Error = text
+		if toolResult.Error == "" {
+			toolResult.Error = "tool reported an error"
+		}
+	}
+	return toolResult, nil
+}
+
+// IsAvailable reports whether the server is connected
+func (t *RemoteTool) IsAvailable(ctx context.Context) bool {
+	return t.client.Connected()
+}
+
+// GetCategory returns CategoryAPI: the tool runs in another process or service
+func (t *RemoteTool) GetCategory() tools.ToolCategory {
+	return tools.CategoryAPI
+}
+
+// RequiresConfirmation returns the confirm setting of the server
+func (t *RemoteTool) RequiresConfirmation() bool {
+	return t.confirm
+}
+
+// GetEstimatedCost returns a medium cost, as the work done remotely is unknown
+func (t *RemoteTool) GetEstimatedCost() int {
+	return 30
+}
+
+// Manager connects the configured MCP servers and keeps their tools registered
+type Manager struct {
+	cfg      config.MCPConfig
+	registry *tools.ToolRegistry
+
+	mu         sync.Mutex
+	clients    map[string]*Client
+	registered map[string][]string // Server name -> registered tool names
+}
+
+// NewManager creates a manager for the servers in the configuration
+func NewManager(cfg config.MCPConfig, registry *tools.ToolRegistry) *Manager {
+	return &Manager{
+		cfg:        cfg,
+		registry:   registry,
+		clients:    make(map[string]*Client),
+		registered: make(map[string][]string),
+	}
+}
+
+// Start connects the enabled servers and registers their tools. A server that
+// cannot be reached is logged and retried in the background, so one bad
+// server does not stop the agent.
+func (m *Manager) Start(ctx context.Context) {
+	names := make([]string, 0, len(m.cfg.Servers))
+	for name, server := range m.cfg.Servers {
+		if server.Enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		server := m.cfg.Servers[name]
+		client := NewClient(name, server)
+		client.OnToolsChanged(func(remote []Tool) { m.sync(client, remote) })
+
+		m.mu.Lock()
+		m.clients[name] = client
+		m.mu.Unlock()
+
+		if err := client.Connect(ctx); err != nil {
+			log.Printf("Warning: MCP server %s unavailable, retrying in background: %v", name, err)
+			client.Reconnect()
+			continue
+		}
+		count := m.sync(client, client.Tools())
+		log.Printf("MCP server %s connected with %d tools", name, count)
+	}
+}
+
+// Clients returns the clients by server name
+func (m *Manager) Clients() map[string]*Client {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clients := make(map[string]*Client, len(m.clients))
+	for name, client := range m.clients {
+		clients[name] = client
+	}
+	return clients
+}
+
+// sync replaces the registered tools of a server with its current list and
+// returns how many were registered
+func (m *Manager) sync(client *Client, remote []Tool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := client.Name()
+	server := m.cfg.Servers[name]
+	for _, toolName := range m.registered[name] {
+		m.registry.UnregisterTool(toolName)
+	}
+
+	var registered []string
+	for _, tool := range remote {
+		if !allowed(server.Tools, tool.Name) {
+			continue
+		}
+		registeredName := toolName(name, server.ToolPrefix, tool.Name)
+		if err := m.registry.RegisterTool(NewRemoteTool(registeredName, tool, client, server.Confirm)); err != nil {
+			log.Printf("Warning: MCP tool %s not registered: %v", registeredName, err)
+			continue
+		}
+		registered = append(registered, registeredName)
+	}
+	m.registered[name] = registered
+	return len(registered)
+}
+
+// Close disconnects every server and unregisters its tools
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, client := range m.clients {
+		client.Close()
+		for _, toolName := range m.registered[name] {
+			m.registry.UnregisterTool(toolName)
+		}
+		delete(m.registered, name)
+	}
+	return nil
+}
+
+// allowed reports whether a tool passes the server allow list (empty allows all)
+func allowed(list []string, name string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, entry := range list {
+		if entry == name {
+			return true
+		}
+	}
+	return false
+}
+
+// toolName builds the registered name: the prefix (by default the server name
+// and "_") plus the remote name, restricted to the characters and length the
+// LLM APIs accept for function names
+func toolName(server, prefix, remote string) string {
+	if prefix == "" {
+		prefix = server + "_"
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, prefix+remote)
+	if len(name) > maxToolNameLength {
+		name = name[:maxToolNameLength]
+	}
+	return name
+}
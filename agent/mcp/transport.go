@@ -0,0 +1,364 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+)
+
+// transport carries JSON-RPC messages to a server. Incoming messages are passed
+// to the receive function given when the transport starts, and lost is called
+// once if the connection drops.
+type transport interface {
+	send(ctx context.Context, msg *Message) error
+	close() error
+}
+
+// errConnectionLost marks failures that need a reconnection
+var errConnectionLost = errors.New("connection to MCP server lost")
+
+// startTransport opens the transport described by the server configuration
+func startTransport(name string, cfg config.MCPServerConfig, receive func(*Message), lost func(error)) (transport, error) {
+	switch {
+	case cfg.Command != "":
+		return startStdio(name, cfg, receive, lost)
+	case cfg.URL != "":
+		return newHTTPTransport(cfg, receive, lost), nil
+	default:
+		return nil, fmt.Errorf("MCP server %s needs a command or a url", name)
+	}
+}
+
+// stdioTransport talks to a server process with one JSON message per line
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	mu     sync.Mutex
+	exited chan struct{}
+}
+
+func startStdio(name string, cfg config.MCPServerConfig, receive func(*Message), lost func(error)) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stderr = &prefixWriter{prefix: "MCP " + name + ": "}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", name, err)
+	}
+
+	t := &stdioTransport{cmd: cmd, stdin: stdin, exited: make(chan struct{})}
+	go func() {
+		reader := bufio.NewReaderSize(stdout, 64*1024)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				var msg Message
+				if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+					log.Printf("MCP %s: ignoring invalid message: %v", name, jsonErr)
+				} else {
+					receive(&msg)
+				}
+			}
+			if err != nil {
+				waitErr := cmd.Wait()
+				close(t.exited)
+				if waitErr == nil {
+					waitErr = err
+				}
+				lost(fmt.Errorf("%w: %v", errConnectionLost, waitErr))
+				return
+			}
+		}
+	}()
+	return t, nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", errConnectionLost, err)
+	}
+	return nil
+}
+
+// close ends the session by closing stdin, then kills the server if it does not exit
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	select {
+	case <-t.exited:
+	case <-time.After(2 * time.Second):
+		t.cmd.Process.Kill()
+		<-t.exited
+	}
+	return nil
+}
+
+// httpTransport posts messages to a streamable HTTP endpoint. Responses come
+// back as JSON or as a server-sent event stream; server notifications arrive on
+// a GET event stream opened once the session starts.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	receive func(*Message)
+	lost    func(error)
+
+	mu        sync.Mutex
+	sessionID string
+	listening bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func newHTTPTransport(cfg config.MCPServerConfig, receive func(*Message), lost func(error)) *httpTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{},
+		receive: receive,
+		lost:    lost,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (t *httpTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("MCP-Protocol-Version", ProtocolVersion)
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+func (t *httpTransport) send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errConnectionLost, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && req.Header.Get("Mcp-Session-Id") != "" {
+		// The server forgot the session: start a new one
+		t.lost(fmt.Errorf("%w: session expired", errConnectionLost))
+		return fmt.Errorf("%w: session expired", errConnectionLost)
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("MCP server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if msg.Method == "notifications/initialized" {
+		t.startListening()
+	}
+
+	switch contentType := resp.Header.Get("Content-Type"); {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		return readEvents(resp.Body, t.receive)
+	case strings.HasPrefix(contentType, "application/json"):
+		return decodeMessages(resp.Body, t.receive)
+	default:
+		return nil // 202 Accepted for notifications and responses
+	}
+}
+
+// startListening opens the GET event stream for server notifications, once per session
+func (t *httpTransport) startListening() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listening {
+		return
+	}
+	t.listening = true
+	go t.listen()
+}
+
+// listen keeps the notification stream open, reopening it after errors. Servers
+// that do not offer the stream answer 405 and are not asked again.
+func (t *httpTransport) listen() {
+	delay := time.Second
+	for t.ctx.Err() == nil {
+		req, err := t.newRequest(t.ctx, http.MethodGet, nil)
+		if err != nil {
+			return
+		}
+		resp, err := t.client.Do(req)
+		if err == nil {
+			if resp.StatusCode == http.StatusMethodNotAllowed {
+				resp.Body.Close()
+				return
+			}
+			if resp.StatusCode < 300 {
+				delay = time.Second
+				readEvents(resp.Body, t.receive)
+			}
+			resp.Body.Close()
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// close ends the session with a DELETE, as the specification asks
+func (t *httpTransport) close() error {
+	t.cancel()
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := t.newRequest(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// decodeMessages reads a JSON message or batch
+func decodeMessages(r io.Reader, receive func(*Message)) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '[' {
+		var batch []*Message
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return fmt.Errorf("invalid MCP response: %w", err)
+		}
+		for _, msg := range batch {
+			receive(msg)
+		}
+		return nil
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("invalid MCP response: %w", err)
+	}
+	receive(&msg)
+	return nil
+}
+
+// readEvents reads a server-sent event stream, one JSON-RPC message per event
+func readEvents(r io.Reader, receive func(*Message)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	flush := func() {
+		if data.Len() == 0 {
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(data.String()), &msg); err == nil {
+			receive(&msg)
+		}
+		data.Reset()
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	flush()
+	return scanner.Err()
+}
+
+// prefixWriter logs the stderr of a server process line by line
+type prefixWriter struct {
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Printf("%s%s", w.prefix, w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
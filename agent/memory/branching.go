@@ -0,0 +1,251 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// MessageNode es un mensaje dentro del árbol de la conversación
+type MessageNode struct {
+	ParentID string      `json:"parent_id,omitempty"`
+	Message  llm.Message `json:"message"`
+}
+
+// BranchInfo describe la posición de un mensaje entre sus alternativas
+type BranchInfo struct {
+	MessageID string   `json:"message_id"`
+	Index     int      `json:"index"`    // Posición del mensaje entre sus hermanos (desde 0)
+	Siblings  []string `json:"siblings"` // IDs de todas las alternativas, en orden de creación
+}
+
+// appendNode añade un mensaje como hijo de la hoja activa y lo convierte en la nueva hoja
+func (cm *ConversationMemory) appendNode(message *llm.Message) {
+	if message.ID == "" {
+		message.ID = generateMessageID(len(cm.Nodes))
+	}
+	cm.Nodes = append(cm.Nodes, MessageNode{ParentID: cm.ActiveLeaf, Message: *message})
+	cm.ActiveLeaf = message.ID
+}
+
+// ensureTree migra sesiones guardadas en formato plano al formato de árbol
+// y reconstruye la rama activa a partir de los nodos
+func (cm *ConversationMemory) ensureTree() {
+	if len(cm.Nodes) == 0 {
+		cm.ActiveLeaf = ""
+		for i := range cm.Messages {
+			cm.appendNode(&cm.Messages[i])
+		}
+		return
+	}
+
+	if cm.ActiveLeaf == "" {
+		cm.ActiveLeaf = cm.Nodes[len(cm.Nodes)-1].Message.ID
+	}
+	cm.rebuildActivePath()
+}
+
+// rebuildActivePath recalcula Messages como el camino desde la raíz hasta la hoja activa
+func (cm *ConversationMemory) rebuildActivePath() {
+	nodes := cm.nodeIndex()
+
+	var path []llm.Message
+	for id := cm.ActiveLeaf; id != ""; {
+		node, ok := nodes[id]
+		if !ok {
+			break
+		}
+		path = append(path, node.Message)
+		id = node.ParentID
+	}
+
+	// Invertir: el recorrido va de la hoja a la raíz
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	cm.Messages = path
+}
+
+// nodeIndex indexa los nodos por ID de mensaje
+func (cm *ConversationMemory) nodeIndex() map[string]*MessageNode {
+	index := make(map[string]*MessageNode, len(cm.Nodes))
+	for i := range cm.Nodes {
+		index[cm.Nodes[i].Message.ID] = &cm.Nodes[i]
+	}
+	return index
+}
+
+// GetMessage devuelve un mensaje del árbol por su ID
+func (cm *ConversationMemory) GetMessage(messageID string) (llm.Message, bool) {
+	node, ok := cm.nodeIndex()[messageID]
+	if !ok {
+		return llm.Message{}, false
+	}
+	return node.Message, true
+}
+
+// RewindTo mueve la hoja activa a un mensaje anterior, de modo que el siguiente
+// mensaje añadido abre una nueva rama. Un ID vacío vuelve a la raíz.
+func (cm *ConversationMemory) RewindTo(messageID string) error {
+	if messageID != "" {
+		if _, ok := cm.nodeIndex()[messageID]; !ok {
+			return fmt.Errorf("message %s not found", messageID)
+		}
+	}
+
+	cm.ActiveLeaf = messageID
+	cm.rebuildActivePath()
+	cm.LastAccess = time.Now()
+	return nil
+}
+
+// SwitchBranch activa la rama que contiene el mensaje indicado, siguiendo
+// siempre la respuesta más reciente a partir de él
+func (cm *ConversationMemory) SwitchBranch(messageID string) error {
+	if _, ok := cm.nodeIndex()[messageID]; !ok {
+		return fmt.Errorf("message %s not found", messageID)
+	}
+
+	cm.ActiveLeaf = cm.newestLeaf(messageID)
+	cm.rebuildActivePath()
+	cm.LastAccess = time.Now()
+	return nil
+}
+
+// Checkpoint es la posición del árbol antes de un turno: los nodos que ya
+// existían y la hoja activa. Se guardan los IDs y no el número de nodos porque
+// la compresión puede eliminar nodos antiguos durante el turno.
+type Checkpoint struct {
+	nodes map[string]bool
+	leaf  string
+}
+
+// Checkpoint guarda la posición actual del árbol para un Rollback posterior
+func (cm *ConversationMemory) Checkpoint() Checkpoint {
+	nodes := make(map[string]bool, len(cm.Nodes))
+	for _, node := range cm.Nodes {
+		nodes[node.Message.ID] = true
+	}
+	return Checkpoint{nodes: nodes, leaf: cm.ActiveLeaf}
+}
+
+// AddedSince indica si se han añadido mensajes desde el checkpoint
+func (cm *ConversationMemory) AddedSince(cp Checkpoint) bool {
+	for _, node := range cm.Nodes {
+		if !cp.nodes[node.Message.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// Rollback descarta los mensajes añadidos desde el checkpoint y reactiva la
+// rama más reciente a partir de su hoja. Así un turno fallido no deja rastro
+// en la memoria y, al regenerar o editar, se recupera la rama anterior.
+func (cm *ConversationMemory) Rollback(cp Checkpoint) {
+	nodes := cm.Nodes[:0]
+	for _, node := range cm.Nodes {
+		if cp.nodes[node.Message.ID] {
+			nodes = append(nodes, node)
+		}
+	}
+	cm.Nodes = nodes
+
+	leaf := cp.leaf
+	if leaf != "" {
+		if _, ok := cm.nodeIndex()[leaf]; !ok {
+			leaf = ""
+		}
+	}
+
+	cm.ActiveLeaf = cm.newestLeaf(leaf)
+	cm.rebuildActivePath()
+}
+
+// newestLeaf sigue siempre el hijo más reciente desde un mensaje hasta una hoja
+func (cm *ConversationMemory) newestLeaf(messageID string) string {
+	leaf := messageID
+	for {
+		children := cm.children(leaf)
+		if len(children) == 0 {
+			return leaf
+		}
+		leaf = children[len(children)-1]
+	}
+}
+
+// GetBranches devuelve las alternativas (hermanos) de un mensaje
+func (cm *ConversationMemory) GetBranches(messageID string) (BranchInfo, error) {
+	node, ok := cm.nodeIndex()[messageID]
+	if !ok {
+		return BranchInfo{}, fmt.Errorf("message %s not found", messageID)
+	}
+
+	siblings := cm.children(node.ParentID)
+	info := BranchInfo{MessageID: messageID, Siblings: siblings}
+	for i, id := range siblings {
+		if id == messageID {
+			info.Index = i
+		}
+	}
+	return info, nil
+}
+
+// children devuelve los IDs de los hijos de un mensaje en orden de creación
+func (cm *ConversationMemory) children(parentID string) []string {
+	var ids []string
+	for _, node := range cm.Nodes {
+		if node.ParentID == parentID {
+			ids = append(ids, node.Message.ID)
+		}
+	}
+	return ids
+}
+
+// Fork crea una nueva sesión con la rama activa hasta el mensaje indicado (incluido)
+func (cm *ConversationMemory) Fork(messageID string) (*ConversationMemory, error) {
+	end := -1
+	for i, msg := range cm.Messages {
+		if msg.ID == messageID {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("message %s is not in the active branch", messageID)
+	}
+
+	fork := NewConversationMemory(cm.StoragePath)
+	fork.Topics = append(fork.Topics, cm.Topics...)
+	fork.UserProfile = cm.UserProfile
+	for _, msg := range cm.Messages[:end+1] {
+		fork.Messages = append(fork.Messages, msg)
+		fork.appendNode(&fork.Messages[len(fork.Messages)-1])
+	}
+
+	return fork, nil
+}
+
+// pruneNodes elimina del árbol los mensajes indicados y todas las ramas que
+// colgaban de ellos. newRoot pasa a ser la raíz del árbol.
+func (cm *ConversationMemory) pruneNodes(removed map[string]bool, newRoot string) {
+	kept := make(map[string]bool, len(cm.Nodes))
+	nodes := cm.Nodes[:0]
+	for _, node := range cm.Nodes {
+		id := node.Message.ID
+		switch {
+		case id == newRoot:
+			node.ParentID = ""
+		case removed[id] || node.ParentID == "" || !kept[node.ParentID]:
+			continue
+		}
+		kept[id] = true
+		nodes = append(nodes, node)
+	}
+	cm.Nodes = nodes
+}
+
+func generateMessageID(seq int) string {
+	return fmt.Sprintf("msg_%d_%d", time.Now().UnixNano(), seq)
+}
@@ -29,6 +29,7 @@ type ContextProvider interface {
 type ContextManager struct {
 	providers []ContextProvider
 	enabled   bool
+	allowed   map[string]bool // Proveedores activos (nil = todos)
 }
 
 // NewContextManager crea un nuevo gestor de contexto
@@ -72,6 +73,9 @@ func (cm *ContextManager) GetContext(query string, session *ConversationMemory)
 		if !provider.IsEnabled() {
 			continue
 		}
+		if cm.allowed != nil && !cm.allowed[provider.GetName()] {
+			continue
+		}
 		
 		if provider.ShouldActivate(query, session) {
 			providerContext := provider.GetContext(query, session)
@@ -111,6 +115,18 @@ func (cm *ContextManager) SetEnabled(enabled bool) {
 	cm.enabled = enabled
 }
 
+// SetAllowedProviders limita el contexto a los proveedores indicados (vacío = todos)
+func (cm *ContextManager) SetAllowedProviders(names []string) {
+	if len(names) == 0 {
+		cm.allowed = nil
+		return
+	}
+	cm.allowed = make(map[string]bool, len(names))
+	for _, name := range names {
+		cm.allowed[name] = true
+	}
+}
+
 // IsEnabled verifica si el gestor está habilitado
 func (cm *ContextManager) IsEnabled() bool {
 	return cm.enabled
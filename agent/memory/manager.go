@@ -20,6 +20,8 @@ type MemoryManager struct {
 	contextManager  *ContextManager
 	maxSessions     int
 	autoSaveEnabled bool
+
+	traceContextMode string // Uso de la traza de herramientas en el contexto (exclude/compact)
 }
 
 // GlobalMemory mantiene información que persiste entre conversaciones
@@ -67,6 +69,26 @@ func NewMemoryManager(storageDir string) *MemoryManager {
 	return mm
 }
 
+// NewEphemeralMemoryManager crea un gestor de memoria que no escribe en disco,
+// usado para ejecuciones auxiliares como los sub-agentes
+func NewEphemeralMemoryManager() *MemoryManager {
+	mm := &MemoryManager{
+		contextManager:  NewContextManager(),
+		autoSaveEnabled: false,
+		globalMemory: &GlobalMemory{
+			UserProfiles:    make(map[string]UserProfile),
+			ClubDatabase:    make(map[string]ClubInfo),
+			CommonPatterns:  make([]Pattern, 0),
+			LastUpdated:     time.Now(),
+			PreferredTopics: make([]string, 0),
+		},
+	}
+
+	mm.registerDefaultProviders()
+
+	return mm
+}
+
 // registerDefaultProviders registra los proveedores de contexto por defecto
 func (mm *MemoryManager) registerDefaultProviders() {
 	// Sistema: fecha/hora, versión, etc.
@@ -134,6 +156,28 @@ func (mm *MemoryManager) LoadSession(sessionID string) (*ConversationMemory, err
 	return session, nil
 }
 
+// ForkSession crea una nueva sesión a partir de la rama activa hasta el mensaje
+// indicado y la convierte en la sesión actual
+func (mm *MemoryManager) ForkSession(messageID string) (*ConversationMemory, error) {
+	if mm.currentSession == nil {
+		return nil, fmt.Errorf("no active session")
+	}
+
+	fork, err := mm.currentSession.Fork(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fork.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save forked session: %w", err)
+	}
+
+	mm.currentSession = fork
+	mm.globalMemory.TotalSessions++
+
+	return fork, nil
+}
+
 // DeleteSession deletes a session by session ID
 func (mm *MemoryManager) DeleteSession(sessionID string) error {
 	// Clear current session if it's the one being deleted
@@ -200,6 +244,11 @@ func (mm *MemoryManager) GetContextForQuery(query string, maxTokens int) []llm.M
 		contextualMessages = append([]llm.Message{systemMessage}, contextualMessages...)
 	}
 
+	// Añadir la traza compacta de herramientas si está habilitada
+	if traceMessage, ok := mm.traceContextMessage(); ok {
+		contextualMessages = append([]llm.Message{traceMessage}, contextualMessages...)
+	}
+
 	// Obtener contexto de los proveedores pluggables
 	providerContext := mm.contextManager.GetContext(query, mm.currentSession)
 	
@@ -235,7 +284,7 @@ func (mm *MemoryManager) ListSessions() ([]SessionSummary, error) {
 			SessionID:    sessionID,
 			StartTime:    session.StartTime,
 			Duration:     duration.Truncate(time.Second).String(),
-			MessageCount: len(session.Messages),
+			MessageCount: len(session.ConversationMessages()),
 			Topics:       session.Topics,
 			Summary:      session.GetSummary(),
 		}
@@ -269,7 +318,7 @@ func (mm *MemoryManager) SearchConversations(query string, limit int) ([]SearchR
 		}
 
 		// Buscar en mensajes
-		for _, message := range fullSession.Messages {
+		for _, message := range fullSession.ConversationMessages() {
 			content := strings.ToLower(message.Content)
 			relevance := 0
 
@@ -285,7 +334,7 @@ func (mm *MemoryManager) SearchConversations(query string, limit int) ([]SearchR
 					Message:   message,
 					Relevance: float64(relevance) / float64(len(queryWords)),
 					Timestamp: session.StartTime, // Aproximación
-					Context:   mm.extractContext(fullSession.Messages, message),
+					Context:   mm.extractContext(fullSession.ConversationMessages(), message),
 				}
 				results = append(results, result)
 			}
@@ -409,6 +458,11 @@ func (mm *MemoryManager) SetContextManagerEnabled(enabled bool) {
 	mm.contextManager.SetEnabled(enabled)
 }
 
+// SetContextProviders limita el contexto a los proveedores indicados (vacío = todos)
+func (mm *MemoryManager) SetContextProviders(names []string) {
+	mm.contextManager.SetAllowedProviders(names)
+}
+
 // Métodos privados
 
 func (mm *MemoryManager) loadGlobalMemory() error {
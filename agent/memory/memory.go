@@ -20,7 +20,9 @@ type ConversationMemory struct {
 	SessionID       string                `json:"session_id"`
 	StartTime       time.Time             `json:"start_time"`
 	LastAccess      time.Time             `json:"last_access"`
-	Messages        []llm.Message         `json:"messages"`
+	Messages        []llm.Message         `json:"messages"`              // Rama activa del árbol de mensajes
+	Nodes           []MessageNode         `json:"nodes,omitempty"`       // Árbol completo de mensajes (ediciones y regeneraciones)
+	ActiveLeaf      string                `json:"active_leaf,omitempty"` // ID del último mensaje de la rama activa
 	Summary         string                `json:"summary"`
 	Topics          []string              `json:"topics"`
 	KeyFacts        []KeyFact             `json:"key_facts"`
@@ -29,6 +31,28 @@ type ConversationMemory struct {
 	CompressAfter   int                   `json:"compress_after"`
 	StoragePath     string                `json:"-"`
 	SemanticMemory  *SemanticMemory       `json:"semantic_memory"`  // Enhanced semantic memory
+	Usage           SessionUsage          `json:"usage"`            // Consumo acumulado para los presupuestos
+	Profile         string                `json:"profile,omitempty"` // Perfil de agente de la sesión
+}
+
+// SessionUsage consumo acumulado de una conversación, incluidos los turnos fallidos
+type SessionUsage struct {
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	TotalTokens      int           `json:"total_tokens"`
+	Cost             float64       `json:"cost"`            // Coste estimado en USD
+	ProcessingTime   time.Duration `json:"processing_time"` // Tiempo acumulado procesando turnos
+	ToolCalls        int           `json:"tool_calls"`
+}
+
+// Add suma otro consumo a este
+func (u *SessionUsage) Add(other SessionUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.Cost += other.Cost
+	u.ProcessingTime += other.ProcessingTime
+	u.ToolCalls += other.ToolCalls
 }
 
 // KeyFact representa un hecho importante extraído de la conversación
@@ -106,13 +130,23 @@ func LoadConversationMemory(sessionID string, storagePath string) (*Conversation
 		memory.SemanticMemory = NewSemanticMemory()
 	}
 	
+	// Migrar sesiones en formato plano y reconstruir la rama activa
+	memory.ensureTree()
+	
 	return &memory, nil
 }
 
 // AddMessage añade un mensaje a la memoria
 func (cm *ConversationMemory) AddMessage(message llm.Message) {
+	cm.appendNode(&message)
 	cm.Messages = append(cm.Messages, message)
 	cm.LastAccess = time.Now()
+
+	// La traza de herramientas solo se guarda, no se analiza
+	if message.Trace {
+		return
+	}
+
 	cm.UserProfile.Interactions++
 	
 	// Extraer información si es mensaje del usuario
@@ -129,15 +163,19 @@ func (cm *ConversationMemory) AddMessage(message llm.Message) {
 	}
 }
 
-// GetRecentMessages obtiene los mensajes más recientes
+// GetRecentMessages obtiene los últimos count mensajes de la conversación con
+// la traza de herramientas que haya entre ellos, que no cuenta
 func (cm *ConversationMemory) GetRecentMessages(count int) []llm.Message {
 	if count <= 0 || len(cm.Messages) == 0 {
 		return []llm.Message{}
 	}
 	
-	start := len(cm.Messages) - count
-	if start < 0 {
-		start = 0
+	start := len(cm.Messages)
+	for seen := 0; start > 0 && seen < count; {
+		start--
+		if !cm.Messages[start].Trace {
+			seen++
+		}
 	}
 	
 	return cm.Messages[start:]
@@ -145,13 +183,15 @@ func (cm *ConversationMemory) GetRecentMessages(count int) []llm.Message {
 
 // GetContextualMessages obtiene mensajes relevantes para una query usando memoria semántica
 func (cm *ConversationMemory) GetContextualMessages(query string, maxCount int) []llm.Message {
-	if len(cm.Messages) == 0 {
+	// Tool-call trace is never used as context directly
+	conversation := cm.ConversationMessages()
+	if len(conversation) == 0 {
 		return []llm.Message{}
 	}
 	
 	// Get recent messages (always include some recent context)
 	recentCount := maxCount / 3
-	recentMessages := cm.GetRecentMessages(recentCount)
+	recentMessages := conversation[max(len(conversation)-recentCount, 0):]
 	
 	// Get semantically relevant facts
 	relevantFacts := cm.SemanticMemory.GetRelevantFacts(query, 10)
@@ -160,7 +200,7 @@ func (cm *ConversationMemory) GetContextualMessages(query string, maxCount int)
 	factBasedMessages := make([]llm.Message, 0)
 	for _, fact := range relevantFacts {
 		// Find messages that contain this fact's content
-		for _, message := range cm.Messages {
+		for _, message := range conversation {
 			if strings.Contains(strings.ToLower(message.Content), strings.ToLower(fact.Content[:min(len(fact.Content), 50)])) {
 				factBasedMessages = append(factBasedMessages, message)
 				if len(factBasedMessages) >= maxCount/2 {
@@ -178,8 +218,8 @@ func (cm *ConversationMemory) GetContextualMessages(query string, maxCount int)
 		queryWords := strings.Fields(strings.ToLower(query))
 		keywordMessages := make([]llm.Message, 0)
 		
-		for i := len(cm.Messages) - 1; i >= 0 && len(keywordMessages) < maxCount/2; i-- {
-			message := cm.Messages[i]
+		for i := len(conversation) - 1; i >= 0 && len(keywordMessages) < maxCount/2; i-- {
+			message := conversation[i]
 			content := strings.ToLower(message.Content)
 			
 			relevance := 0
@@ -221,7 +261,7 @@ func (cm *ConversationMemory) GetSummary() string {
 	userMessages := 0
 	assistantMessages := 0
 	
-	for _, msg := range cm.Messages {
+	for _, msg := range cm.ConversationMessages() {
 		if msg.Role == "user" {
 			userMessages++
 		} else if msg.Role == "assistant" {
@@ -333,22 +373,43 @@ func (cm *ConversationMemory) Save() error {
 
 // compressIfNeeded comprime la conversación si es muy larga
 func (cm *ConversationMemory) compressIfNeeded() {
-	if len(cm.Messages) <= cm.MaxMessages {
+	// La traza de herramientas no cuenta para el límite
+	conversationCount := len(cm.ConversationMessages())
+	if conversationCount <= cm.MaxMessages {
 		return
 	}
 	
-	// Mantener los últimos 30 mensajes
+	// Mantener los últimos 30 mensajes de conversación (con su traza)
 	keepRecent := 30
-	if keepRecent > len(cm.Messages) {
-		keepRecent = len(cm.Messages)
+	if keepRecent > conversationCount {
+		keepRecent = conversationCount
+	}
+	
+	cut := 0
+	for seen := 0; cut < len(cm.Messages); cut++ {
+		if !cm.Messages[cut].Trace {
+			if seen == conversationCount-keepRecent {
+				break
+			}
+			seen++
+		}
 	}
 	
 	// Extraer información importante de mensajes antiguos
-	oldMessages := cm.Messages[:len(cm.Messages)-keepRecent]
+	oldMessages := cm.Messages[:cut]
 	cm.extractKeyInformation(oldMessages)
 	
+	// Eliminar del árbol los mensajes antiguos y las ramas que salían de ellos
+	removed := make(map[string]bool, cut)
+	for _, msg := range oldMessages {
+		removed[msg.ID] = true
+	}
+	
 	// Mantener solo mensajes recientes
-	cm.Messages = cm.Messages[len(cm.Messages)-keepRecent:]
+	cm.Messages = cm.Messages[cut:]
+	if len(cm.Messages) > 0 {
+		cm.pruneNodes(removed, cm.Messages[0].ID)
+	}
 	
 	// Actualizar resumen
 	cm.updateSummary()
@@ -423,7 +484,7 @@ func (cm *ConversationMemory) GenerateAISummary(ctx context.Context, llmProvider
 
 	// Format messages for the prompt
 	var messageTexts []string
-	for _, msg := range cm.Messages {
+	for _, msg := range cm.ConversationMessages() {
 		if msg.Role == "system" {
 			continue // Skip system messages in summary
 		}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// Modos de uso de la traza de herramientas en el contexto de futuras consultas
+const (
+	TraceContextExclude = "exclude" // La traza se guarda pero no se envía al LLM
+	TraceContextCompact = "compact" // Se envía un resumen compacto de las llamadas a herramientas
+)
+
+const (
+	compactTraceMaxCalls   = 10  // Máximo de llamadas incluidas en el resumen compacto
+	compactTracePreviewLen = 200 // Caracteres máximos del resultado mostrado por llamada
+)
+
+// ConversationMessages devuelve los mensajes de la conversación sin la traza de herramientas
+func (cm *ConversationMemory) ConversationMessages() []llm.Message {
+	messages := make([]llm.Message, 0, len(cm.Messages))
+	for _, msg := range cm.Messages {
+		if !msg.Trace {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// TraceMessages devuelve solo los mensajes intermedios de llamadas a herramientas
+func (cm *ConversationMemory) TraceMessages() []llm.Message {
+	var messages []llm.Message
+	for _, msg := range cm.Messages {
+		if msg.Trace {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// CompactTrace resume las últimas llamadas a herramientas en un único texto,
+// emparejando cada llamada con un extracto de su resultado
+func CompactTrace(trace []llm.Message, maxCalls int) string {
+	results := make(map[string]string)
+	for _, msg := range trace {
+		if msg.Role == "tool" && msg.ToolCallID != "" {
+			results[msg.ToolCallID] = msg.Content
+		}
+	}
+
+	var lines []string
+	for _, msg := range trace {
+		for _, call := range msg.ToolCalls {
+			preview := strings.Join(strings.Fields(results[call.ID]), " ")
+			if runes := []rune(preview); len(runes) > compactTracePreviewLen {
+				preview = string(runes[:compactTracePreviewLen]) + "..."
+			}
+			lines = append(lines, fmt.Sprintf("- %s %s → %s", call.Function.Name, call.Function.Arguments, preview))
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	if maxCalls > 0 && len(lines) > maxCalls {
+		lines = lines[len(lines)-maxCalls:]
+	}
+
+	return "Tool calls made earlier in this conversation:\n" + strings.Join(lines, "\n")
+}
+
+// SetTraceContextMode define cómo se usa la traza de herramientas en el contexto
+func (mm *MemoryManager) SetTraceContextMode(mode string) {
+	mm.traceContextMode = mode
+}
+
+// traceContextMessage devuelve el mensaje de sistema con la traza compacta, si procede
+func (mm *MemoryManager) traceContextMessage() (llm.Message, bool) {
+	if mm.traceContextMode != TraceContextCompact || mm.currentSession == nil {
+		return llm.Message{}, false
+	}
+
+	compact := CompactTrace(mm.currentSession.TraceMessages(), compactTraceMaxCalls)
+	if compact == "" {
+		return llm.Message{}, false
+	}
+
+	return llm.Message{Role: "system", Content: compact}, true
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/metrics"
+)
+
+// agentMetrics are the metrics the agent reports to its registry
+type agentMetrics struct {
+	registry *metrics.Registry
+
+	llmRequests  *metrics.Counter
+	llmErrors    *metrics.Counter
+	llmDuration  *metrics.Histogram
+	llmTokens    *metrics.Counter
+	llmCost      *metrics.Counter
+	toolCalls    *metrics.Counter
+	wsConns      *metrics.Gauge
+	wsSessions   *metrics.Gauge
+	cacheHits    *metrics.Counter
+	cacheMisses  *metrics.Counter
+	cacheRatio   *metrics.Gauge
+	cacheEntries *metrics.Gauge
+}
+
+// newAgentMetrics registers the agent metrics in registry
+func newAgentMetrics(registry *metrics.Registry) *agentMetrics {
+	return &agentMetrics{
+		registry: registry,
+
+		llmRequests: registry.NewCounter("agent_llm_requests_total", "LLM requests by provider, model and status.", "provider", "model", "status"),
+		llmErrors:   registry.NewCounter("agent_llm_errors_total", "Failed LLM requests by provider, model and provider error type.", "provider", "model", "type"),
+		llmDuration: registry.NewHistogram("agent_llm_request_duration_seconds", "LLM request latency.", metrics.DefaultLatencyBuckets, "provider", "model"),
+		llmTokens:   registry.NewCounter("agent_llm_tokens_total", "Tokens used by kind (prompt or completion).", "provider", "model", "kind"),
+		llmCost:     registry.NewCounter("agent_llm_cost_usd_total", "Estimated LLM cost in USD from the budget pricing table.", "provider", "model"),
+
+		toolCalls: registry.NewCounter("agent_tool_executions_total", "Tool executions by tool and outcome.", "tool", "outcome"),
+
+		wsConns:    registry.NewGauge("agent_websocket_connections", "Open WebSocket connections."),
+		wsSessions: registry.NewGauge("agent_websocket_sessions", "Conversation sessions in use by open WebSocket connections."),
+
+		cacheHits:    registry.NewCounter("agent_prompt_cache_hits_total", "System prompt cache hits."),
+		cacheMisses:  registry.NewCounter("agent_prompt_cache_misses_total", "System prompt cache misses."),
+		cacheRatio:   registry.NewGauge("agent_prompt_cache_hit_ratio", "System prompt cache hit ratio."),
+		cacheEntries: registry.NewGauge("agent_prompt_cache_entries", "System prompts in the cache."),
+	}
+}
+
+// Metrics returns the registry the agent reports to, for exposing it (e.g. on /metrics)
+func (a *V3Agent) Metrics() *metrics.Registry {
+	return a.metrics.registry
+}
+
+// collectMetrics mirrors the tool registry and prompt cache statistics on every scrape
+func (a *V3Agent) collectMetrics() {
+	m := a.metrics
+	m.registry.OnCollect(func() {
+		for tool, outcomes := range a.toolRegistry.ExecutionCounts() {
+			for outcome, count := range outcomes {
+				m.toolCalls.Set(float64(count), tool, outcome)
+			}
+		}
+
+		stats := a.promptCache.GetStats()
+		if hits, ok := stats["hits"].(int64); ok {
+			m.cacheHits.Set(float64(hits))
+		}
+		if misses, ok := stats["misses"].(int64); ok {
+			m.cacheMisses.Set(float64(misses))
+		}
+		if ratio, ok := stats["hit_ratio"].(float64); ok {
+			m.cacheRatio.Set(ratio)
+		}
+		if entries, ok := stats["total_entries"].(int); ok {
+			m.cacheEntries.Set(float64(entries))
+		}
+	})
+}
+
+// observeLLM records the outcome, latency, tokens and cost of an LLM request
+func (a *V3Agent) observeLLM(provider string, req *llm.CompletionRequest, resp *llm.CompletionResponse, err error, elapsed time.Duration) {
+	m := a.metrics
+	model := req.Model
+	if resp != nil && resp.Model != "" {
+		model = resp.Model
+	}
+	if model == "" {
+		model = "default"
+	}
+
+	m.llmDuration.Observe(elapsed.Seconds(), provider, model)
+	if err != nil {
+		m.llmRequests.Inc(provider, model, "error")
+		m.llmErrors.Inc(provider, model, providerErrorType(err))
+		return
+	}
+
+	m.llmRequests.Inc(provider, model, "ok")
+	m.llmTokens.Add(float64(resp.Usage.PromptTokens), provider, model, "prompt")
+	m.llmTokens.Add(float64(resp.Usage.CompletionTokens), provider, model, "completion")
+	m.llmCost.Add(a.llmCost(resp), provider, model)
+}
+
+// providerErrorType classifies an LLM error by its ProviderError.Type
+func providerErrorType(err error) string {
+	var providerErr *llm.ProviderError
+	switch {
+	case errors.As(err, &providerErr) && providerErr.Type != "":
+		return providerErr.Type
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,282 @@
+// Package metrics is a small metrics registry (counters, gauges and histograms
+// with labels) that the agent reports to and servers expose in the Prometheus
+// text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are histogram buckets in seconds suited to LLM and tool calls
+var DefaultLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120}
+
+// Registry holds metric families and the collectors that refresh them on scrape
+type Registry struct {
+	mu         sync.Mutex
+	families   []*family
+	byName     map[string]*family
+	collectors []func()
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+// OnCollect registers a function that runs before every export, to refresh
+// metrics mirrored from other components
+func (r *Registry) OnCollect(collect func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collect)
+}
+
+// NewCounter registers a counter
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", labelNames, nil)}
+}
+
+// NewGauge registers a gauge
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", labelNames, nil)}
+}
+
+// NewHistogram registers a histogram with the given upper bounds
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(name, help, "histogram", labelNames, buckets)}
+}
+
+// register returns the family with that name, creating it if needed
+func (r *Registry) register(name, help, kind string, labelNames []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.byName[name]; ok {
+		return f
+	}
+	f := &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	if len(labelNames) == 0 && kind != "histogram" {
+		f.update(nil, func(*series) {}) // Unlabelled metrics are exported from the start
+	}
+	r.families = append(r.families, f)
+	r.byName[name] = f
+	return f
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition format
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]func(){}, r.collectors...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+
+	for _, collect := range collectors {
+		collect()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WritePrometheus(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Counter is a value that only goes up
+type Counter struct{ f *family }
+
+// Inc adds one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Set overwrites the value. It is meant for counters mirrored from another
+// component in an OnCollect function.
+func (c *Counter) Set(v float64, labelValues ...string) {
+	c.f.update(labelValues, func(s *series) { s.value = v })
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct{ f *family }
+
+// Set sets the value
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) { s.value = v })
+}
+
+// Add adds v (negative to subtract)
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Inc adds one
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec subtracts one
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations in buckets
+type Histogram struct{ f *family }
+
+// Observe records a value
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.update(labelValues, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+		for i, bound := range h.f.buckets {
+			if v <= bound {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.value += v
+	})
+}
+
+// family is a metric name with its series by label values
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is one combination of label values. For histograms value is the sum.
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // Cumulative bucket counts
+	count       uint64
+}
+
+// update applies fn to the series of the label values, creating it if needed.
+// Missing label values are empty and extra ones are ignored.
+func (f *family) update(labelValues []string, fn func(*series)) {
+	values := make([]string, len(f.labelNames))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: values}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// write writes the family in the text format, series sorted by labels
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labels(s.labelValues, ""), formatValue(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			var count uint64
+			if s.counts != nil {
+				count = s.counts[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, formatValue(bound)), count)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labels(s.labelValues, ""), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labels(s.labelValues, ""), s.count)
+	}
+}
+
+// labels formats a label set, adding le for histogram buckets
+func (f *family) labels(values []string, le string) string {
+	var pairs []string
+	for i, name := range f.labelNames {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i])))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/planner"
+	"github.com/santiagocorredoira/agent/agent/prompts"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+// Turn modes
+const (
+	ModeLoop = "loop" // The model calls tools until it answers (default)
+	ModePlan = "plan" // The model writes a step plan, the agent runs it and the model answers from the results
+)
+
+const (
+	maxReplans      = 2   // Revised plans per turn after failed steps
+	planResultChars = 500 // Tool output kept in each plan step
+)
+
+// PlanCallback is called with a copy of the plan whenever it changes
+type PlanCallback func(plan *planner.Plan)
+
+// LastPlan returns a copy of the plan of the last turn run in plan mode, or nil
+func (a *V3Agent) LastPlan() *planner.Plan {
+	return a.lastPlan.Copy()
+}
+
+// mode resolves the turn mode: the call options, then the session profile, then
+// the configuration
+func (a *V3Agent) mode(opts ConversationOptions) string {
+	if opts.Mode != "" {
+		return opts.Mode
+	}
+	if a.profile != nil && a.profile.Mode != "" {
+		return a.profile.Mode
+	}
+	if a.config.Agent.Mode != "" {
+		return a.config.Agent.Mode
+	}
+	return ModeLoop
+}
+
+// generatePlannedResponse answers a message in plan mode: the model (or the
+// heuristic planner when it fails) writes a step plan, each step runs as a tool
+// call, failed steps trigger a revised plan, and the model writes the answer
+// from the step results. Failures are returned as *TurnError.
+func (a *V3Agent) generatePlannedResponse(message string, enableStreaming bool, opts ConversationOptions) (*llm.CompletionResponse, error) {
+	defer func() { a.lastPlan = a.turnPlan }()
+
+	contextMessages := a.memoryManager.GetContextForQuery(message, opts.ContextLimit)
+
+	a.reportStatus(enableStreaming, opts, "Planning...")
+	plan, err := a.writePlan(message, contextMessages, nil)
+	if err != nil {
+		log.Printf("Planning failed, using heuristic plan: %v", err)
+		plan = a.taskPlanner.HeuristicPlan(message)
+	}
+	a.turnPlan = plan
+	a.publishPlan(opts)
+
+	systemPrompt := a.buildSystemPromptCached(true)
+	if opts.SystemPrompt != "" {
+		systemPrompt += "\n\nAdditional instructions: " + opts.SystemPrompt
+	}
+	messages := append([]llm.Message{{Role: "system", Content: systemPrompt}}, contextMessages...)
+
+	maxSteps := a.maxToolIterations(opts)
+	executed := 0
+	for step := plan.Next(); step != nil; step = plan.Next() {
+		if a.turnAnswerNow || executed >= maxSteps {
+			plan.SkipPending()
+			a.publishPlan(opts)
+			break
+		}
+		if err := a.checkBudget(); err != nil {
+			return nil, err
+		}
+
+		a.reportStatus(enableStreaming, opts, fmt.Sprintf("Step %d/%d: %s", step.ID, len(plan.Steps), step.Description))
+		step.Status = planner.StepRunning
+		a.publishPlan(opts)
+
+		messages = a.runPlanStep(step, messages, opts)
+		executed++
+		a.publishPlan(opts)
+
+		if step.Status == planner.StepFailed && plan.Revisions < maxReplans {
+			a.reportStatus(enableStreaming, opts, "Replanning...")
+			revised, err := a.writePlan(message, contextMessages, plan)
+			if err != nil {
+				log.Printf("Replanning failed, keeping the current plan: %v", err)
+				continue
+			}
+			plan.Replan(revised)
+			a.publishPlan(opts)
+		}
+	}
+
+	a.turnSpan.SetAttributes(map[string]interface{}{
+		"plan_source":    plan.Source,
+		"plan_steps":     len(plan.Steps),
+		"plan_revisions": plan.Revisions,
+	})
+
+	// Under the strict policy an answer built without a single working step is a failure
+	if a.errorPolicy(opts) == ErrorPolicyStrict && a.turnToolCalls > 0 && a.turnToolErrors == a.turnToolCalls {
+		return nil, &TurnError{Kind: ErrToolFailed, Err: a.turnToolErr}
+	}
+	if err := a.checkBudget(); err != nil {
+		return nil, err
+	}
+
+	a.reportStatus(enableStreaming, opts, "Writing answer...")
+	if len(plan.Steps) > 0 {
+		messages = append(messages, llm.Message{
+			Role: "system",
+			Content: "Plan results:\n" + plan.Progress() +
+				"\nWrite the final answer to the user's message from the step results above. Include exact identifiers (endpoints, parameters, file paths) as they appear in the results, and say what could not be found instead of guessing.",
+		})
+	}
+	resp, err := a.complete(a.ctx, &llm.CompletionRequest{
+		Messages:    messages,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// writePlan asks the model for a plan. With a current plan it asks for the
+// remaining steps given the steps already run.
+func (a *V3Agent) writePlan(message string, contextMessages []llm.Message, current *planner.Plan) (*planner.Plan, error) {
+	progress := "None yet."
+	if current != nil {
+		progress = current.Progress()
+	}
+	prompt := prompts.RenderTaskPlanPrompt(prompts.PromptData{
+		Content:  a.describeTools(),
+		Messages: progress,
+	})
+
+	req := &llm.CompletionRequest{
+		Messages:    append([]llm.Message{{Role: "system", Content: prompt}}, contextMessages...),
+		MaxTokens:   1000,
+		Temperature: 0,
+	}
+	resp, err := a.complete(a.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return planner.ParsePlan(message, resp.Content)
+}
+
+// describeTools lists the enabled tools with their parameters for the planning prompt
+func (a *V3Agent) describeTools() string {
+	var b strings.Builder
+	for _, tool := range a.buildToolsForLLM() {
+		params, _ := json.Marshal(tool.Function.Parameters)
+		fmt.Fprintf(&b, "- %s: %s\n  Parameters: %s\n", tool.Function.Name, tool.Function.Description, params)
+	}
+	if b.Len() == 0 {
+		return "No tools are available."
+	}
+	return b.String()
+}
+
+// runPlanStep executes a step as a tool call, recording it in the turn trace
+// like the tool loop does, and returns the messages with the call and its result
+func (a *V3Agent) runPlanStep(step *planner.PlanStep, messages []llm.Message, opts ConversationOptions) []llm.Message {
+	args := []byte("{}")
+	if len(step.Arguments) > 0 {
+		args, _ = json.Marshal(step.Arguments)
+	}
+	toolCall := llm.ToolCall{
+		ID:   fmt.Sprintf("plan_step_%d", step.ID),
+		Type: "function",
+		Function: llm.FunctionCall{
+			Name:      step.Tool,
+			Arguments: string(args),
+		},
+	}
+	callMessage := llm.Message{
+		Role:      "assistant",
+		Content:   fmt.Sprintf("Step %d: %s", step.ID, step.Description),
+		ToolCalls: []llm.ToolCall{toolCall},
+	}
+
+	start := time.Now()
+	result, refused, err := a.executeToolCall(toolCall, opts)
+	step.DurationMS = time.Since(start).Milliseconds()
+
+	a.chargeToolCall()
+	var toolContent string
+	if err != nil {
+		a.turnToolErrors++
+		a.turnToolErr = fmt.Errorf("%s: %w", step.Tool, err)
+		step.Status = planner.StepFailed
+		step.Error = err.Error()
+		toolContent = fmt.Sprintf("Error executing %s: %v", step.Tool, err)
+	} else if refused {
+		// A vetoed or denied step did not run, so the plan cannot rely on it
+		a.turnToolErrors++
+		a.turnToolErr = fmt.Errorf("%s: %s", step.Tool, result)
+		step.Status = planner.StepFailed
+		step.Error = result
+		toolContent = result
+	} else {
+		step.Status = planner.StepDone
+		toolContent = result
+		if toolContent == "" {
+			toolContent = "Tool executed successfully with no output."
+		}
+		step.Result = tools.TruncateResult(toolContent, planResultChars, tools.TruncateHeadTail, "")
+	}
+
+	toolMessage := llm.Message{Role: "tool", Content: toolContent, ToolCallID: toolCall.ID}
+	a.turnTrace = append(a.turnTrace, callMessage, toolMessage)
+	return append(messages, callMessage, toolMessage)
+}
+
+// publishPlan hands a copy of the turn plan to the plan callback
+func (a *V3Agent) publishPlan(opts ConversationOptions) {
+	if opts.PlanCallback != nil && a.turnPlan != nil {
+		opts.PlanCallback(a.turnPlan.Copy())
+	}
+}
+
+// reportStatus sends a progress message while streaming
+func (a *V3Agent) reportStatus(enableStreaming bool, opts ConversationOptions, message string) {
+	if !enableStreaming {
+		return
+	}
+	if opts.StatusCallback != nil {
+		opts.StatusCallback(message)
+	} else {
+		fmt.Printf("%s\n", message)
+	}
+}
@@ -0,0 +1,181 @@
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StepStatus is the state of a plan step
+type StepStatus string
+
+const (
+	StepPending StepStatus = "pending"
+	StepRunning StepStatus = "running"
+	StepDone    StepStatus = "done"
+	StepFailed  StepStatus = "failed"
+	StepSkipped StepStatus = "skipped" // Dropped by a replan or left over when the step limit was reached
+)
+
+// Plan sources
+const (
+	SourceLLM       = "llm"       // Written by the model
+	SourceHeuristic = "heuristic" // Built from AnalyzeQuery suggestions
+)
+
+// Plan is an explicit list of tool steps to answer a query
+type Plan struct {
+	Query     string      `json:"query"`
+	Source    string      `json:"source"`
+	Steps     []*PlanStep `json:"steps"`
+	Revisions int         `json:"revisions"` // Times the pending steps were replanned after a failure
+}
+
+// PlanStep is one tool call of a plan
+type PlanStep struct {
+	ID          int                    `json:"id"`
+	Description string                 `json:"description"`
+	Tool        string                 `json:"tool"`
+	Arguments   map[string]interface{} `json:"arguments,omitempty"`
+	Status      StepStatus             `json:"status"`
+	Result      string                 `json:"result,omitempty"` // Start of the tool output
+	Error       string                 `json:"error,omitempty"`
+	DurationMS  int64                  `json:"duration_ms,omitempty"`
+}
+
+// HeuristicPlan builds a plan from the AnalyzeQuery suggestions that carry
+// their parameters and name a registered tool. It is the cheap fallback when
+// the model cannot write a plan.
+func (p *TaskPlanner) HeuristicPlan(query string) *Plan {
+	plan := &Plan{Query: query, Source: SourceHeuristic}
+	for _, suggestion := range p.AnalyzeQuery(query) {
+		if suggestion.Parameters == nil {
+			continue
+		}
+		if _, exists := p.toolRegistry.GetTool(suggestion.ToolName); !exists {
+			continue
+		}
+		plan.add(&PlanStep{
+			Description: suggestion.Reason,
+			Tool:        suggestion.ToolName,
+			Arguments:   suggestion.Parameters,
+		})
+	}
+	return plan
+}
+
+// ParsePlan reads the steps a model wrote as a JSON object {"steps": [...]},
+// optionally inside a code fence. An empty step list is a valid plan.
+func ParsePlan(query, text string) (*Plan, error) {
+	var parsed struct {
+		Steps []struct {
+			Description string                 `json:"description"`
+			Tool        string                 `json:"tool"`
+			Arguments   map[string]interface{} `json:"arguments"`
+		} `json:"steps"`
+	}
+
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in plan")
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid plan JSON: %w", err)
+	}
+
+	plan := &Plan{Query: query, Source: SourceLLM}
+	for i, step := range parsed.Steps {
+		if step.Tool == "" {
+			return nil, fmt.Errorf("plan step %d has no tool", i+1)
+		}
+		plan.add(&PlanStep{
+			Description: step.Description,
+			Tool:        step.Tool,
+			Arguments:   step.Arguments,
+		})
+	}
+	return plan, nil
+}
+
+// add appends a pending step with the next id
+func (p *Plan) add(step *PlanStep) {
+	step.ID = len(p.Steps) + 1
+	step.Status = StepPending
+	p.Steps = append(p.Steps, step)
+}
+
+// Next returns the first pending step, or nil when there is none
+func (p *Plan) Next() *PlanStep {
+	for _, step := range p.Steps {
+		if step.Status == StepPending {
+			return step
+		}
+	}
+	return nil
+}
+
+// Replan replaces the pending steps with the steps of a revised plan
+func (p *Plan) Replan(revised *Plan) {
+	p.SkipPending()
+	for _, step := range revised.Steps {
+		p.add(&PlanStep{
+			Description: step.Description,
+			Tool:        step.Tool,
+			Arguments:   step.Arguments,
+		})
+	}
+	p.Revisions++
+}
+
+// SkipPending marks every pending step as skipped
+func (p *Plan) SkipPending() {
+	for _, step := range p.Steps {
+		if step.Status == StepPending {
+			step.Status = StepSkipped
+		}
+	}
+}
+
+// Count returns the number of steps with a status
+func (p *Plan) Count(status StepStatus) int {
+	count := 0
+	for _, step := range p.Steps {
+		if step.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Progress describes the steps run so far, for replanning and the final answer
+func (p *Plan) Progress() string {
+	var b strings.Builder
+	for _, step := range p.Steps {
+		if step.Status == StepPending || step.Status == StepSkipped {
+			continue
+		}
+		args, _ := json.Marshal(step.Arguments)
+		fmt.Fprintf(&b, "%d. [%s] %s — %s(%s)\n", step.ID, step.Status, step.Description, step.Tool, args)
+		if step.Error != "" {
+			fmt.Fprintf(&b, "   Error: %s\n", step.Error)
+		} else if step.Result != "" {
+			fmt.Fprintf(&b, "   Result: %s\n", step.Result)
+		}
+	}
+	return b.String()
+}
+
+// Copy returns a deep copy, safe to hand to callers while the plan runs
+func (p *Plan) Copy() *Plan {
+	if p == nil {
+		return nil
+	}
+	copied := *p
+	copied.Steps = make([]*PlanStep, len(p.Steps))
+	for i, step := range p.Steps {
+		s := *step
+		copied.Steps[i] = &s
+	}
+	return &copied
+}
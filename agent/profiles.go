@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/prompts"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+// ProfileInfo describes a configured agent profile
+type ProfileInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tools       []string `json:"tools,omitempty"`
+	Default     bool     `json:"default"`
+}
+
+// ListProfiles returns the configured agent profiles sorted by name
+func (a *V3Agent) ListProfiles() []ProfileInfo {
+	profiles := make([]ProfileInfo, 0, len(a.config.Profiles))
+	for name, profile := range a.config.Profiles {
+		profiles = append(profiles, ProfileInfo{
+			Name:        name,
+			Description: profile.Description,
+			Tools:       profile.Tools,
+			Default:     name == a.config.Agent.Profile,
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// GetProfile returns the profile of the current session, or "" when none is active
+func (a *V3Agent) GetProfile() string {
+	return a.profileName
+}
+
+// applyProfile switches the agent to a configured profile. An empty name
+// restores the general configuration. Nothing changes when the profile is invalid.
+func (a *V3Agent) applyProfile(name string) error {
+	var profile *config.Profile
+	var templates []string
+	var provider llm.Provider
+
+	if name != "" {
+		p, ok := a.config.Profiles[name]
+		if !ok {
+			return fmt.Errorf("unknown profile %q", name)
+		}
+		profile = &p
+
+		for _, ref := range profile.SystemPrompts {
+			template, err := loadPromptTemplate(ref)
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", name, err)
+			}
+			templates = append(templates, template)
+		}
+
+		var err error
+		if provider, err = a.profileProvider(name, profile); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+
+	a.profileName = name
+	a.profile = profile
+	a.profilePrompts = templates
+	a.routedProvider = provider
+
+	a.toolsOnlyMode = a.baseToolsOnlyMode
+	if profile != nil && profile.ToolsOnlyMode != nil {
+		a.toolsOnlyMode = *profile.ToolsOnlyMode
+	}
+
+	var contextProviders []string
+	if profile != nil {
+		contextProviders = profile.ContextProviders
+	}
+	a.memoryManager.SetContextProviders(contextProviders)
+
+	// Report the profile budget until the next turn sets its own
+	a.turnBudget = a.turnBudgetFor(ConversationOptions{})
+	return nil
+}
+
+// profileProvider returns the LLM provider routed by a profile, or nil when the
+// profile uses the default provider. Providers are built once per profile.
+func (a *V3Agent) profileProvider(name string, profile *config.Profile) (llm.Provider, error) {
+	if a.fixedProvider || (len(profile.ProviderRoute) == 0 && profile.Model == "") {
+		return nil, nil
+	}
+	if provider, ok := a.profileProviders[name]; ok {
+		return provider, nil
+	}
+
+	route := profile.ProviderRoute
+	if len(route) == 0 {
+		route = a.config.LLM.FallbackOrder
+	}
+	provider, err := createLLMProvider(a.config, route, profile.Model)
+	if err != nil {
+		return nil, err
+	}
+	a.profileProviders[name] = provider
+	return provider, nil
+}
+
+// provider returns the LLM provider of the current session
+func (a *V3Agent) provider() llm.Provider {
+	if a.routedProvider == nil {
+		return a.llmProvider
+	}
+	// Keep interaction logging when the session uses a routed provider
+	if logged, ok := a.llmProvider.(*llm.LoggedProvider); ok {
+		return llm.NewLoggedProvider(a.routedProvider, logged.GetLogger(), logged.GetSessionID())
+	}
+	return a.routedProvider
+}
+
+// toolEnabled reports whether the session profile enables a tool
+func (a *V3Agent) toolEnabled(name string) bool {
+	if a.profile == nil || len(a.profile.Tools) == 0 {
+		return true
+	}
+	for _, enabled := range a.profile.Tools {
+		if enabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabledTools lists the available tools enabled by the session profile
+func (a *V3Agent) enabledTools() []tools.ToolInfo {
+	available := a.toolRegistry.ListAvailableTools(a.ctx)
+	if a.profile == nil || len(a.profile.Tools) == 0 {
+		return available
+	}
+
+	enabled := make([]tools.ToolInfo, 0, len(available))
+	for _, info := range available {
+		if a.toolEnabled(info.Name) {
+			enabled = append(enabled, info)
+		}
+	}
+	return enabled
+}
+
+// maxToolIterations resolves the tool rounds of a turn: the call options, then
+// the session profile, then the built-in default
+func (a *V3Agent) maxToolIterations(opts ConversationOptions) int {
+	if opts.MaxToolIterations > 0 {
+		return opts.MaxToolIterations
+	}
+	if a.profile != nil && a.profile.MaxToolIterations > 0 {
+		return a.profile.MaxToolIterations
+	}
+	return defaultMaxToolIterations
+}
+
+// minSearches resolves the minimum searches of a turn like maxToolIterations
+func (a *V3Agent) minSearches(opts ConversationOptions) int {
+	if opts.MinSearches > 0 {
+		return opts.MinSearches
+	}
+	if a.profile != nil && a.profile.MinSearches > 0 {
+		return a.profile.MinSearches
+	}
+	return defaultMinSearches
+}
+
+// buildProfilePrompt renders the system prompt template chain of the session profile
+func (a *V3Agent) buildProfilePrompt(toolCount int) string {
+	parts := make([]string, 0, len(a.profilePrompts))
+	for _, template := range a.profilePrompts {
+		parts = append(parts, prompts.RenderSystemPrompt(template, prompts.PromptData{ToolCount: toolCount}))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// loadPromptTemplate resolves a profile prompt reference: an embedded template
+// name or a path to a template file
+func loadPromptTemplate(ref string) (string, error) {
+	if template, ok := prompts.Lookup(ref); ok {
+		return template, nil
+	}
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to load system prompt %q: %w", ref, err)
+	}
+	return string(data), nil
+}
@@ -34,6 +34,18 @@ var AntiHallucinationTemplate string
 //go:embed tools_only_mode.md
 var ToolsOnlyModeTemplate string
 
+//go:embed tool_result_summary.md
+var ToolResultSummaryTemplate string
+
+//go:embed delegate_task.md
+var DelegateTaskTemplate string
+
+//go:embed guardrail_judge.md
+var GuardrailJudgeTemplate string
+
+//go:embed task_plan.md
+var TaskPlanTemplate string
+
 // PromptData represents data to substitute in prompts
 type PromptData struct {
 	SearchQuery      string
@@ -43,6 +55,12 @@ type PromptData struct {
 	FirstUserMessage string
 	Messages         string
 	ToolCount        int
+	ToolName         string
+	ToolOutput       string
+	MaxChars         int
+	Task             string
+	Criteria         string
+	Content          string
 }
 
 // RenderDocumentRelevancePrompt renders the document relevance prompt with data
@@ -69,6 +87,39 @@ func RenderConversationSummaryPrompt(data PromptData) string {
 	return prompt
 }
 
+// RenderToolResultSummaryPrompt renders the tool result summary prompt with data
+func RenderToolResultSummaryPrompt(data PromptData) string {
+	prompt := ToolResultSummaryTemplate
+	prompt = strings.ReplaceAll(prompt, "{{.ToolName}}", data.ToolName)
+	prompt = strings.ReplaceAll(prompt, "{{.SearchQuery}}", data.SearchQuery)
+	prompt = strings.ReplaceAll(prompt, "{{.MaxChars}}", fmt.Sprintf("%d", data.MaxChars))
+	prompt = strings.ReplaceAll(prompt, "{{.ToolOutput}}", data.ToolOutput)
+	return prompt
+}
+
+// RenderDelegateTaskPrompt renders the sub-agent task prompt with data
+func RenderDelegateTaskPrompt(data PromptData) string {
+	prompt := DelegateTaskTemplate
+	prompt = strings.ReplaceAll(prompt, "{{.Task}}", data.Task)
+	return prompt
+}
+
+// RenderGuardrailJudgePrompt renders the guardrail judge prompt with data
+func RenderGuardrailJudgePrompt(data PromptData) string {
+	prompt := GuardrailJudgeTemplate
+	prompt = strings.ReplaceAll(prompt, "{{.Criteria}}", data.Criteria)
+	prompt = strings.ReplaceAll(prompt, "{{.Content}}", data.Content)
+	return prompt
+}
+
+// RenderTaskPlanPrompt renders the plan-and-execute planning prompt with data
+func RenderTaskPlanPrompt(data PromptData) string {
+	prompt := TaskPlanTemplate
+	prompt = strings.ReplaceAll(prompt, "{{.Content}}", data.Content)
+	prompt = strings.ReplaceAll(prompt, "{{.Messages}}", data.Messages)
+	return prompt
+}
+
 // RenderSystemBasePrompt renders the base system prompt with data
 func RenderSystemBasePrompt(data PromptData) string {
 	prompt := SystemBaseTemplate
@@ -94,4 +145,23 @@ func GetAntiHallucinationPrompt() string {
 // GetToolsOnlyModePrompt returns the tools-only mode prompt
 func GetToolsOnlyModePrompt() string {
 	return ToolsOnlyModeTemplate
-}
\ No newline at end of file
+}
+
+// Lookup returns an embedded system prompt template by name ("system_base",
+// "system_brief", "search_strategy", "filter_rules" or "anti_hallucination")
+func Lookup(name string) (string, bool) {
+	templates := map[string]string{
+		"system_base":        SystemBaseTemplate,
+		"system_brief":       SystemBriefTemplate,
+		"search_strategy":    SearchStrategyTemplate,
+		"filter_rules":       FilterRulesTemplate,
+		"anti_hallucination": AntiHallucinationTemplate,
+	}
+	template, ok := templates[name]
+	return template, ok
+}
+
+// RenderSystemPrompt renders a system prompt template with data
+func RenderSystemPrompt(template string, data PromptData) string {
+	return strings.ReplaceAll(template, "{{.ToolCount}}", fmt.Sprintf("%d", data.ToolCount))
+}
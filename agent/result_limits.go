@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/prompts"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+const (
+	// minToolResultChars is the smallest slice of a result kept once the turn budget runs low
+	minToolResultChars = 500
+
+	// maxSummaryInputChars bounds how much of an oversize result is sent to the summarizer
+	maxSummaryInputChars = 32000
+)
+
+// limitToolResult applies the configured per-tool and per-turn size limits to a
+// tool output before it is appended to the conversation. The full output stays
+// in the tool registry execution history under executionID.
+func (a *V3Agent) limitToolResult(toolName, content, executionID string) string {
+	limits := a.config.Tools.ResultLimits
+	limit := limits.LimitFor(toolName)
+
+	// Shrink the limit to whatever is left of the per-turn budget
+	if limits.TotalChars > 0 {
+		remaining := limits.TotalChars - a.turnResultChars
+		if remaining < minToolResultChars {
+			remaining = minToolResultChars
+		}
+		if limit <= 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+
+	if limit <= 0 || len(content) <= limit {
+		a.turnResultChars += len(content)
+		return content
+	}
+
+	var limited string
+	if limits.Summarize {
+		summary, err := a.summarizeToolResult(toolName, content, limit)
+		if err != nil {
+			log.Printf("Failed to summarize %s result, truncating instead: %v", toolName, err)
+		} else {
+			limited = fmt.Sprintf("%s\n\n[Summarized from %d characters]", summary, len(content))
+		}
+	}
+	if limited == "" {
+		limited = tools.TruncateResult(content, limit, limits.Strategy, a.turnQuery)
+	}
+	if executionID != "" {
+		limited += fmt.Sprintf("\n[Full output recorded in execution %s]", executionID)
+	}
+
+	a.turnResultChars += len(limited)
+	return limited
+}
+
+// summarizeToolResult asks the LLM to condense an oversize tool output to at most maxChars
+func (a *V3Agent) summarizeToolResult(toolName, content string, maxChars int) (string, error) {
+	input := tools.TruncateResult(content, maxSummaryInputChars, a.config.Tools.ResultLimits.Strategy, a.turnQuery)
+
+	req := &llm.CompletionRequest{
+		Messages: []llm.Message{
+			{Role: "user", Content: prompts.RenderToolResultSummaryPrompt(prompts.PromptData{
+				ToolName:    toolName,
+				SearchQuery: a.turnQuery,
+				ToolOutput:  input,
+				MaxChars:    maxChars,
+			})},
+		},
+		MaxTokens:   maxChars/3 + 100, // Rough chars-per-token estimate with some headroom
+		Temperature: 0.2,
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := a.complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	if len(summary) > maxChars {
+		summary = tools.TruncateResult(summary, maxChars, tools.TruncateHeadTail, "")
+	}
+	return summary, nil
+}
+
+// GetToolExecution returns a recorded tool execution with its full output
+func (a *V3Agent) GetToolExecution(executionID string) (*tools.ToolExecutionHistory, bool) {
+	return a.toolRegistry.GetExecution(executionID)
+}
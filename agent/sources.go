@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"sort"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// addSources records documents surfaced or read by a tool in this turn. A
+// document found several times keeps its best score and the first title and
+// snippet found.
+func (a *V3Agent) addSources(sources []llm.Source) {
+	for _, source := range sources {
+		if source.Path == "" {
+			continue
+		}
+		known := false
+		for i := range a.turnSources {
+			existing := &a.turnSources[i]
+			if existing.Path != source.Path {
+				continue
+			}
+			known = true
+			if source.Score > existing.Score {
+				existing.Score = source.Score
+			}
+			if existing.Title == "" {
+				existing.Title = source.Title
+			}
+			if existing.Snippet == "" {
+				existing.Snippet = source.Snippet
+			}
+			break
+		}
+		if !known {
+			a.turnSources = append(a.turnSources, source)
+		}
+	}
+
+	// Best matches first; documents read in full (no score) keep their order at the end
+	sort.SliceStable(a.turnSources, func(i, j int) bool {
+		return a.turnSources[i].Score > a.turnSources[j].Score
+	})
+}
@@ -0,0 +1,366 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+)
+
+// apiHostKey carries the API host of the conversation in a tool context
+type apiHostKey struct{}
+
+// WithAPIHost returns a context carrying the API host of the conversation
+// (ConversationContext.Metadata["api_host"]). API tools resolve relative paths
+// against it and accept it as an allowed host.
+func WithAPIHost(ctx context.Context, host string) context.Context {
+	if host == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, apiHostKey{}, host)
+}
+
+// APIHostFrom returns the API host carried by a context, or ""
+func APIHostFrom(ctx context.Context) string {
+	host, _ := ctx.Value(apiHostKey{}).(string)
+	return host
+}
+
+// APIRequest is a request sent through an APIClient
+type APIRequest struct {
+	Method     string
+	URL        string     // Absolute URL, or a path resolved against Endpoint or the conversation API host
+	Endpoint   string     // Name of a configured API endpoint
+	Query      url.Values // Added to the URL query
+	Headers    map[string]string
+	Body       interface{} // Sent as JSON when not nil
+	Credential string      // Name of a configured credential profile
+}
+
+// APIResponse is the size-limited outcome of an APIRequest
+type APIResponse struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"` // Without query credentials
+	StatusCode  int               `json:"status_code"`
+	Status      string            `json:"status"`
+	ContentType string            `json:"content_type,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body"`
+	Truncated   bool              `json:"truncated,omitempty"` // The body was cut at the size limit
+	DurationMS  int64             `json:"duration_ms"`
+}
+
+// APIClient sends HTTP requests to allowed hosts, adding credentials from
+// named profiles that the model never sees. Credential values are removed from
+// the responses it returns.
+type APIClient struct {
+	client       *http.Client
+	endpoints    map[string]string
+	allowedHosts []string
+	credentials  map[string]config.CredentialConfig
+	maxBytes     int
+}
+
+// NewAPIClient creates a client for the configured endpoints, whose hosts are
+// allowed, and the http_request settings
+func NewAPIClient(endpoints map[string]string, cfg config.HTTPConfig) *APIClient {
+	c := &APIClient{
+		endpoints:    endpoints,
+		allowedHosts: append([]string(nil), cfg.AllowedHosts...),
+		credentials:  make(map[string]config.CredentialConfig, len(cfg.Credentials)),
+		maxBytes:     cfg.MaxResponseBytes,
+	}
+	for _, base := range endpoints {
+		if u, err := url.Parse(base); err == nil && u.Host != "" {
+			c.allowedHosts = append(c.allowedHosts, u.Hostname())
+		}
+	}
+	for name, cred := range cfg.Credentials {
+		cred.Token = os.ExpandEnv(cred.Token)
+		cred.Username = os.ExpandEnv(cred.Username)
+		cred.Password = os.ExpandEnv(cred.Password)
+		cred.Value = os.ExpandEnv(cred.Value)
+		c.credentials[name] = cred
+	}
+	if c.maxBytes <= 0 {
+		c.maxBytes = 64 * 1024
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	c.client = &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("stopped after 5 redirects")
+			}
+			if !c.hostAllowed(req.Context(), req.URL.Hostname()) {
+				return fmt.Errorf("redirect to host %s is not allowed", req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+	return c
+}
+
+// EndpointNames returns the names of the configured endpoints, sorted
+func (c *APIClient) EndpointNames() []string {
+	return sortedKeys(c.endpoints)
+}
+
+// CredentialNames returns the names of the credential profiles, sorted
+func (c *APIClient) CredentialNames() []string {
+	names := make([]string, 0, len(c.credentials))
+	for name := range c.credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *APIClient) hasCredential(name string) bool {
+	_, ok := c.credentials[name]
+	return ok
+}
+
+// Do sends a request and reads at most the configured number of bytes of the
+// response. HTTP error statuses are responses, not errors.
+func (c *APIClient) Do(ctx context.Context, req APIRequest) (*APIResponse, error) {
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	target, err := c.resolve(ctx, req.Endpoint, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Query) > 0 {
+		query := target.Query()
+		for key, values := range req.Query {
+			query[key] = values
+		}
+		target.RawQuery = query.Encode()
+	}
+
+	var body io.Reader
+	if req.Body != nil {
+		data, err := json.Marshal(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	displayURL := target.String()
+	var secrets []string
+	if req.Credential != "" {
+		cred, ok := c.credentials[req.Credential]
+		if !ok {
+			return nil, fmt.Errorf("unknown credential profile %q (available: %s)", req.Credential, strings.Join(c.CredentialNames(), ", "))
+		}
+		if len(cred.Hosts) > 0 && !matchHost(cred.Hosts, target.Hostname()) {
+			return nil, fmt.Errorf("credential profile %q cannot be sent to %s", req.Credential, target.Hostname())
+		}
+		secrets = credentialSecrets(cred)
+		if cred.Type == "query" {
+			query := target.Query()
+			query.Set(cred.Name, cred.Value)
+			target.RawQuery = query.Encode()
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	if body != nil && httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json, */*")
+	}
+	if req.Credential != "" {
+		// Set last so the model cannot replace or see the credential headers
+		applyCredential(httpReq, c.credentials[req.Credential])
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s", redact(err.Error(), secrets))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(c.maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	truncated := len(data) > c.maxBytes
+	if truncated {
+		data = data[:c.maxBytes]
+	}
+
+	result := &APIResponse{
+		Method:      method,
+		URL:         displayURL,
+		StatusCode:  resp.StatusCode,
+		Status:      resp.Status,
+		ContentType: resp.Header.Get("Content-Type"),
+		Headers:     make(map[string]string),
+		Body:        redact(string(data), secrets),
+		Truncated:   truncated,
+		DurationMS:  time.Since(start).Milliseconds(),
+	}
+	for _, name := range []string{"Location", "Retry-After", "X-Request-Id", "X-RateLimit-Remaining"} {
+		if value := resp.Header.Get(name); value != "" {
+			result.Headers[name] = redact(value, secrets)
+		}
+	}
+	return result, nil
+}
+
+// resolve builds the target URL and checks its host. Paths are resolved against
+// the named endpoint, else the conversation API host, else the only endpoint.
+func (c *APIClient) resolve(ctx context.Context, endpoint, rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if !target.IsAbs() {
+		base, err := c.baseURL(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		query := target.RawQuery
+		target = base.JoinPath(target.EscapedPath())
+		target.RawQuery = query
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", target.Scheme)
+	}
+	if !c.hostAllowed(ctx, target.Hostname()) {
+		allowed := c.allowedList(ctx)
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("host %s is not allowed; no API hosts are configured", target.Hostname())
+		}
+		return nil, fmt.Errorf("host %s is not allowed; allowed hosts: %s", target.Hostname(), strings.Join(allowed, ", "))
+	}
+	return target, nil
+}
+
+func (c *APIClient) baseURL(ctx context.Context, endpoint string) (*url.URL, error) {
+	var base string
+	switch {
+	case endpoint != "":
+		var ok bool
+		if base, ok = c.endpoints[endpoint]; !ok {
+			return nil, fmt.Errorf("unknown endpoint %q (available: %s)", endpoint, strings.Join(c.EndpointNames(), ", "))
+		}
+	case APIHostFrom(ctx) != "":
+		base = hostURL(APIHostFrom(ctx))
+	case len(c.endpoints) == 1:
+		for _, only := range c.endpoints {
+			base = only
+		}
+	default:
+		return nil, fmt.Errorf("relative url needs an endpoint (available: %s) or an absolute URL", strings.Join(c.EndpointNames(), ", "))
+	}
+	return url.Parse(base)
+}
+
+// hostAllowed reports whether a host is configured or is the conversation API host
+func (c *APIClient) hostAllowed(ctx context.Context, host string) bool {
+	return matchHost(c.allowedList(ctx), host)
+}
+
+func (c *APIClient) allowedList(ctx context.Context) []string {
+	hosts := c.allowedHosts
+	if apiHost := APIHostFrom(ctx); apiHost != "" {
+		if u, err := url.Parse(hostURL(apiHost)); err == nil {
+			hosts = append(append([]string(nil), hosts...), u.Hostname())
+		}
+	}
+	return hosts
+}
+
+// hostURL adds https:// to hosts given without a scheme
+func hostURL(host string) string {
+	if strings.Contains(host, "://") {
+		return host
+	}
+	return "https://" + host
+}
+
+// matchHost matches exact hosts and "*.example.com" patterns, which cover
+// example.com and its subdomains
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok && (host == suffix || strings.HasSuffix(host, "."+suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyCredential(req *http.Request, cred config.CredentialConfig) {
+	switch cred.Type {
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+cred.Token)
+	case "basic":
+		req.SetBasicAuth(cred.Username, cred.Password)
+	case "header":
+		req.Header.Set(cred.Name, cred.Value)
+	}
+}
+
+// credentialSecrets lists the values to hide from responses
+func credentialSecrets(cred config.CredentialConfig) []string {
+	var secrets []string
+	for _, value := range []string{cred.Token, cred.Password, cred.Value} {
+		if len(value) >= 4 { // Shorter values would redact ordinary text
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+func redact(text string, secrets []string) string {
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, "[REDACTED]")
+	}
+	return text
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
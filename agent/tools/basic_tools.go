@@ -4,33 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
 )
 
-// HTTPGetTool performs HTTP GET requests
+// HTTPGetTool performs HTTP GET requests to the hosts allowed by its client
 type HTTPGetTool struct {
 	*BaseTool
-	client *http.Client
+	client *APIClient
 }
 
 // NewHTTPGetTool creates a new HTTP GET tool
-func NewHTTPGetTool() *HTTPGetTool {
+func NewHTTPGetTool(client *APIClient) *HTTPGetTool {
 	tool := &HTTPGetTool{
 		BaseTool: NewBaseTool(
 			"http_get",
-			"Performs HTTP GET requests to retrieve data from web APIs or websites",
+			"Performs HTTP GET requests to retrieve data from the allowed APIs or websites",
 			CategoryAPI,
 			false, // Low risk operation
 			10,    // Low cost
 		),
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client: client,
 	}
 
 	// Define parameter schema
@@ -46,6 +45,7 @@ func NewHTTPGetTool() *HTTPGetTool {
 			"headers": {
 				Type:        "object",
 				Description: "Optional HTTP headers to include in the request",
+				AdditionalProperties: &PropertySchema{Type: "string"},
 			},
 			"timeout": {
 				Type:        "number",
@@ -71,68 +71,59 @@ func (h *HTTPGetTool) Execute(ctx context.Context, params map[string]interface{}
 		), nil
 	}
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return h.CreateErrorResult(err, "Failed to create HTTP request"), nil
-	}
+	req := APIRequest{Method: http.MethodGet, URL: url}
 
 	// Add headers if provided
 	if headers, ok := params["headers"].(map[string]interface{}); ok {
+		req.Headers = make(map[string]string, len(headers))
 		for key, value := range headers {
 			if strValue, ok := value.(string); ok {
-				req.Header.Set(key, strValue)
+				req.Headers[key] = strValue
 			}
 		}
 	}
 
 	// Set timeout if provided
 	if timeoutSecs, ok := params["timeout"].(float64); ok {
-		h.client.Timeout = time.Duration(timeoutSecs) * time.Second
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutSecs)*time.Second)
+		defer cancel()
 	}
 
 	// Execute request
-	resp, err := h.client.Do(req)
+	resp, err := h.client.Do(ctx, req)
 	if err != nil {
 		return h.CreateErrorResult(err, "HTTP request failed"), nil
 	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return h.CreateErrorResult(err, "Failed to read response body"), nil
-	}
 
-	result := map[string]interface{}{
-		"status_code": resp.StatusCode,
-		"headers":     resp.Header,
-		"body":        string(body),
-		"url":         url,
-	}
+	return h.CreateSuccessResult(resp, FormatAPIResponse(resp)), nil
+}
 
-	return h.CreateSuccessResult(result, fmt.Sprintf("HTTP GET request to %s completed with status %d", url, resp.StatusCode)), nil
+func (h *HTTPGetTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(h)
 }
 
 func (h *HTTPGetTool) IsAvailable(ctx context.Context) bool {
 	return true // HTTP requests are generally always available
 }
 
-// FileReadTool reads file contents
+// FileReadTool reads file contents within the allowed directories
 type FileReadTool struct {
 	*BaseTool
+	roots []*RestrictedFS
 }
 
-// NewFileReadTool creates a new file read tool
-func NewFileReadTool() *FileReadTool {
+// NewFileReadTool creates a new file read tool confined to roots
+func NewFileReadTool(roots []*RestrictedFS) *FileReadTool {
 	tool := &FileReadTool{
 		BaseTool: NewBaseTool(
 			"file_read",
-			"Reads the contents of a local file",
+			"Reads the contents of a local file. Allowed directories: "+rootList(roots),
 			CategoryFile,
 			false, // Reading files is generally safe
 			5,     // Very low cost
 		),
+		roots: roots,
 	}
 
 	schema := &ParameterSchema{
@@ -141,7 +132,7 @@ func NewFileReadTool() *FileReadTool {
 		Properties: map[string]PropertySchema{
 			"path": {
 				Type:        "string",
-				Description: "The path to the file to read",
+				Description: "The path to the file to read, relative to an allowed directory",
 			},
 			"encoding": {
 				Type:        "string",
@@ -173,8 +164,12 @@ func (f *FileReadTool) Execute(ctx context.Context, params map[string]interface{
 		), nil
 	}
 
-	// Check if file exists
-	info, err := os.Stat(path)
+	// Check if file exists within the allowed directories
+	fullPath, err := resolveFilePath(f.roots, path, true)
+	if err != nil {
+		return f.CreateErrorResult(err, fmt.Sprintf("File not found: %s", path)), nil
+	}
+	info, err := os.Stat(fullPath)
 	if err != nil {
 		return f.CreateErrorResult(err, fmt.Sprintf("File not found: %s", path)), nil
 	}
@@ -193,7 +188,7 @@ func (f *FileReadTool) Execute(ctx context.Context, params map[string]interface{
 	}
 
 	// Read file content
-	content, err := os.ReadFile(path)
+	content, err := os.ReadFile(fullPath)
 	if err != nil {
 		return f.CreateErrorResult(err, fmt.Sprintf("Failed to read file: %s", path)), nil
 	}
@@ -208,28 +203,36 @@ func (f *FileReadTool) Execute(ctx context.Context, params map[string]interface{
 		"content":  contentStr,
 	}
 
-	return f.CreateSuccessResult(result, fmt.Sprintf("Successfully read file: %s (%d bytes)", path, len(content))), nil
+	toolResult := f.CreateSuccessResult(result, fmt.Sprintf("Successfully read file: %s (%d bytes)", path, len(content)))
+	toolResult.Sources = []llm.Source{{Path: relativeToRoots(f.roots, fullPath)}}
+	return toolResult, nil
+}
+
+func (f *FileReadTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(f)
 }
 
 func (f *FileReadTool) IsAvailable(ctx context.Context) bool {
 	return true // File reading is generally always available
 }
 
-// FileWriteTool writes content to files
+// FileWriteTool writes content to files within the allowed directories
 type FileWriteTool struct {
 	*BaseTool
+	roots []*RestrictedFS
 }
 
-// NewFileWriteTool creates a new file write tool
-func NewFileWriteTool() *FileWriteTool {
+// NewFileWriteTool creates a new file write tool confined to roots
+func NewFileWriteTool(roots []*RestrictedFS) *FileWriteTool {
 	tool := &FileWriteTool{
 		BaseTool: NewBaseTool(
 			"file_write",
-			"Writes content to a local file",
+			"Writes content to a local file. Allowed directories: "+rootList(roots),
 			CategoryFile,
 			true, // Writing files can be destructive, requires confirmation
 			25,   // Medium cost due to potential impact
 		),
+		roots: roots,
 	}
 
 	schema := &ParameterSchema{
@@ -238,7 +241,7 @@ func NewFileWriteTool() *FileWriteTool {
 		Properties: map[string]PropertySchema{
 			"path": {
 				Type:        "string",
-				Description: "The path where to write the file",
+				Description: "The path where to write the file, relative to an allowed directory",
 			},
 			"content": {
 				Type:        "string",
@@ -290,6 +293,13 @@ func (f *FileWriteTool) Execute(ctx context.Context, params map[string]interface
 		createDirs = createDirsParam
 	}
 
+	// Resolve the path within the allowed directories
+	displayPath := path
+	path, err := resolveFilePath(f.roots, path, false)
+	if err != nil {
+		return f.CreateErrorResult(err, fmt.Sprintf("Cannot write file: %s", displayPath)), nil
+	}
+
 	// Create parent directories if requested
 	if createDirs {
 		dir := filepath.Dir(path)
@@ -299,7 +309,7 @@ func (f *FileWriteTool) Execute(ctx context.Context, params map[string]interface
 	}
 
 	// Check file existence based on mode
-	_, err := os.Stat(path)
+	_, err = os.Stat(path)
 	fileExists := err == nil
 
 	switch mode {
@@ -347,6 +357,10 @@ func (f *FileWriteTool) Execute(ctx context.Context, params map[string]interface
 	return f.CreateSuccessResult(result, fmt.Sprintf("Successfully wrote file: %s (%d bytes)", path, len(content))), nil
 }
 
+func (f *FileWriteTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(f)
+}
+
 func (f *FileWriteTool) IsAvailable(ctx context.Context) bool {
 	return true // File writing is generally always available
 }
@@ -428,6 +442,10 @@ func (j *JSONParseTool) Execute(ctx context.Context, params map[string]interface
 	return j.CreateSuccessResult(result, message), nil
 }
 
+func (j *JSONParseTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(j)
+}
+
 func (j *JSONParseTool) IsAvailable(ctx context.Context) bool {
 	return true // JSON parsing is always available
 }
@@ -566,6 +584,10 @@ func (t *TextSearchTool) Execute(ctx context.Context, params map[string]interfac
 	return t.CreateSuccessResult(result, message), nil
 }
 
+func (t *TextSearchTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
 func (t *TextSearchTool) IsAvailable(ctx context.Context) bool {
 	return true // Text search is always available
 }
\ No newline at end of file
@@ -0,0 +1,638 @@
+package tools
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Time zones do not depend on the host database
+)
+
+// maxCalcSteps bounds the work of a calculate program
+const maxCalcSteps = 100000
+
+// calcValue is a *big.Rat, calcTime, time.Duration, string, bool or []calcValue
+type calcValue interface{}
+
+// calcTime is an instant, or a calendar date when dateOnly is set. Dates are
+// kept at midnight UTC, so subtracting them gives whole days.
+type calcTime struct {
+	t        time.Time
+	dateOnly bool
+}
+
+// calcEnv evaluates statements, keeping the variables they assign
+type calcEnv struct {
+	vars  map[string]calcValue
+	steps int
+}
+
+func newCalcEnv(vars map[string]calcValue) *calcEnv {
+	env := &calcEnv{vars: map[string]calcValue{
+		"pi": mustRat(strconv.FormatFloat(math.Pi, 'g', -1, 64)),
+		"e":  mustRat(strconv.FormatFloat(math.E, 'g', -1, 64)),
+	}}
+	for name, value := range vars {
+		env.vars[name] = value
+	}
+	return env
+}
+
+func mustRat(s string) *big.Rat {
+	r, _ := new(big.Rat).SetString(s)
+	return r
+}
+
+func (env *calcEnv) eval(node calcNode) (calcValue, error) {
+	env.steps++
+	if env.steps > maxCalcSteps {
+		return nil, fmt.Errorf("calculation takes more than %d steps", maxCalcSteps)
+	}
+	switch n := node.(type) {
+	case *calcLiteral:
+		return n.value, nil
+	case *calcVar:
+		value, ok := env.vars[n.name]
+		if !ok {
+			if _, isFunc := calcFunctions[n.name]; isFunc {
+				return nil, fmt.Errorf("%s is a function, call it as %s(...)", n.name, n.name)
+			}
+			return nil, fmt.Errorf("unknown variable %s", n.name)
+		}
+		return value, nil
+	case *calcList:
+		items := make([]calcValue, len(n.items))
+		for i, item := range n.items {
+			value, err := env.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+	case *calcPercent:
+		value, err := env.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := value.(*big.Rat)
+		if !ok {
+			return nil, fmt.Errorf("%% applies to numbers, not %s", calcType(value))
+		}
+		return new(big.Rat).Quo(r, big.NewRat(100, 1)), nil
+	case *calcUnary:
+		value, err := env.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		return calcUnaryOp(n.op, value)
+	case *calcBinary:
+		return env.binary(n)
+	case *calcCall:
+		return env.call(n)
+	}
+	return nil, fmt.Errorf("invalid expression")
+}
+
+func (env *calcEnv) binary(n *calcBinary) (calcValue, error) {
+	left, err := env.eval(n.left)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "and" || n.op == "or" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s applies to booleans, not %s", n.op, calcType(left))
+		}
+		if (n.op == "and" && !l) || (n.op == "or" && l) {
+			return l, nil
+		}
+		right, err := env.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := right.(bool); !ok {
+			return nil, fmt.Errorf("%s applies to booleans, not %s", n.op, calcType(right))
+		}
+		return right, nil
+	}
+
+	// a + x% and a - x% add or subtract x percent of a, as on a calculator
+	if percent, ok := n.right.(*calcPercent); ok && (n.op == "+" || n.op == "-") {
+		if base, ok := left.(*big.Rat); ok {
+			value, err := env.eval(percent.operand)
+			if err != nil {
+				return nil, err
+			}
+			rate, ok := value.(*big.Rat)
+			if !ok {
+				return nil, fmt.Errorf("%% applies to numbers, not %s", calcType(value))
+			}
+			delta := new(big.Rat).Mul(base, rate)
+			delta.Quo(delta, big.NewRat(100, 1))
+			if n.op == "-" {
+				delta.Neg(delta)
+			}
+			return delta.Add(delta, base), nil
+		}
+	}
+
+	right, err := env.eval(n.right)
+	if err != nil {
+		return nil, err
+	}
+	return calcBinaryOp(n.op, left, right)
+}
+
+func calcUnaryOp(op string, value calcValue) (calcValue, error) {
+	switch v := value.(type) {
+	case *big.Rat:
+		switch op {
+		case "-":
+			return new(big.Rat).Neg(v), nil
+		case "+":
+			return v, nil
+		}
+	case time.Duration:
+		switch op {
+		case "-":
+			return -v, nil
+		case "+":
+			return v, nil
+		}
+	case bool:
+		if op == "!" {
+			return !v, nil
+		}
+	}
+	return nil, fmt.Errorf("%s cannot be applied to %s", op, calcType(value))
+}
+
+func calcBinaryOp(op string, left, right calcValue) (calcValue, error) {
+	switch op {
+	case "==", "!=":
+		equal, err := calcEqual(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return equal == (op == "=="), nil
+	case "<", "<=", ">", ">=":
+		cmp, err := calcCompare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+	}
+
+	switch l := left.(type) {
+	case *big.Rat:
+		switch r := right.(type) {
+		case *big.Rat:
+			return ratOp(op, l, r)
+		case time.Duration:
+			if op == "*" {
+				return scaleDuration(r, l)
+			}
+		}
+	case time.Duration:
+		switch r := right.(type) {
+		case time.Duration:
+			switch op {
+			case "+":
+				return addDurations(l, r)
+			case "-":
+				return addDurations(l, -r)
+			case "/":
+				if r == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return big.NewRat(int64(l), int64(r)), nil
+			}
+		case *big.Rat:
+			switch op {
+			case "*":
+				return scaleDuration(l, r)
+			case "/":
+				if r.Sign() == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return scaleDuration(l, new(big.Rat).Inv(r))
+			}
+		case calcTime:
+			if op == "+" {
+				return addToTime(r, l), nil
+			}
+		}
+	case calcTime:
+		switch r := right.(type) {
+		case time.Duration:
+			switch op {
+			case "+":
+				return addToTime(l, r), nil
+			case "-":
+				return addToTime(l, -r), nil
+			}
+		case calcTime:
+			if op == "-" {
+				return l.t.Sub(r.t), nil
+			}
+		}
+	case string:
+		if r, ok := right.(string); ok && op == "+" {
+			return l + r, nil
+		}
+	}
+	return nil, fmt.Errorf("%s cannot be applied to %s and %s", op, calcType(left), calcType(right))
+}
+
+func ratOp(op string, l, r *big.Rat) (calcValue, error) {
+	result := new(big.Rat)
+	switch op {
+	case "+":
+		result.Add(l, r)
+	case "-":
+		result.Sub(l, r)
+	case "*":
+		result.Mul(l, r)
+	case "/":
+		if r.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result.Quo(l, r)
+	case "%":
+		if r.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		// Floored modulo: the result has the sign of the divisor
+		quotient := floorRat(new(big.Rat).Quo(l, r))
+		result.Sub(l, quotient.Mul(quotient, r))
+	case "^":
+		if exp, ok := ratInt(r); ok {
+			return ratPow(l, exp)
+		}
+		if r.IsInt() {
+			return nil, fmt.Errorf("number too large")
+		}
+		return ratFromFloat(math.Pow(ratFloat(l), ratFloat(r)))
+	default:
+		return nil, fmt.Errorf("%s cannot be applied to numbers", op)
+	}
+	return result, checkRat(result)
+}
+
+// addToTime adds a duration; a date stays a date when the duration is whole days
+func addToTime(t calcTime, d time.Duration) calcTime {
+	result := calcTime{t: t.t.Add(d), dateOnly: t.dateOnly}
+	if d%(24*time.Hour) != 0 {
+		result.dateOnly = false
+	}
+	return result
+}
+
+func addDurations(a, b time.Duration) (calcValue, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return nil, fmt.Errorf("duration too large")
+	}
+	return sum, nil
+}
+
+func scaleDuration(d time.Duration, factor *big.Rat) (calcValue, error) {
+	ns := new(big.Rat).Mul(big.NewRat(int64(d), 1), factor)
+	return durationFromNanos(ns)
+}
+
+// durationFromNanos rounds to whole nanoseconds and checks the range
+func durationFromNanos(ns *big.Rat) (time.Duration, error) {
+	rounded := roundRat(ns, 0)
+	if !rounded.Num().IsInt64() {
+		return 0, fmt.Errorf("duration too large (limit about 292 years)")
+	}
+	return time.Duration(rounded.Num().Int64()), nil
+}
+
+func calcEqual(left, right calcValue) (bool, error) {
+	switch l := left.(type) {
+	case bool:
+		r, ok := right.(bool)
+		return ok && l == r, nil
+	case []calcValue:
+		return false, fmt.Errorf("lists cannot be compared")
+	}
+	if cmp, err := calcCompare(left, right); err == nil {
+		return cmp == 0, nil
+	}
+	return false, nil
+}
+
+func calcCompare(left, right calcValue) (int, error) {
+	switch l := left.(type) {
+	case *big.Rat:
+		if r, ok := right.(*big.Rat); ok {
+			return l.Cmp(r), nil
+		}
+	case time.Duration:
+		if r, ok := right.(time.Duration); ok {
+			return cmp.Compare(l, r), nil
+		}
+	case calcTime:
+		if r, ok := right.(calcTime); ok {
+			return l.t.Compare(r.t), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", calcType(left), calcType(right))
+}
+
+func calcType(value calcValue) string {
+	switch v := value.(type) {
+	case *big.Rat:
+		return "number"
+	case calcTime:
+		if v.dateOnly {
+			return "date"
+		}
+		return "datetime"
+	case time.Duration:
+		return "duration"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []calcValue:
+		return "list"
+	}
+	return "unknown"
+}
+
+// formatCalcValue writes a value for the model; numbers get at most places
+// decimals unless they are exact with fewer
+func formatCalcValue(value calcValue, places int) string {
+	switch v := value.(type) {
+	case *big.Rat:
+		return formatDecimal(v, places)
+	case calcTime:
+		if v.dateOnly {
+			return v.t.Format("2006-01-02") + " (" + v.t.Weekday().String() + ")"
+		}
+		return v.t.Format("2006-01-02T15:04:05.999999999Z07:00") + " (" + v.t.Location().String() + ", " + v.t.Weekday().String() + ")"
+	case time.Duration:
+		return formatDuration(v)
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []calcValue:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatCalcValue(item, places)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// formatDuration writes days, hours, minutes and seconds, such as 1d 2h 30m
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	var parts []string
+	for _, unit := range []struct {
+		size time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}} {
+		if d >= unit.size {
+			parts = append(parts, strconv.FormatInt(int64(d/unit.size), 10)+unit.name)
+			d %= unit.size
+		}
+	}
+	if d > 0 {
+		seconds := new(big.Rat).SetFrac64(int64(d), int64(time.Second))
+		parts = append(parts, formatDecimal(seconds, 9)+"s")
+	}
+	return sign + strings.Join(parts, " ")
+}
+
+// parseDuration reads durations such as 1h30m, 2d, 1.5h or 1w 2d. The units
+// are w, d, h, m (or min), s, ms, us and ns.
+func parseDuration(s string) (time.Duration, error) {
+	text := strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimLeft(text, "+-")
+	if text == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	units := map[string]int64{
+		"w": int64(7 * 24 * time.Hour), "d": int64(24 * time.Hour), "h": int64(time.Hour),
+		"m": int64(time.Minute), "min": int64(time.Minute), "s": int64(time.Second),
+		"ms": int64(time.Millisecond), "us": int64(time.Microsecond), "ns": 1,
+	}
+	total := new(big.Rat)
+	for text != "" {
+		i := 0
+		for i < len(text) && (text[i] == '.' || (text[i] >= '0' && text[i] <= '9')) {
+			i++
+		}
+		j := i
+		for j < len(text) && text[j] >= 'a' && text[j] <= 'z' {
+			j++
+		}
+		size, ok := units[text[i:j]]
+		if i == 0 || !ok {
+			return 0, fmt.Errorf("invalid duration %q (use units w, d, h, m, s, ms)", s)
+		}
+		amount, err := parseDecimal(text[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total.Add(total, amount.Mul(amount, big.NewRat(size, 1)))
+		text = text[j:]
+	}
+	if negative {
+		total.Neg(total)
+	}
+	return durationFromNanos(total)
+}
+
+// parseCalcTime reads a date or date and time. Times without an offset are in
+// loc; times with one are converted to loc.
+func parseCalcTime(s string, loc *time.Location) (calcTime, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05Z07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return calcTime{t: t.In(loc)}, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02 15:04:05.999999999", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return calcTime{t: t}, nil
+		}
+	}
+	return calcTime{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD, YYYY-MM-DDTHH:MM[:SS] or RFC 3339)", s)
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || strings.EqualFold(name, "local") {
+		return nil, fmt.Errorf("unknown time zone %q (use IANA names such as Europe/Madrid or UTC)", name)
+	}
+	return loc, nil
+}
+
+// calendarDay counts days since the epoch for the date shown by t in its zone
+func calendarDay(t time.Time) int64 {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+}
+
+// addMonths adds calendar months, clamping the day to the end of the month:
+// January 31 plus one month is February 28 or 29
+func addMonths(t time.Time, months int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(d, last)-1)
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// businessDays counts Monday to Friday days from a (included) to b (excluded),
+// negative when b is before a
+func businessDays(a, b time.Time) int64 {
+	from, to := calendarDay(a), calendarDay(b)
+	sign := int64(1)
+	if to < from {
+		from, to = to, from
+		sign = -1
+	}
+	// Day 0, 1970-01-01, was a Thursday: weekday index 0 = Monday
+	weekdays := func(day int64) int64 { // Business days in [0, day)
+		weeks, rest := day/7, day%7
+		if rest < 0 {
+			weeks, rest = weeks-1, rest+7
+		}
+		count := weeks * 5
+		for i := int64(0); i < rest; i++ {
+			if (i+3)%7 < 5 {
+				count++
+			}
+		}
+		return count
+	}
+	return sign * (weekdays(to) - weekdays(from))
+}
+
+// formatTime implements the strftime directives %Y %m %d %H %M %S %y %B %b %A
+// %a %j %p %I %Z %z %F %T %s and %%
+func formatTime(t time.Time, pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			b.WriteString(t.Format("2006"))
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'I':
+			b.WriteString(t.Format("03"))
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'M':
+			b.WriteString(t.Format("04"))
+		case 'S':
+			b.WriteString(t.Format("05"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'b':
+			b.WriteString(t.Format("Jan"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'j':
+			b.WriteString(fmt.Sprintf("%03d", t.YearDay()))
+		case 'Z':
+			b.WriteString(t.Format("MST"))
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'F':
+			b.WriteString(t.Format("2006-01-02"))
+		case 'T':
+			b.WriteString(t.Format("15:04:05"))
+		case 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
+// flattenNumbers collects the numbers of the arguments and the lists among them
+func flattenNumbers(name string, args []calcValue) ([]*big.Rat, error) {
+	var numbers []*big.Rat
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case *big.Rat:
+			numbers = append(numbers, v)
+		case []calcValue:
+			inner, err := flattenNumbers(name, v)
+			if err != nil {
+				return nil, err
+			}
+			numbers = append(numbers, inner...)
+		default:
+			return nil, fmt.Errorf("%s expects numbers, got %s", name, calcType(arg))
+		}
+	}
+	return numbers, nil
+}
+
+// sortedCalcVars lists variable names in order for deterministic output
+func sortedCalcVars(vars map[string]calcValue) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,425 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxCalcExpression bounds the length of a calculate program
+	maxCalcExpression = 10000
+
+	// maxCalcDepth bounds the nesting of parentheses and function calls
+	maxCalcDepth = 64
+)
+
+type calcTokenKind int
+
+const (
+	calcEOF calcTokenKind = iota
+	calcNumber
+	calcString
+	calcIdent
+	calcOp
+	calcSep // ; or a line break between statements
+)
+
+type calcToken struct {
+	kind calcTokenKind
+	text string
+	pos  int
+}
+
+// calcOperators are matched longest first
+var calcOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "**", "+", "-", "*", "/", "^", "%", "(", ")", "[", "]", ",", "=", "<", ">", "!"}
+
+func lexCalc(src string) ([]calcToken, error) {
+	var tokens []calcToken
+	runes := []rune(src)
+	nesting := 0 // Line breaks inside parentheses and brackets do not end a statement
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ';' || (r == '\n' && nesting == 0):
+			tokens = append(tokens, calcToken{calcSep, string(r), i})
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '#': // Comment to the end of the line
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == '_') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					for i = j; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+					}
+				}
+			}
+			tokens = append(tokens, calcToken{calcNumber, strings.ReplaceAll(string(runes[start:i]), "_", ""), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, calcToken{calcIdent, string(runes[start:i]), start})
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if runes[i] == r {
+					i++
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			tokens = append(tokens, calcToken{calcString, b.String(), start})
+		default:
+			matched := false
+			for _, op := range calcOperators {
+				if strings.HasPrefix(string(runes[i:min(i+2, len(runes))]), op) {
+					switch op {
+					case "(", "[":
+						nesting++
+					case ")", "]":
+						nesting = max(nesting-1, 0)
+					}
+					tokens = append(tokens, calcToken{calcOp, op, i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+		}
+	}
+	return append(tokens, calcToken{calcEOF, "", len(runes)}), nil
+}
+
+// Syntax tree of a calculate program
+type (
+	calcNode interface{}
+
+	calcLiteral struct{ value calcValue }
+	calcVar     struct{ name string }
+	calcUnary   struct {
+		op      string
+		operand calcNode
+	}
+	calcBinary struct {
+		op          string
+		left, right calcNode
+	}
+	calcPercent struct{ operand calcNode } // x% is x/100, but a + x% adds x percent of a
+	calcCall    struct {
+		name string
+		args []calcNode
+	}
+	calcList      struct{ items []calcNode }
+	calcStatement struct {
+		name string // Assigned variable, "" for an expression
+		expr calcNode
+	}
+)
+
+type calcParser struct {
+	tokens []calcToken
+	pos    int
+	depth  int
+}
+
+// parseCalc parses statements separated by ; or line breaks. A statement is an
+// expression or an assignment, name = expression.
+func parseCalc(src string) ([]calcStatement, error) {
+	if len(src) > maxCalcExpression {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxCalcExpression)
+	}
+	tokens, err := lexCalc(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &calcParser{tokens: tokens}
+	var statements []calcStatement
+	for {
+		for p.peek().kind == calcSep {
+			p.pos++
+		}
+		if p.peek().kind == calcEOF {
+			break
+		}
+		var statement calcStatement
+		if p.peek().kind == calcIdent && p.tokens[p.pos+1].text == "=" && p.tokens[p.pos+1].kind == calcOp {
+			statement.name = p.next().text
+			p.pos++
+		}
+		if statement.expr, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if tok := p.peek(); tok.kind != calcSep && tok.kind != calcEOF {
+			return nil, p.unexpected(tok)
+		}
+		statements = append(statements, statement)
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return statements, nil
+}
+
+func (p *calcParser) peek() calcToken { return p.tokens[p.pos] }
+
+func (p *calcParser) next() calcToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != calcEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the operator or keyword if it is next
+func (p *calcParser) accept(texts ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != calcOp && tok.kind != calcIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *calcParser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return p.unexpected(p.peek())
+	}
+	return nil
+}
+
+func (p *calcParser) unexpected(tok calcToken) error {
+	if tok.kind == calcEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *calcParser) expr() (calcNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxCalcDepth {
+		return nil, fmt.Errorf("expression is nested too deeply")
+	}
+	return p.or()
+}
+
+func (p *calcParser) or() (calcNode, error) {
+	left, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("||", "or"); !ok {
+			break
+		}
+		var right calcNode
+		if right, err = p.and(); err == nil {
+			left = &calcBinary{"or", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *calcParser) and() (calcNode, error) {
+	left, err := p.comparison()
+	for err == nil {
+		if _, ok := p.accept("&&", "and"); !ok {
+			break
+		}
+		var right calcNode
+		if right, err = p.comparison(); err == nil {
+			left = &calcBinary{"and", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *calcParser) comparison() (calcNode, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("==", "!=", "<", "<=", ">", ">="); ok {
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &calcBinary{op, left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *calcParser) additive() (calcNode, error) {
+	left, err := p.multiplicative()
+	for err == nil {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			break
+		}
+		var right calcNode
+		if right, err = p.multiplicative(); err == nil {
+			left = &calcBinary{op, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *calcParser) multiplicative() (calcNode, error) {
+	left, err := p.unary()
+	for err == nil {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			break
+		}
+		var right calcNode
+		if right, err = p.unary(); err == nil {
+			left = &calcBinary{op, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *calcParser) unary() (calcNode, error) {
+	if op, ok := p.accept("-", "+", "!", "not"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "not" {
+			op = "!"
+		}
+		return &calcUnary{op, operand}, nil
+	}
+	return p.power()
+}
+
+// power is right associative and binds tighter than unary minus: -2^2 is -4
+func (p *calcParser) power() (calcNode, error) {
+	base, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("^", "**"); ok {
+		exponent, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &calcBinary{"^", base, exponent}, nil
+	}
+	return base, nil
+}
+
+// postfix reads a % that ends an operand as a percentage; followed by an
+// operand, % is the modulo operator
+func (p *calcParser) postfix() (calcNode, error) {
+	operand, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == calcOp && p.peek().text == "%" && !startsOperand(p.tokens[p.pos+1]) {
+		p.pos++
+		operand = &calcPercent{operand}
+	}
+	return operand, nil
+}
+
+func startsOperand(tok calcToken) bool {
+	switch tok.kind {
+	case calcNumber, calcString:
+		return true
+	case calcIdent:
+		return tok.text != "and" && tok.text != "or"
+	case calcOp:
+		return tok.text == "(" || tok.text == "["
+	}
+	return false
+}
+
+func (p *calcParser) primary() (calcNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case calcNumber:
+		value, err := parseDecimal(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("%v at position %d", err, tok.pos)
+		}
+		return &calcLiteral{value}, nil
+	case calcString:
+		return &calcLiteral{tok.text}, nil
+	case calcIdent:
+		switch tok.text {
+		case "true":
+			return &calcLiteral{true}, nil
+		case "false":
+			return &calcLiteral{false}, nil
+		}
+		if _, ok := p.accept("("); !ok {
+			return &calcVar{tok.text}, nil
+		}
+		args, err := p.list(")")
+		if err != nil {
+			return nil, err
+		}
+		return &calcCall{tok.text, args}, nil
+	case calcOp:
+		switch tok.text {
+		case "(":
+			node, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			items, err := p.list("]")
+			if err != nil {
+				return nil, err
+			}
+			return &calcList{items}, nil
+		}
+	}
+	return nil, p.unexpected(tok)
+}
+
+// list reads comma separated expressions up to the closing token
+func (p *calcParser) list(closing string) ([]calcNode, error) {
+	var items []calcNode
+	if _, ok := p.accept(closing); ok {
+		return items, nil
+	}
+	for {
+		item, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		return items, p.expect(closing)
+	}
+}
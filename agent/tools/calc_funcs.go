@@ -0,0 +1,538 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxBusinessDays bounds add_business_days, which steps one day at a time
+const maxBusinessDays = 100000
+
+// calcFunction is a function of calculate. max is -1 for any number of
+// arguments.
+type calcFunction struct {
+	min, max int
+	usage    string
+	fn       func(args []calcValue) (calcValue, error)
+}
+
+var calcFunctions = map[string]calcFunction{
+	// Numbers
+	"round": {1, 2, "round(x, places=0), halves away from zero", func(args []calcValue) (calcValue, error) {
+		x, err := ratArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		places := int64(0)
+		if len(args) > 1 {
+			if places, err = intArg(args, 1); err != nil {
+				return nil, err
+			}
+		}
+		if places < 0 || places > 100 {
+			return nil, fmt.Errorf("places must be between 0 and 100")
+		}
+		return roundRat(x, int(places)), nil
+	}},
+	"floor": {1, 1, "floor(x)", ratFunc(floorRat)},
+	"ceil":  {1, 1, "ceil(x)", ratFunc(ceilRat)},
+	"trunc": {1, 1, "trunc(x)", ratFunc(truncRat)},
+	"abs":   {1, 1, "abs(x)", ratFunc(func(x *big.Rat) *big.Rat { return new(big.Rat).Abs(x) })},
+	"sqrt": {1, 1, "sqrt(x), approximate", floatFunc(func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, fmt.Errorf("square root of a negative number")
+		}
+		return math.Sqrt(x), nil
+	})},
+	"ln": {1, 1, "ln(x), approximate", floatFunc(func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, fmt.Errorf("logarithm of a number that is not positive")
+		}
+		return math.Log(x), nil
+	})},
+	"log10": {1, 1, "log10(x), approximate", floatFunc(func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, fmt.Errorf("logarithm of a number that is not positive")
+		}
+		return math.Log10(x), nil
+	})},
+	"exp": {1, 1, "exp(x), approximate", floatFunc(func(x float64) (float64, error) { return math.Exp(x), nil })},
+	"pow": {2, 2, "pow(x, y), same as x ^ y", func(args []calcValue) (calcValue, error) {
+		return binaryRatFunc(args, "^")
+	}},
+	"mod": {2, 2, "mod(a, b), with the sign of b", func(args []calcValue) (calcValue, error) {
+		return binaryRatFunc(args, "%")
+	}},
+	"percent": {2, 2, "percent(part, whole): part as a percentage of whole", func(args []calcValue) (calcValue, error) {
+		ratio, err := binaryRatFunc(args, "/")
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Rat).Mul(ratio.(*big.Rat), big.NewRat(100, 1)), nil
+	}},
+	"sum": {0, -1, "sum(x, ...) of numbers or lists", func(args []calcValue) (calcValue, error) {
+		numbers, err := flattenNumbers("sum", args)
+		if err != nil {
+			return nil, err
+		}
+		total := new(big.Rat)
+		for _, n := range numbers {
+			total.Add(total, n)
+		}
+		return total, nil
+	}},
+	"avg": {1, -1, "avg(x, ...) of numbers or lists", func(args []calcValue) (calcValue, error) {
+		numbers, err := flattenNumbers("avg", args)
+		if err != nil {
+			return nil, err
+		}
+		if len(numbers) == 0 {
+			return nil, fmt.Errorf("no numbers to average")
+		}
+		total := new(big.Rat)
+		for _, n := range numbers {
+			total.Add(total, n)
+		}
+		return total.Quo(total, big.NewRat(int64(len(numbers)), 1)), nil
+	}},
+	"min": {1, -1, "min(x, ...) of numbers or lists", extremeFunc("min", -1)},
+	"max": {1, -1, "max(x, ...) of numbers or lists", extremeFunc("max", 1)},
+	"count": {0, -1, "count(x, ...): how many numbers the arguments hold", func(args []calcValue) (calcValue, error) {
+		numbers, err := flattenNumbers("count", args)
+		if err != nil {
+			return nil, err
+		}
+		return big.NewRat(int64(len(numbers)), 1), nil
+	}},
+
+	// Dates and times
+	"date": {1, 1, `date("YYYY-MM-DD") or date(datetime): a calendar date`, func(args []calcValue) (calcValue, error) {
+		if t, ok := args[0].(calcTime); ok {
+			y, m, d := t.t.Date()
+			return calcTime{t: time.Date(y, m, d, 0, 0, 0, 0, time.UTC), dateOnly: true}, nil
+		}
+		s, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q (use YYYY-MM-DD)", s)
+		}
+		return calcTime{t: t, dateOnly: true}, nil
+	}},
+	"datetime": {1, 2, `datetime("YYYY-MM-DDTHH:MM[:SS]" or date, tz="UTC")`, func(args []calcValue) (calcValue, error) {
+		loc, err := locationArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := args[0].(calcTime); ok {
+			if !t.dateOnly {
+				return calcTime{t: t.t.In(loc)}, nil
+			}
+			y, m, d := t.t.Date()
+			return calcTime{t: time.Date(y, m, d, 0, 0, 0, 0, loc)}, nil
+		}
+		s, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return parseCalcTime(s, loc)
+	}},
+	"from_unix": {1, 2, "from_unix(seconds, tz=\"UTC\")", func(args []calcValue) (calcValue, error) {
+		seconds, err := ratArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := locationArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		ns := roundRat(new(big.Rat).Mul(seconds, big.NewRat(int64(time.Second), 1)), 0)
+		if !ns.Num().IsInt64() {
+			return nil, fmt.Errorf("timestamp out of range")
+		}
+		return calcTime{t: time.Unix(0, ns.Num().Int64()).In(loc)}, nil
+	}},
+	"unix": {1, 1, "unix(datetime): seconds since 1970-01-01 UTC", func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Rat).SetFrac64(t.t.UnixNano(), int64(time.Second)), nil
+	}},
+	"in_tz": {2, 2, `in_tz(datetime, "Area/City"): the same instant in another zone`, func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if t.dateOnly {
+			return nil, fmt.Errorf("a date has no time zone, use datetime(date, tz)")
+		}
+		loc, err := locationArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return calcTime{t: t.t.In(loc)}, nil
+	}},
+	"add_days":   {2, 2, "add_days(t, n): calendar days, keeping the local time across DST changes", addCalendar(func(t time.Time, n int) time.Time { return t.AddDate(0, 0, n) })},
+	"add_months": {2, 2, "add_months(t, n), clamped to the end of the month", addCalendar(addMonths)},
+	"add_years":  {2, 2, "add_years(t, n), February 29 becomes February 28", addCalendar(func(t time.Time, n int) time.Time { return addMonths(t, 12*n) })},
+	"add_business_days": {2, 2, "add_business_days(t, n): skips Saturdays and Sundays", func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := intArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxBusinessDays || n < -maxBusinessDays {
+			return nil, fmt.Errorf("at most %d business days", maxBusinessDays)
+		}
+		step := 1
+		if n < 0 {
+			step, n = -1, -n
+		}
+		result := t.t
+		for n > 0 {
+			result = result.AddDate(0, 0, step)
+			if !isWeekend(result) {
+				n--
+			}
+		}
+		return calcTime{t: result, dateOnly: t.dateOnly}, nil
+	}},
+	"days_between": {2, 2, "days_between(a, b): calendar days from a to b", func(args []calcValue) (calcValue, error) {
+		a, b, err := twoTimes(args)
+		if err != nil {
+			return nil, err
+		}
+		return big.NewRat(calendarDay(b.t)-calendarDay(a.t), 1), nil
+	}},
+	"business_days": {2, 2, "business_days(a, b): Monday to Friday days from a (included) to b (excluded)", func(args []calcValue) (calcValue, error) {
+		a, b, err := twoTimes(args)
+		if err != nil {
+			return nil, err
+		}
+		return big.NewRat(businessDays(a.t, b.t), 1), nil
+	}},
+	"start_of": {2, 2, `start_of(t, "day"|"week"|"month"|"year"), weeks start on Monday`, func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		unit, err := stringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		y, m, d := t.t.Date()
+		loc := t.t.Location()
+		var start time.Time
+		switch unit {
+		case "day":
+			start = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		case "week":
+			offset := (int(t.t.Weekday()) + 6) % 7
+			start = time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+		case "month":
+			start = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		case "year":
+			start = time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+		default:
+			return nil, fmt.Errorf("unknown unit %q (use day, week, month or year)", unit)
+		}
+		return calcTime{t: start, dateOnly: t.dateOnly}, nil
+	}},
+	"weekday": {1, 1, "weekday(t): Monday, Tuesday...", func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return t.t.Weekday().String(), nil
+	}},
+	"year":   {1, 1, "year(t)", timePart(func(t time.Time) int { return t.Year() })},
+	"month":  {1, 1, "month(t), 1 to 12", timePart(func(t time.Time) int { return int(t.Month()) })},
+	"day":    {1, 1, "day(t), day of the month", timePart(func(t time.Time) int { return t.Day() })},
+	"hour":   {1, 1, "hour(t)", timePart(func(t time.Time) int { return t.Hour() })},
+	"minute": {1, 1, "minute(t)", timePart(func(t time.Time) int { return t.Minute() })},
+	"format": {2, 2, `format(t, "%Y-%m-%d %H:%M"), strftime directives`, func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := stringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return formatTime(t.t, pattern), nil
+	}},
+
+	// Durations
+	"duration": {1, 1, `duration("1h30m"), units w, d, h, m, s, ms`, func(args []calcValue) (calcValue, error) {
+		s, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return parseDuration(s)
+	}},
+	"weeks":   {1, 1, "weeks(n): a duration", durationFunc(7 * 24 * time.Hour)},
+	"days":    {1, 1, "days(n): a duration of n times 24 hours, see add_days", durationFunc(24 * time.Hour)},
+	"hours":   {1, 1, "hours(n): a duration", durationFunc(time.Hour)},
+	"minutes": {1, 1, "minutes(n): a duration", durationFunc(time.Minute)},
+	"seconds": {1, 1, "seconds(n): a duration", durationFunc(time.Second)},
+
+	// Units
+	"convert": {2, 3, `convert(x, "from", "to") or convert(duration, "to")`, func(args []calcValue) (calcValue, error) {
+		if d, ok := args[0].(time.Duration); ok {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("convert(duration, unit) takes the target unit only")
+			}
+			to, err := stringArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return convertUnits(new(big.Rat).SetFrac64(int64(d), int64(time.Second)), "s", to)
+		}
+		if len(args) != 3 {
+			return nil, fmt.Errorf("convert(x, from, to) needs both units")
+		}
+		x, err := ratArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		from, err := stringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		to, err := stringArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return convertUnits(x, from, to)
+	}},
+}
+
+// call evaluates a function call. if evaluates only the branch it returns.
+func (env *calcEnv) call(n *calcCall) (calcValue, error) {
+	if n.name == "if" {
+		if len(n.args) != 3 {
+			return nil, fmt.Errorf("if expects (condition, then, else)")
+		}
+		cond, err := env.eval(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, ok := cond.(bool)
+		if !ok {
+			return nil, fmt.Errorf("if: condition is %s, not boolean", calcType(cond))
+		}
+		if b {
+			return env.eval(n.args[1])
+		}
+		return env.eval(n.args[2])
+	}
+
+	f, ok := calcFunctions[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s (available: %s)", n.name, strings.Join(calcFunctionNames(), ", "))
+	}
+	if len(n.args) < f.min || (f.max >= 0 && len(n.args) > f.max) {
+		return nil, fmt.Errorf("%s: wrong number of arguments, usage: %s", n.name, f.usage)
+	}
+	args := make([]calcValue, len(n.args))
+	for i, arg := range n.args {
+		value, err := env.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	result, err := f.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	if r, ok := result.(*big.Rat); ok {
+		if err := checkRat(r); err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+	}
+	return result, nil
+}
+
+func calcFunctionNames() []string {
+	names := make([]string, 0, len(calcFunctions)+1)
+	for name := range calcFunctions {
+		names = append(names, name)
+	}
+	names = append(names, "if")
+	sort.Strings(names)
+	return names
+}
+
+func ratArg(args []calcValue, i int) (*big.Rat, error) {
+	r, ok := args[i].(*big.Rat)
+	if !ok {
+		return nil, fmt.Errorf("argument %d must be a number, got %s", i+1, calcType(args[i]))
+	}
+	return r, nil
+}
+
+func intArg(args []calcValue, i int) (int64, error) {
+	r, err := ratArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := ratInt(r)
+	if !ok || n > math.MaxInt32 || n < math.MinInt32 {
+		return 0, fmt.Errorf("argument %d must be a whole number", i+1)
+	}
+	return n, nil
+}
+
+func stringArg(args []calcValue, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d must be a string, got %s", i+1, calcType(args[i]))
+	}
+	return s, nil
+}
+
+func timeArg(args []calcValue, i int) (calcTime, error) {
+	t, ok := args[i].(calcTime)
+	if !ok {
+		return calcTime{}, fmt.Errorf(`argument %d must be a date or datetime, got %s (use date("YYYY-MM-DD") or datetime(...))`, i+1, calcType(args[i]))
+	}
+	return t, nil
+}
+
+func twoTimes(args []calcValue) (calcTime, calcTime, error) {
+	a, err := timeArg(args, 0)
+	if err != nil {
+		return calcTime{}, calcTime{}, err
+	}
+	b, err := timeArg(args, 1)
+	return a, b, err
+}
+
+// locationArg reads an optional time zone argument, UTC when absent
+func locationArg(args []calcValue, i int) (*time.Location, error) {
+	if i >= len(args) {
+		return time.UTC, nil
+	}
+	name, err := stringArg(args, i)
+	if err != nil {
+		return nil, err
+	}
+	return loadLocation(name)
+}
+
+func ratFunc(f func(*big.Rat) *big.Rat) func([]calcValue) (calcValue, error) {
+	return func(args []calcValue) (calcValue, error) {
+		x, err := ratArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return f(x), nil
+	}
+}
+
+// floatFunc wraps functions without an exact form, computed in float64
+func floatFunc(f func(float64) (float64, error)) func([]calcValue) (calcValue, error) {
+	return func(args []calcValue) (calcValue, error) {
+		x, err := ratArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		result, err := f(ratFloat(x))
+		if err != nil {
+			return nil, err
+		}
+		return ratFromFloat(result)
+	}
+}
+
+func binaryRatFunc(args []calcValue, op string) (calcValue, error) {
+	a, err := ratArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ratArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return ratOp(op, a, b)
+}
+
+func extremeFunc(name string, sign int) func([]calcValue) (calcValue, error) {
+	return func(args []calcValue) (calcValue, error) {
+		// Dates and durations compare too, when they are not mixed with numbers
+		if len(args) > 1 {
+			if _, isNumber := args[0].(*big.Rat); !isNumber {
+				best := args[0]
+				for _, arg := range args[1:] {
+					cmp, err := calcCompare(arg, best)
+					if err != nil {
+						return nil, err
+					}
+					if cmp*sign > 0 {
+						best = arg
+					}
+				}
+				return best, nil
+			}
+		}
+		numbers, err := flattenNumbers(name, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(numbers) == 0 {
+			return nil, fmt.Errorf("no numbers")
+		}
+		best := numbers[0]
+		for _, n := range numbers[1:] {
+			if n.Cmp(best)*sign > 0 {
+				best = n
+			}
+		}
+		return best, nil
+	}
+}
+
+func addCalendar(add func(time.Time, int) time.Time) func([]calcValue) (calcValue, error) {
+	return func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := intArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return calcTime{t: add(t.t, int(n)), dateOnly: t.dateOnly}, nil
+	}
+}
+
+func timePart(part func(time.Time) int) func([]calcValue) (calcValue, error) {
+	return func(args []calcValue) (calcValue, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return big.NewRat(int64(part(t.t)), 1), nil
+	}
+}
+
+func durationFunc(unit time.Duration) func([]calcValue) (calcValue, error) {
+	return func(args []calcValue) (calcValue, error) {
+		n, err := ratArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return durationFromNanos(new(big.Rat).Mul(n, big.NewRat(int64(unit), 1)))
+	}
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// calcUnit converts a unit to the base unit of its dimension: base = value *
+// factor + offset. Only temperatures have an offset.
+type calcUnit struct {
+	dimension string
+	factor    *big.Rat
+	offset    *big.Rat
+}
+
+// calcUnitDefs lists the units by dimension: names (the first is canonical),
+// factor to the base unit (the first of the dimension) and offset, as
+// decimals or fractions. Factors are the exact legal definitions, so
+// conversions are exact.
+var calcUnitDefs = []struct {
+	dimension string
+	names     []string
+	factor    string
+	offset    string
+}{
+	{"length", []string{"m", "meter", "meters", "metre", "metres"}, "1", "0"},
+	{"length", []string{"km", "kilometer", "kilometers", "kilometre", "kilometres"}, "1000", "0"},
+	{"length", []string{"cm", "centimeter", "centimeters"}, "0.01", "0"},
+	{"length", []string{"mm", "millimeter", "millimeters"}, "0.001", "0"},
+	{"length", []string{"mi", "mile", "miles"}, "1609.344", "0"},
+	{"length", []string{"yd", "yard", "yards"}, "0.9144", "0"},
+	{"length", []string{"ft", "foot", "feet"}, "0.3048", "0"},
+	{"length", []string{"in", "inch", "inches"}, "0.0254", "0"},
+	{"length", []string{"nmi", "nautical_mile", "nautical_miles"}, "1852", "0"},
+
+	{"mass", []string{"kg", "kilogram", "kilograms"}, "1", "0"},
+	{"mass", []string{"g", "gram", "grams"}, "0.001", "0"},
+	{"mass", []string{"mg", "milligram", "milligrams"}, "0.000001", "0"},
+	{"mass", []string{"t", "tonne", "tonnes"}, "1000", "0"},
+	{"mass", []string{"lb", "lbs", "pound", "pounds"}, "0.45359237", "0"},
+	{"mass", []string{"oz", "ounce", "ounces"}, "0.028349523125", "0"},
+
+	{"volume", []string{"l", "L", "liter", "liters", "litre", "litres"}, "1", "0"},
+	{"volume", []string{"ml", "mL", "milliliter", "milliliters"}, "0.001", "0"},
+	{"volume", []string{"m3", "cubic_meter", "cubic_meters"}, "1000", "0"},
+	{"volume", []string{"gal", "gallon", "gallons"}, "3.785411784", "0"},
+	{"volume", []string{"qt", "quart", "quarts"}, "0.946352946", "0"},
+	{"volume", []string{"pt", "pint", "pints"}, "0.473176473", "0"},
+	{"volume", []string{"cup", "cups"}, "0.2365882365", "0"},
+	{"volume", []string{"floz", "fl_oz"}, "0.0295735295625", "0"},
+
+	{"area", []string{"m2", "square_meter", "square_meters"}, "1", "0"},
+	{"area", []string{"km2", "square_kilometer", "square_kilometers"}, "1000000", "0"},
+	{"area", []string{"cm2"}, "0.0001", "0"},
+	{"area", []string{"ha", "hectare", "hectares"}, "10000", "0"},
+	{"area", []string{"acre", "acres"}, "4046.8564224", "0"},
+	{"area", []string{"ft2", "square_foot", "square_feet"}, "0.09290304", "0"},
+	{"area", []string{"mi2", "square_mile", "square_miles"}, "2589988.110336", "0"},
+
+	{"time", []string{"s", "sec", "second", "seconds"}, "1", "0"},
+	{"time", []string{"ns", "nanosecond", "nanoseconds"}, "0.000000001", "0"},
+	{"time", []string{"us", "microsecond", "microseconds"}, "0.000001", "0"},
+	{"time", []string{"ms", "millisecond", "milliseconds"}, "0.001", "0"},
+	{"time", []string{"min", "minute", "minutes"}, "60", "0"},
+	{"time", []string{"h", "hr", "hour", "hours"}, "3600", "0"},
+	{"time", []string{"d", "day", "days"}, "86400", "0"},
+	{"time", []string{"wk", "week", "weeks"}, "604800", "0"},
+
+	{"data", []string{"B", "byte", "bytes"}, "1", "0"},
+	{"data", []string{"bit", "bits"}, "0.125", "0"},
+	{"data", []string{"KB", "kB", "kilobyte", "kilobytes"}, "1000", "0"},
+	{"data", []string{"MB", "megabyte", "megabytes"}, "1000000", "0"},
+	{"data", []string{"GB", "gigabyte", "gigabytes"}, "1000000000", "0"},
+	{"data", []string{"TB", "terabyte", "terabytes"}, "1000000000000", "0"},
+	{"data", []string{"KiB", "kibibyte", "kibibytes"}, "1024", "0"},
+	{"data", []string{"MiB", "mebibyte", "mebibytes"}, "1048576", "0"},
+	{"data", []string{"GiB", "gibibyte", "gibibytes"}, "1073741824", "0"},
+	{"data", []string{"TiB", "tebibyte", "tebibytes"}, "1099511627776", "0"},
+	{"data", []string{"kbit", "kilobit", "kilobits"}, "125", "0"},
+	{"data", []string{"Mbit", "megabit", "megabits"}, "125000", "0"},
+	{"data", []string{"Gbit", "gigabit", "gigabits"}, "125000000", "0"},
+
+	{"speed", []string{"m/s", "mps"}, "1", "0"},
+	{"speed", []string{"km/h", "kph", "kmh"}, "5/18", "0"},
+	{"speed", []string{"mph"}, "0.44704", "0"},
+	{"speed", []string{"kn", "knot", "knots"}, "463/900", "0"},
+	{"speed", []string{"ft/s", "fps"}, "0.3048", "0"},
+
+	{"energy", []string{"J", "joule", "joules"}, "1", "0"},
+	{"energy", []string{"kJ", "kilojoule", "kilojoules"}, "1000", "0"},
+	{"energy", []string{"cal", "calorie", "calories"}, "4.184", "0"},
+	{"energy", []string{"kcal", "kilocalorie", "kilocalories"}, "4184", "0"},
+	{"energy", []string{"Wh", "watt_hour", "watt_hours"}, "3600", "0"},
+	{"energy", []string{"kWh", "kilowatt_hour", "kilowatt_hours"}, "3600000", "0"},
+
+	{"temperature", []string{"K", "kelvin"}, "1", "0"},
+	{"temperature", []string{"C", "°C", "degC", "celsius"}, "1", "273.15"},
+	{"temperature", []string{"F", "°F", "degF", "fahrenheit"}, "5/9", "45967/180"},
+}
+
+// calcUnits indexes the units by name
+var calcUnits = buildCalcUnits()
+
+func buildCalcUnits() map[string]*calcUnit {
+	units := make(map[string]*calcUnit)
+	for _, def := range calcUnitDefs {
+		factor, _ := new(big.Rat).SetString(def.factor)
+		offset, _ := new(big.Rat).SetString(def.offset)
+		unit := &calcUnit{dimension: def.dimension, factor: factor, offset: offset}
+		for _, name := range def.names {
+			units[name] = unit
+		}
+	}
+	return units
+}
+
+// lookupUnit finds a unit by name, ignoring case when only one unit matches,
+// so kwh finds kWh
+func lookupUnit(name string) (*calcUnit, error) {
+	if unit, ok := calcUnits[name]; ok {
+		return unit, nil
+	}
+	var found *calcUnit
+	for candidate, unit := range calcUnits {
+		if !strings.EqualFold(candidate, name) {
+			continue
+		}
+		if found != nil && found != unit {
+			return nil, fmt.Errorf("unit %q is ambiguous, check its case", name)
+		}
+		found = unit
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown unit %q (known: %s)", name, strings.Join(unitNames(), ", "))
+	}
+	return found, nil
+}
+
+// convertUnits converts value between two units of the same dimension
+func convertUnits(value *big.Rat, from, to string) (*big.Rat, error) {
+	fromUnit, err := lookupUnit(from)
+	if err != nil {
+		return nil, err
+	}
+	toUnit, err := lookupUnit(to)
+	if err != nil {
+		return nil, err
+	}
+	if fromUnit.dimension != toUnit.dimension {
+		return nil, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, fromUnit.dimension, to, toUnit.dimension)
+	}
+	base := new(big.Rat).Mul(value, fromUnit.factor)
+	base.Add(base, fromUnit.offset)
+	result := base.Sub(base, toUnit.offset)
+	return result.Quo(result, toUnit.factor), nil
+}
+
+// unitNames lists the canonical unit names for error messages
+func unitNames() []string {
+	names := make([]string, 0, len(calcUnitDefs))
+	for _, def := range calcUnitDefs {
+		names = append(names, def.names[0])
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// calcIdentPattern matches the variable names an expression can use
+var calcIdentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CalculateTool evaluates arithmetic, date and unit conversion expressions.
+// Numbers are exact decimals, so prices add up to the cent, and evaluation
+// depends only on the expression: there is no clock, file or network access.
+type CalculateTool struct {
+	*BaseTool
+}
+
+// CalculationResult is the outcome of a calculate call
+type CalculationResult struct {
+	Result    string            `json:"result"`
+	Type      string            `json:"type"`
+	Variables map[string]string `json:"variables,omitempty"` // Values assigned by the expression
+}
+
+// NewCalculateTool creates the calculate tool
+func NewCalculateTool() *CalculateTool {
+	tool := &CalculateTool{
+		BaseTool: NewBaseTool(
+			"calculate",
+			"Evaluates an expression exactly: use it for any arithmetic, totals, percentages, date and duration math or unit conversion instead of computing in your head. "+
+				"Numbers are exact decimals (0.1 + 0.2 is 0.3). Operators: + - * / ^, % (200 * 15% is 30, 200 + 10% is 220; use mod(a, b) for remainders), comparisons, and/or/not. "+
+				"Several statements can be separated by ; or new lines, with assignments such as subtotal = 3 * 19.99. "+
+				"Numbers: round(x, places), floor, ceil, trunc, abs, min, max, sum, avg, count, percent(part, whole), sqrt, pow, ln, log10, exp, mod, if(cond, a, b). "+
+				`Dates: date("2024-01-31"), datetime("2024-03-10T09:00", "Europe/Madrid"), from_unix(s, tz), unix(t), in_tz(t, tz), add_days, add_months, add_years, add_business_days, days_between(a, b), business_days(a, b), start_of(t, "week"), weekday, year, month, day, hour, minute, format(t, "%Y-%m-%d %H:%M"). `+
+				`Durations: duration("1h30m"), weeks(n), days(n), hours(n), minutes(n), seconds(n); date - date is a duration. `+
+				`Units: convert(x, "mi", "km") for length, mass, volume, area, time, data (MB, GiB...), speed, energy and temperature; convert(duration, "h"). There is no now(): pass today's date explicitly.`,
+			CategoryCalculation,
+			false,
+			1,
+		),
+	}
+	tool.SetParameterSchema(&ParameterSchema{
+		Type:        "object",
+		Description: "Parameters for a calculation",
+		Properties: map[string]PropertySchema{
+			"expression": {
+				Type:        "string",
+				Description: "Expression or statements to evaluate; the value of the last one is the result",
+			},
+			"variables": {
+				Type:                 "object",
+				Description:          "Values the expression can use by name, such as prices taken from a previous result",
+				AdditionalProperties: &PropertySchema{OneOf: []PropertySchema{{Type: "number"}, {Type: "string"}, {Type: "boolean"}, {Type: "array"}}},
+			},
+			"decimals": {
+				Type:        "integer",
+				Description: "Decimals shown for results that are not exact with fewer (default 12); use round() to round for real",
+				Minimum:     func() *float64 { v := 0.0; return &v }(),
+				Maximum:     func() *float64 { v := 50.0; return &v }(),
+			},
+		},
+		Required: []string{"expression"},
+	})
+	return tool
+}
+
+func (t *CalculateTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
+func (t *CalculateTool) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+func (t *CalculateTool) Execute(ctx context.Context, params map[string]interface{}) (*ToolResult, error) {
+	places := defaultDecimalPlaces
+	if decimals, ok := params["decimals"].(float64); ok {
+		places = int(decimals)
+	}
+
+	vars := make(map[string]calcValue)
+	if variables, ok := params["variables"].(map[string]interface{}); ok {
+		for name, raw := range variables {
+			if !calcIdentPattern.MatchString(name) {
+				return t.CreateErrorResult(fmt.Errorf("invalid variable name %q", name), "Invalid parameters"), nil
+			}
+			value, err := calcValueFromJSON(raw)
+			if err != nil {
+				return t.CreateErrorResult(fmt.Errorf("variable %s: %w", name, err), "Invalid parameters"), nil
+			}
+			vars[name] = value
+		}
+	}
+
+	statements, err := parseCalc(stringParam(params, "expression"))
+	if err != nil {
+		return t.CreateErrorResult(err, "Invalid expression"), nil
+	}
+
+	env := newCalcEnv(vars)
+	var lines []string
+	assigned := make(map[string]string)
+	var result calcValue
+	for _, statement := range statements {
+		if result, err = env.eval(statement.expr); err != nil {
+			return t.CreateErrorResult(err, "Calculation failed"), nil
+		}
+		if statement.name != "" {
+			env.vars[statement.name] = result
+			assigned[statement.name] = formatCalcValue(result, places)
+			lines = append(lines, statement.name+" = "+assigned[statement.name])
+		}
+	}
+
+	formatted := formatCalcValue(result, places)
+	if statements[len(statements)-1].name == "" {
+		lines = append(lines, "= "+formatted)
+	}
+	if len(assigned) == 0 {
+		assigned = nil
+	}
+	return t.CreateSuccessResult(&CalculationResult{
+		Result:    formatted,
+		Type:      calcType(result),
+		Variables: assigned,
+	}, strings.Join(lines, "\n")), nil
+}
+
+// calcValueFromJSON converts a decoded JSON value to a calculate value
+func calcValueFromJSON(raw interface{}) (calcValue, error) {
+	switch v := raw.(type) {
+	case float64:
+		return ratFromFloat(v)
+	case string, bool:
+		return v, nil
+	case []interface{}:
+		items := make([]calcValue, len(v))
+		for i, item := range v {
+			value, err := calcValueFromJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+	case *big.Rat:
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v (use numbers, strings, booleans or lists)", raw)
+}
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type calcCase struct {
+	expr    string
+	want    string // Formatted result
+	wantErr string // Substring of the error, when the calculation must fail
+}
+
+func runCalcCases(t *testing.T, cases []calcCase) {
+	t.Helper()
+	tool := NewCalculateTool()
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			result, err := tool.Execute(context.Background(), map[string]interface{}{"expression": tc.expr})
+			if err != nil {
+				t.Fatalf("Execute returned error: %v", err)
+			}
+			if tc.wantErr != "" {
+				if result.Success {
+					t.Fatalf("expected error containing %q, got result %v", tc.wantErr, result.Data)
+				}
+				if !strings.Contains(result.Error, tc.wantErr) {
+					t.Fatalf("error = %q, want it to contain %q", result.Error, tc.wantErr)
+				}
+				return
+			}
+			if !result.Success {
+				t.Fatalf("calculation failed: %s", result.Error)
+			}
+			if got := result.Data.(*CalculationResult).Result; got != tc.want {
+				t.Errorf("result = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCalculateNumbers(t *testing.T) {
+	runCalcCases(t, []calcCase{
+		{expr: "0.1+0.2", want: "0.3"},
+		{expr: "1/3", want: "0.333333333333"},
+		{expr: "2/3 * 3", want: "2"},
+		{expr: "round(2.345,2)", want: "2.35"},
+		{expr: "round(-2.5,0)", want: "-3"},
+		{expr: "floor(-2.5)", want: "-3"},
+		{expr: "trunc(-2.5)", want: "-2"},
+		{expr: "-2^2", want: "-4"},
+		{expr: "2 ** 10", want: "1024"},
+		{expr: "mod(-7, 3)", want: "2"},
+		{expr: "sum([1, 2, 3.5])", want: "6.5"},
+		{expr: "avg(1, 2)", want: "1.5"},
+		{expr: "subtotal = 3 * 19.99 + 2 * 5.50; tax = round(subtotal * 21%, 2); subtotal + tax", want: "85.87"},
+		{expr: "if(2 > 1, \"yes\", 1/0)", want: `"yes"`},
+		{expr: "9^9^9", wantErr: "number too large"},
+		{expr: "1/0", wantErr: "division by zero"},
+		{expr: "mod(5, 0)", wantErr: "division by zero"},
+		{expr: "foo(1)", wantErr: "unknown function foo"},
+		{expr: "1 +", wantErr: "unexpected end of expression"},
+	})
+}
+
+func TestCalculatePercentages(t *testing.T) {
+	runCalcCases(t, []calcCase{
+		{expr: "200 + 10%", want: "220"},
+		{expr: "200 - 10%", want: "180"},
+		{expr: "200 * 15%", want: "30"},
+		{expr: "50%", want: "0.5"},
+		{expr: "10 % 3", want: "1"},
+		{expr: "percent(30, 200)", want: "15"},
+	})
+}
+
+func TestCalculateDates(t *testing.T) {
+	runCalcCases(t, []calcCase{
+		{expr: `add_months(date("2024-01-31"), 1)`, want: "2024-02-29 (Thursday)"},
+		{expr: `add_months(date("2023-01-31"), 1)`, want: "2023-02-28 (Tuesday)"},
+		{expr: `add_years(date("2024-02-29"), 1)`, want: "2025-02-28 (Friday)"},
+		// 02:30 does not exist on the night clocks move forward
+		{expr: `datetime("2024-03-31T02:30","Europe/Madrid")`, want: "2024-03-31T03:30:00+02:00 (Europe/Madrid, Sunday)"},
+		// A calendar day keeps the wall clock, 24 hours do not
+		{expr: `add_days(datetime("2024-03-30T12:00","Europe/Madrid"), 1)`, want: "2024-03-31T12:00:00+02:00 (Europe/Madrid, Sunday)"},
+		{expr: `datetime("2024-03-30T12:00","Europe/Madrid") + days(1)`, want: "2024-03-31T13:00:00+02:00 (Europe/Madrid, Sunday)"},
+		{expr: `in_tz(datetime("2024-03-10T09:00","Europe/Madrid"), "Asia/Tokyo")`, want: "2024-03-10T17:00:00+09:00 (Asia/Tokyo, Sunday)"},
+		{expr: `days_between(date("2024-01-01"), date("2024-12-31"))`, want: "365"},
+		{expr: `weekday(date("2024-06-07"))`, want: `"Friday"`},
+		{expr: `format(date("2024-06-07"), "%d/%m/%Y")`, want: `"07/06/2024"`},
+		{expr: `datetime("2024-01-01T00:00", "Mars/Base")`, wantErr: "unknown time zone"},
+	})
+}
+
+func TestCalculateBusinessDays(t *testing.T) {
+	runCalcCases(t, []calcCase{
+		{expr: `business_days(date("2024-06-03"), date("2024-06-17"))`, want: "10"},
+		{expr: `add_business_days(date("2024-06-07"), 1)`, want: "2024-06-10 (Monday)"},
+		{expr: `start_of(date("2024-06-07"), "week")`, want: "2024-06-03 (Monday)"},
+	})
+}
+
+func TestCalculateDurations(t *testing.T) {
+	runCalcCases(t, []calcCase{
+		{expr: `duration("1h30m") * 3`, want: "4h 30m"},
+		{expr: `date("2024-03-01") - date("2024-02-01")`, want: "29d"},
+		{expr: `convert(duration("90m"), "h")`, want: "1.5"},
+		{expr: `hours(1) + minutes(15)`, want: "1h 15m"},
+		{expr: `duration("1x")`, wantErr: "duration"},
+	})
+}
+
+func TestCalculateUnits(t *testing.T) {
+	runCalcCases(t, []calcCase{
+		{expr: `convert(100, "C", "F")`, want: "212"},
+		{expr: `convert(-40, "F", "C")`, want: "-40"},
+		{expr: `convert(0, "C", "K")`, want: "273.15"},
+		{expr: `convert(1, "GiB", "MB")`, want: "1073.741824"},
+		{expr: `convert(5, "mi", "km")`, want: "8.04672"},
+		{expr: `convert(1, "kg", "m")`, wantErr: "cannot convert kg (mass) to m (length)"},
+	})
+}
+
+func TestCalculateVariables(t *testing.T) {
+	tool := NewCalculateTool()
+	result, err := tool.Execute(context.Background(), map[string]interface{}{
+		"expression": "price * qty",
+		"variables":  map[string]interface{}{"price": 19.99, "qty": 3.0},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("calculation failed: %v %s", err, result.Error)
+	}
+	if got := result.Data.(*CalculationResult).Result; got != "59.97" {
+		t.Errorf("result = %q, want 59.97", got)
+	}
+}
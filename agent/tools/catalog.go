@@ -0,0 +1,397 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// Requirement is a security setting that must be enabled for a built-in tool
+type Requirement string
+
+const (
+	RequiresAPIAccess  Requirement = "allow_api_access"
+	RequiresFileAccess Requirement = "allow_file_access"
+	RequiresShell      Requirement = "allow_shell"
+)
+
+// met reports whether the security configuration enables the requirement
+func (r Requirement) met(security config.SecurityConfig) bool {
+	switch r {
+	case RequiresAPIAccess:
+		return security.AllowAPIAccess
+	case RequiresFileAccess:
+		return security.AllowFileAccess
+	case RequiresShell:
+		return security.AllowShell
+	}
+	return false
+}
+
+// CatalogEntry describes a built-in tool that tools.enabled_tools can enable
+type CatalogEntry struct {
+	Name     string
+	Aliases  []string      // Earlier names accepted in enabled_tools
+	Config   []string      // Config keys the tool reads
+	Requires []Requirement // Security settings the tool needs
+	build    func(b *catalogBuild) ([]Tool, error)
+}
+
+// Catalog lists the built-in tools
+func Catalog() []CatalogEntry {
+	return []CatalogEntry{
+		{
+			Name:    "kbase",
+			Aliases: []string{"search_docs"},
+			Config:  []string{"kbase.path"},
+			build:   (*catalogBuild).kbase,
+		},
+		{
+			Name:     "http_request",
+			Aliases:  []string{"api_call"},
+			Config:   []string{"tools.api_endpoints", "tools.http"},
+			Requires: []Requirement{RequiresAPIAccess},
+			build: func(b *catalogBuild) ([]Tool, error) {
+				return []Tool{NewHTTPRequestTool(b.apiClient(), b.cfg.Tools.HTTP.ConfirmMethods)}, nil
+			},
+		},
+		{
+			Name:     "http_get",
+			Config:   []string{"tools.api_endpoints", "tools.http"},
+			Requires: []Requirement{RequiresAPIAccess},
+			build: func(b *catalogBuild) ([]Tool, error) {
+				return []Tool{NewHTTPGetTool(b.apiClient())}, nil
+			},
+		},
+		{
+			Name:     "file_read",
+			Config:   []string{"tools.file_roots", "security.restricted_paths"},
+			Requires: []Requirement{RequiresFileAccess},
+			build: func(b *catalogBuild) ([]Tool, error) {
+				roots, err := b.fileRoots()
+				if err != nil {
+					return nil, err
+				}
+				return []Tool{NewFileReadTool(roots)}, nil
+			},
+		},
+		{
+			Name:     "file_write",
+			Config:   []string{"tools.file_roots", "security.restricted_paths"},
+			Requires: []Requirement{RequiresFileAccess},
+			build: func(b *catalogBuild) ([]Tool, error) {
+				roots, err := b.fileRoots()
+				if err != nil {
+					return nil, err
+				}
+				return []Tool{NewFileWriteTool(roots)}, nil
+			},
+		},
+		{
+			Name:     "data_query",
+			Config:   []string{"tools.file_roots", "security.restricted_paths"},
+			Requires: []Requirement{RequiresFileAccess},
+			build: func(b *catalogBuild) ([]Tool, error) {
+				roots, err := b.fileRoots()
+				if err != nil {
+					return nil, err
+				}
+				return []Tool{NewDataQueryTool(roots)}, nil
+			},
+		},
+		{
+			Name:     "shell_exec",
+			Config:   []string{"tools.shell", "security.restricted_paths"},
+			Requires: []Requirement{RequiresShell},
+			build:    (*catalogBuild).shell,
+		},
+		{
+			Name:  "calculate",
+			build: func(b *catalogBuild) ([]Tool, error) { return []Tool{NewCalculateTool()}, nil },
+		},
+		{
+			Name:  "json_query",
+			build: func(b *catalogBuild) ([]Tool, error) { return []Tool{NewJSONQueryTool()}, nil },
+		},
+		{
+			Name:  "json_parse",
+			build: func(b *catalogBuild) ([]Tool, error) { return []Tool{NewJSONParseTool()}, nil },
+		},
+		{
+			Name:  "text_search",
+			build: func(b *catalogBuild) ([]Tool, error) { return []Tool{NewTextSearchTool()}, nil },
+		},
+		{
+			// Built by the agent, which starts the sub-agents
+			Name:   "delegate",
+			Config: []string{"tools.delegate"},
+			build:  func(b *catalogBuild) ([]Tool, error) { return nil, nil },
+		},
+	}
+}
+
+// ToolEnabled reports whether tools.enabled_tools, or the default set without
+// it, enables the catalog entry name
+func ToolEnabled(cfg *config.Config, name string) bool {
+	entries, err := enabledEntries(cfg)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildTools creates the built-in tools named in tools.enabled_tools and the
+// operations of the enabled OpenAPI specs. Without enabled_tools, kbase and,
+// when API access is allowed, http_request are built.
+//
+// Unknown names, tools whose security requirement is disabled and file roots or
+// shell work directories that overlap a restricted path are errors. The returned notes report what was
+// skipped or imported, for the startup log.
+func BuildTools(cfg *config.Config, provider llm.Provider) ([]Tool, []string, error) {
+	entries, err := enabledEntries(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := &catalogBuild{cfg: cfg, provider: provider}
+	if err := b.loadSpecs(); err != nil {
+		return nil, nil, err
+	}
+
+	var built []Tool
+	for _, entry := range entries {
+		entryTools, err := entry.build(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tool %s: %w", entry.Name, err)
+		}
+		built = append(built, entryTools...)
+	}
+
+	openAPITools, err := b.openAPITools()
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(built, openAPITools...), b.notes, nil
+}
+
+// enabledEntries resolves tools.enabled_tools, with aliases, to catalog entries
+// and checks their security requirements
+func enabledEntries(cfg *config.Config) ([]CatalogEntry, error) {
+	catalog := Catalog()
+	byName := make(map[string]int, len(catalog))
+	available := make([]string, 0, len(catalog))
+	for i, entry := range catalog {
+		byName[entry.Name] = i
+		for _, alias := range entry.Aliases {
+			byName[alias] = i
+		}
+		available = append(available, entry.Name)
+	}
+
+	names := cfg.Tools.EnabledTools
+	explicit := names != nil
+	if !explicit {
+		names = []string{"kbase"}
+		if cfg.Security.AllowAPIAccess {
+			names = append(names, "http_request")
+		}
+	}
+
+	var entries []CatalogEntry
+	seen := map[int]bool{}
+	for _, name := range names {
+		i, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q in tools.enabled_tools (available: %s)", name, strings.Join(available, ", "))
+		}
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+
+		entry := catalog[i]
+		for _, requirement := range entry.Requires {
+			if !requirement.met(cfg.Security) {
+				return nil, fmt.Errorf("tool %s is enabled in tools.enabled_tools but requires security.%s", entry.Name, requirement)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// catalogBuild holds what the built-in tools share while they are built: the
+// HTTP client and the file roots are created once
+type catalogBuild struct {
+	cfg      *config.Config
+	provider llm.Provider
+	specs    map[string]*OpenAPISpec
+	client   *APIClient
+	roots    []*RestrictedFS
+	notes    []string
+}
+
+func (b *catalogBuild) kbase() ([]Tool, error) {
+	path := b.cfg.KnowledgeBase.Path
+	if path == "" {
+		return nil, fmt.Errorf("kbase.path is not set")
+	}
+	if _, err := os.Stat(path); err != nil {
+		b.notes = append(b.notes, fmt.Sprintf("Knowledge base path %s does not exist, skipping knowledge base tools", path))
+		return nil, nil
+	}
+	restrictedFS, err := NewRestrictedFS(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create restricted filesystem: %w", err)
+	}
+	return []Tool{NewSearchEngineToolWithLLM(restrictedFS, b.provider)}, nil
+}
+
+// loadSpecs reads the enabled OpenAPI specs, whose hosts the HTTP client allows
+func (b *catalogBuild) loadSpecs() error {
+	b.specs = make(map[string]*OpenAPISpec)
+	for name, apiConfig := range b.cfg.Tools.OpenAPI {
+		if !apiConfig.Enabled {
+			continue
+		}
+		if !RequiresAPIAccess.met(b.cfg.Security) {
+			return fmt.Errorf("tools.openapi.%s is enabled but requires security.%s", name, RequiresAPIAccess)
+		}
+		spec, err := LoadOpenAPISpec(apiConfig.Spec)
+		if err != nil {
+			return fmt.Errorf("failed to load OpenAPI spec %s: %w", name, err)
+		}
+		b.specs[name] = spec
+	}
+	return nil
+}
+
+func (b *catalogBuild) openAPITools() ([]Tool, error) {
+	names := make([]string, 0, len(b.specs))
+	for name := range b.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var built []Tool
+	for _, name := range names {
+		imported, warnings, err := ImportOpenAPI(name, b.specs[name], b.cfg.Tools.OpenAPI[name], b.apiClient(), b.cfg.Tools.HTTP.ConfirmMethods)
+		if err != nil {
+			return nil, err
+		}
+		for _, warning := range warnings {
+			b.notes = append(b.notes, fmt.Sprintf("OpenAPI %s: %s", name, warning))
+		}
+		for _, tool := range imported {
+			built = append(built, tool)
+		}
+		b.notes = append(b.notes, fmt.Sprintf("Registered %d tools from OpenAPI spec %s", len(imported), name))
+	}
+	return built, nil
+}
+
+// apiClient returns the client shared by the HTTP tools. The absolute base URLs
+// of the OpenAPI specs are added as endpoints, so their hosts are allowed.
+func (b *catalogBuild) apiClient() *APIClient {
+	if b.client != nil {
+		return b.client
+	}
+	endpoints := make(map[string]string, len(b.cfg.Tools.APIEndpoints)+len(b.specs))
+	for name, baseURL := range b.cfg.Tools.APIEndpoints {
+		endpoints[name] = baseURL
+	}
+	for name, spec := range b.specs {
+		// Relative base URLs are sent to the conversation API host instead
+		if baseURL := OpenAPIBaseURL(spec, b.cfg.Tools.OpenAPI[name]); strings.Contains(baseURL, "://") {
+			if _, exists := endpoints[name]; !exists {
+				endpoints[name] = baseURL
+			}
+		}
+	}
+	b.client = NewAPIClient(endpoints, b.cfg.Tools.HTTP)
+	return b.client
+}
+
+// fileRoots opens tools.file_roots (the knowledge base by default) and rejects
+// roots that contain or sit inside a restricted path
+func (b *catalogBuild) fileRoots() ([]*RestrictedFS, error) {
+	if b.roots != nil {
+		return b.roots, nil
+	}
+	dirs := b.cfg.Tools.FileRoots
+	if len(dirs) == 0 {
+		if b.cfg.KnowledgeBase.Path == "" {
+			return nil, fmt.Errorf("tools.file_roots is empty and kbase.path is not set")
+		}
+		dirs = []string{b.cfg.KnowledgeBase.Path}
+	}
+
+	roots := make([]*RestrictedFS, 0, len(dirs))
+	for _, dir := range dirs {
+		root, err := NewRestrictedFS(dir)
+		if err != nil {
+			return nil, fmt.Errorf("file root %s: %w", dir, err)
+		}
+		if err := b.checkRestricted("file root "+dir, root); err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	b.roots = roots
+	return roots, nil
+}
+
+// shell builds shell_exec jailed in tools.shell.work_dir, the current
+// directory by default
+func (b *catalogBuild) shell() ([]Tool, error) {
+	dir := b.cfg.Tools.Shell.WorkDir
+	if dir == "" {
+		dir = "."
+	}
+	workDir, err := NewRestrictedFS(dir)
+	if err != nil {
+		return nil, fmt.Errorf("work directory %s: %w", dir, err)
+	}
+	if err := b.checkRestricted("work directory "+dir, workDir); err != nil {
+		return nil, err
+	}
+	tool, notes, err := NewShellExecTool(b.cfg.Tools.Shell, workDir)
+	if err != nil {
+		return nil, err
+	}
+	b.notes = append(b.notes, notes...)
+	return []Tool{tool}, nil
+}
+
+// checkRestricted rejects a root that contains or sits inside a restricted path
+func (b *catalogBuild) checkRestricted(what string, root *RestrictedFS) error {
+	realRoot := realPath(root.GetRoot())
+	for _, restricted := range b.cfg.Security.RestrictedPaths {
+		realRestricted := realPath(restricted)
+		if pathWithin(realRestricted, realRoot) || pathWithin(realRoot, realRestricted) {
+			return fmt.Errorf("%s overlaps security.restricted_paths entry %s", what, restricted)
+		}
+	}
+	return nil
+}
+
+// realPath returns the absolute path with symlinks resolved where it exists
+func realPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := evalExistingSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
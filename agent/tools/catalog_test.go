@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+)
+
+func TestToolEnabled(t *testing.T) {
+	cfg := &config.Config{}
+	if ToolEnabled(cfg, "delegate") {
+		t.Error("delegate is enabled without enabled_tools")
+	}
+	if !ToolEnabled(cfg, "kbase") {
+		t.Error("kbase is not enabled by default")
+	}
+
+	cfg.Tools.EnabledTools = []string{"search_docs", "delegate"}
+	if !ToolEnabled(cfg, "delegate") || !ToolEnabled(cfg, "kbase") {
+		t.Errorf("enabled_tools %v: delegate and kbase should be enabled", cfg.Tools.EnabledTools)
+	}
+
+	// The agent registers delegate itself, so the catalog builds nothing for it
+	cfg.Tools.EnabledTools = []string{"calculate", "delegate"}
+	built, _, err := BuildTools(cfg, nil)
+	if err != nil {
+		t.Fatalf("BuildTools with delegate enabled: %v", err)
+	}
+	if len(built) != 1 || built[0].GetName() != "calculate" {
+		t.Errorf("BuildTools built %d tools, want only calculate", len(built))
+	}
+}
@@ -0,0 +1,966 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dataAggregates are the functions computed over the rows of a group
+var dataAggregates = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// dataFunctions are the row functions, with their argument counts
+var dataFunctions = map[string][2]int{
+	"LOWER": {1, 1}, "UPPER": {1, 1}, "TRIM": {1, 1}, "LENGTH": {1, 1}, "ROUND": {1, 2}, "ABS": {1, 1},
+	"COALESCE": {1, 100}, "YEAR": {1, 1}, "MONTH": {1, 1}, "DAY": {1, 1}, "STRFTIME": {2, 2},
+}
+
+// dataScope is what an expression is evaluated against: a row, and the rows
+// of its group when the query aggregates
+type dataScope struct {
+	row   []calcValue
+	group [][]calcValue
+}
+
+// likeCache keeps the regular expression of the last LIKE pattern, which is
+// usually the same for every row
+type likeCache struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// dataResult holds the rows a query produced, before display limits
+type dataResult struct {
+	columns []string
+	rows    [][]calcValue
+	matched int // Rows that passed WHERE
+}
+
+// bindDataQuery resolves column references against the table. Aliases of the
+// select list can be used in the other clauses; a column of the same name wins.
+func bindDataQuery(q *dataQuery, table *dataTable) error {
+	aliases := make(map[string]dataNode)
+	for i := range q.items {
+		item := &q.items[i]
+		if item.expr == nil {
+			continue
+		}
+		expr, err := bindDataNode(item.expr, table, nil)
+		if err != nil {
+			return err
+		}
+		item.expr = expr
+		if item.alias != "" {
+			aliases[strings.ToLower(item.alias)] = expr
+		}
+	}
+
+	var err error
+	if q.where != nil {
+		if q.where, err = bindDataNode(q.where, table, aliases); err != nil {
+			return err
+		}
+		if hasDataAggregate(q.where) {
+			return fmt.Errorf("aggregates cannot be used in WHERE, use HAVING")
+		}
+	}
+	for i := range q.groupBy {
+		if q.groupBy[i], err = bindDataNode(q.groupBy[i], table, aliases); err != nil {
+			return err
+		}
+		if hasDataAggregate(q.groupBy[i]) {
+			return fmt.Errorf("aggregates cannot be used in GROUP BY")
+		}
+	}
+	if q.having != nil {
+		if q.having, err = bindDataNode(q.having, table, aliases); err != nil {
+			return err
+		}
+	}
+	for i := range q.orderBy {
+		if q.orderBy[i].expr, err = bindDataNode(q.orderBy[i].expr, table, aliases); err != nil {
+			return err
+		}
+	}
+
+	if !q.grouped() {
+		return nil
+	}
+	// Outside aggregates, a grouped query can only use the GROUP BY expressions
+	groupKeys := make(map[string]bool)
+	for _, expr := range q.groupBy {
+		groupKeys[formatDataNode(expr)] = true
+	}
+	check := []dataNode{q.having}
+	for _, item := range q.items {
+		if item.expr == nil {
+			return fmt.Errorf("SELECT * cannot be used with GROUP BY or aggregates")
+		}
+		check = append(check, item.expr)
+	}
+	for _, order := range q.orderBy {
+		check = append(check, order.expr)
+	}
+	for _, node := range check {
+		if err := checkGroupedNode(node, groupKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grouped reports whether the query produces a row per group
+func (q *dataQuery) grouped() bool {
+	if len(q.groupBy) > 0 || q.having != nil {
+		return true
+	}
+	for _, item := range q.items {
+		if item.expr != nil && hasDataAggregate(item.expr) {
+			return true
+		}
+	}
+	for _, order := range q.orderBy {
+		if hasDataAggregate(order.expr) {
+			return true
+		}
+	}
+	return false
+}
+
+func bindDataNode(node dataNode, table *dataTable, aliases map[string]dataNode) (dataNode, error) {
+	var err error
+	switch n := node.(type) {
+	case *dataColumnRef:
+		if index, ok := table.columnIndex(n.name); ok {
+			n.index = index
+			return n, nil
+		}
+		if expr, ok := aliases[strings.ToLower(n.name)]; ok {
+			return expr, nil
+		}
+		return nil, fmt.Errorf("unknown column %s (columns: %s)", n.name, strings.Join(table.columnNames(), ", "))
+	case *dataUnary:
+		n.operand, err = bindDataNode(n.operand, table, aliases)
+	case *dataBinary:
+		if n.left, err = bindDataNode(n.left, table, aliases); err == nil {
+			n.right, err = bindDataNode(n.right, table, aliases)
+		}
+	case *dataIsNull:
+		n.operand, err = bindDataNode(n.operand, table, aliases)
+	case *dataIn:
+		if n.operand, err = bindDataNode(n.operand, table, aliases); err == nil {
+			err = bindDataNodes(n.list, table, aliases)
+		}
+	case *dataBetween:
+		if n.operand, err = bindDataNode(n.operand, table, aliases); err == nil {
+			if n.low, err = bindDataNode(n.low, table, aliases); err == nil {
+				n.high, err = bindDataNode(n.high, table, aliases)
+			}
+		}
+	case *dataLike:
+		if n.operand, err = bindDataNode(n.operand, table, aliases); err == nil {
+			n.pattern, err = bindDataNode(n.pattern, table, aliases)
+		}
+		n.cache = &likeCache{}
+	case *dataCall:
+		if err := checkDataCall(n); err != nil {
+			return nil, err
+		}
+		err = bindDataNodes(n.args, table, aliases)
+	}
+	return node, err
+}
+
+func bindDataNodes(nodes []dataNode, table *dataTable, aliases map[string]dataNode) error {
+	for i := range nodes {
+		node, err := bindDataNode(nodes[i], table, aliases)
+		if err != nil {
+			return err
+		}
+		nodes[i] = node
+	}
+	return nil
+}
+
+func checkDataCall(n *dataCall) error {
+	if dataAggregates[n.name] {
+		switch {
+		case n.star && n.name != "COUNT":
+			return fmt.Errorf("%s(*) is not supported, only COUNT(*)", n.name)
+		case !n.star && len(n.args) != 1:
+			return fmt.Errorf("%s takes one argument", n.name)
+		}
+		return nil
+	}
+	arity, ok := dataFunctions[n.name]
+	if !ok {
+		names := make([]string, 0, len(dataAggregates)+len(dataFunctions))
+		for name := range dataAggregates {
+			names = append(names, name)
+		}
+		for name := range dataFunctions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown function %s (available: %s)", n.name, strings.Join(names, ", "))
+	}
+	if n.star || n.distinct {
+		return fmt.Errorf("%s is not an aggregate", n.name)
+	}
+	if len(n.args) < arity[0] || len(n.args) > arity[1] {
+		return fmt.Errorf("%s takes %d to %d arguments, got %d", n.name, arity[0], arity[1], len(n.args))
+	}
+	return nil
+}
+
+// dataChildren returns the operands of a node
+func dataChildren(node dataNode) []dataNode {
+	switch n := node.(type) {
+	case *dataUnary:
+		return []dataNode{n.operand}
+	case *dataBinary:
+		return []dataNode{n.left, n.right}
+	case *dataIsNull:
+		return []dataNode{n.operand}
+	case *dataIn:
+		return append([]dataNode{n.operand}, n.list...)
+	case *dataBetween:
+		return []dataNode{n.operand, n.low, n.high}
+	case *dataLike:
+		return []dataNode{n.operand, n.pattern}
+	case *dataCall:
+		return n.args
+	}
+	return nil
+}
+
+func hasDataAggregate(node dataNode) bool {
+	if call, ok := node.(*dataCall); ok && dataAggregates[call.name] {
+		return true
+	}
+	for _, child := range dataChildren(node) {
+		if hasDataAggregate(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkGroupedNode(node dataNode, groupKeys map[string]bool) error {
+	if node == nil || groupKeys[formatDataNode(node)] {
+		return nil
+	}
+	switch n := node.(type) {
+	case *dataCall:
+		if dataAggregates[n.name] {
+			return nil
+		}
+	case *dataColumnRef:
+		return fmt.Errorf("column %s must be in GROUP BY or used inside an aggregate such as COUNT or SUM", n.name)
+	}
+	for _, child := range dataChildren(node) {
+		if err := checkGroupedNode(child, groupKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDataQuery filters, groups, sorts and pages the rows of a bound query
+func runDataQuery(ctx context.Context, q *dataQuery, table *dataTable) (*dataResult, error) {
+	result := &dataResult{}
+	for _, item := range q.items {
+		switch {
+		case item.expr == nil:
+			result.columns = append(result.columns, table.columnNames()...)
+		case item.alias != "":
+			result.columns = append(result.columns, item.alias)
+		default:
+			result.columns = append(result.columns, formatDataNode(item.expr))
+		}
+	}
+
+	var matched [][]calcValue
+	for i, row := range table.rows {
+		if i%10000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if q.where != nil {
+			keep, err := dataCondition(q.where, &dataScope{row: row}, "WHERE")
+			if err != nil {
+				return nil, err
+			}
+			if !keep {
+				continue
+			}
+		}
+		matched = append(matched, row)
+	}
+	result.matched = len(matched)
+
+	var scopes []*dataScope
+	if q.grouped() {
+		groups, err := groupDataRows(q.groupBy, matched)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			scope := &dataScope{group: group}
+			if len(group) > 0 {
+				scope.row = group[0]
+			}
+			if q.having != nil {
+				keep, err := dataCondition(q.having, scope, "HAVING")
+				if err != nil {
+					return nil, err
+				}
+				if !keep {
+					continue
+				}
+			}
+			scopes = append(scopes, scope)
+		}
+	} else {
+		scopes = make([]*dataScope, len(matched))
+		for i, row := range matched {
+			scopes[i] = &dataScope{row: row}
+		}
+	}
+
+	type outputRow struct {
+		values, keys []calcValue
+	}
+	rows := make([]outputRow, 0, len(scopes))
+	seen := make(map[string]bool)
+	for i, scope := range scopes {
+		if i%10000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var out outputRow
+		for _, item := range q.items {
+			if item.expr == nil {
+				out.values = append(out.values, scope.row...)
+				continue
+			}
+			value, err := evalData(item.expr, scope)
+			if err != nil {
+				return nil, err
+			}
+			out.values = append(out.values, value)
+		}
+		if q.distinct {
+			key := dataRowKey(out.values)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		for _, order := range q.orderBy {
+			// ORDER BY 2 sorts by the second column
+			if literal, ok := order.expr.(*dataLiteral); ok {
+				if r, ok := literal.value.(*big.Rat); ok {
+					position, isInt := ratInt(r)
+					if !isInt || position < 1 || int(position) > len(out.values) {
+						return nil, fmt.Errorf("ORDER BY position %s is not a column of the result", formatDecimal(r, 0))
+					}
+					out.keys = append(out.keys, out.values[position-1])
+					continue
+				}
+			}
+			value, err := evalData(order.expr, scope)
+			if err != nil {
+				return nil, err
+			}
+			out.keys = append(out.keys, value)
+		}
+		rows = append(rows, out)
+	}
+
+	if len(q.orderBy) > 0 {
+		sort.SliceStable(rows, func(a, b int) bool {
+			for i, order := range q.orderBy {
+				c := compareDataOrder(rows[a].keys[i], rows[b].keys[i])
+				if order.desc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	start := min(q.offset, len(rows))
+	end := len(rows)
+	if q.limit >= 0 {
+		end = min(start+q.limit, end)
+	}
+	for _, row := range rows[start:end] {
+		result.rows = append(result.rows, row.values)
+	}
+	return result, nil
+}
+
+// groupDataRows splits rows by the values of the GROUP BY expressions, in
+// order of first appearance. Without GROUP BY all rows form one group, even
+// when there are none, so COUNT(*) can be 0.
+func groupDataRows(groupBy []dataNode, rows [][]calcValue) ([][][]calcValue, error) {
+	if len(groupBy) == 0 {
+		return [][][]calcValue{rows}, nil
+	}
+	index := make(map[string]int)
+	var groups [][][]calcValue
+	for _, row := range rows {
+		values := make([]calcValue, len(groupBy))
+		for i, expr := range groupBy {
+			value, err := evalData(expr, &dataScope{row: row})
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		key := dataRowKey(values)
+		n, exists := index[key]
+		if !exists {
+			n = len(groups)
+			index[key] = n
+			groups = append(groups, nil)
+		}
+		groups[n] = append(groups[n], row)
+	}
+	return groups, nil
+}
+
+// dataRowKey identifies a list of values for grouping and DISTINCT
+func dataRowKey(values []calcValue) string {
+	var b strings.Builder
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			b.WriteString("n")
+		case *big.Rat:
+			b.WriteString("r" + v.RatString())
+		case calcTime:
+			b.WriteString("t" + v.t.UTC().Format(time.RFC3339Nano))
+		case time.Duration:
+			b.WriteString("d" + strconv.FormatInt(int64(v), 10))
+		default:
+			b.WriteString(fmt.Sprintf("%T:%v", v, v))
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// dataCondition evaluates a WHERE or HAVING condition; NULL does not match
+func dataCondition(node dataNode, scope *dataScope, clause string) (bool, error) {
+	value, err := evalData(node, scope)
+	if err != nil {
+		return false, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("%s must be a condition, got %s", clause, calcType(value))
+}
+
+func evalData(node dataNode, scope *dataScope) (calcValue, error) {
+	switch n := node.(type) {
+	case *dataLiteral:
+		return n.value, nil
+	case *dataColumnRef:
+		if scope.row == nil {
+			return nil, nil
+		}
+		return scope.row[n.index], nil
+	case *dataUnary:
+		value, err := evalData(n.operand, scope)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		if n.op == "NOT" {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("NOT needs a condition, got %s", calcType(value))
+			}
+			return !b, nil
+		}
+		return calcUnaryOp(n.op, value)
+	case *dataBinary:
+		return evalDataBinary(n, scope)
+	case *dataIsNull:
+		value, err := evalData(n.operand, scope)
+		if err != nil {
+			return nil, err
+		}
+		return (value == nil) != n.not, nil
+	case *dataIn:
+		value, err := evalData(n.operand, scope)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		var result calcValue = false
+		for _, item := range n.list {
+			candidate, err := evalData(item, scope)
+			if err != nil {
+				return nil, err
+			}
+			c, err := compareData(value, candidate)
+			if err != nil {
+				return nil, err
+			}
+			if c == nil {
+				result = nil
+			} else if *c == 0 {
+				result = true
+				break
+			}
+		}
+		if b, ok := result.(bool); ok && n.not {
+			return !b, nil
+		}
+		return result, nil
+	case *dataBetween:
+		low := &dataBinary{">=", n.operand, n.low}
+		high := &dataBinary{"<=", n.operand, n.high}
+		value, err := evalDataBinary(&dataBinary{"AND", low, high}, scope)
+		if b, ok := value.(bool); ok && n.not {
+			return !b, err
+		}
+		return value, err
+	case *dataLike:
+		return evalDataLike(n, scope)
+	case *dataCall:
+		if dataAggregates[n.name] {
+			return evalDataAggregate(n, scope)
+		}
+		return evalDataFunction(n, scope)
+	}
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+func evalDataBinary(n *dataBinary, scope *dataScope) (calcValue, error) {
+	left, err := evalData(n.left, scope)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "AND" || n.op == "OR" {
+		// Three-valued logic: FALSE AND NULL is FALSE, TRUE OR NULL is TRUE
+		l, err := dataLogic(n.op, left)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil && *l == (n.op == "OR") {
+			return *l, nil
+		}
+		right, err := evalData(n.right, scope)
+		if err != nil {
+			return nil, err
+		}
+		r, err := dataLogic(n.op, right)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case r != nil && *r == (n.op == "OR"):
+			return *r, nil
+		case l == nil || r == nil:
+			return nil, nil
+		}
+		return *r, nil
+	}
+
+	right, err := evalData(n.right, scope)
+	if err != nil || left == nil || right == nil {
+		return nil, err
+	}
+	switch n.op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		c, err := compareData(left, right)
+		if err != nil || c == nil {
+			return nil, err
+		}
+		switch n.op {
+		case "=":
+			return *c == 0, nil
+		case "!=":
+			return *c != 0, nil
+		case "<":
+			return *c < 0, nil
+		case "<=":
+			return *c <= 0, nil
+		case ">":
+			return *c > 0, nil
+		}
+		return *c >= 0, nil
+	}
+	return calcBinaryOp(n.op, coerceData(left, right), coerceData(right, left))
+}
+
+func dataLogic(op string, value calcValue) (*bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return &v, nil
+	}
+	return nil, fmt.Errorf("%s needs conditions, got %s", op, calcType(value))
+}
+
+// compareData compares two values, reading strings as numbers or dates when
+// compared with one, so amount > '100' and day >= '2024-01-01' work. The result
+// is nil when either value is NULL.
+func compareData(left, right calcValue) (*int, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	left, right = coerceData(left, right), coerceData(right, left)
+	var c int
+	if l, ok := left.(bool); ok {
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare boolean with %s", calcType(right))
+		}
+		switch {
+		case l == r:
+		case r:
+			c = -1
+		default:
+			c = 1
+		}
+		return &c, nil
+	}
+	c, err := calcCompare(left, right)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// coerceData converts a string to the type of the value it is compared or
+// computed with, when it can be read as one
+func coerceData(value, other calcValue) calcValue {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	switch other.(type) {
+	case *big.Rat:
+		if number, err := parseDecimal(s); err == nil {
+			return number
+		}
+	case calcTime:
+		if t, err := parseDataTime(strings.TrimSpace(s)); err == nil {
+			return t
+		}
+	case bool:
+		if strings.EqualFold(s, "true") || strings.EqualFold(s, "false") {
+			return strings.EqualFold(s, "true")
+		}
+	}
+	return value
+}
+
+// compareDataOrder orders values for ORDER BY: NULLs last, then values of
+// different types by type name
+func compareDataOrder(a, b calcValue) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if c, err := compareData(a, b); err == nil && c != nil {
+		return *c
+	}
+	return strings.Compare(calcType(a), calcType(b))
+}
+
+// evalDataLike matches case-insensitively, with % for any text and _ for one
+// character
+func evalDataLike(n *dataLike, scope *dataScope) (calcValue, error) {
+	value, err := evalData(n.operand, scope)
+	if err != nil {
+		return nil, err
+	}
+	patternValue, err := evalData(n.pattern, scope)
+	if err != nil || value == nil || patternValue == nil {
+		return nil, err
+	}
+	pattern, ok := patternValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("LIKE needs a text pattern, got %s", calcType(patternValue))
+	}
+	if n.cache.re == nil || n.cache.pattern != pattern {
+		var b strings.Builder
+		b.WriteString("(?is)^")
+		for _, r := range pattern {
+			switch r {
+			case '%':
+				b.WriteString(".*")
+			case '_':
+				b.WriteString(".")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		b.WriteString("$")
+		n.cache.pattern = pattern
+		n.cache.re = regexp.MustCompile(b.String())
+	}
+	return n.cache.re.MatchString(dataText(value)) != n.not, nil
+}
+
+func evalDataAggregate(n *dataCall, scope *dataScope) (calcValue, error) {
+	if scope.group == nil && scope.row != nil {
+		return nil, fmt.Errorf("%s cannot be used here", formatDataNode(n))
+	}
+	if n.star {
+		return big.NewRat(int64(len(scope.group)), 1), nil
+	}
+
+	var values []calcValue
+	seen := make(map[string]bool)
+	for _, row := range scope.group {
+		value, err := evalData(n.args[0], &dataScope{row: row})
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		if n.distinct {
+			key := dataRowKey([]calcValue{value})
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		values = append(values, value)
+	}
+
+	if n.name == "COUNT" {
+		return big.NewRat(int64(len(values)), 1), nil
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	switch n.name {
+	case "MIN", "MAX":
+		best := values[0]
+		for _, value := range values[1:] {
+			c, err := compareData(value, best)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", n.name, err)
+			}
+			if (n.name == "MIN" && *c < 0) || (n.name == "MAX" && *c > 0) {
+				best = value
+			}
+		}
+		return best, nil
+	}
+
+	// SUM and AVG add numbers or durations
+	var sum calcValue
+	for _, value := range values {
+		switch value.(type) {
+		case *big.Rat, time.Duration:
+		default:
+			return nil, fmt.Errorf("%s needs numbers, got %s", n.name, calcType(value))
+		}
+		if sum == nil {
+			sum = value
+			continue
+		}
+		var err error
+		if sum, err = calcBinaryOp("+", sum, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+	}
+	if n.name == "AVG" {
+		return calcBinaryOp("/", sum, big.NewRat(int64(len(values)), 1))
+	}
+	return sum, nil
+}
+
+func evalDataFunction(n *dataCall, scope *dataScope) (calcValue, error) {
+	if n.name == "COALESCE" {
+		for _, arg := range n.args {
+			value, err := evalData(arg, scope)
+			if err != nil || value != nil {
+				return value, err
+			}
+		}
+		return nil, nil
+	}
+
+	args := make([]calcValue, len(n.args))
+	for i, arg := range n.args {
+		value, err := evalData(arg, scope)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, nil
+		}
+		args[i] = value
+	}
+
+	switch n.name {
+	case "LOWER":
+		return strings.ToLower(dataText(args[0])), nil
+	case "UPPER":
+		return strings.ToUpper(dataText(args[0])), nil
+	case "TRIM":
+		return strings.TrimSpace(dataText(args[0])), nil
+	case "LENGTH":
+		return big.NewRat(int64(len([]rune(dataText(args[0])))), 1), nil
+	case "ROUND", "ABS":
+		number, ok := coerceData(args[0], new(big.Rat)).(*big.Rat)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a number, got %s", n.name, calcType(args[0]))
+		}
+		if n.name == "ABS" {
+			return new(big.Rat).Abs(number), nil
+		}
+		places := int64(0)
+		if len(args) == 2 {
+			r, isNumber := args[1].(*big.Rat)
+			if isNumber {
+				places, isNumber = ratInt(r)
+			}
+			if !isNumber || places < 0 || places > 50 {
+				return nil, fmt.Errorf("ROUND places must be a whole number from 0 to 50")
+			}
+		}
+		return roundRat(number, int(places)), nil
+	case "YEAR", "MONTH", "DAY":
+		t, ok := coerceData(args[0], calcTime{}).(calcTime)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a date, got %s", n.name, calcType(args[0]))
+		}
+		part := map[string]int{"YEAR": t.t.Year(), "MONTH": int(t.t.Month()), "DAY": t.t.Day()}[n.name]
+		return big.NewRat(int64(part), 1), nil
+	case "STRFTIME":
+		pattern, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("STRFTIME needs a format such as '%%Y-%%m' first")
+		}
+		t, ok := coerceData(args[1], calcTime{}).(calcTime)
+		if !ok {
+			return nil, fmt.Errorf("STRFTIME needs a date, got %s", calcType(args[1]))
+		}
+		return formatTime(t.t, pattern), nil
+	}
+	return nil, fmt.Errorf("unknown function %s", n.name)
+}
+
+// dataText writes a value as text for string functions and the result table
+func dataText(value calcValue) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *big.Rat:
+		return formatDecimal(v, defaultDecimalPlaces)
+	case calcTime:
+		if v.dateOnly {
+			return v.t.Format("2006-01-02")
+		}
+		return v.t.Format(time.RFC3339Nano)
+	case time.Duration:
+		return formatDuration(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// formatDataNode writes an expression back as query text, for column headings
+// and to match expressions against GROUP BY
+func formatDataNode(node dataNode) string {
+	switch n := node.(type) {
+	case *dataLiteral:
+		switch v := n.value.(type) {
+		case nil:
+			return "NULL"
+		case string:
+			return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		case bool:
+			return strings.ToUpper(strconv.FormatBool(v))
+		}
+		return dataText(n.value)
+	case *dataColumnRef:
+		for _, r := range n.name {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+				return `"` + strings.ReplaceAll(n.name, `"`, `""`) + `"`
+			}
+		}
+		return n.name
+	case *dataUnary:
+		if n.op == "NOT" {
+			return "NOT " + formatDataOperand(n.operand)
+		}
+		return n.op + formatDataOperand(n.operand)
+	case *dataBinary:
+		return formatDataOperand(n.left) + " " + n.op + " " + formatDataOperand(n.right)
+	case *dataIsNull:
+		if n.not {
+			return formatDataOperand(n.operand) + " IS NOT NULL"
+		}
+		return formatDataOperand(n.operand) + " IS NULL"
+	case *dataIn:
+		items := make([]string, len(n.list))
+		for i, item := range n.list {
+			items[i] = formatDataNode(item)
+		}
+		return formatDataOperand(n.operand) + dataNot(n.not) + " IN (" + strings.Join(items, ", ") + ")"
+	case *dataBetween:
+		return formatDataOperand(n.operand) + dataNot(n.not) + " BETWEEN " + formatDataOperand(n.low) + " AND " + formatDataOperand(n.high)
+	case *dataLike:
+		return formatDataOperand(n.operand) + dataNot(n.not) + " LIKE " + formatDataOperand(n.pattern)
+	case *dataCall:
+		if n.star {
+			return n.name + "(*)"
+		}
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			args[i] = formatDataNode(arg)
+		}
+		prefix := ""
+		if n.distinct {
+			prefix = "DISTINCT "
+		}
+		return n.name + "(" + prefix + strings.Join(args, ", ") + ")"
+	}
+	return "?"
+}
+
+// formatDataOperand parenthesizes operators inside other expressions
+func formatDataOperand(node dataNode) string {
+	switch node.(type) {
+	case *dataLiteral, *dataColumnRef, *dataCall:
+		return formatDataNode(node)
+	}
+	return "(" + formatDataNode(node) + ")"
+}
+
+func dataNot(not bool) string {
+	if not {
+		return " NOT"
+	}
+	return ""
+}
@@ -0,0 +1,234 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+const (
+	// defaultDataResultRows is the number of result rows shown without LIMIT
+	defaultDataResultRows = 50
+
+	// maxDataResultRows bounds the result rows shown, whatever the LIMIT
+	maxDataResultRows = 200
+
+	// maxDataCellChars bounds the text of a cell in the result table
+	maxDataCellChars = 80
+
+	// dataSampleRows is the number of rows shown when describing a file
+	dataSampleRows = 5
+)
+
+// DataQueryTool answers questions about CSV, TSV, JSON and JSONL files in the
+// allowed directories with a small SQL dialect. Only the result table is
+// returned, so large files never reach the prompt.
+type DataQueryTool struct {
+	*BaseTool
+	roots []*RestrictedFS
+}
+
+// DataQueryResult is the outcome of a data_query call
+type DataQueryResult struct {
+	Path        string           `json:"path"`
+	Columns     []DataColumnInfo `json:"columns"`
+	Rows        [][]interface{}  `json:"rows"`
+	TotalRows   int              `json:"total_rows"`             // Rows in the file
+	MatchedRows int              `json:"matched_rows,omitempty"` // Rows that passed WHERE
+	ResultRows  int              `json:"result_rows"`            // Rows the query produced
+	Truncated   bool             `json:"truncated,omitempty"`    // Rows holds only the first result rows
+}
+
+// DataColumnInfo describes a column of a file or of a query result
+type DataColumnInfo struct {
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"`  // Inferred type of a file column
+	Nulls int    `json:"nulls,omitempty"` // Empty cells of a file column
+}
+
+// NewDataQueryTool creates the data_query tool for files in roots
+func NewDataQueryTool(roots []*RestrictedFS) *DataQueryTool {
+	tool := &DataQueryTool{
+		BaseTool: NewBaseTool(
+			"data_query",
+			"Queries a CSV, TSV, JSON (array of objects) or JSONL file with SQL, such as exports of members or invoices, and returns the result table. "+
+				"Call it without a query first to see the columns and their types. "+
+				"Supports SELECT [DISTINCT] ... WHERE ... GROUP BY ... HAVING ... ORDER BY ... [DESC] LIMIT n OFFSET m, with AS aliases, = != < <= > >=, + - * / %, AND/OR/NOT, IS [NOT] NULL, IN (...), BETWEEN, LIKE (case-insensitive, % and _), "+
+				"COUNT(*), COUNT([DISTINCT] x), SUM, AVG, MIN, MAX, LOWER, UPPER, TRIM, LENGTH, ROUND(x, places), ABS, COALESCE, YEAR, MONTH, DAY and STRFTIME('%Y-%m', date). "+
+				"Quote text with 'single quotes' and column names with spaces with \"double quotes\"; empty cells are NULL; numbers are exact decimals. "+
+				"At most 200 result rows are returned, 50 without LIMIT. Allowed directories: "+rootList(roots),
+			CategoryData,
+			false,
+			5,
+		),
+		roots: roots,
+	}
+	tool.SetParameterSchema(&ParameterSchema{
+		Type:        "object",
+		Description: "Parameters for a data query",
+		Properties: map[string]PropertySchema{
+			"path": {
+				Type:        "string",
+				Description: "File to query, relative to an allowed directory",
+			},
+			"query": {
+				Type:        "string",
+				Description: "SQL SELECT over the rows of the file, for example SELECT country, COUNT(*) AS members GROUP BY country ORDER BY members DESC. Omit it to describe the file",
+			},
+			"format": {
+				Type:        "string",
+				Description: "File format, when the extension does not tell",
+				Enum:        []interface{}{"csv", "tsv", "json", "jsonl"},
+			},
+		},
+		Required: []string{"path"},
+	})
+	return tool
+}
+
+func (t *DataQueryTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
+func (t *DataQueryTool) IsAvailable(ctx context.Context) bool {
+	return len(t.roots) > 0
+}
+
+func (t *DataQueryTool) Execute(ctx context.Context, params map[string]interface{}) (*ToolResult, error) {
+	path := stringParam(params, "path")
+	queryText := strings.TrimSpace(stringParam(params, "query"))
+
+	// Parse first, so a bad query does not wait for the file to load
+	var query *dataQuery
+	if queryText != "" {
+		var err error
+		if query, err = parseDataQuery(queryText); err != nil {
+			return t.CreateErrorResult(err, "Invalid query"), nil
+		}
+	}
+
+	fullPath, err := resolveFilePath(t.roots, path, true)
+	if err != nil {
+		return t.CreateErrorResult(err, fmt.Sprintf("File not found: %s", path)), nil
+	}
+	table, err := loadDataTable(fullPath, stringParam(params, "format"))
+	if err != nil {
+		return t.CreateErrorResult(err, fmt.Sprintf("Failed to load %s", path)), nil
+	}
+
+	result := &DataQueryResult{Path: path, TotalRows: len(table.rows)}
+	if query == nil {
+		// Describe the file: its columns and a few rows
+		query = &dataQuery{items: []dataSelectItem{{}}, limit: dataSampleRows}
+	} else if err := bindDataQuery(query, table); err != nil {
+		return t.CreateErrorResult(err, "Invalid query"), nil
+	}
+
+	output, err := runDataQuery(ctx, query, table)
+	if err != nil {
+		return t.CreateErrorResult(err, "Query failed"), nil
+	}
+	result.ResultRows = len(output.rows)
+	shown := output.rows
+	if limit := dataDisplayLimit(query); len(shown) > limit {
+		shown = shown[:limit]
+		result.Truncated = true
+	}
+
+	var b strings.Builder
+	if queryText == "" {
+		result.Columns = make([]DataColumnInfo, len(table.columns))
+		fmt.Fprintf(&b, "%s: %d rows, %d columns\n\n", filepath.Base(path), len(table.rows), len(table.columns))
+		b.WriteString("| column | type | empty |\n|---|---|---|\n")
+		for i, column := range table.columns {
+			result.Columns[i] = DataColumnInfo{Name: column.name, Type: column.kind, Nulls: column.nulls}
+			fmt.Fprintf(&b, "| %s | %s | %d |\n", dataCell(column.name), column.kind, column.nulls)
+		}
+		if len(shown) > 0 {
+			fmt.Fprintf(&b, "\nFirst %d rows:\n\n", len(shown))
+		}
+	} else {
+		result.MatchedRows = output.matched
+		for _, name := range output.columns {
+			result.Columns = append(result.Columns, DataColumnInfo{Name: name})
+		}
+	}
+	if len(shown) > 0 {
+		writeDataTable(&b, output.columns, shown)
+	}
+
+	result.Rows = make([][]interface{}, len(shown))
+	for i, row := range shown {
+		result.Rows[i] = make([]interface{}, len(row))
+		for j, value := range row {
+			result.Rows[i][j] = dataJSONValue(value)
+		}
+	}
+
+	if queryText != "" {
+		if len(shown) > 0 {
+			b.WriteString("\n")
+		}
+		noun := "rows"
+		if result.ResultRows == 1 {
+			noun = "row"
+		}
+		fmt.Fprintf(&b, "%d result %s (%d of %d file rows matched)", result.ResultRows, noun, result.MatchedRows, result.TotalRows)
+		if result.Truncated {
+			fmt.Fprintf(&b, "; showing the first %d, use LIMIT and OFFSET or aggregate to see the rest", len(shown))
+		}
+	}
+	toolResult := t.CreateSuccessResult(result, strings.TrimRight(b.String(), "\n"))
+	toolResult.Sources = []llm.Source{{Path: relativeToRoots(t.roots, fullPath)}}
+	return toolResult, nil
+}
+
+// dataDisplayLimit is the number of result rows shown for a query
+func dataDisplayLimit(q *dataQuery) int {
+	if q.limit < 0 {
+		return defaultDataResultRows
+	}
+	return min(q.limit, maxDataResultRows)
+}
+
+// writeDataTable writes rows as a Markdown table
+func writeDataTable(b *strings.Builder, columns []string, rows [][]calcValue) {
+	cells := make([]string, len(columns))
+	for i, name := range columns {
+		cells[i] = dataCell(name)
+	}
+	b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	b.WriteString(strings.Repeat("|---", len(columns)) + "|\n")
+	for _, row := range rows {
+		for i, value := range row {
+			cells[i] = dataCell(dataText(value))
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+}
+
+// dataCell keeps a cell on one line of the table and shortens long text
+func dataCell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	text = strings.ReplaceAll(text, "|", `\|`)
+	if runes := []rune(text); len(runes) > maxDataCellChars {
+		text = string(runes[:maxDataCellChars-1]) + "…"
+	}
+	return text
+}
+
+// dataJSONValue converts a cell for the structured result
+func dataJSONValue(value calcValue) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string:
+		return v
+	case *big.Rat:
+		return json.Number(formatDecimal(v, defaultDecimalPlaces))
+	}
+	return dataText(value)
+}
@@ -0,0 +1,570 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxDataQuery bounds the length of a data_query query
+	maxDataQuery = 5000
+
+	// maxDataDepth bounds the nesting of a query expression
+	maxDataDepth = 64
+)
+
+type dataTokenKind int
+
+const (
+	dataEOF dataTokenKind = iota
+	dataNumber
+	dataString
+	dataIdent
+	dataQuoted // "column name" or `column name`
+	dataOp
+)
+
+type dataToken struct {
+	kind dataTokenKind
+	text string
+	pos  int
+}
+
+// dataOperators are matched longest first
+var dataOperators = []string{"<=", ">=", "<>", "!=", "=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",", ";"}
+
+func lexData(src string) ([]dataToken, error) {
+	var tokens []dataToken
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-': // Comment to the end of the line
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					for i = j; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+					}
+				}
+			}
+			tokens = append(tokens, dataToken{dataNumber, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, dataToken{dataIdent, string(runes[start:i]), start})
+		case r == '\'' || r == '"' || r == '`':
+			// Quotes are escaped by doubling them, as in 'O''Brien'
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated quote at position %d", start)
+				}
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i++
+					} else {
+						i++
+						break
+					}
+				}
+				b.WriteRune(runes[i])
+			}
+			kind := dataQuoted
+			if r == '\'' {
+				kind = dataString
+			}
+			tokens = append(tokens, dataToken{kind, b.String(), start})
+		default:
+			matched := false
+			for _, op := range dataOperators {
+				if strings.HasPrefix(string(runes[i:min(i+2, len(runes))]), op) {
+					tokens = append(tokens, dataToken{dataOp, op, i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+		}
+	}
+	return append(tokens, dataToken{dataEOF, "", len(runes)}), nil
+}
+
+// Syntax tree of a query
+type (
+	dataNode interface{}
+
+	dataLiteral   struct{ value calcValue }
+	dataColumnRef struct {
+		name  string
+		index int // Set when the query is bound to a table
+	}
+	dataUnary struct {
+		op      string // - or NOT
+		operand dataNode
+	}
+	dataBinary struct {
+		op          string
+		left, right dataNode
+	}
+	dataIsNull struct {
+		operand dataNode
+		not     bool
+	}
+	dataIn struct {
+		operand dataNode
+		list    []dataNode
+		not     bool
+	}
+	dataBetween struct {
+		operand, low, high dataNode
+		not                bool
+	}
+	dataLike struct {
+		operand, pattern dataNode
+		not              bool
+		cache            *likeCache
+	}
+	dataCall struct {
+		name     string // Upper case
+		args     []dataNode
+		star     bool // COUNT(*)
+		distinct bool // COUNT(DISTINCT x)
+	}
+)
+
+type dataSelectItem struct {
+	expr  dataNode // nil for *
+	alias string
+}
+
+type dataOrder struct {
+	expr dataNode
+	desc bool
+}
+
+// dataQuery is a parsed SELECT statement
+type dataQuery struct {
+	distinct bool
+	items    []dataSelectItem
+	where    dataNode
+	groupBy  []dataNode
+	having   dataNode
+	orderBy  []dataOrder
+	limit    int // -1 when there is no LIMIT
+	offset   int
+}
+
+// dataKeywords cannot be used as bare column names or aliases
+var dataKeywords = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "HAVING": true,
+	"ORDER": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true, "AS": true, "AND": true, "OR": true,
+	"NOT": true, "IS": true, "NULL": true, "IN": true, "LIKE": true, "BETWEEN": true, "TRUE": true, "FALSE": true,
+}
+
+type dataParser struct {
+	tokens []dataToken
+	pos    int
+	depth  int
+}
+
+// parseDataQuery parses SELECT items [FROM name] [WHERE cond] [GROUP BY exprs]
+// [HAVING cond] [ORDER BY exprs [ASC|DESC]] [LIMIT n [OFFSET m]]. The FROM
+// clause is accepted and ignored: the table is the file being queried.
+func parseDataQuery(src string) (*dataQuery, error) {
+	if len(src) > maxDataQuery {
+		return nil, fmt.Errorf("query is longer than %d characters", maxDataQuery)
+	}
+	tokens, err := lexData(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &dataParser{tokens: tokens}
+	q := &dataQuery{limit: -1}
+
+	if !p.keyword("SELECT") {
+		return nil, fmt.Errorf("queries start with SELECT")
+	}
+	q.distinct = p.keyword("DISTINCT")
+	for {
+		var item dataSelectItem
+		if p.acceptOp("*") {
+			q.items = append(q.items, item)
+		} else {
+			if item.expr, err = p.expr(); err != nil {
+				return nil, err
+			}
+			if p.keyword("AS") {
+				if item.alias, err = p.name(); err != nil {
+					return nil, err
+				}
+			} else if tok := p.peek(); tok.kind == dataQuoted || (tok.kind == dataIdent && !dataKeywords[strings.ToUpper(tok.text)]) {
+				item.alias, _ = p.name()
+			}
+			q.items = append(q.items, item)
+		}
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if p.keyword("FROM") {
+		if tok := p.next(); tok.kind != dataIdent && tok.kind != dataString && tok.kind != dataQuoted {
+			return nil, p.unexpected(tok)
+		}
+	}
+	if p.keyword("WHERE") {
+		if q.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("GROUP") {
+		if !p.keyword("BY") {
+			return nil, p.unexpected(p.peek())
+		}
+		if q.groupBy, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("HAVING") {
+		if q.having, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("ORDER") {
+		if !p.keyword("BY") {
+			return nil, p.unexpected(p.peek())
+		}
+		for {
+			var order dataOrder
+			if order.expr, err = p.expr(); err != nil {
+				return nil, err
+			}
+			if p.keyword("DESC") {
+				order.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			q.orderBy = append(q.orderBy, order)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		if q.limit, err = p.count("LIMIT"); err != nil {
+			return nil, err
+		}
+		if p.keyword("OFFSET") {
+			if q.offset, err = p.count("OFFSET"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.acceptOp(";")
+	if tok := p.peek(); tok.kind != dataEOF {
+		return nil, p.unexpected(tok)
+	}
+	return q, nil
+}
+
+func (p *dataParser) peek() dataToken { return p.tokens[p.pos] }
+
+func (p *dataParser) next() dataToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != dataEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword consumes the keyword, in any case, if it is next
+func (p *dataParser) keyword(word string) bool {
+	if tok := p.peek(); tok.kind == dataIdent && strings.EqualFold(tok.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *dataParser) acceptOp(op string) bool {
+	if tok := p.peek(); tok.kind == dataOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *dataParser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.unexpected(p.peek())
+	}
+	return nil
+}
+
+func (p *dataParser) unexpected(tok dataToken) error {
+	if tok.kind == dataEOF {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// name reads an alias, bare or quoted
+func (p *dataParser) name() (string, error) {
+	tok := p.next()
+	if tok.kind == dataQuoted || (tok.kind == dataIdent && !dataKeywords[strings.ToUpper(tok.text)]) {
+		return tok.text, nil
+	}
+	return "", p.unexpected(tok)
+}
+
+func (p *dataParser) count(clause string) (int, error) {
+	tok := p.next()
+	if tok.kind != dataNumber {
+		return 0, p.unexpected(tok)
+	}
+	var n int
+	if _, err := fmt.Sscanf(tok.text, "%d", &n); err != nil || fmt.Sprint(n) != tok.text {
+		return 0, fmt.Errorf("%s must be a whole number", clause)
+	}
+	return n, nil
+}
+
+func (p *dataParser) exprList() ([]dataNode, error) {
+	var list []dataNode
+	for {
+		node, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, node)
+		if !p.acceptOp(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *dataParser) expr() (dataNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDataDepth {
+		return nil, fmt.Errorf("query is nested too deeply")
+	}
+	return p.or()
+}
+
+func (p *dataParser) or() (dataNode, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("OR") {
+		var right dataNode
+		if right, err = p.and(); err == nil {
+			left = &dataBinary{"OR", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *dataParser) and() (dataNode, error) {
+	left, err := p.not()
+	for err == nil && p.keyword("AND") {
+		var right dataNode
+		if right, err = p.not(); err == nil {
+			left = &dataBinary{"AND", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *dataParser) not() (dataNode, error) {
+	if p.keyword("NOT") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &dataUnary{"NOT", operand}, nil
+	}
+	return p.comparison()
+}
+
+func (p *dataParser) comparison() (dataNode, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind == dataOp {
+		switch tok.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.pos++
+			right, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			op := tok.text
+			if op == "<>" {
+				op = "!="
+			}
+			return &dataBinary{op, left, right}, nil
+		}
+	}
+
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		if !p.keyword("NULL") {
+			return nil, p.unexpected(p.peek())
+		}
+		return &dataIsNull{left, not}, nil
+	}
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return &dataIn{left, list, not}, p.expectOp(")")
+	case p.keyword("LIKE"):
+		pattern, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &dataLike{operand: left, pattern: pattern, not: not}, nil
+	case p.keyword("BETWEEN"):
+		low, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.unexpected(p.peek())
+		}
+		high, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &dataBetween{left, low, high, not}, nil
+	}
+	if not {
+		return nil, p.unexpected(p.peek())
+	}
+	return left, nil
+}
+
+func (p *dataParser) additive() (dataNode, error) {
+	left, err := p.multiplicative()
+	for err == nil {
+		tok := p.peek()
+		if tok.kind != dataOp || (tok.text != "+" && tok.text != "-") {
+			break
+		}
+		p.pos++
+		var right dataNode
+		if right, err = p.multiplicative(); err == nil {
+			left = &dataBinary{tok.text, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *dataParser) multiplicative() (dataNode, error) {
+	left, err := p.unary()
+	for err == nil {
+		tok := p.peek()
+		if tok.kind != dataOp || (tok.text != "*" && tok.text != "/" && tok.text != "%") {
+			break
+		}
+		p.pos++
+		var right dataNode
+		if right, err = p.unary(); err == nil {
+			left = &dataBinary{tok.text, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *dataParser) unary() (dataNode, error) {
+	if p.acceptOp("-") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &dataUnary{"-", operand}, nil
+	}
+	p.acceptOp("+")
+	return p.primary()
+}
+
+func (p *dataParser) primary() (dataNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case dataNumber:
+		value, err := parseDecimal(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("%v at position %d", err, tok.pos)
+		}
+		return &dataLiteral{value}, nil
+	case dataString:
+		return &dataLiteral{tok.text}, nil
+	case dataQuoted:
+		return &dataColumnRef{name: tok.text}, nil
+	case dataIdent:
+		switch strings.ToUpper(tok.text) {
+		case "NULL":
+			return &dataLiteral{nil}, nil
+		case "TRUE":
+			return &dataLiteral{true}, nil
+		case "FALSE":
+			return &dataLiteral{false}, nil
+		}
+		if !p.acceptOp("(") {
+			if dataKeywords[strings.ToUpper(tok.text)] {
+				return nil, p.unexpected(tok)
+			}
+			return &dataColumnRef{name: tok.text}, nil
+		}
+		call := &dataCall{name: strings.ToUpper(tok.text)}
+		if p.acceptOp("*") {
+			call.star = true
+			return call, p.expectOp(")")
+		}
+		call.distinct = p.keyword("DISTINCT")
+		if p.acceptOp(")") {
+			return call, nil
+		}
+		args, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		call.args = args
+		return call, p.expectOp(")")
+	case dataOp:
+		if tok.text == "(" {
+			node, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expectOp(")")
+		}
+	}
+	return nil, p.unexpected(tok)
+}
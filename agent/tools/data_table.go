@@ -0,0 +1,419 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDataFileBytes bounds the files data_query loads
+	maxDataFileBytes = 64 << 20
+
+	// maxDataRows bounds the rows of a loaded table
+	maxDataRows = 1000000
+
+	// maxDataColumns bounds the columns of a loaded table
+	maxDataColumns = 1000
+)
+
+// dataNumberPattern matches the cells read as numbers. Integers with leading
+// zeros, such as zip codes and IDs, stay text.
+var dataNumberPattern = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$|^[+-]?\.[0-9]+$`)
+
+// dataTable is a loaded file. Cells are nil, *big.Rat, string, bool or
+// calcTime, all of the type of their column.
+type dataTable struct {
+	columns []dataColumn
+	rows    [][]calcValue
+}
+
+type dataColumn struct {
+	name  string
+	kind  string // number, string, boolean, date, datetime or empty
+	nulls int
+}
+
+// dataFormats maps file extensions to formats
+var dataFormats = map[string]string{
+	".csv":    "csv",
+	".tsv":    "tsv",
+	".tab":    "tsv",
+	".json":   "json",
+	".jsonl":  "jsonl",
+	".ndjson": "jsonl",
+}
+
+// loadDataTable reads a CSV, TSV, JSON or JSONL file and infers the column
+// types. format overrides the one implied by the extension.
+func loadDataTable(path, format string) (*dataTable, error) {
+	if format == "" {
+		format = dataFormats[strings.ToLower(filepath.Ext(path))]
+		if format == "" {
+			return nil, fmt.Errorf("unknown format of %s (pass format: csv, tsv, json or jsonl)", filepath.Base(path))
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", filepath.Base(path))
+	}
+	if info.Size() > maxDataFileBytes {
+		return nil, fmt.Errorf("file is %d bytes, the limit is %d", info.Size(), maxDataFileBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+
+	var names []string
+	var records [][]interface{}
+	switch format {
+	case "csv":
+		names, records, err = readDelimited(data, ',')
+	case "tsv":
+		names, records, err = readDelimited(data, '\t')
+	case "json", "jsonl":
+		names, records, err = readJSONRecords(data, format == "jsonl")
+	default:
+		return nil, fmt.Errorf("unknown format %q (use csv, tsv, json or jsonl)", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > maxDataColumns {
+		return nil, fmt.Errorf("file has %d columns, the limit is %d", len(names), maxDataColumns)
+	}
+	return inferDataTable(names, records), nil
+}
+
+// readDelimited reads a header line and records. Short records are padded
+// with empty cells; empty cells are nulls.
+func readDelimited(data []byte, comma rune) ([]string, [][]interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("file is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	names := uniqueColumnNames(header)
+
+	var records [][]interface{}
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(fields) > len(names) {
+			line, _ := reader.FieldPos(0)
+			return nil, nil, fmt.Errorf("line %d has %d fields, the header has %d", line, len(fields), len(names))
+		}
+		if len(records) == maxDataRows {
+			return nil, nil, fmt.Errorf("file has more than %d rows", maxDataRows)
+		}
+		record := make([]interface{}, len(names))
+		for i, field := range fields {
+			if field != "" {
+				record[i] = field
+			}
+		}
+		records = append(records, record)
+	}
+	return names, records, nil
+}
+
+// uniqueColumnNames names blank header cells column_N and numbers repeated
+// names, so every column can be referenced
+func uniqueColumnNames(header []string) []string {
+	names := make([]string, len(header))
+	seen := make(map[string]bool)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		unique := name
+		for n := 2; seen[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		seen[unique] = true
+		names[i] = unique
+	}
+	return names
+}
+
+// readJSONRecords reads an array of objects, an object holding one such array
+// (as in {"data": [...]}) or, for jsonl, one object per line. Nested objects
+// become columns such as address.city; arrays are kept as JSON text.
+func readJSONRecords(data []byte, lines bool) ([]string, [][]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var items []interface{}
+	if lines {
+		for {
+			var item interface{}
+			if err := decoder.Decode(&item); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, nil, fmt.Errorf("record %d: %w", len(items)+1, err)
+			}
+			if len(items) == maxDataRows {
+				return nil, nil, fmt.Errorf("file has more than %d rows", maxDataRows)
+			}
+			items = append(items, item)
+		}
+	} else {
+		var root interface{}
+		if err := decoder.Decode(&root); err != nil {
+			return nil, nil, err
+		}
+		switch v := root.(type) {
+		case []interface{}:
+			items = v
+		case map[string]interface{}:
+			var arrays []string
+			for key, value := range v {
+				if list, ok := value.([]interface{}); ok {
+					arrays = append(arrays, key)
+					items = list
+				}
+			}
+			if len(arrays) != 1 {
+				return nil, nil, fmt.Errorf("expected an array of objects, or an object with one array field")
+			}
+		default:
+			return nil, nil, fmt.Errorf("expected an array of objects")
+		}
+		if len(items) > maxDataRows {
+			return nil, nil, fmt.Errorf("file has more than %d rows", maxDataRows)
+		}
+	}
+
+	index := make(map[string]int)
+	var names []string
+	records := make([][]interface{}, 0, len(items))
+	for n, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("record %d is not an object", n+1)
+		}
+		fields := make(map[string]interface{})
+		if err := flattenJSONRecord("", obj, fields); err != nil {
+			return nil, nil, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		// Columns are ordered by first appearance, by name within a record
+		for _, key := range sortedKeys(fields) {
+			if _, exists := index[key]; !exists {
+				if len(names) == maxDataColumns {
+					return nil, nil, fmt.Errorf("file has more than %d columns", maxDataColumns)
+				}
+				index[key] = len(names)
+				names = append(names, key)
+			}
+		}
+		record := make([]interface{}, len(names))
+		for key, value := range fields {
+			record[index[key]] = value
+		}
+		records = append(records, record)
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("file has no records")
+	}
+	for i, record := range records {
+		if len(record) < len(names) {
+			records[i] = append(record, make([]interface{}, len(names)-len(record))...)
+		}
+	}
+	return names, records, nil
+}
+
+func flattenJSONRecord(prefix string, obj map[string]interface{}, fields map[string]interface{}) error {
+	for key, value := range obj {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flattenJSONRecord(prefix+key+".", v, fields); err != nil {
+				return err
+			}
+		case []interface{}:
+			text, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			fields[prefix+key] = string(text)
+		case json.Number:
+			number, err := parseDecimal(v.String())
+			if err != nil {
+				return err
+			}
+			fields[prefix+key] = number
+		default:
+			fields[prefix+key] = v
+		}
+	}
+	return nil
+}
+
+// inferDataTable gives each column the narrowest type all its cells fit:
+// number, boolean, date, datetime or else string
+func inferDataTable(names []string, records [][]interface{}) *dataTable {
+	table := &dataTable{columns: make([]dataColumn, len(names)), rows: make([][]calcValue, len(records))}
+	for i := range table.rows {
+		table.rows[i] = make([]calcValue, len(names))
+	}
+	for col, name := range names {
+		kind := inferColumnKind(records, col)
+		column := dataColumn{name: name, kind: kind}
+		for row, record := range records {
+			value := convertDataCell(record[col], kind)
+			if value == nil {
+				column.nulls++
+			}
+			table.rows[row][col] = value
+		}
+		table.columns[col] = column
+	}
+	return table
+}
+
+func inferColumnKind(records [][]interface{}, col int) string {
+	candidates := map[string]bool{"number": true, "boolean": true, "date": true, "datetime": true}
+	seen := false
+	for _, record := range records {
+		cell := record[col]
+		if cell == nil {
+			continue
+		}
+		seen = true
+		switch v := cell.(type) {
+		case *big.Rat:
+			candidates["boolean"], candidates["date"], candidates["datetime"] = false, false, false
+		case bool:
+			candidates["number"], candidates["date"], candidates["datetime"] = false, false, false
+		case string:
+			text := strings.TrimSpace(v)
+			if candidates["number"] && !dataNumberPattern.MatchString(text) {
+				candidates["number"] = false
+			}
+			if candidates["boolean"] && !strings.EqualFold(text, "true") && !strings.EqualFold(text, "false") {
+				candidates["boolean"] = false
+			}
+			if candidates["date"] || candidates["datetime"] {
+				date, err := parseDataTime(text)
+				if err != nil {
+					candidates["date"], candidates["datetime"] = false, false
+				} else if !date.dateOnly {
+					candidates["date"] = false
+				}
+			}
+		}
+		if !candidates["number"] && !candidates["boolean"] && !candidates["datetime"] {
+			return "string"
+		}
+	}
+	if !seen {
+		return "empty"
+	}
+	for _, kind := range []string{"number", "boolean", "date", "datetime"} {
+		if candidates[kind] {
+			return kind
+		}
+	}
+	return "string"
+}
+
+func convertDataCell(cell interface{}, kind string) calcValue {
+	switch v := cell.(type) {
+	case nil:
+		return nil
+	case *big.Rat:
+		if kind == "string" {
+			return formatDecimal(v, defaultDecimalPlaces)
+		}
+		return v
+	case bool:
+		if kind == "string" {
+			return strconv.FormatBool(v)
+		}
+		return v
+	case string:
+		text := strings.TrimSpace(v)
+		switch kind {
+		case "number":
+			number, _ := parseDecimal(text)
+			return number
+		case "boolean":
+			return strings.EqualFold(text, "true")
+		case "date", "datetime":
+			date, _ := parseDataTime(text)
+			return date
+		}
+		return v
+	}
+	return fmt.Sprint(cell)
+}
+
+// parseDataTime reads YYYY-MM-DD as a date and the forms of parseCalcTime as
+// instants, in UTC unless they carry an offset
+func parseDataTime(text string) (calcTime, error) {
+	if len(text) == len("2006-01-02") {
+		t, err := time.Parse("2006-01-02", text)
+		if err != nil {
+			return calcTime{}, err
+		}
+		return calcTime{t: t, dateOnly: true}, nil
+	}
+	if len(text) < len("2006-01-02T15:04") {
+		return calcTime{}, errors.New("not a date")
+	}
+	return parseCalcTime(text, time.UTC)
+}
+
+// columnIndex finds a column by name, ignoring case when that is unambiguous
+func (t *dataTable) columnIndex(name string) (int, bool) {
+	match := -1
+	for i, column := range t.columns {
+		if column.name == name {
+			return i, true
+		}
+		if strings.EqualFold(column.name, name) {
+			if match >= 0 {
+				return 0, false
+			}
+			match = i
+		}
+	}
+	return match, match >= 0
+}
+
+func (t *dataTable) columnNames() []string {
+	names := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		names[i] = column.name
+	}
+	return names
+}
@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxRatBits bounds the numerator and denominator of exact numbers, so an
+	// expression such as 9^9^9 fails instead of exhausting memory
+	maxRatBits = 4096
+
+	// defaultDecimalPlaces is the number of decimals shown for numbers without a
+	// short exact decimal form, such as 1/3
+	defaultDecimalPlaces = 12
+)
+
+// parseDecimal reads a decimal or scientific literal as an exact number
+func parseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.Contains(s, "/") {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return r, checkRat(r)
+}
+
+// ratFromFloat converts a float by its shortest decimal form, so 0.1 becomes
+// exactly 1/10
+func ratFromFloat(f float64) (*big.Rat, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("result is not a finite number")
+	}
+	return parseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// ratFloat returns the nearest float of an exact number
+func ratFloat(r *big.Rat) float64 {
+	f, _ := r.Float64()
+	return f
+}
+
+// checkRat rejects numbers too large to keep computing with exactly
+func checkRat(r *big.Rat) error {
+	if r.Num().BitLen() > maxRatBits || r.Denom().BitLen() > maxRatBits {
+		return fmt.Errorf("number too large")
+	}
+	return nil
+}
+
+// ratInt returns the value of an integer number that fits in an int64
+func ratInt(r *big.Rat) (int64, bool) {
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return r.Num().Int64(), true
+}
+
+// ratPow raises base to an integer exponent exactly
+func ratPow(base *big.Rat, exp int64) (*big.Rat, error) {
+	if exp < 0 {
+		if base.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		base = new(big.Rat).Inv(base)
+		exp = -exp
+	}
+	// Rough size check before computing, 2^4096 would already be rejected
+	if bits := int64(max(base.Num().BitLen(), base.Denom().BitLen())); bits > 1 && exp > maxRatBits {
+		return nil, fmt.Errorf("number too large")
+	}
+	num := new(big.Int).Exp(base.Num(), big.NewInt(exp), nil)
+	den := new(big.Int).Exp(base.Denom(), big.NewInt(exp), nil)
+	result := new(big.Rat).SetFrac(num, den)
+	return result, checkRat(result)
+}
+
+// roundRat rounds to places decimals, halves away from zero
+func roundRat(r *big.Rat, places int) *big.Rat {
+	rounded, _ := new(big.Rat).SetString(r.FloatString(places))
+	return rounded
+}
+
+// floorRat returns the largest integer not above r
+func floorRat(r *big.Rat) *big.Rat {
+	q := new(big.Int).Div(r.Num(), r.Denom()) // Euclidean division floors for positive denominators
+	return new(big.Rat).SetInt(q)
+}
+
+// ceilRat returns the smallest integer not below r
+func ceilRat(r *big.Rat) *big.Rat {
+	floor := floorRat(r)
+	if floor.Cmp(r) == 0 {
+		return floor
+	}
+	return floor.Add(floor, big.NewRat(1, 1))
+}
+
+// truncRat drops the fractional part
+func truncRat(r *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Quo(r.Num(), r.Denom()))
+}
+
+// formatDecimal writes a number exactly when it has at most places decimals,
+// and rounded to places decimals otherwise, without trailing zeros
+func formatDecimal(r *big.Rat, places int) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	if exact, ok := exactDecimals(r); ok && exact <= places {
+		return r.FloatString(exact)
+	}
+	s := strings.TrimRight(r.FloatString(places), "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// exactDecimals returns how many decimals r needs, if its expansion ends
+func exactDecimals(r *big.Rat) (int, bool) {
+	den := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	five, mod := big.NewInt(5), new(big.Int)
+	for den.Bit(0) == 0 {
+		den.Rsh(den, 1)
+		twos++
+	}
+	for {
+		q, m := new(big.Int).QuoRem(den, five, mod)
+		if m.Sign() != 0 {
+			break
+		}
+		den = q
+		fives++
+	}
+	if den.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	return max(twos, fives), true
+}
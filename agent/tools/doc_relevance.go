@@ -8,6 +8,7 @@ import (
 
 	"github.com/santiagocorredoira/agent/agent/llm"
 	"github.com/santiagocorredoira/agent/agent/prompts"
+	"github.com/santiagocorredoira/agent/agent/tracing"
 )
 
 // DocumentRelevanceEvaluator uses LLM to evaluate document relevance
@@ -50,14 +51,28 @@ func (e *DocumentRelevanceEvaluator) EvaluateRelevance(ctx context.Context, sear
 		Temperature: 0.1, // Low temperature for consistent results
 	}
 
+	ctx, span := tracing.StartSpan(ctx, "relevance.evaluate", map[string]interface{}{
+		"query":    searchQuery,
+		"document": filePath,
+		"provider": e.llmProvider.GetName(),
+	})
+	defer span.End()
+
 	// Get LLM response
 	response, err := e.llmProvider.Complete(ctx, request)
 	if err != nil {
+		span.SetError(err)
 		return false, fmt.Errorf("failed to evaluate relevance: %v", err)
 	}
 
 	// Parse response
 	result := strings.TrimSpace(strings.ToUpper(response.Content))
+	span.SetAttributes(map[string]interface{}{
+		"model":             response.Model,
+		"prompt_tokens":     response.Usage.PromptTokens,
+		"completion_tokens": response.Usage.CompletionTokens,
+		"relevant":          result == "RELEVANT",
+	})
 	return result == "RELEVANT", nil
 }
 
@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// HTTPRequestTool sends requests to the configured APIs and the API host of
+// the conversation, so the model can try the endpoints it documents
+type HTTPRequestTool struct {
+	*BaseTool
+	client         *APIClient
+	confirmMethods []string
+}
+
+// NewHTTPRequestTool creates the http_request tool. Calls with one of
+// confirmMethods require confirmation.
+func NewHTTPRequestTool(client *APIClient, confirmMethods []string) *HTTPRequestTool {
+	tool := &HTTPRequestTool{
+		BaseTool: NewBaseTool(
+			"http_request",
+			"Sends an HTTP request to an allowed API (the configured endpoints or the API host of this conversation) and returns the status and response body. Use it to try an endpoint for the user. URLs may be absolute or a path such as /v1/users, which is sent to the conversation API host or to the given endpoint.",
+			CategoryAPI,
+			false, // Only mutating methods are confirmed, see RequiresConfirmationFor
+			20,
+		),
+		client:         client,
+		confirmMethods: confirmMethods,
+	}
+
+	properties := map[string]PropertySchema{
+		"method": {
+			Type:        "string",
+			Description: "HTTP method (default GET)",
+			Enum:        []interface{}{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"},
+			Default:     "GET",
+		},
+		"url": {
+			Type:        "string",
+			Description: "Absolute URL, or a path relative to the endpoint or the conversation API host",
+		},
+		"query": {
+			Type:                 "object",
+			Description:          "Query parameters added to the URL",
+			AdditionalProperties: &PropertySchema{OneOf: []PropertySchema{{Type: "string"}, {Type: "number"}, {Type: "boolean"}}},
+		},
+		"headers": {
+			Type:                 "object",
+			Description:          "HTTP headers to send",
+			AdditionalProperties: &PropertySchema{Type: "string"},
+		},
+		"body": {
+			Description: "JSON request body for POST, PUT and PATCH",
+		},
+	}
+	if names := client.EndpointNames(); len(names) > 0 {
+		properties["endpoint"] = PropertySchema{
+			Type:        "string",
+			Description: "Configured API whose base URL a relative url is resolved against",
+			Enum:        stringsToEnum(names),
+		}
+	}
+	if names := client.CredentialNames(); len(names) > 0 {
+		properties["credential"] = PropertySchema{
+			Type:        "string",
+			Description: "Credential profile to authenticate with; the agent adds the secret, never put tokens in headers yourself",
+			Enum:        stringsToEnum(names),
+		}
+	}
+
+	tool.SetParameterSchema(&ParameterSchema{
+		Type:        "object",
+		Description: "Parameters for an HTTP request",
+		Properties:  properties,
+		Required:    []string{"url"},
+	})
+	return tool
+}
+
+func (t *HTTPRequestTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
+func (t *HTTPRequestTool) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+// RequiresConfirmationFor confirms the methods configured in confirm_methods
+func (t *HTTPRequestTool) RequiresConfirmationFor(params map[string]interface{}) bool {
+	method, _ := params["method"].(string)
+	if method == "" {
+		method = "GET"
+	}
+	for _, confirm := range t.confirmMethods {
+		if strings.EqualFold(confirm, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *HTTPRequestTool) Execute(ctx context.Context, params map[string]interface{}) (*ToolResult, error) {
+	req := APIRequest{
+		Method:     stringParam(params, "method"),
+		URL:        stringParam(params, "url"),
+		Endpoint:   stringParam(params, "endpoint"),
+		Body:       params["body"],
+		Credential: stringParam(params, "credential"),
+	}
+	if query, ok := params["query"].(map[string]interface{}); ok {
+		req.Query = make(url.Values, len(query))
+		for key, value := range query {
+			req.Query.Set(key, fmt.Sprint(value))
+		}
+	}
+	if headers, ok := params["headers"].(map[string]interface{}); ok {
+		req.Headers = make(map[string]string, len(headers))
+		for key, value := range headers {
+			req.Headers[key] = fmt.Sprint(value)
+		}
+	}
+
+	resp, err := t.client.Do(ctx, req)
+	if err != nil {
+		return t.CreateErrorResult(err, "HTTP request failed"), nil
+	}
+	return t.CreateSuccessResult(resp, FormatAPIResponse(resp)), nil
+}
+
+// FormatAPIResponse renders a response for the model: the status line, the
+// notable headers and the body, indented when it is JSON
+func FormatAPIResponse(resp *APIResponse) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s -> %s (%d ms)\n", resp.Method, resp.URL, resp.Status, resp.DurationMS)
+	if resp.ContentType != "" {
+		fmt.Fprintf(&b, "Content-Type: %s\n", resp.ContentType)
+	}
+	for _, name := range sortedKeys(resp.Headers) {
+		fmt.Fprintf(&b, "%s: %s\n", name, resp.Headers[name])
+	}
+
+	body := resp.Body
+	if strings.Contains(resp.ContentType, "json") && !resp.Truncated {
+		var indented bytes.Buffer
+		if json.Indent(&indented, []byte(body), "", "  ") == nil {
+			body = indented.String()
+		}
+	}
+	if body != "" {
+		b.WriteString("\n")
+		b.WriteString(body)
+	}
+	if resp.Truncated {
+		fmt.Fprintf(&b, "\n[Response truncated at %d bytes]", len(resp.Body))
+	}
+	return b.String()
+}
+
+func stringParam(params map[string]interface{}, name string) string {
+	value, _ := params[name].(string)
+	return value
+}
+
+func stringsToEnum(values []string) []interface{} {
+	enum := make([]interface{}, len(values))
+	for i, value := range values {
+		enum[i] = value
+	}
+	return enum
+}
@@ -0,0 +1,1170 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxJQSteps bounds the work of a query
+	maxJQSteps = 1000000
+
+	// maxJQDepth bounds the nesting of a query
+	maxJQDepth = 64
+)
+
+// errJQSteps stops a query that exceeds maxJQSteps; ? and // do not catch it
+var errJQSteps = fmt.Errorf("query takes more than %d steps", maxJQSteps)
+
+// jq values are nil, bool, string, *big.Rat, []interface{} and
+// map[string]interface{}. Numbers are exact, so adding prices does not drift.
+
+type jqTokenKind int
+
+const (
+	jqEOF jqTokenKind = iota
+	jqNumber
+	jqString
+	jqIdent
+	jqField // .name
+	jqOp
+)
+
+type jqToken struct {
+	kind jqTokenKind
+	text string
+	pos  int
+}
+
+var jqOperators = []string{"..", "//", "==", "!=", "<=", ">=", "|", ",", "+", "-", "*", "/", "%", "(", ")", "[", "]", "{", "}", ":", ";", "?", "<", ">", "."}
+
+func lexJQ(src string) ([]jqToken, error) {
+	var tokens []jqToken
+	runes := []rune(src)
+	isIdent := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '.' && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || runes[i+1] == '_'):
+			start := i
+			for i++; i < len(runes) && isIdent(runes[i]); i++ {
+			}
+			tokens = append(tokens, jqToken{jqField, string(runes[start+1 : i]), start})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				for i = j; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+				}
+			}
+			tokens = append(tokens, jqToken{jqNumber, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && isIdent(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, jqToken{jqIdent, string(runes[start:i]), start})
+		case r == '"':
+			start := i
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					if i+1 < len(runes) && runes[i+1] == '(' {
+						return nil, fmt.Errorf("string interpolation is not supported (position %d), use + and tostring", i)
+					}
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			var text string
+			if err := json.Unmarshal([]byte(string(runes[start:i])), &text); err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", start)
+			}
+			tokens = append(tokens, jqToken{jqString, text, start})
+		case r == '$':
+			return nil, fmt.Errorf("variables are not supported (position %d)", i)
+		default:
+			matched := false
+			for _, op := range jqOperators {
+				if strings.HasPrefix(string(runes[i:min(i+2, len(runes))]), op) {
+					tokens = append(tokens, jqToken{jqOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+		}
+	}
+	return append(tokens, jqToken{jqEOF, "", len(runes)}), nil
+}
+
+// Syntax tree of a query
+type (
+	jqNode interface{}
+
+	jqIdentity struct{}
+	jqRecurse  struct{}
+	jqLiteral  struct{ value interface{} }
+	jqFieldOf  struct {
+		target jqNode
+		name   string
+	}
+	jqIndex struct{ target, index jqNode }
+	jqSlice struct {
+		target   jqNode
+		from, to jqNode // nil when omitted
+	}
+	jqIterate struct{ target jqNode }
+	jqTry     struct{ body jqNode }
+	jqPipe    struct{ left, right jqNode }
+	jqComma   struct{ left, right jqNode }
+	jqBinary  struct {
+		op          string
+		left, right jqNode
+	}
+	jqNeg    struct{ operand jqNode }
+	jqArray  struct{ body jqNode } // nil for []
+	jqObject struct {
+		keys, values []jqNode
+	}
+	jqIf struct {
+		cond, then, otherwise jqNode
+	}
+	jqCall struct {
+		name string
+		args []jqNode
+	}
+)
+
+type jqParser struct {
+	tokens []jqToken
+	pos    int
+	depth  int
+}
+
+// parseJQ parses a query in the jq subset described by the json_query tool
+func parseJQ(src string) (jqNode, error) {
+	if len(src) > maxCalcExpression {
+		return nil, fmt.Errorf("query is longer than %d characters", maxCalcExpression)
+	}
+	tokens, err := lexJQ(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &jqParser{tokens: tokens}
+	node, err := p.pipe()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != jqEOF {
+		return nil, p.unexpected(tok)
+	}
+	return node, nil
+}
+
+func (p *jqParser) peek() jqToken { return p.tokens[p.pos] }
+
+func (p *jqParser) next() jqToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != jqEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *jqParser) isOp(text string) bool {
+	tok := p.peek()
+	return tok.kind == jqOp && tok.text == text
+}
+
+func (p *jqParser) accept(texts ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != jqOp && tok.kind != jqIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *jqParser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return p.unexpected(p.peek())
+	}
+	return nil
+}
+
+func (p *jqParser) unexpected(tok jqToken) error {
+	if tok.kind == jqEOF {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// pipe is the lowest precedence level: a | b
+func (p *jqParser) pipe() (jqNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxJQDepth {
+		return nil, fmt.Errorf("query is nested too deeply")
+	}
+	left, err := p.comma()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("|"); ok {
+		right, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		return &jqPipe{left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *jqParser) comma() (jqNode, error) {
+	left, err := p.alternative()
+	for err == nil {
+		if _, ok := p.accept(","); !ok {
+			break
+		}
+		var right jqNode
+		if right, err = p.alternative(); err == nil {
+			left = &jqComma{left, right}
+		}
+	}
+	return left, err
+}
+
+// alternative is right associative: a // b // c
+func (p *jqParser) alternative() (jqNode, error) {
+	left, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("//"); ok {
+		right, err := p.alternative()
+		if err != nil {
+			return nil, err
+		}
+		return &jqBinary{"//", left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *jqParser) or() (jqNode, error) {
+	left, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("or"); !ok {
+			break
+		}
+		var right jqNode
+		if right, err = p.and(); err == nil {
+			left = &jqBinary{"or", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *jqParser) and() (jqNode, error) {
+	left, err := p.comparison()
+	for err == nil {
+		if _, ok := p.accept("and"); !ok {
+			break
+		}
+		var right jqNode
+		if right, err = p.comparison(); err == nil {
+			left = &jqBinary{"and", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *jqParser) comparison() (jqNode, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("==", "!=", "<", "<=", ">", ">="); ok {
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &jqBinary{op, left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *jqParser) additive() (jqNode, error) {
+	left, err := p.multiplicative()
+	for err == nil {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			break
+		}
+		var right jqNode
+		if right, err = p.multiplicative(); err == nil {
+			left = &jqBinary{op, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *jqParser) multiplicative() (jqNode, error) {
+	left, err := p.unary()
+	for err == nil {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			break
+		}
+		var right jqNode
+		if right, err = p.unary(); err == nil {
+			left = &jqBinary{op, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *jqParser) unary() (jqNode, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &jqNeg{operand}, nil
+	}
+	return p.postfix()
+}
+
+// postfix applies .name, ."name", [index], [from:to], [] and ? suffixes
+func (p *jqParser) postfix() (jqNode, error) {
+	node, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == jqField:
+			p.pos++
+			node = &jqFieldOf{node, tok.text}
+		case p.isOp(".") && p.tokens[p.pos+1].kind == jqString:
+			p.pos++
+			node = &jqFieldOf{node, p.next().text}
+		case p.isOp(".") && p.tokens[p.pos+1].kind == jqOp && p.tokens[p.pos+1].text == "[":
+			p.pos++ // .a.[0] is the same as .a[0]
+		case p.isOp("["):
+			p.pos++
+			if node, err = p.bracket(node); err != nil {
+				return nil, err
+			}
+		case p.isOp("?"):
+			p.pos++
+			node = &jqTry{node}
+		default:
+			return node, nil
+		}
+	}
+}
+
+// bracket parses what follows [ after a target
+func (p *jqParser) bracket(target jqNode) (jqNode, error) {
+	if _, ok := p.accept("]"); ok {
+		return &jqIterate{target}, nil
+	}
+	var from jqNode
+	if !p.isOp(":") {
+		var err error
+		if from, err = p.pipe(); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := p.accept(":"); ok {
+		var to jqNode
+		if !p.isOp("]") {
+			var err error
+			if to, err = p.pipe(); err != nil {
+				return nil, err
+			}
+		}
+		return &jqSlice{target, from, to}, p.expect("]")
+	}
+	return &jqIndex{target, from}, p.expect("]")
+}
+
+func (p *jqParser) primary() (jqNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case jqNumber:
+		value, err := parseDecimal(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("%v at position %d", err, tok.pos)
+		}
+		return &jqLiteral{value}, nil
+	case jqString:
+		return &jqLiteral{tok.text}, nil
+	case jqField:
+		return &jqFieldOf{&jqIdentity{}, tok.text}, nil
+	case jqIdent:
+		switch tok.text {
+		case "true":
+			return &jqLiteral{true}, nil
+		case "false":
+			return &jqLiteral{false}, nil
+		case "null":
+			return &jqLiteral{nil}, nil
+		case "if":
+			return p.ifExpr()
+		}
+		call := &jqCall{name: tok.text}
+		if _, ok := p.accept("("); ok {
+			for {
+				arg, err := p.pipe()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if _, ok := p.accept(";"); !ok {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		return call, nil
+	case jqOp:
+		switch tok.text {
+		case ".":
+			if p.peek().kind == jqString {
+				return &jqFieldOf{&jqIdentity{}, p.next().text}, nil
+			}
+			return &jqIdentity{}, nil
+		case "..":
+			return &jqRecurse{}, nil
+		case "(":
+			node, err := p.pipe()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			if _, ok := p.accept("]"); ok {
+				return &jqArray{}, nil
+			}
+			body, err := p.pipe()
+			if err != nil {
+				return nil, err
+			}
+			return &jqArray{body}, p.expect("]")
+		case "{":
+			return p.object()
+		}
+	}
+	return nil, p.unexpected(tok)
+}
+
+func (p *jqParser) ifExpr() (jqNode, error) {
+	cond, err := p.pipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.pipe()
+	if err != nil {
+		return nil, err
+	}
+	node := &jqIf{cond: cond, then: then, otherwise: &jqIdentity{}}
+	switch keyword, _ := p.accept("elif", "else", "end"); keyword {
+	case "elif":
+		if node.otherwise, err = p.ifExpr(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case "else":
+		if node.otherwise, err = p.pipe(); err != nil {
+			return nil, err
+		}
+		return node, p.expect("end")
+	case "end":
+		return node, nil
+	}
+	return nil, p.unexpected(p.peek())
+}
+
+// object parses {a, "b": x, (expr): y, c: .d}
+func (p *jqParser) object() (jqNode, error) {
+	node := &jqObject{}
+	if _, ok := p.accept("}"); ok {
+		return node, nil
+	}
+	for {
+		var key jqNode
+		var name string
+		tok := p.next()
+		switch {
+		case tok.kind == jqIdent || tok.kind == jqString:
+			name = tok.text
+			key = &jqLiteral{name}
+		case tok.kind == jqOp && tok.text == "(":
+			var err error
+			if key, err = p.pipe(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.unexpected(tok)
+		}
+
+		var value jqNode
+		if _, ok := p.accept(":"); ok {
+			var err error
+			if value, err = p.objectValue(); err != nil {
+				return nil, err
+			}
+		} else if name != "" {
+			value = &jqFieldOf{&jqIdentity{}, name} // {name} is {name: .name}
+		} else {
+			return nil, p.unexpected(p.peek())
+		}
+		node.keys = append(node.keys, key)
+		node.values = append(node.values, value)
+
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		return node, p.expect("}")
+	}
+}
+
+// objectValue reads a value up to the next , or }: pipes need parentheses
+func (p *jqParser) objectValue() (jqNode, error) {
+	return p.alternative()
+}
+
+// jqEval runs a query with a step budget
+type jqEval struct {
+	steps int
+}
+
+func (q *jqEval) step() error {
+	q.steps++
+	if q.steps > maxJQSteps {
+		return errJQSteps
+	}
+	return nil
+}
+
+func (q *jqEval) eval(node jqNode, input interface{}) ([]interface{}, error) {
+	if err := q.step(); err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case *jqIdentity:
+		return []interface{}{input}, nil
+	case *jqLiteral:
+		return []interface{}{n.value}, nil
+	case *jqRecurse:
+		var out []interface{}
+		return out, q.recurse(input, &out)
+	case *jqFieldOf:
+		return q.each(n.target, input, func(v interface{}) ([]interface{}, error) {
+			value, err := jqGetField(v, n.name)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{value}, nil
+		})
+	case *jqIndex:
+		return q.each(n.target, input, func(v interface{}) ([]interface{}, error) {
+			indexes, err := q.eval(n.index, input)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, index := range indexes {
+				value, err := jqGetIndex(v, index)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, value)
+			}
+			return out, nil
+		})
+	case *jqSlice:
+		return q.each(n.target, input, func(v interface{}) ([]interface{}, error) {
+			from, err := q.optionalInt(n.from, input)
+			if err != nil {
+				return nil, err
+			}
+			to, err := q.optionalInt(n.to, input)
+			if err != nil {
+				return nil, err
+			}
+			value, err := jqSliceOf(v, from, to)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{value}, nil
+		})
+	case *jqIterate:
+		return q.each(n.target, input, func(v interface{}) ([]interface{}, error) {
+			return jqValues(v)
+		})
+	case *jqTry:
+		out, err := q.eval(n.body, input)
+		if err != nil {
+			if errors.Is(err, errJQSteps) {
+				return nil, err
+			}
+			return out, nil // Outputs before the error are kept, as in jq
+		}
+		return out, nil
+	case *jqPipe:
+		return q.each(n.left, input, func(v interface{}) ([]interface{}, error) {
+			return q.eval(n.right, v)
+		})
+	case *jqComma:
+		left, err := q.eval(n.left, input)
+		if err != nil {
+			return nil, err
+		}
+		right, err := q.eval(n.right, input)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	case *jqNeg:
+		return q.each(n.operand, input, func(v interface{}) ([]interface{}, error) {
+			r, ok := v.(*big.Rat)
+			if !ok {
+				return nil, fmt.Errorf("cannot negate %s", jqType(v))
+			}
+			return []interface{}{new(big.Rat).Neg(r)}, nil
+		})
+	case *jqBinary:
+		return q.binary(n, input)
+	case *jqArray:
+		if n.body == nil {
+			return []interface{}{[]interface{}{}}, nil
+		}
+		items, err := q.eval(n.body, input)
+		if err != nil {
+			return nil, err
+		}
+		if items == nil {
+			items = []interface{}{}
+		}
+		return []interface{}{items}, nil
+	case *jqObject:
+		return q.object(n, input)
+	case *jqIf:
+		return q.each(n.cond, input, func(cond interface{}) ([]interface{}, error) {
+			if jqTruthy(cond) {
+				return q.eval(n.then, input)
+			}
+			return q.eval(n.otherwise, input)
+		})
+	case *jqCall:
+		return q.call(n, input)
+	}
+	return nil, fmt.Errorf("invalid query")
+}
+
+// each evaluates node and maps every output through f
+func (q *jqEval) each(node jqNode, input interface{}, f func(interface{}) ([]interface{}, error)) ([]interface{}, error) {
+	values, err := q.eval(node, input)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, v := range values {
+		results, err := f(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, results...)
+	}
+	return out, nil
+}
+
+func (q *jqEval) recurse(v interface{}, out *[]interface{}) error {
+	if err := q.step(); err != nil {
+		return err
+	}
+	*out = append(*out, v)
+	switch c := v.(type) {
+	case []interface{}:
+		for _, item := range c {
+			if err := q.recurse(item, out); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(c) {
+			if err := q.recurse(c[key], out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q *jqEval) optionalInt(node jqNode, input interface{}) (*int, error) {
+	if node == nil {
+		return nil, nil
+	}
+	values, err := q.eval(node, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("slice bounds must be single numbers")
+	}
+	if values[0] == nil {
+		return nil, nil
+	}
+	n, err := jqInt(values[0])
+	return &n, err
+}
+
+func (q *jqEval) binary(n *jqBinary, input interface{}) ([]interface{}, error) {
+	if n.op == "//" {
+		left, err := q.eval(n.left, input)
+		if errors.Is(err, errJQSteps) {
+			return nil, err
+		}
+		var out []interface{}
+		for _, v := range left {
+			if jqTruthy(v) {
+				out = append(out, v)
+			}
+		}
+		if len(out) > 0 {
+			return out, nil
+		}
+		return q.eval(n.right, input)
+	}
+
+	return q.each(n.left, input, func(left interface{}) ([]interface{}, error) {
+		if n.op == "and" && !jqTruthy(left) {
+			return []interface{}{false}, nil
+		}
+		if n.op == "or" && jqTruthy(left) {
+			return []interface{}{true}, nil
+		}
+		return q.each(n.right, input, func(right interface{}) ([]interface{}, error) {
+			value, err := jqBinaryOp(n.op, left, right)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{value}, nil
+		})
+	})
+}
+
+func (q *jqEval) object(n *jqObject, input interface{}) ([]interface{}, error) {
+	results := []map[string]interface{}{{}}
+	for i := range n.keys {
+		keys, err := q.eval(n.keys[i], input)
+		if err != nil {
+			return nil, err
+		}
+		values, err := q.eval(n.values[i], input)
+		if err != nil {
+			return nil, err
+		}
+		var next []map[string]interface{}
+		for _, partial := range results {
+			for _, key := range keys {
+				name, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("object keys must be strings, not %s", jqType(key))
+				}
+				for _, value := range values {
+					if err := q.step(); err != nil {
+						return nil, err
+					}
+					obj := make(map[string]interface{}, len(partial)+1)
+					for k, v := range partial {
+						obj[k] = v
+					}
+					obj[name] = value
+					next = append(next, obj)
+				}
+			}
+		}
+		results = next
+	}
+	out := make([]interface{}, len(results))
+	for i, obj := range results {
+		out[i] = obj
+	}
+	return out, nil
+}
+
+func jqGetField(v interface{}, name string) (interface{}, error) {
+	switch c := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return c[name], nil
+	}
+	return nil, fmt.Errorf("cannot index %s with %q", jqType(v), name)
+}
+
+func jqGetIndex(v, index interface{}) (interface{}, error) {
+	switch i := index.(type) {
+	case string:
+		return jqGetField(v, i)
+	case *big.Rat:
+		if v == nil {
+			return nil, nil
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %s with a number", jqType(v))
+		}
+		n, err := jqInt(i)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			n += len(list)
+		}
+		if n < 0 || n >= len(list) {
+			return nil, nil
+		}
+		return list[n], nil
+	}
+	return nil, fmt.Errorf("cannot index %s with %s", jqType(v), jqType(index))
+}
+
+func jqSliceOf(v interface{}, from, to *int) (interface{}, error) {
+	var length int
+	switch c := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		length = len(c)
+	case string:
+		length = len([]rune(c))
+	default:
+		return nil, fmt.Errorf("cannot slice %s", jqType(v))
+	}
+	bound := func(b *int, def int) int {
+		if b == nil {
+			return def
+		}
+		n := *b
+		if n < 0 {
+			n += length
+		}
+		return max(0, min(n, length))
+	}
+	start, end := bound(from, 0), bound(to, length)
+	if end < start {
+		end = start
+	}
+	if s, ok := v.(string); ok {
+		return string([]rune(s)[start:end]), nil
+	}
+	return append([]interface{}{}, v.([]interface{})[start:end]...), nil
+}
+
+// jqValues returns the elements of an array or the values of an object
+func jqValues(v interface{}) ([]interface{}, error) {
+	switch c := v.(type) {
+	case []interface{}:
+		return c, nil
+	case map[string]interface{}:
+		out := make([]interface{}, 0, len(c))
+		for _, key := range sortedKeys(c) {
+			out = append(out, c[key])
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", jqType(v))
+}
+
+func jqTruthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+func jqInt(v interface{}) (int, error) {
+	r, ok := v.(*big.Rat)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, got %s", jqType(v))
+	}
+	n, ok := ratInt(truncRat(r))
+	if !ok || n > 1<<31 || n < -(1<<31) {
+		return 0, fmt.Errorf("number out of range")
+	}
+	return int(n), nil
+}
+
+func jqType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case *big.Rat:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func jqBinaryOp(op string, left, right interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return jqCompare(left, right) == 0, nil
+	case "!=":
+		return jqCompare(left, right) != 0, nil
+	case "<":
+		return jqCompare(left, right) < 0, nil
+	case "<=":
+		return jqCompare(left, right) <= 0, nil
+	case ">":
+		return jqCompare(left, right) > 0, nil
+	case ">=":
+		return jqCompare(left, right) >= 0, nil
+	case "and", "or":
+		return jqTruthy(right), nil
+	}
+
+	if l, ok := left.(*big.Rat); ok {
+		if r, ok := right.(*big.Rat); ok {
+			if op == "%" {
+				li, ri := truncRat(l), truncRat(r)
+				if ri.Sign() == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return new(big.Rat).SetInt(new(big.Int).Rem(li.Num(), ri.Num())), nil
+			}
+			return ratOp(op, l, r)
+		}
+	}
+	switch op {
+	case "+":
+		if left == nil {
+			return right, nil
+		}
+		if right == nil {
+			return left, nil
+		}
+		switch l := left.(type) {
+		case string:
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		case []interface{}:
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+		case map[string]interface{}:
+			if r, ok := right.(map[string]interface{}); ok {
+				merged := make(map[string]interface{}, len(l)+len(r))
+				for k, v := range l {
+					merged[k] = v
+				}
+				for k, v := range r {
+					merged[k] = v
+				}
+				return merged, nil
+			}
+		}
+	case "-":
+		if l, ok := left.([]interface{}); ok {
+			if r, ok := right.([]interface{}); ok {
+				out := []interface{}{}
+				for _, item := range l {
+					keep := true
+					for _, remove := range r {
+						if jqCompare(item, remove) == 0 {
+							keep = false
+							break
+						}
+					}
+					if keep {
+						out = append(out, item)
+					}
+				}
+				return out, nil
+			}
+		}
+	case "/":
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return jqSplit(l, r), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s cannot be applied to %s and %s", op, jqType(left), jqType(right))
+}
+
+func jqSplit(s, sep string) []interface{} {
+	parts := strings.Split(s, sep)
+	out := make([]interface{}, len(parts))
+	for i, part := range parts {
+		out[i] = part
+	}
+	return out
+}
+
+// jqCompare orders values as jq does: null, false, true, numbers, strings,
+// arrays, objects
+func jqCompare(a, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch x := v.(type) {
+		case nil:
+			return 0
+		case bool:
+			if x {
+				return 2
+			}
+			return 1
+		case *big.Rat:
+			return 3
+		case string:
+			return 4
+		case []interface{}:
+			return 5
+		}
+		return 6
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch x := a.(type) {
+	case *big.Rat:
+		return x.Cmp(b.(*big.Rat))
+	case string:
+		return strings.Compare(x, b.(string))
+	case []interface{}:
+		y := b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := jqCompare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return len(x) - len(y)
+	case map[string]interface{}:
+		y := b.(map[string]interface{})
+		keysX, keysY := sortedKeys(x), sortedKeys(y)
+		if c := jqCompare(stringsToEnum(keysX), stringsToEnum(keysY)); c != 0 {
+			return c
+		}
+		for _, key := range keysX {
+			if c := jqCompare(x[key], y[key]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+// jqFromJSON converts decoded JSON to query values; json.Number and float64
+// become exact numbers
+func jqFromJSON(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case json.Number:
+		return parseDecimal(x.String())
+	case float64:
+		return ratFromFloat(x)
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, item := range x {
+			value, err := jqFromJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for key, item := range x {
+			value, err := jqFromJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// jqToJSON converts query values back to values encoding/json can write
+func jqToJSON(v interface{}) interface{} {
+	switch x := v.(type) {
+	case *big.Rat:
+		return json.Number(formatDecimal(x, defaultDecimalPlaces))
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, item := range x {
+			out[i] = jqToJSON(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for key, item := range x {
+			out[key] = jqToJSON(item)
+		}
+		return out
+	}
+	return v
+}
+
+// parseJQInput decodes JSON text keeping numbers exact
+func parseJQInput(text string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("more than one JSON value")
+	}
+	return jqFromJSON(value)
+}
@@ -0,0 +1,635 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jqFunctionNames lists the supported builtins for error messages
+var jqFunctionNames = []string{
+	"add", "all", "any", "arrays", "ascii_downcase", "ascii_upcase", "ceil", "contains", "empty",
+	"endswith", "first", "flatten", "floor", "from_entries", "fromjson", "group_by", "has", "join",
+	"keys", "last", "length", "limit", "ltrimstr", "map", "map_values", "max", "max_by", "min",
+	"min_by", "not", "numbers", "objects", "range", "recurse", "reverse", "round", "rtrimstr",
+	"select", "sort", "sort_by", "split", "startswith", "strings", "test", "to_entries", "tojson",
+	"tonumber", "tostring", "type", "unique", "unique_by", "with_entries",
+}
+
+func (q *jqEval) call(n *jqCall, input interface{}) ([]interface{}, error) {
+	one := func(v interface{}, err error) ([]interface{}, error) {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+		return []interface{}{v}, nil
+	}
+	arity := len(n.args)
+	wrongArity := func() ([]interface{}, error) {
+		return nil, fmt.Errorf("%s/%d is not defined", n.name, arity)
+	}
+
+	switch arity {
+	case 0:
+		switch n.name {
+		case "empty":
+			return nil, nil
+		case "not":
+			return []interface{}{!jqTruthy(input)}, nil
+		case "length":
+			return one(jqLength(input))
+		case "keys":
+			obj, ok := input.(map[string]interface{})
+			if list, isList := input.([]interface{}); isList {
+				keys := make([]interface{}, len(list))
+				for i := range list {
+					keys[i] = big.NewRat(int64(i), 1)
+				}
+				return one(keys, nil)
+			}
+			if !ok {
+				return one(nil, fmt.Errorf("%s has no keys", jqType(input)))
+			}
+			return one(stringsToEnum(sortedKeys(obj)), nil)
+		case "add":
+			values, err := jqValues(input)
+			if err != nil {
+				return one(nil, err)
+			}
+			var sum interface{}
+			for _, v := range values {
+				if sum, err = jqBinaryOp("+", sum, v); err != nil {
+					return one(nil, err)
+				}
+			}
+			return one(sum, nil)
+		case "any", "all":
+			values, err := jqValues(input)
+			if err != nil {
+				return one(nil, err)
+			}
+			return one(jqAnyAll(n.name, values), nil)
+		case "sort", "unique", "min", "max", "reverse", "flatten":
+			list, ok := input.([]interface{})
+			if !ok {
+				if n.name == "reverse" && input == nil {
+					return one([]interface{}{}, nil)
+				}
+				return one(nil, fmt.Errorf("cannot apply to %s", jqType(input)))
+			}
+			return one(jqListOp(n.name, list, list, -1))
+		case "to_entries":
+			obj, ok := input.(map[string]interface{})
+			if !ok {
+				return one(nil, fmt.Errorf("cannot apply to %s", jqType(input)))
+			}
+			entries := make([]interface{}, 0, len(obj))
+			for _, key := range sortedKeys(obj) {
+				entries = append(entries, map[string]interface{}{"key": key, "value": obj[key]})
+			}
+			return one(entries, nil)
+		case "from_entries":
+			return one(jqFromEntries(input))
+		case "type":
+			return []interface{}{jqType(input)}, nil
+		case "tostring":
+			if s, ok := input.(string); ok {
+				return []interface{}{s}, nil
+			}
+			data, err := json.Marshal(jqToJSON(input))
+			return one(string(data), err)
+		case "tojson":
+			data, err := json.Marshal(jqToJSON(input))
+			return one(string(data), err)
+		case "fromjson":
+			s, ok := input.(string)
+			if !ok {
+				return one(nil, fmt.Errorf("cannot parse %s", jqType(input)))
+			}
+			return one(parseJQInput(s))
+		case "tonumber":
+			switch v := input.(type) {
+			case *big.Rat:
+				return []interface{}{v}, nil
+			case string:
+				return one(parseDecimal(v))
+			}
+			return one(nil, fmt.Errorf("cannot convert %s", jqType(input)))
+		case "floor", "ceil", "round":
+			r, ok := input.(*big.Rat)
+			if !ok {
+				return one(nil, fmt.Errorf("expected a number, got %s", jqType(input)))
+			}
+			switch n.name {
+			case "floor":
+				return one(floorRat(r), nil)
+			case "ceil":
+				return one(ceilRat(r), nil)
+			}
+			return one(roundRat(r, 0), nil)
+		case "ascii_downcase", "ascii_upcase":
+			s, ok := input.(string)
+			if !ok {
+				return one(nil, fmt.Errorf("expected a string, got %s", jqType(input)))
+			}
+			if n.name == "ascii_downcase" {
+				return one(strings.ToLower(s), nil)
+			}
+			return one(strings.ToUpper(s), nil)
+		case "recurse":
+			var out []interface{}
+			return out, q.recurse(input, &out)
+		case "arrays", "objects", "strings", "numbers":
+			want := map[string]string{"arrays": "array", "objects": "object", "strings": "string", "numbers": "number"}[n.name]
+			if jqType(input) == want {
+				return []interface{}{input}, nil
+			}
+			return nil, nil
+		case "first", "last":
+			list, ok := input.([]interface{})
+			if !ok {
+				return one(nil, fmt.Errorf("cannot apply to %s", jqType(input)))
+			}
+			if len(list) == 0 {
+				return one(nil, nil)
+			}
+			if n.name == "first" {
+				return one(list[0], nil)
+			}
+			return one(list[len(list)-1], nil)
+		}
+
+	case 1:
+		arg := n.args[0]
+		switch n.name {
+		case "map", "map_values":
+			if n.name == "map_values" {
+				if obj, ok := input.(map[string]interface{}); ok {
+					out := make(map[string]interface{}, len(obj))
+					for key, v := range obj {
+						results, err := q.eval(arg, v)
+						if err != nil {
+							return nil, err
+						}
+						if len(results) > 0 {
+							out[key] = results[0]
+						}
+					}
+					return one(out, nil)
+				}
+			}
+			values, err := jqValues(input)
+			if err != nil {
+				return one(nil, err)
+			}
+			out := []interface{}{}
+			for _, v := range values {
+				results, err := q.eval(arg, v)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, results...)
+			}
+			return one(out, nil)
+		case "select":
+			conds, err := q.eval(arg, input)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, cond := range conds {
+				if jqTruthy(cond) {
+					out = append(out, input)
+				}
+			}
+			return out, nil
+		case "sort_by", "group_by", "unique_by", "min_by", "max_by":
+			list, ok := input.([]interface{})
+			if !ok {
+				return one(nil, fmt.Errorf("cannot apply to %s", jqType(input)))
+			}
+			keys := make([]interface{}, len(list))
+			for i, v := range list {
+				results, err := q.eval(arg, v)
+				if err != nil {
+					return nil, err
+				}
+				if results == nil {
+					results = []interface{}{}
+				}
+				keys[i] = results
+			}
+			return one(jqListOp(strings.TrimSuffix(n.name, "_by"), list, keys, -1))
+		case "has":
+			keys, err := q.eval(arg, input)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, key := range keys {
+				switch c := input.(type) {
+				case map[string]interface{}:
+					name, ok := key.(string)
+					if !ok {
+						return one(nil, fmt.Errorf("object keys are strings"))
+					}
+					_, exists := c[name]
+					out = append(out, exists)
+				case []interface{}:
+					i, err := jqInt(key)
+					if err != nil {
+						return one(nil, err)
+					}
+					out = append(out, i >= 0 && i < len(c))
+				default:
+					return one(nil, fmt.Errorf("cannot check keys of %s", jqType(input)))
+				}
+			}
+			return out, nil
+		case "any", "all":
+			values, err := jqValues(input)
+			if err != nil {
+				return one(nil, err)
+			}
+			var conds []interface{}
+			for _, v := range values {
+				results, err := q.eval(arg, v)
+				if err != nil {
+					return nil, err
+				}
+				conds = append(conds, results...)
+			}
+			return one(jqAnyAll(n.name, conds), nil)
+		case "with_entries":
+			entries, err := q.call(&jqCall{name: "to_entries"}, input)
+			if err != nil {
+				return nil, err
+			}
+			mapped, err := q.call(&jqCall{name: "map", args: []jqNode{arg}}, entries[0])
+			if err != nil {
+				return nil, err
+			}
+			return one(jqFromEntries(mapped[0]))
+		case "first", "last":
+			results, err := q.eval(arg, input)
+			if err != nil {
+				return nil, err
+			}
+			if len(results) == 0 {
+				return nil, nil
+			}
+			if n.name == "first" {
+				return results[:1], nil
+			}
+			return results[len(results)-1:], nil
+		case "flatten":
+			depths, err := q.eval(arg, input)
+			if err != nil {
+				return nil, err
+			}
+			list, ok := input.([]interface{})
+			if !ok {
+				return one(nil, fmt.Errorf("cannot apply to %s", jqType(input)))
+			}
+			var out []interface{}
+			for _, depth := range depths {
+				d, err := jqInt(depth)
+				if err != nil || d < 0 {
+					return one(nil, fmt.Errorf("depth must be a positive number"))
+				}
+				results, err := one(jqListOp("flatten", list, list, d))
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, results...)
+			}
+			return out, nil
+		case "range":
+			limits, err := q.eval(arg, input)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, limit := range limits {
+				end, err := jqInt(limit)
+				if err != nil {
+					return one(nil, err)
+				}
+				for i := 0; i < end; i++ {
+					if err := q.step(); err != nil {
+						return nil, err
+					}
+					out = append(out, big.NewRat(int64(i), 1))
+				}
+			}
+			return out, nil
+		case "join", "split", "test", "startswith", "endswith", "ltrimstr", "rtrimstr", "contains":
+			params, err := q.eval(arg, input)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, param := range params {
+				value, err := jqStringFunc(n.name, input, param)
+				if err != nil {
+					return one(nil, err)
+				}
+				out = append(out, value)
+			}
+			return out, nil
+		}
+
+	case 2:
+		switch n.name {
+		case "limit":
+			counts, err := q.eval(n.args[0], input)
+			if err != nil {
+				return nil, err
+			}
+			if len(counts) != 1 {
+				return one(nil, fmt.Errorf("the count must be one number"))
+			}
+			count, err := jqInt(counts[0])
+			if err != nil {
+				return one(nil, err)
+			}
+			results, err := q.eval(n.args[1], input)
+			if err != nil {
+				return nil, err
+			}
+			return results[:max(0, min(count, len(results)))], nil
+		case "range":
+			starts, err := q.eval(n.args[0], input)
+			if err != nil {
+				return nil, err
+			}
+			ends, err := q.eval(n.args[1], input)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, startValue := range starts {
+				for _, endValue := range ends {
+					start, err := jqInt(startValue)
+					if err != nil {
+						return one(nil, err)
+					}
+					end, err := jqInt(endValue)
+					if err != nil {
+						return one(nil, err)
+					}
+					for i := start; i < end; i++ {
+						if err := q.step(); err != nil {
+							return nil, err
+						}
+						out = append(out, big.NewRat(int64(i), 1))
+					}
+				}
+			}
+			return out, nil
+		}
+	}
+
+	for _, name := range jqFunctionNames {
+		if name == n.name {
+			return wrongArity()
+		}
+	}
+	return nil, fmt.Errorf("unknown function %s (available: %s)", n.name, strings.Join(jqFunctionNames, ", "))
+}
+
+func jqLength(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil:
+		return big.NewRat(0, 1), nil
+	case bool:
+		return nil, fmt.Errorf("boolean has no length")
+	case *big.Rat:
+		return new(big.Rat).Abs(x), nil
+	case string:
+		return big.NewRat(int64(len([]rune(x))), 1), nil
+	case []interface{}:
+		return big.NewRat(int64(len(x)), 1), nil
+	case map[string]interface{}:
+		return big.NewRat(int64(len(x)), 1), nil
+	}
+	return nil, fmt.Errorf("%s has no length", jqType(v))
+}
+
+func jqAnyAll(name string, values []interface{}) bool {
+	for _, v := range values {
+		if name == "any" && jqTruthy(v) {
+			return true
+		}
+		if name == "all" && !jqTruthy(v) {
+			return false
+		}
+	}
+	return name == "all"
+}
+
+// jqListOp sorts, groups, dedupes or picks from list, comparing keys[i] for
+// list[i]. keys is list itself for the forms without _by.
+func jqListOp(op string, list []interface{}, keys []interface{}, depth int) (interface{}, error) {
+	switch op {
+	case "reverse":
+		out := make([]interface{}, len(list))
+		for i, v := range list {
+			out[len(list)-1-i] = v
+		}
+		return out, nil
+	case "flatten":
+		var out []interface{}
+		for _, v := range list {
+			if inner, ok := v.([]interface{}); ok && depth != 0 {
+				flat, _ := jqListOp("flatten", inner, inner, depth-1)
+				out = append(out, flat.([]interface{})...)
+				continue
+			}
+			out = append(out, v)
+		}
+		if out == nil {
+			out = []interface{}{}
+		}
+		return out, nil
+	case "min", "max":
+		if len(list) == 0 {
+			return nil, nil
+		}
+		best := 0
+		for i := 1; i < len(list); i++ {
+			c := jqCompare(keys[i], keys[best])
+			if (op == "min" && c < 0) || (op == "max" && c >= 0) {
+				best = i
+			}
+		}
+		return list[best], nil
+	}
+
+	index := make([]int, len(list))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(a, b int) bool {
+		return jqCompare(keys[index[a]], keys[index[b]]) < 0
+	})
+
+	out := []interface{}{}
+	switch op {
+	case "sort":
+		for _, i := range index {
+			out = append(out, list[i])
+		}
+	case "unique":
+		for n, i := range index {
+			if n == 0 || jqCompare(keys[i], keys[index[n-1]]) != 0 {
+				out = append(out, list[i])
+			}
+		}
+	case "group":
+		var group []interface{}
+		for n, i := range index {
+			if n > 0 && jqCompare(keys[i], keys[index[n-1]]) != 0 {
+				out = append(out, group)
+				group = nil
+			}
+			group = append(group, list[i])
+		}
+		if group != nil {
+			out = append(out, group)
+		}
+	default:
+		return nil, fmt.Errorf("unknown list operation %s", op)
+	}
+	return out, nil
+}
+
+func jqFromEntries(v interface{}) (interface{}, error) {
+	entries, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array of entries, got %s", jqType(v))
+	}
+	out := make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		obj, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("entries must be objects")
+		}
+		var key interface{}
+		for _, name := range []string{"key", "k", "name", "Key", "Name"} {
+			if k, exists := obj[name]; exists && k != nil {
+				key = k
+				break
+			}
+		}
+		value := obj["value"]
+		if v, exists := obj["v"]; exists && value == nil {
+			value = v
+		}
+		switch k := key.(type) {
+		case string:
+			out[k] = value
+		case *big.Rat:
+			out[formatDecimal(k, defaultDecimalPlaces)] = value
+		case bool:
+			out[fmt.Sprint(k)] = value
+		default:
+			return nil, fmt.Errorf("entry has no key")
+		}
+	}
+	return out, nil
+}
+
+func jqStringFunc(name string, input, param interface{}) (interface{}, error) {
+	if name == "contains" {
+		return jqContains(input, param)
+	}
+	if name == "join" {
+		list, ok := input.([]interface{})
+		sep, sepOK := param.(string)
+		if !ok || !sepOK {
+			return nil, fmt.Errorf("join expects an array and a string separator")
+		}
+		parts := make([]string, len(list))
+		for i, v := range list {
+			switch x := v.(type) {
+			case nil:
+			case string:
+				parts[i] = x
+			case *big.Rat:
+				parts[i] = formatDecimal(x, defaultDecimalPlaces)
+			case bool:
+				parts[i] = fmt.Sprint(x)
+			default:
+				return nil, fmt.Errorf("cannot join %s", jqType(v))
+			}
+		}
+		return strings.Join(parts, sep), nil
+	}
+
+	s, ok := input.(string)
+	p, pOK := param.(string)
+	if !ok || !pOK {
+		if (name == "ltrimstr" || name == "rtrimstr") && !ok {
+			return input, nil
+		}
+		return nil, fmt.Errorf("expects strings, got %s and %s", jqType(input), jqType(param))
+	}
+	switch name {
+	case "split":
+		return jqSplit(s, p), nil
+	case "test":
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return re.MatchString(s), nil
+	case "startswith":
+		return strings.HasPrefix(s, p), nil
+	case "endswith":
+		return strings.HasSuffix(s, p), nil
+	case "ltrimstr":
+		return strings.TrimPrefix(s, p), nil
+	}
+	return strings.TrimSuffix(s, p), nil
+}
+
+// jqContains follows jq: substrings for strings, every element of b contained
+// in some element of a for arrays, and recursively by key for objects
+func jqContains(a, b interface{}) (bool, error) {
+	if jqType(a) != jqType(b) {
+		return false, fmt.Errorf("%s and %s cannot have their containment checked", jqType(a), jqType(b))
+	}
+	switch x := a.(type) {
+	case string:
+		return strings.Contains(x, b.(string)), nil
+	case []interface{}:
+		for _, wanted := range b.([]interface{}) {
+			found := false
+			for _, item := range x {
+				if ok, _ := jqContains(item, wanted); ok {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false, nil
+			}
+		}
+		return true, nil
+	case map[string]interface{}:
+		for key, wanted := range b.(map[string]interface{}) {
+			value, exists := x[key]
+			if !exists {
+				return false, nil
+			}
+			if ok, _ := jqContains(value, wanted); !ok {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return jqCompare(a, b) == 0, nil
+}
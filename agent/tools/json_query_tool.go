@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// maxJSONQueryResults bounds the values a query returns
+const maxJSONQueryResults = 500
+
+// JSONQueryTool runs jq-style queries over JSON passed in the call or recorded
+// by an earlier tool execution. Queries cannot define variables or functions,
+// read files or call out, and run with a step budget.
+type JSONQueryTool struct {
+	*BaseTool
+}
+
+// JSONQueryResult is the outcome of a json_query call
+type JSONQueryResult struct {
+	Results []interface{} `json:"results"`
+	Count   int           `json:"count"`             // Values the query produced
+	Omitted int           `json:"omitted,omitempty"` // Values beyond maxJSONQueryResults
+}
+
+// NewJSONQueryTool creates the json_query tool
+func NewJSONQueryTool() *JSONQueryTool {
+	tool := &JSONQueryTool{
+		BaseTool: NewBaseTool(
+			"json_query",
+			"Runs a jq query over JSON, either given in input or taken from an earlier tool result by its execution_id, to filter, reshape, count or total data without copying it by hand. "+
+				"Supports ., .field, .[n], .[a:b], .[], .., |, ',', ?, //, arithmetic, comparisons, and/or/not, if-then-elif-else-end, [...] and {...} constructors, and the functions "+
+				"length, keys, add, any, all, map, map_values, select, sort, sort_by, group_by, unique, unique_by, min, max, min_by, max_by, reverse, flatten, first, last, limit, range, "+
+				"has, contains, to_entries, from_entries, with_entries, join, split, test, startswith, endswith, ltrimstr, rtrimstr, ascii_downcase, ascii_upcase, floor, ceil, round, "+
+				"type, tostring, tonumber, tojson, fromjson, recurse, empty, arrays, objects, strings, numbers. Numbers are exact decimals. Variables ($x) and def are not supported.",
+			CategoryData,
+			false,
+			2,
+		),
+	}
+	tool.SetParameterSchema(&ParameterSchema{
+		Type:        "object",
+		Description: "Parameters for a JSON query",
+		Properties: map[string]PropertySchema{
+			"query": {
+				Type:        "string",
+				Description: "jq query, for example [.items[] | select(.price > 10) | .name]",
+			},
+			"input": {
+				Description: "JSON value to query, or JSON text",
+			},
+			"execution_id": {
+				Type:        "string",
+				Description: "Execution ID of an earlier tool result to query instead of input; its full output is used even if it was truncated",
+			},
+		},
+		Required: []string{"query"},
+	})
+	return tool
+}
+
+func (t *JSONQueryTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
+func (t *JSONQueryTool) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+func (t *JSONQueryTool) Execute(ctx context.Context, params map[string]interface{}) (*ToolResult, error) {
+	query, err := parseJQ(stringParam(params, "query"))
+	if err != nil {
+		return t.CreateErrorResult(err, "Invalid query"), nil
+	}
+
+	input, err := jsonQueryInput(ctx, params)
+	if err != nil {
+		return t.CreateErrorResult(err, "Invalid input"), nil
+	}
+
+	values, err := (&jqEval{}).eval(query, input)
+	if err != nil {
+		return t.CreateErrorResult(err, "Query failed"), nil
+	}
+
+	result := &JSONQueryResult{Results: []interface{}{}, Count: len(values)}
+	var lines []string
+	for i, value := range values {
+		if i == maxJSONQueryResults {
+			result.Omitted = len(values) - i
+			lines = append(lines, fmt.Sprintf("[%d more results omitted]", result.Omitted))
+			break
+		}
+		converted := jqToJSON(value)
+		data, err := json.Marshal(converted)
+		if err != nil {
+			return t.CreateErrorResult(err, "Query failed"), nil
+		}
+		result.Results = append(result.Results, converted)
+		lines = append(lines, string(data))
+	}
+	if len(values) == 0 {
+		lines = append(lines, "(no results)")
+	}
+	return t.CreateSuccessResult(result, strings.Join(lines, "\n")), nil
+}
+
+// jsonQueryInput returns the value to query: the input parameter or the
+// recorded result of execution_id. Text that is not JSON is queried as a string.
+func jsonQueryInput(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	raw, hasInput := params["input"]
+	if executionID := stringParam(params, "execution_id"); executionID != "" {
+		if hasInput {
+			return nil, fmt.Errorf("give either input or execution_id, not both")
+		}
+		recorded, ok := RecordedExecution(ctx, executionID)
+		if !ok {
+			return nil, fmt.Errorf("no recorded execution %s", executionID)
+		}
+		raw = recorded.Result.Data
+		if raw == nil {
+			raw = recorded.Result.Message
+		}
+	} else if !hasInput {
+		return nil, fmt.Errorf("input or execution_id is required")
+	}
+
+	if text, ok := raw.(string); ok {
+		if value, err := parseJQInput(text); err == nil {
+			return value, nil
+		}
+		return text, nil
+	}
+	// Results hold Go values such as structs; their JSON form is what the model sees
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return parseJQInput(string(data))
+}
@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const jsonQueryFixture = `{
+	"items": [
+		{"name": "a", "price": 19.99, "qty": 3, "tags": ["x"]},
+		{"name": "b", "price": 5.5, "qty": 2, "tags": []},
+		{"name": "c", "price": 0.1, "qty": 1, "tags": ["x", "y"]}
+	],
+	"meta": {"total": null}
+}`
+
+func TestJSONQuery(t *testing.T) {
+	tool := NewJSONQueryTool()
+	cases := []struct {
+		query   string
+		want    string // Message: one JSON value per line
+		wantErr string
+	}{
+		// Paths
+		{query: ".items[0].name", want: `"a"`},
+		{query: ".items[-1].name", want: `"c"`},
+		{query: `.["meta"]`, want: `{"total":null}`},
+		{query: ".items[1:] | map(.name)", want: `["b","c"]`},
+		{query: ".missing.field", want: "null"},
+		{query: ".items | .[0,1] | .name", want: "\"a\"\n\"b\""},
+		{query: ".meta.total // \"none\"", want: `"none"`},
+		{query: ".items[0].name.x?", want: "(no results)"},
+
+		// select and map
+		{query: "[.items[] | select(.price > 5) | .name]", want: `["a","b"]`},
+		{query: ".items | map(.price * .qty) | add", want: "71.07"},
+		{query: ".items | map(.price) | add", want: "25.59"},
+		{query: ".items[] | {name, cost: (.price * .qty)} | select(.cost < 1)", want: `{"cost":0.1,"name":"c"}`},
+		{query: ".items | sort_by(.price) | map(.name)", want: `["c","b","a"]`},
+		{query: ".items | group_by(.tags | length) | map(length)", want: "[1,1,1]"},
+		{query: ".items[0] | with_entries(select(.key != \"tags\"))", want: `{"name":"a","price":19.99,"qty":3}`},
+
+		// .. and recurse
+		{query: "[.. | numbers] | add", want: "31.59"},
+		{query: "[recurse | strings] | unique", want: `["a","b","c","x","y"]`},
+
+		// Other builtins
+		{query: "[.items[].tags[]] | unique", want: `["x","y"]`},
+		{query: "if (.items | length) > 2 then \"many\" else \"few\" end", want: `"many"`},
+		{query: "[range(3)]", want: "[0,1,2]"},
+		{query: "\"a,b\" | split(\",\")", want: `["a","b"]`},
+		{query: "[1,[2,[3]]] | flatten(1)", want: "[1,2,[3]]"},
+
+		// Errors
+		{query: ".items[0].name.x", wantErr: `cannot index string with "x"`},
+		{query: "$x", wantErr: "variables are not supported"},
+		{query: "foo", wantErr: "unknown function foo"},
+		{query: "map(1; 2)", wantErr: "map/2 is not defined"},
+		{query: "[range(100000000)]", wantErr: "query takes more than"},
+		{query: ".items[", wantErr: "unexpected end"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			result, err := tool.Execute(context.Background(), map[string]interface{}{"query": tc.query, "input": jsonQueryFixture})
+			if err != nil {
+				t.Fatalf("Execute returned error: %v", err)
+			}
+			if tc.wantErr != "" {
+				if result.Success {
+					t.Fatalf("expected error containing %q, got %s", tc.wantErr, result.Message)
+				}
+				if !strings.Contains(result.Error, tc.wantErr) {
+					t.Fatalf("error = %q, want it to contain %q", result.Error, tc.wantErr)
+				}
+				return
+			}
+			if !result.Success {
+				t.Fatalf("query failed: %s", result.Error)
+			}
+			if result.Message != tc.want {
+				t.Errorf("result = %s, want %s", result.Message, tc.want)
+			}
+		})
+	}
+}
+
+func TestJSONQueryRecordedExecution(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.RegisterTool(NewCalculateTool())
+	registry.RegisterTool(NewJSONQueryTool())
+	ctx := context.Background()
+
+	calc, err := registry.ExecuteTool(ctx, ToolExecution{ToolName: "calculate", Parameters: map[string]interface{}{"expression": "a = 1; b = 2; a + b"}})
+	if err != nil || !calc.Success {
+		t.Fatalf("calculate failed: %v", err)
+	}
+	query, err := registry.ExecuteTool(ctx, ToolExecution{ToolName: "json_query", Parameters: map[string]interface{}{"query": ".variables.b", "execution_id": calc.ExecutionID}})
+	if err != nil || !query.Success {
+		t.Fatalf("json_query failed: %v %s", err, query.Error)
+	}
+	if query.Message != `"2"` {
+		t.Errorf("result = %s, want \"2\"", query.Message)
+	}
+
+	missing, _ := registry.ExecuteTool(ctx, ToolExecution{ToolName: "json_query", Parameters: map[string]interface{}{"query": ".", "execution_id": "nope"}})
+	if missing.Success || !strings.Contains(missing.Error, "no recorded execution") {
+		t.Errorf("unknown execution_id: success=%v error=%q", missing.Success, missing.Error)
+	}
+}
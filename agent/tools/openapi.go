@@ -0,0 +1,388 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxRefDepth bounds nested $ref expansion; deeper schemas accept any value
+const maxRefDepth = 32
+
+// OpenAPISpec is the part of an OpenAPI 3 document the importer uses. Local
+// $ref references are already resolved, so schemas are plain JSON Schema maps.
+type OpenAPISpec struct {
+	OpenAPI string                     `json:"openapi"`
+	Info    OpenAPIInfo                `json:"info"`
+	Servers []OpenAPIServer            `json:"servers"`
+	Paths   map[string]OpenAPIPathItem `json:"paths"`
+	// Security applies to operations that declare none
+	Security []map[string][]string `json:"security"`
+}
+
+// OpenAPIInfo describes the API
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIServer is a base URL of the API, with {variables}
+type OpenAPIServer struct {
+	URL       string `json:"url"`
+	Variables map[string]struct {
+		Default string `json:"default"`
+	} `json:"variables"`
+}
+
+// OpenAPIPathItem holds the operations of a path
+type OpenAPIPathItem struct {
+	Parameters []OpenAPIParameter `json:"parameters"` // Shared by the operations of the path
+	Get        *OpenAPIOperation  `json:"get"`
+	Put        *OpenAPIOperation  `json:"put"`
+	Post       *OpenAPIOperation  `json:"post"`
+	Delete     *OpenAPIOperation  `json:"delete"`
+	Patch      *OpenAPIOperation  `json:"patch"`
+	Head       *OpenAPIOperation  `json:"head"`
+}
+
+// Operations returns the operations of the path by HTTP method
+func (p OpenAPIPathItem) Operations() map[string]*OpenAPIOperation {
+	ops := map[string]*OpenAPIOperation{}
+	for method, op := range map[string]*OpenAPIOperation{
+		"GET": p.Get, "PUT": p.Put, "POST": p.Post, "DELETE": p.Delete, "PATCH": p.Patch, "HEAD": p.Head,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+// OpenAPIOperation is one method of a path
+type OpenAPIOperation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description"`
+	Tags        []string               `json:"tags"`
+	Deprecated  bool                   `json:"deprecated"`
+	Parameters  []OpenAPIParameter     `json:"parameters"`
+	RequestBody *OpenAPIRequestBody    `json:"requestBody"`
+	Security    *[]map[string][]string `json:"security"` // nil inherits the document security
+}
+
+// OpenAPIParameter is a path, query, header or cookie parameter
+type OpenAPIParameter struct {
+	Name        string                      `json:"name"`
+	In          string                      `json:"in"`
+	Description string                      `json:"description"`
+	Required    bool                        `json:"required"`
+	Deprecated  bool                        `json:"deprecated"`
+	Schema      map[string]interface{}      `json:"schema"`
+	Content     map[string]OpenAPIMediaType `json:"content"` // Alternative to schema
+	Explode     *bool                       `json:"explode"` // Arrays in the query repeat the name unless false
+}
+
+// OpenAPIRequestBody is the body of an operation by media type
+type OpenAPIRequestBody struct {
+	Description string                      `json:"description"`
+	Required    bool                        `json:"required"`
+	Content     map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIMediaType holds the schema of a media type
+type OpenAPIMediaType struct {
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// LoadOpenAPISpec reads an OpenAPI 3 document in JSON or YAML and resolves its
+// local $ref references. References to other files are not supported.
+func LoadOpenAPISpec(path string) (*OpenAPISpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI spec: %w", err)
+	}
+
+	var doc interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc) // YAML is a superset of JSON
+		doc = normalizeYAML(doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec %s: %w", path, err)
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("OpenAPI spec %s is not an object", path)
+	}
+	if version, _ := root["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("OpenAPI spec %s: only OpenAPI 3 documents are supported", path)
+	}
+
+	// Only operations are imported, so only the paths are expanded
+	paths, err := resolveRefs(root["paths"], root, nil)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAPI spec %s: %w", path, err)
+	}
+	data, err = json.Marshal(map[string]interface{}{
+		"openapi":  root["openapi"],
+		"info":     root["info"],
+		"servers":  root["servers"],
+		"security": root["security"],
+		"paths":    paths,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var spec OpenAPISpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec %s: %w", path, err)
+	}
+	return &spec, nil
+}
+
+// ServerURL returns the first server URL with its variables set to their
+// defaults, or "" when the spec lists no server
+func (s *OpenAPISpec) ServerURL() string {
+	if len(s.Servers) == 0 {
+		return ""
+	}
+	server := s.Servers[0]
+	serverURL := server.URL
+	for name, variable := range server.Variables {
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", variable.Default)
+	}
+	return serverURL
+}
+
+// normalizeYAML converts the maps decoded by yaml.v3, whose keys may be
+// numbers (response codes), into JSON objects
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return obj
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	}
+	return value
+}
+
+// resolveRefs replaces {"$ref": "#/..."} objects with a copy of their target.
+// A reference to a schema that is being expanded (a recursive schema) or that
+// is nested too deep becomes an empty schema, which accepts any value.
+func resolveRefs(node interface{}, root map[string]interface{}, expanding []string) (interface{}, error) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if !strings.HasPrefix(ref, "#/") {
+				return nil, fmt.Errorf("external reference %q is not supported", ref)
+			}
+			for _, parent := range expanding {
+				if parent == ref {
+					return map[string]interface{}{}, nil
+				}
+			}
+			if len(expanding) >= maxRefDepth {
+				return map[string]interface{}{}, nil
+			}
+			target, err := lookupPointer(root, ref)
+			if err != nil {
+				return nil, err
+			}
+			return resolveRefs(target, root, append(expanding, ref))
+		}
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved, err := resolveRefs(item, root, expanding)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = resolved
+		}
+		return obj, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := resolveRefs(item, root, expanding)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	}
+	return node, nil
+}
+
+// lookupPointer follows a local JSON pointer such as "#/components/schemas/User"
+func lookupPointer(root map[string]interface{}, ref string) (interface{}, error) {
+	var node interface{} = root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("reference %q not found", ref)
+		}
+		if node, ok = obj[token]; !ok {
+			return nil, fmt.Errorf("reference %q not found", ref)
+		}
+	}
+	return node, nil
+}
+
+// openAPISchema converts an OpenAPI schema object into a property schema.
+// Properties marked readOnly are left out, as they are never sent.
+func openAPISchema(schema map[string]interface{}) PropertySchema {
+	prop := PropertySchema{}
+	if schema == nil {
+		return prop
+	}
+
+	switch t := schema["type"].(type) {
+	case string:
+		prop.Type = t
+	case []interface{}: // OpenAPI 3.1: ["string", "null"]
+		for _, item := range t {
+			name, _ := item.(string)
+			if name == "null" {
+				prop.Nullable = true
+			} else if name != "" && prop.Type == "" {
+				prop.Type = name
+			}
+		}
+	}
+	if nullable, _ := schema["nullable"].(bool); nullable { // OpenAPI 3.0
+		prop.Nullable = true
+	}
+	prop.Description, _ = schema["description"].(string)
+	prop.Format, _ = schema["format"].(string)
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		prop.Enum = enum
+	}
+	prop.Default = schema["default"]
+	prop.Minimum = schemaNumber(schema, "minimum")
+	prop.Maximum = schemaNumber(schema, "maximum")
+	if n := schemaNumber(schema, "minLength"); n != nil {
+		length := int(*n)
+		prop.MinLength = &length
+	}
+	if n := schemaNumber(schema, "maxLength"); n != nil {
+		length := int(*n)
+		prop.MaxLength = &length
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		itemsProp := openAPISchema(items)
+		prop.Items = &itemsProp
+		if prop.Type == "" {
+			prop.Type = "array"
+		}
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		prop.Properties = map[string]PropertySchema{}
+		for name, value := range properties {
+			field, _ := value.(map[string]interface{})
+			if readOnly, _ := field["readOnly"].(bool); readOnly {
+				continue
+			}
+			prop.Properties[name] = openAPISchema(field)
+		}
+		if prop.Type == "" {
+			prop.Type = "object"
+		}
+	}
+	for _, name := range schemaStrings(schema, "required") {
+		if _, ok := prop.Properties[name]; ok {
+			prop.Required = append(prop.Required, name)
+		}
+	}
+	switch additional := schema["additionalProperties"].(type) {
+	case bool:
+		prop.NoAdditionalProperties = !additional
+	case map[string]interface{}:
+		additionalProp := openAPISchema(additional)
+		prop.AdditionalProperties = &additionalProp
+	}
+
+	// allOf composes objects; its parts are merged into one
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, part := range allOf {
+			partSchema, _ := part.(map[string]interface{})
+			mergeSchema(&prop, openAPISchema(partSchema))
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		for _, alternative := range oneOf {
+			alternativeSchema, _ := alternative.(map[string]interface{})
+			prop.OneOf = append(prop.OneOf, openAPISchema(alternativeSchema))
+		}
+	}
+	// anyOf alternatives may overlap, which oneOf rejects, so it is left unchecked
+	return prop
+}
+
+func mergeSchema(prop *PropertySchema, part PropertySchema) {
+	if prop.Type == "" {
+		prop.Type = part.Type
+	}
+	if prop.Description == "" {
+		prop.Description = part.Description
+	}
+	if len(part.Properties) > 0 {
+		if prop.Properties == nil {
+			prop.Properties = map[string]PropertySchema{}
+		}
+		for name, field := range part.Properties {
+			prop.Properties[name] = field
+		}
+	}
+	prop.Required = append(prop.Required, part.Required...)
+	if prop.Items == nil {
+		prop.Items = part.Items
+	}
+	if len(prop.Enum) == 0 {
+		prop.Enum = part.Enum
+	}
+	if prop.Format == "" {
+		prop.Format = part.Format
+	}
+}
+
+func schemaNumber(schema map[string]interface{}, key string) *float64 {
+	if n, ok := toFloat(schema[key]); ok {
+		return &n
+	}
+	return nil
+}
+
+func schemaStrings(schema map[string]interface{}, key string) []string {
+	list, _ := schema[key].([]interface{})
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
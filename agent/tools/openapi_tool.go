@@ -0,0 +1,381 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// maxOperationDescription bounds the description an operation adds to the prompt
+const maxOperationDescription = 1000
+
+// OpenAPITool calls one operation of an OpenAPI spec. Its parameters are the
+// path, query and header parameters of the operation plus the JSON body.
+type OpenAPITool struct {
+	*BaseTool
+	client     *APIClient
+	method     string
+	baseURL    string // Relative or empty to use the conversation API host
+	path       string
+	params     []OpenAPIParameter
+	bodyName   string // Parameter holding the request body, "" without body
+	credential string
+}
+
+// OpenAPIBaseURL returns the base URL of the operations: the configured one or
+// the first server of the spec
+func OpenAPIBaseURL(spec *OpenAPISpec, cfg config.OpenAPIConfig) string {
+	if cfg.BaseURL != "" {
+		return cfg.BaseURL
+	}
+	return spec.ServerURL()
+}
+
+// ImportOpenAPI creates a tool for each operation of the spec selected by the
+// tags, methods and operations filters of cfg. Deprecated operations and those
+// whose body is not JSON are skipped; the returned warnings say why.
+func ImportOpenAPI(name string, spec *OpenAPISpec, cfg config.OpenAPIConfig, client *APIClient, confirmMethods []string) ([]*OpenAPITool, []string, error) {
+	for scheme, profile := range cfg.Security {
+		if !client.hasCredential(profile) {
+			return nil, nil, fmt.Errorf("openapi %s: security scheme %s uses unknown credential profile %q", name, scheme, profile)
+		}
+	}
+	if cfg.Credential != "" && !client.hasCredential(cfg.Credential) {
+		return nil, nil, fmt.Errorf("openapi %s: unknown credential profile %q", name, cfg.Credential)
+	}
+
+	prefix := cfg.ToolPrefix
+	if prefix == "" {
+		prefix = name + "_"
+	}
+	baseURL := strings.TrimSuffix(OpenAPIBaseURL(spec, cfg), "/")
+
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var imported []*OpenAPITool
+	var warnings []string
+	names := map[string]bool{}
+	for _, path := range paths {
+		item := spec.Paths[path]
+		ops := item.Operations()
+		for _, method := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"} {
+			op, ok := ops[method]
+			if !ok || !selectOperation(method, op, cfg) {
+				continue
+			}
+			if op.Deprecated {
+				warnings = append(warnings, fmt.Sprintf("%s %s: deprecated, skipped", method, path))
+				continue
+			}
+
+			tool, err := newOpenAPITool(method, path, item, op, spec, cfg, client, confirmMethods)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s %s: %v, skipped", method, path, err))
+				continue
+			}
+			tool.baseURL = baseURL
+
+			toolName := operationToolName(prefix, method, path, op.OperationID)
+			for i := 2; names[toolName]; i++ {
+				suffix := "_" + strconv.Itoa(i)
+				toolName = operationToolName(prefix, method, path, op.OperationID)
+				toolName = toolName[:min(len(toolName), 64-len(suffix))] + suffix
+			}
+			names[toolName] = true
+			tool.name = toolName
+			imported = append(imported, tool)
+		}
+	}
+	return imported, warnings, nil
+}
+
+// selectOperation applies the methods, tags and operations filters
+func selectOperation(method string, op *OpenAPIOperation, cfg config.OpenAPIConfig) bool {
+	if len(cfg.Methods) > 0 && !containsFold(cfg.Methods, method) {
+		return false
+	}
+	if len(cfg.Operations) > 0 && !containsFold(cfg.Operations, op.OperationID) {
+		return false
+	}
+	if len(cfg.Tags) > 0 {
+		for _, tag := range op.Tags {
+			if containsFold(cfg.Tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func newOpenAPITool(method, path string, item OpenAPIPathItem, op *OpenAPIOperation, spec *OpenAPISpec, cfg config.OpenAPIConfig, client *APIClient, confirmMethods []string) (*OpenAPITool, error) {
+	tool := &OpenAPITool{
+		BaseTool: NewBaseTool(
+			"", // Set by ImportOpenAPI once the name is unique
+			operationDescription(method, path, op),
+			CategoryAPI,
+			containsFold(confirmMethods, method),
+			20,
+		),
+		client: client,
+		method: method,
+		path:   path,
+	}
+
+	// Operation parameters override the path parameters with the same name and location
+	params := map[string]OpenAPIParameter{}
+	for _, list := range [][]OpenAPIParameter{item.Parameters, op.Parameters} {
+		for _, param := range list {
+			params[param.In+":"+param.Name] = param
+		}
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	schema := &ParameterSchema{
+		Type:        "object",
+		Description: fmt.Sprintf("Parameters of %s %s", method, path),
+		Properties:  map[string]PropertySchema{},
+	}
+	for _, key := range keys {
+		param := params[key]
+		if param.In == "cookie" {
+			if param.Required {
+				return nil, fmt.Errorf("required cookie parameter %s is not supported", param.Name)
+			}
+			continue
+		}
+		if _, taken := schema.Properties[param.Name]; taken {
+			return nil, fmt.Errorf("parameter %s is defined in more than one location", param.Name)
+		}
+
+		paramSchema := param.Schema
+		if paramSchema == nil {
+			for _, media := range param.Content {
+				paramSchema = media.Schema
+				break
+			}
+		}
+		prop := openAPISchema(paramSchema)
+		if param.Description != "" {
+			prop.Description = param.Description
+		}
+		schema.Properties[param.Name] = prop
+		if param.In == "path" || param.Required {
+			schema.Required = append(schema.Required, param.Name)
+		}
+		tool.params = append(tool.params, param)
+	}
+
+	if body := op.RequestBody; body != nil && len(body.Content) > 0 {
+		media, ok := jsonMediaType(body.Content)
+		switch {
+		case ok:
+			tool.bodyName = "body"
+			if _, taken := schema.Properties[tool.bodyName]; taken {
+				tool.bodyName = "request_body"
+			}
+			prop := openAPISchema(media.Schema)
+			if body.Description != "" {
+				prop.Description = body.Description
+			}
+			if prop.Description == "" {
+				prop.Description = "JSON request body"
+			}
+			schema.Properties[tool.bodyName] = prop
+			if body.Required {
+				schema.Required = append(schema.Required, tool.bodyName)
+			}
+		case body.Required:
+			return nil, fmt.Errorf("request body is not JSON")
+		}
+	}
+	tool.SetParameterSchema(schema)
+
+	security := spec.Security
+	if op.Security != nil {
+		security = *op.Security
+	}
+	tool.credential = operationCredential(security, op.Security != nil, cfg)
+	return tool, nil
+}
+
+// operationCredential picks the credential profile of the first security
+// scheme mapped in config, else the default profile. Operations that declare
+// an empty security list are public.
+func operationCredential(security []map[string][]string, declared bool, cfg config.OpenAPIConfig) string {
+	for _, requirement := range security {
+		schemes := make([]string, 0, len(requirement))
+		for scheme := range requirement {
+			schemes = append(schemes, scheme)
+		}
+		sort.Strings(schemes)
+		for _, scheme := range schemes {
+			if profile, ok := cfg.Security[scheme]; ok {
+				return profile
+			}
+		}
+	}
+	if declared && len(security) == 0 {
+		return ""
+	}
+	return cfg.Credential
+}
+
+func operationDescription(method, path string, op *OpenAPIOperation) string {
+	text := op.Summary
+	if op.Description != "" && op.Description != op.Summary {
+		if text != "" {
+			text += ". "
+		}
+		text += op.Description
+	}
+	if runes := []rune(text); len(runes) > maxOperationDescription {
+		text = string(runes[:maxOperationDescription]) + "..."
+	}
+	if text == "" {
+		return method + " " + path
+	}
+	return method + " " + path + ": " + text
+}
+
+// operationToolName names a tool after the operationId, or the method and path
+func operationToolName(prefix, method, path, operationID string) string {
+	base := operationID
+	if base == "" {
+		base = strings.ToLower(method) + "_" + strings.Trim(strings.NewReplacer("{", "", "}", "").Replace(path), "/")
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, prefix+base)
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// jsonMediaType returns the application/json content, or another JSON type
+func jsonMediaType(content map[string]OpenAPIMediaType) (OpenAPIMediaType, bool) {
+	if media, ok := content["application/json"]; ok {
+		return media, true
+	}
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	for _, mediaType := range types {
+		if strings.HasSuffix(strings.SplitN(mediaType, ";", 2)[0], "json") {
+			return content[mediaType], true
+		}
+	}
+	return OpenAPIMediaType{}, false
+}
+
+func (t *OpenAPITool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
+func (t *OpenAPITool) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+func (t *OpenAPITool) Execute(ctx context.Context, params map[string]interface{}) (*ToolResult, error) {
+	path := t.path
+	query := url.Values{}
+	headers := map[string]string{}
+	for _, param := range t.params {
+		value, ok := params[param.Name]
+		if !ok || value == nil {
+			continue
+		}
+		switch param.In {
+		case "path":
+			segment := formatParam(value)
+			if segment == "" || segment == "." || segment == ".." {
+				return t.CreateErrorResult(fmt.Errorf("invalid value %q for path parameter %s", segment, param.Name), "Invalid parameters"), nil
+			}
+			path = strings.ReplaceAll(path, "{"+param.Name+"}", url.PathEscape(segment))
+		case "query":
+			if list, ok := value.([]interface{}); ok {
+				if param.Explode != nil && !*param.Explode {
+					values := make([]string, len(list))
+					for i, item := range list {
+						values[i] = formatParam(item)
+					}
+					query.Add(param.Name, strings.Join(values, ","))
+					continue
+				}
+				for _, item := range list {
+					query.Add(param.Name, formatParam(item))
+				}
+				continue
+			}
+			query.Add(param.Name, formatParam(value))
+		case "header":
+			headers[param.Name] = formatParam(value)
+		}
+	}
+
+	req := APIRequest{
+		Method:     t.method,
+		URL:        t.baseURL + path,
+		Query:      query,
+		Headers:    headers,
+		Credential: t.credential,
+	}
+	if t.bodyName != "" {
+		req.Body = params[t.bodyName]
+	}
+
+	resp, err := t.client.Do(ctx, req)
+	if err != nil {
+		return t.CreateErrorResult(err, fmt.Sprintf("%s %s failed", t.method, t.path)), nil
+	}
+	return t.CreateSuccessResult(resp, FormatAPIResponse(resp)), nil
+}
+
+// formatParam writes a parameter value as it goes in a URL or header: numbers
+// without exponent, objects as JSON
+func formatParam(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
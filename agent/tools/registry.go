@@ -9,12 +9,17 @@ import (
 	"time"
 )
 
+// registryKey is the context key under which ExecuteTool passes the registry
+// to the tool, see RecordedExecution
+type registryKey struct{}
+
 // ToolRegistry manages the collection of available tools
 type ToolRegistry struct {
 	tools    map[string]Tool
 	history  []ToolExecutionHistory
 	mu       sync.RWMutex
 	maxHistory int
+	outcomes map[string]map[string]int // Executions by tool and outcome, not trimmed like history
 }
 
 // NewToolRegistry creates a new tool registry
@@ -23,6 +28,7 @@ func NewToolRegistry() *ToolRegistry {
 		tools:      make(map[string]Tool),
 		history:    make([]ToolExecutionHistory, 0),
 		maxHistory: 1000, // Keep last 1000 executions
+		outcomes:   make(map[string]map[string]int),
 	}
 }
 
@@ -145,6 +151,7 @@ func (tr *ToolRegistry) ExecuteTool(ctx context.Context, execution ToolExecution
 
 	// Check if tool is available
 	if !tool.IsAvailable(ctx) {
+		tr.countOutcome(execution.ToolName, OutcomeUnavailable)
 		return &ToolResult{
 			Success:     false,
 			Error:       "tool is not available",
@@ -155,7 +162,8 @@ func (tr *ToolRegistry) ExecuteTool(ctx context.Context, execution ToolExecution
 	}
 
 	// Check confirmation requirement
-	if tool.RequiresConfirmation() && !execution.Confirmed {
+	if NeedsConfirmation(tool, execution.Parameters) && !execution.Confirmed {
+		tr.countOutcome(execution.ToolName, OutcomeUnconfirmed)
 		return &ToolResult{
 			Success:     false,
 			Error:       "confirmation required",
@@ -172,6 +180,7 @@ func (tr *ToolRegistry) ExecuteTool(ctx context.Context, execution ToolExecution
 	// Validate parameters if the tool has a ValidateParameters method
 	if validator, ok := tool.(interface{ ValidateParameters(map[string]interface{}) error }); ok {
 		if err := validator.ValidateParameters(execution.Parameters); err != nil {
+			tr.countOutcome(execution.ToolName, OutcomeInvalidParameters)
 			return &ToolResult{
 				Success:     false,
 				Error:       err.Error(),
@@ -184,6 +193,7 @@ func (tr *ToolRegistry) ExecuteTool(ctx context.Context, execution ToolExecution
 
 	// Execute the tool
 	start := time.Now()
+	ctx = context.WithValue(ctx, registryKey{}, tr)
 	result, err := tool.Execute(ctx, execution.Parameters)
 	if err != nil {
 		result = &ToolResult{
@@ -197,6 +207,9 @@ func (tr *ToolRegistry) ExecuteTool(ctx context.Context, execution ToolExecution
 	} else {
 		result.Duration = time.Since(start)
 	}
+	if result.ExecutionID == "" {
+		result.ExecutionID = generateExecutionID()
+	}
 
 	// Record execution in history
 	tr.recordExecution(execution, *result)
@@ -218,6 +231,31 @@ func (tr *ToolRegistry) GetExecutionHistory(limit int) []ToolExecutionHistory {
 	return tr.history[start:]
 }
 
+// GetExecution returns a recorded execution by its execution ID, including the
+// full, untruncated tool output
+func (tr *ToolRegistry) GetExecution(executionID string) (*ToolExecutionHistory, bool) {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	for i := len(tr.history) - 1; i >= 0; i-- {
+		if tr.history[i].Result.ExecutionID == executionID {
+			entry := tr.history[i]
+			return &entry, true
+		}
+	}
+	return nil, false
+}
+
+// RecordedExecution looks up an execution in the history of the registry
+// running the current tool, for tools that work on earlier results
+func RecordedExecution(ctx context.Context, executionID string) (*ToolExecutionHistory, bool) {
+	tr, ok := ctx.Value(registryKey{}).(*ToolRegistry)
+	if !ok {
+		return nil, false
+	}
+	return tr.GetExecution(executionID)
+}
+
 // GetToolUsageStats returns usage statistics for tools
 func (tr *ToolRegistry) GetToolUsageStats() map[string]ToolUsageStats {
 	tr.mu.RLock()
@@ -319,12 +357,57 @@ func (tr *ToolRegistry) recordExecution(execution ToolExecution, result ToolResu
 
 	tr.history = append(tr.history, history)
 
+	outcome := OutcomeSuccess
+	if !result.Success {
+		outcome = OutcomeError
+	}
+	tr.countOutcomeLocked(execution.ToolName, outcome)
+
 	// Maintain max history limit
 	if len(tr.history) > tr.maxHistory {
 		tr.history = tr.history[len(tr.history)-tr.maxHistory:]
 	}
 }
 
+// Execution outcomes counted by ExecutionCounts
+const (
+	OutcomeSuccess           = "success"
+	OutcomeError             = "error"
+	OutcomeUnavailable       = "unavailable"
+	OutcomeUnconfirmed       = "confirmation_required"
+	OutcomeInvalidParameters = "invalid_parameters"
+)
+
+// ExecutionCounts returns the number of executions by tool name and outcome
+// since the registry was created
+func (tr *ToolRegistry) ExecutionCounts() map[string]map[string]int {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	counts := make(map[string]map[string]int, len(tr.outcomes))
+	for name, outcomes := range tr.outcomes {
+		counts[name] = make(map[string]int, len(outcomes))
+		for outcome, n := range outcomes {
+			counts[name][outcome] = n
+		}
+	}
+	return counts
+}
+
+// countOutcome counts an execution that did not reach the tool
+func (tr *ToolRegistry) countOutcome(name, outcome string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.countOutcomeLocked(name, outcome)
+}
+
+func (tr *ToolRegistry) countOutcomeLocked(name, outcome string) {
+	if tr.outcomes[name] == nil {
+		tr.outcomes[name] = make(map[string]int)
+	}
+	tr.outcomes[name][outcome]++
+}
+
 // Supporting types
 
 // ToolUsageStats represents usage statistics for a specific tool
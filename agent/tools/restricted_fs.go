@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
@@ -136,4 +137,110 @@ func (rfs *RestrictedFS) Glob(pattern string) ([]string, error) {
 // Walk walks the file tree rooted at root within the restricted filesystem
 func (rfs *RestrictedFS) Walk(root string, fn fs.WalkDirFunc) error {
 	return fs.WalkDir(rfs, root, fn)
-}
\ No newline at end of file
+}
+
+// Resolve returns the absolute path of a name relative to the root, which may
+// not exist yet. Names that leave the root, directly or through a symlink, are
+// rejected.
+func (rfs *RestrictedFS) Resolve(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: fs.ErrPermission}
+	}
+	fullPath := filepath.Join(rfs.root, clean)
+
+	realRoot, err := filepath.EvalSymlinks(rfs.root)
+	if err != nil {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: err}
+	}
+	realPath, err := evalExistingSymlinks(fullPath)
+	if err != nil {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: err}
+	}
+	if !pathWithin(realRoot, realPath) {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: fs.ErrPermission}
+	}
+	return fullPath, nil
+}
+
+// evalExistingSymlinks resolves the symlinks of the longest existing prefix of
+// a path and appends the part that does not exist yet
+func evalExistingSymlinks(path string) (string, error) {
+	var missing []string
+	for {
+		realPath, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				realPath = filepath.Join(realPath, missing[i])
+			}
+			return realPath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append(missing, filepath.Base(path))
+		path = parent
+	}
+}
+
+// pathWithin reports whether path is dir or inside it
+func pathWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// resolveFilePath finds a path in the first root that holds it. Relative paths
+// are tried in each root in order; when mustExist is false the first root whose
+// jail accepts the path is used.
+func resolveFilePath(roots []*RestrictedFS, path string, mustExist bool) (string, error) {
+	var firstErr error // Reported when no root holds the path
+	for _, root := range roots {
+		name := path
+		if filepath.IsAbs(path) {
+			if !pathWithin(root.GetRoot(), filepath.Clean(path)) {
+				continue
+			}
+			name, _ = filepath.Rel(root.GetRoot(), filepath.Clean(path))
+		}
+		fullPath, err := root.Resolve(name)
+		if err == nil && mustExist {
+			_, err = os.Stat(fullPath)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		return fullPath, nil
+	}
+	if firstErr == nil || errors.Is(firstErr, fs.ErrPermission) {
+		return "", fmt.Errorf("%s is outside the allowed directories (%s)", path, rootList(roots))
+	}
+	return "", firstErr
+}
+
+// relativeToRoots returns a path found by resolveFilePath relative to the root
+// that holds it, as files are cited in answer sources
+func relativeToRoots(roots []*RestrictedFS, fullPath string) string {
+	for _, root := range roots {
+		if pathWithin(root.GetRoot(), fullPath) {
+			rel, _ := filepath.Rel(root.GetRoot(), fullPath)
+			return filepath.ToSlash(rel)
+		}
+	}
+	return fullPath
+}
+
+// rootList lists the root directories for messages and tool descriptions
+func rootList(roots []*RestrictedFS) string {
+	dirs := make([]string, len(roots))
+	for i, root := range roots {
+		dirs[i] = root.GetRoot()
+	}
+	return strings.Join(dirs, ", ")
+}
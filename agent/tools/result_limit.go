@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"testing/fstest"
+	"unicode/utf8"
+
+	search_engine "textSearch"
+)
+
+// Result truncation strategies
+const (
+	TruncateHeadTail = "head_tail" // Keep the beginning and the end of the output
+	TruncateRelevant = "relevant"  // Keep the sections that best match the user query
+)
+
+// relevantContextLines is the number of lines kept around each matching line
+const relevantContextLines = 3
+
+// TruncateResult shortens a tool output to at most limit characters (plus a short
+// note explaining what was removed). A limit <= 0 disables truncation.
+func TruncateResult(content string, limit int, strategy string, query string) string {
+	if limit <= 0 || len(content) <= limit {
+		return content
+	}
+
+	var truncated string
+	if strategy == TruncateRelevant && strings.TrimSpace(query) != "" {
+		truncated = extractRelevantSections(content, query, limit)
+	}
+	if truncated == "" {
+		truncated = truncateHeadTail(content, limit)
+	}
+
+	return fmt.Sprintf("%s\n\n[Output truncated: showing %d of %d characters]", truncated, len(truncated), len(content))
+}
+
+// truncateHeadTail keeps the first two thirds and the last third of the allowed size
+func truncateHeadTail(content string, limit int) string {
+	head := limit * 2 / 3
+	tail := limit - head
+
+	return validUTF8Prefix(content, head) + "\n\n[...]\n\n" + validUTF8Suffix(content, tail)
+}
+
+// extractRelevantSections keeps the sections of content that best match the query,
+// using the same extractor the knowledge base search relies on
+func extractRelevantSections(content, query string, limit int) string {
+	const name = "result.txt"
+	extractor := search_engine.NewContentExtractor(fstest.MapFS{
+		name: &fstest.MapFile{Data: []byte(content)},
+	})
+
+	relevant, err := extractor.ExtractRelevantContent(name, query, relevantContextLines)
+	if err != nil || strings.TrimSpace(relevant) == "" {
+		return ""
+	}
+
+	if len(relevant) > limit {
+		relevant = validUTF8Prefix(relevant, limit)
+	}
+	return relevant
+}
+
+// validUTF8Prefix returns at most n bytes from the start of s without splitting a rune
+func validUTF8Prefix(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// validUTF8Suffix returns at most n bytes from the end of s without splitting a rune
+func validUTF8Suffix(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"path/filepath"
 	"strings"
 
 	search_engine "textSearch"
@@ -15,6 +16,7 @@ import (
 type SearchEngineTool struct {
 	engine search_engine.SearchEngine
 	llmProvider llm.Provider
+	root string // Knowledge base directory (kbase.path); document paths are relative to it
 }
 
 // SearchEngineResult represents a file found by the search engine
@@ -29,6 +31,7 @@ type SearchEngineResult struct {
 func NewSearchEngineTool(restrictedFS fs.FS) *SearchEngineTool {
 	return &SearchEngineTool{
 		engine: search_engine.NewSearchEngine(restrictedFS),
+		root: knowledgeBaseRoot(restrictedFS),
 	}
 }
 
@@ -37,9 +40,19 @@ func NewSearchEngineToolWithLLM(restrictedFS fs.FS, llmProvider llm.Provider) *S
 	return &SearchEngineTool{
 		engine: search_engine.NewSearchEngine(restrictedFS),
 		llmProvider: llmProvider,
+		root: knowledgeBaseRoot(restrictedFS),
 	}
 }
 
+// knowledgeBaseRoot returns the directory behind a file system, or the default
+// kbase.path when the file system does not tell
+func knowledgeBaseRoot(fsys fs.FS) string {
+	if rfs, ok := fsys.(interface{ GetRoot() string }); ok {
+		return rfs.GetRoot()
+	}
+	return "kbase"
+}
+
 func (t *SearchEngineTool) GetName() string {
 	return "kbase"
 }
@@ -152,9 +165,65 @@ func (t *SearchEngineTool) Execute(ctx context.Context, params map[string]interf
 			"results":       results,
 			"general_docs":  generalDocs,
 		},
+		Sources: t.collectSources(query, results, generalDocs),
 	}, nil
 }
 
+// collectSources describes the files surfaced by a search for the answer sources.
+// General docs are read in full, so they carry no score or snippet.
+func (t *SearchEngineTool) collectSources(query string, results []SearchEngineResult, generalDocs []GeneralDoc) []llm.Source {
+	sources := make([]llm.Source, 0, len(results)+len(generalDocs))
+	for _, result := range results {
+		source := llm.Source{
+			Path:  result.FilePath,
+			Title: t.documentTitle(result.FilePath),
+			Score: result.Score,
+		}
+		if content, err := t.engine.ExtractRelevantContent(result.FilePath, query, 2); err == nil {
+			source.Snippet = snippet(content, 300)
+		}
+		sources = append(sources, source)
+	}
+	for _, doc := range generalDocs {
+		sources = append(sources, llm.Source{
+			Path:  doc.FilePath,
+			Title: doc.Title,
+		})
+	}
+	return sources
+}
+
+// documentTitle returns the title in the apidoc metadata of a file, or ""
+func (t *SearchEngineTool) documentTitle(filePath string) string {
+	content, err := t.engine.GetFileContent(filePath)
+	if err != nil {
+		return ""
+	}
+
+	parser := NewDocumentParser()
+	lines := strings.SplitN(content, "\n", 11)
+	for i, line := range lines {
+		if i == 10 { // Metadata lives in the first lines, like ParseMetadata
+			break
+		}
+		if strings.Contains(line, "<apidoc") {
+			if metadata, err := parser.parseApidocTag(strings.TrimSpace(line), filePath); err == nil {
+				return metadata.Title
+			}
+		}
+	}
+	return ""
+}
+
+// snippet collapses whitespace and truncates text to max characters
+func snippet(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max]) + "..."
+	}
+	return text
+}
+
 // ExtractContent extracts relevant content from a specific file
 func (t *SearchEngineTool) ExtractContent(filePath, query string) (string, error) {
 	return t.engine.ExtractRelevantContent(filePath, query, 1000)
@@ -224,7 +293,7 @@ func (t *SearchEngineTool) generateSearchSuggestions(query string) []string {
 
 // GeneralDoc represents a general documentation file with keywords
 type GeneralDoc struct {
-	FilePath string   `json:"file_path"`
+	FilePath string   `json:"file_path"` // Relative to the knowledge base
 	Title    string   `json:"title"`
 	Keywords []string `json:"keywords"`
 }
@@ -377,9 +446,7 @@ func (t *SearchEngineTool) formatResults(query string, results []SearchEngineRes
 			message += fmt.Sprintf("=== %s (relevant keywords: %s) ===\n", doc.Title, strings.Join(doc.Keywords, ", "))
 			
 			// Read COMPLETE content of the general documentation file  
-			// Remove kbase/ prefix since engine already operates within kbase
-			relativePath := strings.TrimPrefix(doc.FilePath, "kbase/")
-			fullContent, err := t.engine.GetFileContent(relativePath)
+			fullContent, err := t.engine.GetFileContent(doc.FilePath)
 			if err == nil && fullContent != "" {
 				message += fullContent + "\n\n"
 			} else {
@@ -444,11 +511,8 @@ func (t *SearchEngineTool) findGeneralDocumentsWithParser() ([]GeneralDoc, error
 	}
 	
 	for _, file := range allFiles {
-		// Construct full path with kbase directory
-		fullPath := fmt.Sprintf("kbase/%s", file.Path)
-		
-		// Parse metadata
-		metadata, err := parser.ParseMetadata(fullPath)
+		// Parse metadata from the file in the knowledge base directory
+		metadata, err := parser.ParseMetadata(filepath.Join(t.root, file.Path))
 		if err != nil {
 			continue // Skip files with parse errors
 		}
@@ -456,7 +520,7 @@ func (t *SearchEngineTool) findGeneralDocumentsWithParser() ([]GeneralDoc, error
 		// Check if it has "general" keyword
 		if metadata.HasKeyword("general") {
 			generalDocs = append(generalDocs, GeneralDoc{
-				FilePath: fullPath,
+				FilePath: file.Path,
 				Title:    metadata.Title,
 				Keywords: metadata.Keywords,
 			})
@@ -0,0 +1,458 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// defaultShellEnv are the variables passed to commands when pass_env is empty
+var defaultShellEnv = []string{"PATH", "HOME", "LANG", "TZ"}
+
+// ShellExecTool runs allowlisted commands, such as git log or kubectl get,
+// directly without a shell. The working directory and the path arguments are
+// kept inside the work directory.
+type ShellExecTool struct {
+	*BaseTool
+	commands  map[string]*shellCommand
+	workDir   *RestrictedFS
+	env       []string
+	timeout   time.Duration
+	maxOutput int
+	limits    shellLimits
+}
+
+// shellCommand is an allowed command with its resolved executable
+type shellCommand struct {
+	path        string
+	subcommands []string
+	args        []*regexp.Regexp
+	denyArgs    []*regexp.Regexp
+}
+
+// shellLimits are the resource limits of the process, applied on Linux
+type shellLimits struct {
+	cpuSeconds  uint64
+	memoryBytes uint64
+	fileBytes   uint64
+}
+
+// ShellResult is the outcome of a shell_exec call
+type ShellResult struct {
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	Dir        string   `json:"dir"`
+	ExitCode   int      `json:"exit_code"`
+	Stdout     string   `json:"stdout"`
+	Stderr     string   `json:"stderr"`
+	Truncated  bool     `json:"truncated,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+// NewShellExecTool creates the shell_exec tool for the commands of cfg, run
+// inside workDir. Commands whose executable is not found are left out and
+// reported in the returned notes.
+func NewShellExecTool(cfg config.ShellConfig, workDir *RestrictedFS) (*ShellExecTool, []string, error) {
+	if len(cfg.Commands) == 0 {
+		return nil, nil, fmt.Errorf("tools.shell.commands is empty")
+	}
+
+	var notes []string
+	commands := make(map[string]*shellCommand, len(cfg.Commands))
+	for name, commandConfig := range cfg.Commands {
+		executable := commandConfig.Path
+		if executable == "" {
+			executable = name
+		}
+		path, err := exec.LookPath(executable)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("Shell command %s is not available (%v), skipping it", name, err))
+			continue
+		}
+		if path, err = filepath.Abs(path); err != nil {
+			return nil, nil, fmt.Errorf("command %s: %w", name, err)
+		}
+		commands[name] = &shellCommand{
+			path:        path,
+			subcommands: commandConfig.Subcommands,
+			args:        compileGlobs(commandConfig.Args),
+			denyArgs:    compileGlobs(commandConfig.DenyArgs),
+		}
+	}
+	if len(commands) == 0 {
+		return nil, nil, fmt.Errorf("none of the commands in tools.shell.commands is available")
+	}
+
+	passEnv := cfg.PassEnv
+	if len(passEnv) == 0 {
+		passEnv = defaultShellEnv
+	}
+	var env []string
+	for _, name := range passEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	for _, name := range sortedKeys(cfg.Env) {
+		env = append(env, name+"="+cfg.Env[name])
+	}
+
+	cpuSeconds := cfg.MaxCPUSeconds
+	if cpuSeconds == 0 {
+		cpuSeconds = cfg.TimeoutSeconds
+	}
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tool := &ShellExecTool{
+		BaseTool: NewBaseTool(
+			"shell_exec",
+			shellDescription(names, commands, workDir.GetRoot()),
+			CategorySystem,
+			true,
+			10,
+		),
+		commands:  commands,
+		workDir:   workDir,
+		env:       env,
+		timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+		maxOutput: cfg.MaxOutputBytes,
+		limits: shellLimits{
+			cpuSeconds:  uint64(cpuSeconds),
+			memoryBytes: uint64(cfg.MaxMemoryMB) << 20,
+			fileBytes:   uint64(cfg.MaxFileSizeMB) << 20,
+		},
+	}
+	tool.SetParameterSchema(&ParameterSchema{
+		Type:        "object",
+		Description: "Parameters for running a command",
+		Properties: map[string]PropertySchema{
+			"command": {
+				Type:        "string",
+				Description: "Command to run",
+				Enum:        stringsToEnum(names),
+			},
+			"args": {
+				Type:        "array",
+				Description: "Arguments, one per item. They are passed as is: there is no shell, so quoting, pipes, redirections and globs are not interpreted.",
+				Items:       &PropertySchema{Type: "string"},
+			},
+			"cwd": {
+				Type:        "string",
+				Description: "Working directory relative to the work directory (default the work directory itself)",
+			},
+		},
+		Required: []string{"command"},
+	})
+	return tool, notes, nil
+}
+
+func shellDescription(names []string, commands map[string]*shellCommand, workDir string) string {
+	allowed := make([]string, len(names))
+	for i, name := range names {
+		allowed[i] = name
+		if subcommands := commands[name].subcommands; len(subcommands) > 0 {
+			allowed[i] += " (" + strings.Join(subcommands, ", ") + ")"
+		}
+	}
+	return fmt.Sprintf("Runs an allowed command without a shell and returns its exit code and output. Use it for read-only diagnostics. Allowed commands: %s. Commands run in %s and cannot reach files outside it. Put global options after the subcommand or write them as --option=value.",
+		strings.Join(allowed, "; "), workDir)
+}
+
+// compileGlobs turns patterns where * matches any text and ? one character
+// into anchored regular expressions
+func compileGlobs(patterns []string) []*regexp.Regexp {
+	globs := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		expr := regexp.QuoteMeta(pattern)
+		expr = strings.NewReplacer(`\*`, `.*`, `\?`, `.`).Replace(expr)
+		globs[i] = regexp.MustCompile(`^(?s:` + expr + `)$`)
+	}
+	return globs
+}
+
+func matchAny(globs []*regexp.Regexp, value string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// check applies the subcommand and argument rules of the command
+func (c *shellCommand) check(name string, args []string) error {
+	subcommand := -1
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			subcommand = i
+			break
+		}
+	}
+	if len(c.subcommands) > 0 {
+		if subcommand < 0 {
+			return fmt.Errorf("%s requires a subcommand (allowed: %s)", name, strings.Join(c.subcommands, ", "))
+		}
+		if !containsString(c.subcommands, args[subcommand]) {
+			return fmt.Errorf("subcommand %q is not allowed for %s (allowed: %s)", args[subcommand], name, strings.Join(c.subcommands, ", "))
+		}
+	}
+	for i, arg := range args {
+		if matchAny(c.denyArgs, arg) {
+			return fmt.Errorf("argument %q is not allowed for %s", arg, name)
+		}
+		if i != subcommand && len(c.args) > 0 && !matchAny(c.args, arg) {
+			return fmt.Errorf("argument %q is not allowed for %s", arg, name)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *ShellExecTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
+func (t *ShellExecTool) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface{}) (*ToolResult, error) {
+	name := stringParam(params, "command")
+	command, ok := t.commands[name]
+	if !ok {
+		return t.CreateErrorResult(fmt.Errorf("command %q is not allowed", name), "Command not allowed"), nil
+	}
+	var args []string
+	if list, ok := params["args"].([]interface{}); ok {
+		for _, item := range list {
+			arg, ok := item.(string)
+			if !ok {
+				return t.CreateErrorResult(fmt.Errorf("arguments must be strings"), "Invalid parameters"), nil
+			}
+			args = append(args, arg)
+		}
+	}
+	if err := command.check(name, args); err != nil {
+		return t.CreateErrorResult(err, "Command not allowed"), nil
+	}
+
+	dir, err := t.workingDir(stringParam(params, "cwd"))
+	if err != nil {
+		return t.CreateErrorResult(err, "Invalid working directory"), nil
+	}
+	if err := t.checkPathArgs(dir, args); err != nil {
+		return t.CreateErrorResult(err, "Command not allowed"), nil
+	}
+
+	result, err := t.run(ctx, name, command, dir, args)
+	if err != nil {
+		return t.CreateErrorResult(err, fmt.Sprintf("%s failed", name)), nil
+	}
+	return t.CreateSuccessResult(result, formatShellResult(result)), nil
+}
+
+// workingDir resolves cwd inside the work directory
+func (t *ShellExecTool) workingDir(cwd string) (string, error) {
+	if cwd == "" {
+		cwd = "."
+	}
+	if filepath.IsAbs(cwd) {
+		if !pathWithin(t.workDir.GetRoot(), filepath.Clean(cwd)) {
+			return "", fmt.Errorf("%s is outside the work directory %s", cwd, t.workDir.GetRoot())
+		}
+		cwd, _ = filepath.Rel(t.workDir.GetRoot(), filepath.Clean(cwd))
+	}
+	dir, err := t.workDir.Resolve(cwd)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return "", fmt.Errorf("%s is outside the work directory %s", cwd, t.workDir.GetRoot())
+		}
+		return "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", cwd)
+	}
+	return dir, nil
+}
+
+// checkPathArgs rejects arguments that name a path outside the work directory,
+// directly or through a symlink. For --option=value the value is checked, and
+// for short options every tail after the option letter, since a value may be
+// attached to the last letter of a group (-rf/etc/passwd). Arguments that are
+// not paths resolve inside the directory and pass.
+func (t *ShellExecTool) checkPathArgs(dir string, args []string) error {
+	root := t.workDir.GetRoot()
+	for _, arg := range args {
+		values := []string{arg}
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			i := strings.Index(arg, "=")
+			if i < 0 {
+				continue
+			}
+			values = []string{arg[i+1:]}
+		case strings.HasPrefix(arg, "-"):
+			values = nil
+			for i := 2; i < len(arg); i++ {
+				values = append(values, arg[i:])
+			}
+		}
+		for _, value := range values {
+			if !t.insideWorkDir(dir, value) {
+				return fmt.Errorf("argument %q refers to a path outside the work directory %s", arg, root)
+			}
+		}
+	}
+	return nil
+}
+
+// insideWorkDir reports whether value, taken as a path relative to dir, stays
+// inside the work directory
+func (t *ShellExecTool) insideWorkDir(dir, value string) bool {
+	if value == "" {
+		return true
+	}
+	root := t.workDir.GetRoot()
+	path := value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !pathWithin(root, path) {
+		return false
+	}
+	rel, _ := filepath.Rel(root, path)
+	_, err := t.workDir.Resolve(rel)
+	return err == nil
+}
+
+// run starts the command with the scrubbed environment and waits for it,
+// killing it with the processes it started when the timeout expires
+func (t *ShellExecTool) run(ctx context.Context, name string, command *shellCommand, dir string, args []string) (*ShellResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{limit: t.maxOutput}
+	stderr := &cappedBuffer{limit: t.maxOutput}
+	cmd := exec.CommandContext(ctx, command.path, args...)
+	cmd.Dir = dir
+	cmd.Env = t.env
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+	wait := configureProcess(cmd)
+	limitProcess(cmd, t.limits)
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	err := wait()
+	duration := time.Since(start)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", name, t.timeout)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil // The command exited but left a process holding its output
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	if exitErr != nil && exitErr.ExitCode() < 0 {
+		return nil, fmt.Errorf("%s was terminated: %s (resource limit reached?)", name, exitErr.ProcessState)
+	}
+
+	return &ShellResult{
+		Command:    name,
+		Args:       args,
+		Dir:        dir,
+		ExitCode:   cmd.ProcessState.ExitCode(),
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		Truncated:  stdout.truncated() || stderr.truncated(),
+		DurationMS: duration.Milliseconds(),
+	}, nil
+}
+
+// formatShellResult renders the command line, the exit code and both outputs
+func formatShellResult(result *ShellResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s", result.Command)
+	for _, arg := range result.Args {
+		fmt.Fprintf(&b, " %s", quoteArg(arg))
+	}
+	fmt.Fprintf(&b, "\nexit code %d (%d ms)\n", result.ExitCode, result.DurationMS)
+	if result.Stdout != "" {
+		b.WriteString("\n" + result.Stdout)
+	}
+	if result.Stderr != "" {
+		b.WriteString("\n[stderr]\n" + result.Stderr)
+	}
+	if result.Truncated {
+		b.WriteString("\n[output truncated]")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`*?") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// cappedBuffer keeps the first limit bytes written and counts the rest, so a
+// verbose command is not blocked on a full pipe
+type cappedBuffer struct {
+	limit int
+	data  []byte
+	total int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if room := b.limit - len(b.data); room > 0 {
+		b.data = append(b.data, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	return strings.ToValidUTF8(string(b.data), "")
+}
+
+func (b *cappedBuffer) truncated() bool {
+	return b.total > len(b.data)
+}
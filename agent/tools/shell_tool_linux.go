@@ -0,0 +1,125 @@
+//go:build linux
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// shellLimitsEnv tells a re-executed copy of this program to set the resource
+// limits and exec the command
+const shellLimitsEnv = "AGENT_SHELL_EXEC_LIMITS"
+
+func init() {
+	if value, ok := os.LookupEnv(shellLimitsEnv); ok {
+		execWithLimits(value)
+	}
+}
+
+// configureProcess starts the command in its own process group, so a timeout
+// kills the processes it started as well. It returns the function that waits
+// for the command.
+func configureProcess(cmd *exec.Cmd) func() error {
+	var mu sync.Mutex
+	exited := false
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if exited {
+			return os.ErrProcessDone
+		}
+		killProcess(cmd)
+		return nil
+	}
+	return func() error {
+		if waitExit(cmd) {
+			mu.Lock()
+			killProcess(cmd) // Processes left in the background
+			exited = true
+			mu.Unlock()
+		}
+		return cmd.Wait()
+	}
+}
+
+// limitProcess sets the CPU, memory and file size limits of the command, which
+// its children inherit. Go cannot set them between fork and exec, so the
+// command starts as a copy of this program that sets them and then execs it.
+func limitProcess(cmd *exec.Cmd, limits shellLimits) {
+	if limits == (shellLimits{}) {
+		return
+	}
+	cmd.Path = "/proc/self/exe"
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d,%d,%d", shellLimitsEnv, limits.cpuSeconds, limits.memoryBytes, limits.fileBytes))
+}
+
+// execWithLimits runs in the copy started by limitProcess: it sets the limits
+// and replaces itself with the command in os.Args
+func execWithLimits(value string) {
+	fail := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, "shell_exec: "+format+"\n", args...)
+		os.Exit(126)
+	}
+
+	fields := strings.Split(value, ",")
+	if len(fields) != 3 {
+		fail("invalid limits %q", value)
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, shellLimitsEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	for i, limit := range []struct {
+		resource int
+		name     string
+	}{
+		{unix.RLIMIT_CPU, "CPU time"},
+		{unix.RLIMIT_AS, "memory"},
+		{unix.RLIMIT_FSIZE, "file size"},
+	} {
+		n, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			fail("invalid %s limit %q", limit.name, fields[i])
+		}
+		if n == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(limit.resource, &unix.Rlimit{Cur: n, Max: n}); err != nil {
+			fail("failed to set %s limit: %v", limit.name, err)
+		}
+	}
+
+	err := syscall.Exec(os.Args[0], os.Args, env)
+	fail("failed to run %s: %v", os.Args[0], err)
+}
+
+// waitExit waits for the command to exit without reaping it. Until Wait reaps
+// it, the command stays a zombie and its id cannot be reused by another process
+// group, so the group can still be killed safely.
+func waitExit(cmd *exec.Cmd) bool {
+	var info unix.Siginfo
+	for {
+		err := unix.Waitid(unix.P_PID, cmd.Process.Pid, &info, unix.WEXITED|unix.WNOWAIT, nil)
+		if err != unix.EINTR {
+			return err == nil
+		}
+	}
+}
+
+// killProcess kills the process group of the command, which must not have been
+// reaped yet
+func killProcess(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
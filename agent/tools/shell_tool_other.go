@@ -0,0 +1,15 @@
+//go:build !linux
+
+package tools
+
+import "os/exec"
+
+// configureProcess keeps the default cancellation, which kills the command
+// but not the processes it started. It returns the function that waits for
+// the command.
+func configureProcess(cmd *exec.Cmd) func() error {
+	return cmd.Wait
+}
+
+// limitProcess does nothing: resource limits are only applied on Linux
+func limitProcess(cmd *exec.Cmd, limits shellLimits) {}
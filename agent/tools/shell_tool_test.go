@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellCheckPathArgs(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(root, "etc")); err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := NewRestrictedFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := &ShellExecTool{workDir: workDir}
+
+	cases := []struct {
+		args    []string
+		allowed bool
+	}{
+		{[]string{"-rn", "TODO", "."}, true},
+		{[]string{"-C3", "-e", "x", "sub"}, true},
+		{[]string{"--include=*.go", "x", "sub/file"}, true},
+		{[]string{"-", "--"}, true},
+		{[]string{"x", "/etc/hostname"}, false},
+		{[]string{"x", "../outside"}, false},
+		{[]string{"x", "etc/hostname"}, false},
+		{[]string{"--file=/etc/hostname", "."}, false},
+		{[]string{"-f/etc/hostname", "-r", "."}, false},
+		{[]string{"-rf/etc/hostname", "."}, false},
+		{[]string{"-f../outside", "."}, false},
+		{[]string{"-fetc/hostname", "."}, false},
+	}
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			err := tool.checkPathArgs(root, tc.args)
+			if tc.allowed && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tc.allowed && err == nil {
+				t.Error("allowed a path outside the work directory")
+			}
+		})
+	}
+}
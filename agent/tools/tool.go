@@ -38,6 +38,21 @@ type Tool interface {
 	GetFunctionDefinition() llm.FunctionDefinition
 }
 
+// CallConfirmer is implemented by tools whose need for confirmation depends on
+// the arguments of the call, such as HTTP tools that only confirm writes
+type CallConfirmer interface {
+	RequiresConfirmationFor(params map[string]interface{}) bool
+}
+
+// NeedsConfirmation reports whether a call must be confirmed by the user
+func NeedsConfirmation(tool Tool, params map[string]interface{}) bool {
+	if tool.RequiresConfirmation() {
+		return true
+	}
+	confirmer, ok := tool.(CallConfirmer)
+	return ok && confirmer.RequiresConfirmationFor(params)
+}
+
 // ParameterSchema defines the expected parameters for a tool
 type ParameterSchema struct {
 	Type        string                        `json:"type"`
@@ -55,37 +70,7 @@ func (ps *ParameterSchema) ToJSONSchema() map[string]interface{} {
 	if ps.Properties != nil {
 		properties := make(map[string]interface{})
 		for name, prop := range ps.Properties {
-			propSchema := map[string]interface{}{
-				"type": prop.Type,
-			}
-			if prop.Description != "" {
-				propSchema["description"] = prop.Description
-			}
-			if prop.Enum != nil {
-				propSchema["enum"] = prop.Enum
-			}
-			if prop.Default != nil {
-				propSchema["default"] = prop.Default
-			}
-			if prop.Format != "" {
-				propSchema["format"] = prop.Format
-			}
-			if prop.Minimum != nil {
-				propSchema["minimum"] = *prop.Minimum
-			}
-			if prop.Maximum != nil {
-				propSchema["maximum"] = *prop.Maximum
-			}
-			if prop.Items != nil {
-				itemSchema := map[string]interface{}{
-					"type": prop.Items.Type,
-				}
-				if prop.Items.Description != "" {
-					itemSchema["description"] = prop.Items.Description
-				}
-				propSchema["items"] = itemSchema
-			}
-			properties[name] = propSchema
+			properties[name] = prop.ToJSONSchema()
 		}
 		schema["properties"] = properties
 	}
@@ -118,6 +103,73 @@ type PropertySchema struct {
 	Minimum     *float64         `json:"minimum,omitempty"`
 	Maximum     *float64         `json:"maximum,omitempty"`
 	Items       *PropertySchema  `json:"items,omitempty"`
+	Properties  map[string]PropertySchema `json:"properties,omitempty"` // Fields of nested objects
+	Required    []string         `json:"required,omitempty"`   // Required fields of nested objects
+	AdditionalProperties *PropertySchema `json:"additionalProperties,omitempty"` // Schema of object fields not in Properties (map values)
+	NoAdditionalProperties bool  `json:"-"`                          // Reject object fields not in Properties
+	OneOf       []PropertySchema `json:"oneOf,omitempty"`      // Alternatives; the value must match exactly one
+	Nullable    bool             `json:"nullable,omitempty"`   // Accepts null, also as the value of a required field
+}
+
+// ToJSONSchema converts the property, with its nested items and properties, to JSON Schema
+func (prop PropertySchema) ToJSONSchema() map[string]interface{} {
+	schema := map[string]interface{}{}
+	if prop.Type != "" {
+		schema["type"] = prop.Type
+	}
+	if prop.Description != "" {
+		schema["description"] = prop.Description
+	}
+	if prop.Enum != nil {
+		schema["enum"] = prop.Enum
+	}
+	if prop.Default != nil {
+		schema["default"] = prop.Default
+	}
+	if prop.Format != "" {
+		schema["format"] = prop.Format
+	}
+	if prop.MinLength != nil {
+		schema["minLength"] = *prop.MinLength
+	}
+	if prop.MaxLength != nil {
+		schema["maxLength"] = *prop.MaxLength
+	}
+	if prop.Minimum != nil {
+		schema["minimum"] = *prop.Minimum
+	}
+	if prop.Maximum != nil {
+		schema["maximum"] = *prop.Maximum
+	}
+	if prop.Items != nil {
+		schema["items"] = prop.Items.ToJSONSchema()
+	}
+	if prop.Properties != nil {
+		properties := make(map[string]interface{})
+		for name, nested := range prop.Properties {
+			properties[name] = nested.ToJSONSchema()
+		}
+		schema["properties"] = properties
+	}
+	if len(prop.Required) > 0 {
+		schema["required"] = prop.Required
+	}
+	if prop.NoAdditionalProperties {
+		schema["additionalProperties"] = false
+	} else if prop.AdditionalProperties != nil {
+		schema["additionalProperties"] = prop.AdditionalProperties.ToJSONSchema()
+	}
+	if prop.Nullable {
+		schema["nullable"] = true
+	}
+	if len(prop.OneOf) > 0 {
+		oneOf := make([]interface{}, len(prop.OneOf))
+		for i, alternative := range prop.OneOf {
+			oneOf[i] = alternative.ToJSONSchema()
+		}
+		schema["oneOf"] = oneOf
+	}
+	return schema
 }
 
 // ToolResult represents the result of executing a tool
@@ -130,6 +182,7 @@ type ToolResult struct {
 	ExecutionID string                 `json:"execution_id"`
 	Timestamp   time.Time              `json:"timestamp"`
 	Duration    time.Duration          `json:"duration"`
+	Sources     []llm.Source           `json:"sources,omitempty"` // Documents surfaced or read, cited in the answer
 }
 
 // ToolCategory represents different categories of tools
@@ -232,44 +285,18 @@ func (bt *BaseTool) GetParameterSchema() *ParameterSchema {
 	return bt.parameterSchema
 }
 
-// ValidateParameters validates parameters against the schema
+// ValidateParameters validates parameters against the schema, including nested
+// objects and array items. Errors name the offending path, such as
+// "headers.Authorization: expected string", so the model can correct its call.
 func (bt *BaseTool) ValidateParameters(params map[string]interface{}) error {
 	if bt.parameterSchema == nil {
 		return nil // No schema means no validation required
 	}
-
-	// Check required parameters
-	for _, required := range bt.parameterSchema.Required {
-		if _, exists := params[required]; !exists {
-			return &ToolError{
-				Type:    "validation_error",
-				Message: "missing required parameter: " + required,
-				Code:    "MISSING_REQUIRED_PARAM",
-			}
-		}
-	}
-
-	// Validate each parameter against its schema
-	for paramName, paramValue := range params {
-		propSchema, exists := bt.parameterSchema.Properties[paramName]
-		if !exists {
-			return &ToolError{
-				Type:    "validation_error", 
-				Message: "unknown parameter: " + paramName,
-				Code:    "UNKNOWN_PARAM",
-			}
-		}
-
-		if err := validateParameterValue(paramValue, propSchema); err != nil {
-			return &ToolError{
-				Type:    "validation_error",
-				Message: "invalid value for parameter " + paramName + ": " + err.Error(),
-				Code:    "INVALID_PARAM_VALUE",
-			}
-		}
-	}
-
-	return nil
+	return validateObject("", params, PropertySchema{
+		Properties:             bt.parameterSchema.Properties,
+		Required:               bt.parameterSchema.Required,
+		NoAdditionalProperties: true, // Unknown parameters are usually misspelled ones
+	})
 }
 
 // CreateSuccessResult creates a successful tool result
@@ -308,37 +335,6 @@ func (e *ToolError) Error() string {
 
 // Helper functions
 
-func validateParameterValue(value interface{}, schema PropertySchema) error {
-	// Basic type validation - can be extended
-	switch schema.Type {
-	case "string":
-		if _, ok := value.(string); !ok {
-			return &ToolError{Type: "type_error", Message: "expected string", Code: "TYPE_MISMATCH"}
-		}
-	case "number":
-		switch value.(type) {
-		case int, int64, float64, float32:
-			// Valid number types
-		default:
-			return &ToolError{Type: "type_error", Message: "expected number", Code: "TYPE_MISMATCH"}
-		}
-	case "boolean":
-		if _, ok := value.(bool); !ok {
-			return &ToolError{Type: "type_error", Message: "expected boolean", Code: "TYPE_MISMATCH"}
-		}
-	case "array":
-		if _, ok := value.([]interface{}); !ok {
-			return &ToolError{Type: "type_error", Message: "expected array", Code: "TYPE_MISMATCH"}
-		}
-	case "object":
-		if _, ok := value.(map[string]interface{}); !ok {
-			return &ToolError{Type: "type_error", Message: "expected object", Code: "TYPE_MISMATCH"}
-		}
-	}
-
-	return nil
-}
-
 func generateExecutionID() string {
 	// Simple execution ID generation - could use UUID in production
 	return "exec_" + time.Now().Format("20060102_150405") + "_" + randomString(6)
@@ -0,0 +1,365 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+// TypedTool is a tool whose parameters are the fields of the Args struct. The
+// schema sent to the LLM is derived from the struct, and calls are validated
+// and decoded into Args before the function runs.
+//
+// Fields are named by their json tag and described by these tags:
+//
+//	description:"..."   what the parameter is for
+//	required:"true"     the parameter must be present
+//	enum:"a,b,c"        allowed values
+//	minimum, maximum    bounds of numbers
+//	minLength, maxLength  bounds of string lengths
+//	format:"uri"        string format hint
+//	default:"30"        value used when the parameter is absent, also in nested objects
+//
+// Nested structs become objects, slices become arrays, and pointers are optional
+// values of their element type.
+type TypedTool[Args any, Result any] struct {
+	*BaseTool
+	fn func(ctx context.Context, args Args) (Result, error)
+}
+
+// NewTypedTool creates a tool from a function. It panics if Args is not a struct
+// or its tags are malformed, as that is a programming error.
+func NewTypedTool[Args any, Result any](name, description string, fn func(ctx context.Context, args Args) (Result, error)) *TypedTool[Args, Result] {
+	schema, err := SchemaFor[Args]()
+	if err != nil {
+		panic(fmt.Sprintf("tools: invalid arguments of tool %s: %v", name, err))
+	}
+	tool := &TypedTool[Args, Result]{
+		BaseTool: NewBaseTool(name, description, CategoryCustom, false, 10),
+		fn:       fn,
+	}
+	tool.SetParameterSchema(schema)
+	return tool
+}
+
+// WithCategory sets the tool category (CategoryCustom by default)
+func (t *TypedTool[Args, Result]) WithCategory(category ToolCategory) *TypedTool[Args, Result] {
+	t.category = category
+	return t
+}
+
+// WithConfirmation makes the tool ask the user before each call
+func (t *TypedTool[Args, Result]) WithConfirmation() *TypedTool[Args, Result] {
+	t.requiresConfirmation = true
+	return t
+}
+
+// WithCost sets the estimated cost (0-100, 10 by default)
+func (t *TypedTool[Args, Result]) WithCost(cost int) *TypedTool[Args, Result] {
+	t.estimatedCost = cost
+	return t
+}
+
+func (t *TypedTool[Args, Result]) GetFunctionDefinition() llm.FunctionDefinition {
+	return DefaultGetFunctionDefinition(t)
+}
+
+func (t *TypedTool[Args, Result]) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+// Execute decodes the parameters into Args and runs the function. The result
+// is the tool data; its text (a string, a fmt.Stringer or indented JSON) is the
+// message the model reads.
+func (t *TypedTool[Args, Result]) Execute(ctx context.Context, params map[string]interface{}) (*ToolResult, error) {
+	args, err := t.decode(params)
+	if err != nil {
+		return t.CreateErrorResult(err, "Invalid parameters"), nil
+	}
+
+	result, err := t.fn(ctx, args)
+	if err != nil {
+		return t.CreateErrorResult(err, fmt.Sprintf("%s failed", t.GetName())), nil
+	}
+	return t.CreateSuccessResult(result, resultMessage(result)), nil
+}
+
+// decode validates the parameters, fills in defaults and converts them to Args
+func (t *TypedTool[Args, Result]) decode(params map[string]interface{}) (Args, error) {
+	var args Args
+	if err := t.ValidateParameters(params); err != nil {
+		return args, err
+	}
+
+	schema := t.GetParameterSchema()
+	withDefaults := applyDefaults(params, PropertySchema{Type: "object", Properties: schema.Properties})
+
+	data, err := json.Marshal(withDefaults)
+	if err != nil {
+		return args, err
+	}
+	if err := json.Unmarshal(data, &args); err != nil {
+		return args, fmt.Errorf("invalid parameters: %w", err)
+	}
+	return args, nil
+}
+
+// applyDefaults returns a copy of the value with the defaults of the schema set
+// in the absent fields of its objects, including objects nested in fields,
+// array items and map values
+func applyDefaults(value interface{}, prop PropertySchema) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		filled := make(map[string]interface{}, len(v))
+		for name, field := range prop.Properties {
+			if field.Default != nil {
+				filled[name] = field.Default
+			}
+		}
+		for name, fieldValue := range v {
+			if field, ok := prop.Properties[name]; ok {
+				fieldValue = applyDefaults(fieldValue, field)
+			} else if prop.AdditionalProperties != nil {
+				fieldValue = applyDefaults(fieldValue, *prop.AdditionalProperties)
+			}
+			filled[name] = fieldValue
+		}
+		return filled
+	case []interface{}:
+		if prop.Items == nil {
+			return v
+		}
+		filled := make([]interface{}, len(v))
+		for i, item := range v {
+			filled[i] = applyDefaults(item, *prop.Items)
+		}
+		return filled
+	}
+	return value
+}
+
+func resultMessage(result interface{}) string {
+	switch r := result.(type) {
+	case string:
+		return r
+	case fmt.Stringer:
+		return r.String()
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Sprint(result)
+	}
+	return string(data)
+}
+
+// SchemaFor derives the parameter schema of a struct type from its fields and tags
+func SchemaFor[T any]() (*ParameterSchema, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	prop, err := propertyFor(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return &ParameterSchema{
+		Type:       "object",
+		Properties: prop.Properties,
+		Required:   prop.Required,
+	}, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// propertyFor maps a Go type to its schema. Types being expanded are tracked
+// to reject recursive structs, which have no finite schema.
+func propertyFor(t reflect.Type, expanding map[reflect.Type]bool) (PropertySchema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return PropertySchema{Type: "string", Format: "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return PropertySchema{Type: "string"}, nil
+	case reflect.Bool:
+		return PropertySchema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return PropertySchema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return PropertySchema{Type: "number"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return PropertySchema{Type: "string", Format: "byte"}, nil // Base64, as encoding/json does
+		}
+		items, err := propertyFor(t.Elem(), expanding)
+		if err != nil {
+			return PropertySchema{}, err
+		}
+		return PropertySchema{Type: "array", Items: &items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return PropertySchema{}, fmt.Errorf("map keys of %s must be strings", t)
+		}
+		values, err := propertyFor(t.Elem(), expanding)
+		if err != nil {
+			return PropertySchema{}, err
+		}
+		prop := PropertySchema{Type: "object"}
+		if values.Type != "" {
+			prop.AdditionalProperties = &values
+		}
+		return prop, nil
+	case reflect.Interface:
+		return PropertySchema{}, nil // Any value
+	case reflect.Struct:
+		if expanding[t] {
+			return PropertySchema{}, fmt.Errorf("recursive type %s", t)
+		}
+		expanding[t] = true
+		defer delete(expanding, t)
+
+		prop := PropertySchema{Type: "object", Properties: map[string]PropertySchema{}}
+		if err := addFields(&prop, t, expanding); err != nil {
+			return PropertySchema{}, err
+		}
+		return prop, nil
+	}
+	return PropertySchema{}, fmt.Errorf("unsupported type %s", t)
+}
+
+// addFields adds the exported fields of a struct to an object schema. Embedded
+// structs without a json name contribute their fields, as in encoding/json.
+func addFields(prop *PropertySchema, t reflect.Type, expanding map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := addFields(prop, embedded, expanding); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldProp, err := propertyFor(field.Type, expanding)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := applyTags(&fieldProp, field); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		prop.Properties[name] = fieldProp
+		if field.Tag.Get("required") == "true" {
+			prop.Required = append(prop.Required, name)
+		}
+	}
+	return nil
+}
+
+// jsonName returns the json name of a field ("" when the tag has none) and
+// whether the field is skipped
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+// applyTags copies the schema tags of a field into its property
+func applyTags(prop *PropertySchema, field reflect.StructField) error {
+	tag := field.Tag
+	if description := tag.Get("description"); description != "" {
+		prop.Description = description
+	}
+	if format := tag.Get("format"); format != "" {
+		prop.Format = format
+	}
+	if enum := tag.Get("enum"); enum != "" {
+		target := prop
+		if prop.Type == "array" && prop.Items != nil {
+			target = prop.Items // Allowed values of each item
+		}
+		for _, value := range strings.Split(enum, ",") {
+			parsed, err := parseTagValue(target.Type, strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("enum: %w", err)
+			}
+			target.Enum = append(target.Enum, parsed)
+		}
+	}
+	if value := tag.Get("default"); value != "" {
+		parsed, err := parseTagValue(prop.Type, value)
+		if err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+		prop.Default = parsed
+	}
+	for _, bound := range []struct {
+		name   string
+		target **float64
+	}{{"minimum", &prop.Minimum}, {"maximum", &prop.Maximum}} {
+		if value := tag.Get(bound.name); value != "" {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", bound.name, err)
+			}
+			*bound.target = &n
+		}
+	}
+	for _, bound := range []struct {
+		name   string
+		target **int
+	}{{"minLength", &prop.MinLength}, {"maxLength", &prop.MaxLength}} {
+		if value := tag.Get(bound.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", bound.name, err)
+			}
+			*bound.target = &n
+		}
+	}
+	return nil
+}
+
+// parseTagValue converts a tag value to the JSON type of the property
+func parseTagValue(typ, value string) (interface{}, error) {
+	switch typ {
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
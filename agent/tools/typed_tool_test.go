@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type typedFilter struct {
+	Status string `json:"status" enum:"open,closed" default:"open"`
+	Limit  int    `json:"limit" minimum:"1" maximum:"50" default:"10"`
+}
+
+type typedSearchArgs struct {
+	Query   string        `json:"query" required:"true" minLength:"2" description:"Text to search"`
+	Filter  typedFilter   `json:"filter"`
+	Sorts   []typedSort   `json:"sorts"`
+	Tags    []string      `json:"tags" enum:"a,b"`
+	Options *typedOptions `json:"options"`
+}
+
+type typedSort struct {
+	Field string `json:"field" required:"true"`
+	Order string `json:"order" enum:"asc,desc" default:"asc"`
+}
+
+type typedOptions struct {
+	Verbose bool `json:"verbose" default:"true"`
+}
+
+func newTypedSearchTool() *TypedTool[typedSearchArgs, typedSearchArgs] {
+	return NewTypedTool("search", "Search items", func(ctx context.Context, args typedSearchArgs) (typedSearchArgs, error) {
+		return args, nil
+	})
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema, err := SchemaFor[typedSearchArgs]()
+	if err != nil {
+		t.Fatalf("SchemaFor: %v", err)
+	}
+	if len(schema.Required) != 1 || schema.Required[0] != "query" {
+		t.Errorf("required = %v, want [query]", schema.Required)
+	}
+	if query := schema.Properties["query"]; query.Type != "string" || query.MinLength == nil || *query.MinLength != 2 || query.Description != "Text to search" {
+		t.Errorf("query = %+v", query)
+	}
+
+	filter := schema.Properties["filter"]
+	if filter.Type != "object" {
+		t.Fatalf("filter type = %q, want object", filter.Type)
+	}
+	if status := filter.Properties["status"]; len(status.Enum) != 2 || status.Enum[0] != "open" || status.Default != "open" {
+		t.Errorf("filter.status = %+v", status)
+	}
+	if limit := filter.Properties["limit"]; limit.Type != "integer" || limit.Minimum == nil || *limit.Minimum != 1 || limit.Maximum == nil || *limit.Maximum != 50 || limit.Default != int64(10) {
+		t.Errorf("filter.limit = %+v", limit)
+	}
+
+	sorts := schema.Properties["sorts"]
+	if sorts.Type != "array" || sorts.Items == nil || sorts.Items.Type != "object" || len(sorts.Items.Required) != 1 {
+		t.Fatalf("sorts = %+v", sorts)
+	}
+	if tags := schema.Properties["tags"]; tags.Items == nil || len(tags.Items.Enum) != 2 {
+		t.Errorf("tags enum should apply to the items: %+v", tags)
+	}
+	if options := schema.Properties["options"]; options.Type != "object" || options.Properties["verbose"].Default != true {
+		t.Errorf("options = %+v", options)
+	}
+
+	if _, err := SchemaFor[string](); err == nil {
+		t.Error("SchemaFor accepted a non-struct type")
+	}
+	type node struct {
+		Children []node `json:"children"`
+	}
+	if _, err := SchemaFor[node](); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("SchemaFor of a recursive type: err = %v", err)
+	}
+}
+
+func TestTypedToolDefaults(t *testing.T) {
+	tool := newTypedSearchTool()
+	result, err := tool.Execute(context.Background(), map[string]interface{}{
+		"query":   "go",
+		"filter":  map[string]interface{}{"status": "closed"},
+		"sorts":   []interface{}{map[string]interface{}{"field": "date"}, map[string]interface{}{"field": "name", "order": "desc"}},
+		"options": map[string]interface{}{},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %s", err, result.Error)
+	}
+
+	args := result.Data.(typedSearchArgs)
+	if args.Filter.Status != "closed" || args.Filter.Limit != 10 {
+		t.Errorf("filter = %+v, want status closed and default limit 10", args.Filter)
+	}
+	if len(args.Sorts) != 2 || args.Sorts[0].Order != "asc" || args.Sorts[1].Order != "desc" {
+		t.Errorf("sorts = %+v, want default order asc on the first", args.Sorts)
+	}
+	if args.Options == nil || !args.Options.Verbose {
+		t.Errorf("options = %+v, want default verbose", args.Options)
+	}
+}
+
+func TestTypedToolValidation(t *testing.T) {
+	cases := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr string // Substring of the error
+	}{
+		{"missing query", map[string]interface{}{}, "query: is required"},
+		{"short query", map[string]interface{}{"query": "g"}, "query: must be at least 2 characters"},
+		{"enum", map[string]interface{}{"query": "go", "filter": map[string]interface{}{"status": "done"}}, "filter.status: must be one of"},
+		{"maximum", map[string]interface{}{"query": "go", "filter": map[string]interface{}{"limit": 51}}, "filter.limit: must be <= 50"},
+		{"minimum", map[string]interface{}{"query": "go", "filter": map[string]interface{}{"limit": 0}}, "filter.limit: must be >= 1"},
+		{"nested required", map[string]interface{}{"query": "go", "sorts": []interface{}{map[string]interface{}{"order": "asc"}}}, "sorts[0].field: is required"},
+		{"item enum", map[string]interface{}{"query": "go", "tags": []interface{}{"c"}}, "tags[0]: must be one of"},
+	}
+	tool := newTypedSearchTool()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := tool.Execute(context.Background(), tc.params)
+			if err != nil {
+				t.Fatalf("Execute returned error: %v", err)
+			}
+			if result.Success {
+				t.Fatalf("expected error containing %q, got %+v", tc.wantErr, result.Data)
+			}
+			if !strings.Contains(result.Error, tc.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", result.Error, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package tools
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validation error codes
+const (
+	CodeMissingParam = "MISSING_REQUIRED_PARAM"
+	CodeUnknownParam = "UNKNOWN_PARAM"
+	CodeInvalidValue = "INVALID_PARAM_VALUE"
+)
+
+// ValidateValue checks a parameter value against its schema: type, enum,
+// bounds, format, array items, nested object fields and oneOf alternatives.
+// Errors name the path of the offending value, such as
+// "filters.status: expected string".
+func ValidateValue(path string, value interface{}, schema PropertySchema) error {
+	if value == nil {
+		return nil // Absent optional values; required fields are checked by their object
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return validationError(path, CodeInvalidValue, "expected string")
+		}
+		length := utf8.RuneCountInString(s)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			return validationError(path, CodeInvalidValue, fmt.Sprintf("must be at least %d characters", *schema.MinLength))
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			return validationError(path, CodeInvalidValue, fmt.Sprintf("must be at most %d characters", *schema.MaxLength))
+		}
+		if err := checkFormat(schema.Format, s); err != nil {
+			return validationError(path, CodeInvalidValue, err.Error())
+		}
+	case "number", "integer":
+		n, ok := toFloat(value)
+		if !ok {
+			return validationError(path, CodeInvalidValue, "expected "+schema.Type)
+		}
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			return validationError(path, CodeInvalidValue, "expected integer")
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			return validationError(path, CodeInvalidValue, fmt.Sprintf("must be >= %v", *schema.Minimum))
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			return validationError(path, CodeInvalidValue, fmt.Sprintf("must be <= %v", *schema.Maximum))
+		}
+	case "null":
+		return validationError(path, CodeInvalidValue, "expected null")
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return validationError(path, CodeInvalidValue, "expected boolean")
+		}
+	case "array":
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return validationError(path, CodeInvalidValue, "expected array")
+		}
+		if schema.Items != nil {
+			for i := 0; i < rv.Len(); i++ {
+				if err := ValidateValue(fmt.Sprintf("%s[%d]", path, i), rv.Index(i).Interface(), *schema.Items); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		obj, ok := toObject(value)
+		if !ok {
+			return validationError(path, CodeInvalidValue, "expected object")
+		}
+		if err := validateObject(path, obj, schema); err != nil {
+			return err
+		}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		return validationError(path, CodeInvalidValue, fmt.Sprintf("must be one of %s", formatEnum(schema.Enum)))
+	}
+
+	if len(schema.OneOf) > 0 {
+		matches := 0
+		var firstErr error
+		for _, alternative := range schema.OneOf {
+			if err := ValidateValue(path, value, alternative); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			matches++
+		}
+		switch {
+		case matches == 0 && len(schema.OneOf) == 1:
+			return firstErr
+		case matches == 0:
+			return validationError(path, CodeInvalidValue, fmt.Sprintf("matches none of the %d allowed forms (first: %v)", len(schema.OneOf), firstErr))
+		case matches > 1:
+			return validationError(path, CodeInvalidValue, "matches more than one of the allowed forms")
+		}
+	}
+	return nil
+}
+
+// validateObject checks the required fields of an object, the value of each
+// known field and the fields not listed in the schema. A required field set to
+// null counts as missing unless its schema allows null. Fields are visited in
+// name order so the reported error does not change between calls.
+func validateObject(path string, obj map[string]interface{}, schema PropertySchema) error {
+	for _, name := range schema.Required {
+		value, exists := obj[name]
+		if !exists || (value == nil && !allowsNull(schema.Properties[name])) {
+			return validationError(joinPath(path, name), CodeMissingParam, "is required")
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := obj[name]
+		prop, exists := schema.Properties[name]
+		switch {
+		case exists:
+		case schema.NoAdditionalProperties:
+			return validationError(joinPath(path, name), CodeUnknownParam, "unknown parameter")
+		case schema.AdditionalProperties != nil:
+			prop = *schema.AdditionalProperties
+		default:
+			continue
+		}
+		if err := ValidateValue(joinPath(path, name), value, prop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowsNull reports whether null is a valid value for the schema
+func allowsNull(schema PropertySchema) bool {
+	if schema.Nullable || schema.Type == "null" {
+		return true
+	}
+	for _, alternative := range schema.OneOf {
+		if allowsNull(alternative) {
+			return true
+		}
+	}
+	return false
+}
+
+func validationError(path, code, message string) error {
+	if path != "" {
+		message = path + ": " + message
+	}
+	return &ToolError{Type: "validation_error", Message: message, Code: code}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// toObject accepts JSON objects and string maps built by Go callers
+func toObject(value interface{}) (map[string]interface{}, bool) {
+	if obj, ok := value.(map[string]interface{}); ok {
+		return obj, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	obj := make(map[string]interface{}, rv.Len())
+	for _, key := range rv.MapKeys() {
+		obj[key.String()] = rv.MapIndex(key).Interface()
+	}
+	return obj, true
+}
+
+// toFloat converts any Go number (JSON numbers decode as float64) to float64
+func toFloat(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// inEnum compares numbers by value, so 3 matches an enum entry of 3.0
+func inEnum(value interface{}, enum []interface{}) bool {
+	n, isNumber := toFloat(value)
+	for _, allowed := range enum {
+		if isNumber {
+			if m, ok := toFloat(allowed); ok && m == n {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, v := range enum {
+		values[i] = fmt.Sprint(v)
+	}
+	return strings.Join(values, ", ")
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// checkFormat validates the string formats the tools use. Unknown formats are
+// hints for the model and accept any string.
+func checkFormat(format, s string) error {
+	switch format {
+	case "uri", "url":
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("expected an absolute URL")
+		}
+	case "email":
+		if _, err := mail.ParseAddress(s); err != nil {
+			return fmt.Errorf("expected an email address")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return fmt.Errorf("expected an RFC 3339 date-time")
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return fmt.Errorf("expected a YYYY-MM-DD date")
+		}
+	case "uuid":
+		if !uuidPattern.MatchString(s) {
+			return fmt.Errorf("expected a UUID")
+		}
+	case "ipv4":
+		if ip := net.ParseIP(s); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("expected an IPv4 address")
+		}
+	case "ipv6":
+		if ip := net.ParseIP(s); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("expected an IPv6 address")
+		}
+	case "byte":
+		if _, err := base64.StdEncoding.DecodeString(s); err != nil {
+			return fmt.Errorf("expected base64 data")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRequiredNull(t *testing.T) {
+	schema := PropertySchema{
+		Type: "object",
+		Properties: map[string]PropertySchema{
+			"url":    {Type: "string"},
+			"note":   {Type: "string", Nullable: true},
+			"cursor": {OneOf: []PropertySchema{{Type: "string"}, {Type: "null"}}},
+			"tag":    {Type: "string"},
+		},
+		Required: []string{"url", "note", "cursor"},
+	}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"url": "https://example.com", "note": "x", "cursor": "c"}
+	}
+
+	cases := []struct {
+		name     string
+		field    string
+		value    interface{}
+		wantCode string // Empty when the object must validate
+	}{
+		{name: "valid", field: "tag", value: "t"},
+		{name: "optional null", field: "tag", value: nil},
+		{name: "required null", field: "url", value: nil, wantCode: CodeMissingParam},
+		{name: "nullable required null", field: "note", value: nil},
+		{name: "oneOf null alternative", field: "cursor", value: nil},
+		{name: "required wrong type", field: "url", value: 3, wantCode: CodeInvalidValue},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			obj := valid()
+			obj[tc.field] = tc.value
+			err := ValidateValue("", obj, schema)
+			if tc.wantCode == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var toolErr *ToolError
+			if !errors.As(err, &toolErr) || toolErr.Code != tc.wantCode {
+				t.Fatalf("error = %v, want code %s", err, tc.wantCode)
+			}
+		})
+	}
+
+	obj := valid()
+	delete(obj, "note")
+	if err := ValidateValue("", obj, schema); err == nil {
+		t.Error("missing nullable required field passed validation")
+	}
+}
+
+func TestOpenAPISchemaNullable(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema map[string]interface{}
+		want   PropertySchema
+	}{
+		{"3.1 type list", map[string]interface{}{"type": []interface{}{"null", "string"}}, PropertySchema{Type: "string", Nullable: true}},
+		{"3.0 nullable", map[string]interface{}{"type": "integer", "nullable": true}, PropertySchema{Type: "integer", Nullable: true}},
+		{"not nullable", map[string]interface{}{"type": "string"}, PropertySchema{Type: "string"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := openAPISchema(tc.schema)
+			if got.Type != tc.want.Type || got.Nullable != tc.want.Nullable {
+				t.Errorf("openAPISchema = {Type: %q, Nullable: %v}, want {Type: %q, Nullable: %v}", got.Type, got.Nullable, tc.want.Type, tc.want.Nullable)
+			}
+		})
+	}
+}
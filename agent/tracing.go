@@ -0,0 +1,13 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/santiagocorredoira/agent/agent/tracing"
+)
+
+// startSpan starts a span under the turn in progress. Outside a turn the span
+// hangs from the span carried by ctx, if any.
+func (a *V3Agent) startSpan(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, *tracing.Span) {
+	return a.tracer.Start(tracing.ContextWithSpan(ctx, a.turnSpan), name, attrs)
+}
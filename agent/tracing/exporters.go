@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSONLExporter appends one JSON object per span to a file
+type JSONLExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewJSONLExporter opens (or creates) the trace file
+func NewJSONLExporter(path string) (*JSONLExporter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("tracing path is required for the jsonl exporter")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &JSONLExporter{file: file}, nil
+}
+
+func (e *JSONLExporter) Export(ctx context.Context, spans []*Span) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, span := range spans {
+		span.mu.Lock()
+		err := encoder.Encode(span)
+		span.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to encode span %s: %w", span.Name, err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.file.Write(buf.Bytes())
+	return err
+}
+
+func (e *JSONLExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector using OTLP over HTTP
+// with the JSON encoding
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+}
+
+// NewOTLPExporter creates an exporter for a collector. The /v1/traces path is
+// added when endpoint has no path.
+func NewOTLPExporter(endpoint string, headers map[string]string, serviceName string) (*OTLPExporter, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("tracing endpoint is required for the otlp exporter")
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.Contains(strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://"), "/") {
+		endpoint += "/v1/traces"
+	}
+	return &OTLPExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  serviceName,
+		client:   &http.Client{},
+	}, nil
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// OTLP JSON structures (ExportTraceServiceRequest)
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 0 unset, 1 ok, 2 error
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+// payload converts spans to an OTLP export request
+func (e *OTLPExporter) payload(spans []*Span) otlpRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		span.mu.Lock()
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              1, // Internal
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1},
+		}
+		for key, value := range span.Attributes {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: key, Value: otlpValue(value)})
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{Code: 2, Message: span.Error}
+		}
+		span.mu.Unlock()
+		converted = append(converted, s)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue(e.service)},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/santiagocorredoira/agent"},
+			Spans: converted,
+		}},
+	}}}
+}
+
+// otlpValue converts an attribute value to an OTLP AnyValue
+func otlpValue(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
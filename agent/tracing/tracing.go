@@ -0,0 +1,237 @@
+// Package tracing records spans for agent turns (turn, LLM calls, tool calls and
+// relevance evaluations) and exports them to a JSONL file or an OTLP HTTP collector.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent/config"
+)
+
+// Span is a timed operation of a turn. All methods are safe on a nil span, so
+// callers can trace unconditionally when tracing is disabled.
+type Span struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	StartTime  time.Time              `json:"start"`
+	EndTime    time.Time              `json:"end"`
+	DurationMS float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = value
+}
+
+// SetAttributes sets several attributes of the span
+func (s *Span) SetAttributes(attrs map[string]interface{}) {
+	for key, value := range attrs {
+		s.SetAttribute(key, value)
+	}
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// End finishes the span. Spans are exported together when the root span of
+// their trace ends.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.DurationMS = float64(s.EndTime.Sub(s.StartTime).Microseconds()) / 1000
+	s.mu.Unlock()
+
+	s.tracer.finish(s)
+}
+
+// Exporter sends finished spans to a backend
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer creates spans and hands finished traces to its exporter. A nil tracer
+// creates no spans.
+type Tracer struct {
+	exporter Exporter
+	mu       sync.Mutex
+	pending  map[string][]*Span // Finished spans by trace, waiting for their root
+	exports  sync.WaitGroup
+}
+
+// NewTracer creates a tracer that exports to exporter
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+		pending:  make(map[string][]*Span),
+	}
+}
+
+// New creates the tracer described by the configuration, or nil when tracing is disabled
+func New(cfg config.TracingConfig) (*Tracer, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var exporter Exporter
+	var err error
+	switch cfg.Exporter {
+	case "jsonl":
+		exporter, err = NewJSONLExporter(cfg.Path)
+	case "otlp":
+		exporter, err = NewOTLPExporter(cfg.Endpoint, cfg.Headers, cfg.ServiceName)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewTracer(exporter), nil
+}
+
+// Start starts a span, child of the span in ctx if any, and returns a context carrying it
+func (t *Tracer) Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		SpanID:    newID(8),
+		Name:      name,
+		StartTime: time.Now(),
+		tracer:    t,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = newID(16)
+	}
+	span.SetAttributes(attrs)
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Shutdown waits for pending exports, exports spans whose root never ended and
+// closes the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	var orphans []*Span
+	for traceID, spans := range t.pending {
+		orphans = append(orphans, spans...)
+		delete(t.pending, traceID)
+	}
+	t.mu.Unlock()
+
+	t.exports.Wait()
+	if len(orphans) > 0 {
+		if err := t.exporter.Export(ctx, orphans); err != nil {
+			log.Printf("Failed to export traces: %v", err)
+		}
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// finish queues a finished span and exports its trace when the root span ends
+func (t *Tracer) finish(span *Span) {
+	t.mu.Lock()
+	if span.ParentID != "" {
+		t.pending[span.TraceID] = append(t.pending[span.TraceID], span)
+		t.mu.Unlock()
+		return
+	}
+	spans := append(t.pending[span.TraceID], span)
+	delete(t.pending, span.TraceID)
+	t.mu.Unlock()
+
+	// Export in the background so slow collectors do not delay the answer
+	t.exports.Add(1)
+	go func() {
+		defer t.exports.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := t.exporter.Export(ctx, spans); err != nil {
+			log.Printf("Failed to export traces: %v", err)
+		}
+	}()
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a child of the span in ctx with the same tracer. Without a
+// span in ctx nothing is traced; this lets packages without a tracer (tools,
+// providers) add spans to the turn that called them.
+func StartSpan(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, attrs)
+}
+
+// newID returns a random hex identifier of n bytes
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,333 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/santiagocorredoira/agent/agent"
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/tools"
+	"github.com/santiagocorredoira/agent/agent/tracing"
+)
+
+// collector is a fake OTLP/HTTP collector that keeps the spans it receives
+type collector struct {
+	mu       sync.Mutex
+	services []string
+	spans    []collectedSpan
+}
+
+type collectedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Attributes   []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"attributes"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// attr returns the value of an attribute as sent, such as "12" for an intValue
+func (s collectedSpan) attr(key string) interface{} {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			for _, v := range a.Value {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string                 `json:"key"`
+					Value map[string]interface{} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []collectedSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, a := range rs.Resource.Attributes {
+			if a.Key == "service.name" {
+				c.services = append(c.services, fmt.Sprint(a.Value["stringValue"]))
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+// scriptedProvider asks for the lookup and broken tools, then answers once it
+// has their results. Relevance
+// evaluations, recognised by their 10 token limit, are always relevant.
+type scriptedProvider struct{}
+
+func (p *scriptedProvider) GetName() string                      { return "scripted" }
+func (p *scriptedProvider) IsAvailable(ctx context.Context) bool { return true }
+func (p *scriptedProvider) GetModels() []string                  { return []string{"scripted-model"} }
+func (p *scriptedProvider) GetDefaultModel() string              { return "scripted-model" }
+func (p *scriptedProvider) ValidateConfig() error                { return nil }
+func (p *scriptedProvider) SupportsFunctionCalling() bool        { return true }
+func (p *scriptedProvider) Stream(ctx context.Context, req *llm.CompletionRequest) (<-chan llm.StreamChunk, error) {
+	return nil, errors.New("streaming not supported")
+}
+
+func (p *scriptedProvider) Complete(ctx context.Context, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	if req.MaxTokens == 10 {
+		return &llm.CompletionResponse{Content: "RELEVANT", Model: "relevance-model", Usage: llm.TokenUsage{PromptTokens: 7, CompletionTokens: 1, TotalTokens: 8}}, nil
+	}
+	for _, msg := range req.Messages {
+		if msg.Role == "tool" {
+			return &llm.CompletionResponse{Content: "Done.", Model: "scripted-model", Usage: llm.TokenUsage{PromptTokens: 40, CompletionTokens: 2, TotalTokens: 42}}, nil
+		}
+	}
+	return &llm.CompletionResponse{
+		Model: "scripted-model",
+		Usage: llm.TokenUsage{PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42},
+		ToolCalls: []llm.ToolCall{
+			{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "lookup", Arguments: `{"query":"fees"}`}},
+			{ID: "call_2", Type: "function", Function: llm.FunctionCall{Name: "broken", Arguments: `{}`}},
+		},
+	}, nil
+}
+
+// lookupTool evaluates a document with the relevance evaluator, which traces
+// under the tool span through ctx
+type lookupTool struct {
+	*tools.BaseTool
+	evaluator *tools.DocumentRelevanceEvaluator
+}
+
+func (t *lookupTool) IsAvailable(ctx context.Context) bool { return true }
+func (t *lookupTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return tools.DefaultGetFunctionDefinition(t)
+}
+func (t *lookupTool) Execute(ctx context.Context, params map[string]interface{}) (*tools.ToolResult, error) {
+	relevant, err := t.evaluator.EvaluateRelevance(ctx, fmt.Sprint(params["query"]), "guides/fees.md")
+	if err != nil {
+		return t.CreateErrorResult(err, "Evaluation failed"), nil
+	}
+	return t.CreateSuccessResult(relevant, "guides/fees.md is relevant"), nil
+}
+
+// newBaseTool creates a custom tool taking string parameters
+func newBaseTool(name, description string, params ...string) *tools.BaseTool {
+	properties := make(map[string]tools.PropertySchema)
+	for _, param := range params {
+		properties[param] = tools.PropertySchema{Type: "string"}
+	}
+	base := tools.NewBaseTool(name, description, tools.CategoryCustom, false, 1)
+	base.SetParameterSchema(&tools.ParameterSchema{Type: "object", Properties: properties})
+	return base
+}
+
+// brokenTool always fails
+type brokenTool struct {
+	*tools.BaseTool
+}
+
+func (t *brokenTool) IsAvailable(ctx context.Context) bool { return true }
+func (t *brokenTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return tools.DefaultGetFunctionDefinition(t)
+}
+func (t *brokenTool) Execute(ctx context.Context, params map[string]interface{}) (*tools.ToolResult, error) {
+	return t.CreateErrorResult(errors.New("disk on fire"), "Broken"), nil
+}
+
+func TestOTLPExportOfAgentTurn(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	configJSON := fmt.Sprintf(`{"tracing": {"enabled": true, "exporter": "otlp", "endpoint": %q, "service_name": "agent-test"}}`, srv.URL)
+	if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &scriptedProvider{}
+	a, err := agent.NewV3Agent(agent.AgentConfig{
+		ConfigPath: configPath,
+		StorageDir: filepath.Join(dir, "memory"),
+		Provider:   provider,
+		CustomTools: []tools.Tool{
+			&lookupTool{
+				BaseTool:  newBaseTool("lookup", "Looks up a document", "query"),
+				evaluator: tools.NewDocumentRelevanceEvaluator(provider),
+			},
+			&brokenTool{BaseTool: newBaseTool("broken", "Always fails")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewV3Agent: %v", err)
+	}
+	if _, err := a.StartConversation(); err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if _, err := a.SendMessage("What are the fees?"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	a.Shutdown() // Waits for the export
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.services) == 0 || c.services[0] != "agent-test" {
+		t.Errorf("service names = %v, want agent-test", c.services)
+	}
+	byName := make(map[string][]collectedSpan)
+	for _, span := range c.spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	if len(byName["agent.turn"]) != 1 {
+		t.Fatalf("spans = %v, want one agent.turn", byName)
+	}
+	turn := byName["agent.turn"][0]
+	if turn.ParentSpanID != "" {
+		t.Errorf("agent.turn has parent %s", turn.ParentSpanID)
+	}
+	for _, span := range c.spans {
+		if span.TraceID != turn.TraceID {
+			t.Errorf("%s is in trace %s, want %s", span.Name, span.TraceID, turn.TraceID)
+		}
+	}
+
+	llmCalls := byName["llm.call"]
+	if len(llmCalls) != 2 {
+		t.Fatalf("llm.call spans = %d, want 2", len(llmCalls))
+	}
+	for _, span := range llmCalls {
+		if span.ParentSpanID != turn.SpanID {
+			t.Errorf("llm.call parent = %s, want the turn %s", span.ParentSpanID, turn.SpanID)
+		}
+		if span.attr("provider") != "scripted" || span.attr("model") != "scripted-model" {
+			t.Errorf("llm.call provider = %v, model = %v", span.attr("provider"), span.attr("model"))
+		}
+	}
+	tokens := map[interface{}]bool{}
+	for _, span := range llmCalls {
+		tokens[span.attr("prompt_tokens")] = true
+		tokens[span.attr("completion_tokens")] = true
+	}
+	for _, want := range []string{"30", "12", "40", "2"} {
+		if !tokens[want] {
+			t.Errorf("no llm.call with %s tokens in %v", want, tokens)
+		}
+	}
+
+	toolSpans := make(map[string]collectedSpan)
+	for _, span := range byName["tool.call"] {
+		if span.ParentSpanID != turn.SpanID {
+			t.Errorf("tool.call parent = %s, want the turn %s", span.ParentSpanID, turn.SpanID)
+		}
+		toolSpans[fmt.Sprint(span.attr("tool"))] = span
+	}
+	lookup, ok := toolSpans["lookup"]
+	if !ok {
+		t.Fatalf("no tool.call span for lookup in %v", byName["tool.call"])
+	}
+	if lookup.attr("args_size") != fmt.Sprint(len(`{"query":"fees"}`)) || lookup.Status.Code != 1 {
+		t.Errorf("lookup span: args_size = %v, status = %+v", lookup.attr("args_size"), lookup.Status)
+	}
+	broken, ok := toolSpans["broken"]
+	if !ok {
+		t.Fatalf("no tool.call span for broken in %v", byName["tool.call"])
+	}
+	if broken.Status.Code != 2 || broken.Status.Message == "" {
+		t.Errorf("broken span status = %+v, want an error", broken.Status)
+	}
+
+	relevance := byName["relevance.evaluate"]
+	if len(relevance) != 1 {
+		t.Fatalf("relevance.evaluate spans = %d, want 1", len(relevance))
+	}
+	if relevance[0].ParentSpanID != lookup.SpanID {
+		t.Errorf("relevance.evaluate parent = %s, want the lookup call %s", relevance[0].ParentSpanID, lookup.SpanID)
+	}
+	if relevance[0].attr("provider") != "scripted" || relevance[0].attr("model") != "relevance-model" || relevance[0].attr("relevant") != true {
+		t.Errorf("relevance.evaluate attributes = %+v", relevance[0].Attributes)
+	}
+}
+
+func TestJSONLExporterRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "spans.jsonl")
+	exporter, err := tracing.NewJSONLExporter(path)
+	if err != nil {
+		t.Fatalf("NewJSONLExporter: %v", err)
+	}
+	tracer := tracing.NewTracer(exporter)
+
+	ctx, root := tracer.Start(context.Background(), "agent.turn", map[string]interface{}{"profile": "support"})
+	_, child := tracing.StartSpan(ctx, "tool.call", map[string]interface{}{"tool": "file_read", "args_size": 12})
+	child.SetError(errors.New("file not found"))
+	child.End()
+	root.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var spans []*tracing.Span
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		span := &tracing.Span{}
+		if err := json.Unmarshal(scanner.Bytes(), span); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+
+	// Children end first, so they are written first
+	gotChild, gotRoot := spans[0], spans[1]
+	if gotRoot.Name != "agent.turn" || gotRoot.ParentID != "" || gotRoot.Attributes["profile"] != "support" {
+		t.Errorf("root = %+v", gotRoot)
+	}
+	if gotChild.Name != "tool.call" || gotChild.TraceID != gotRoot.TraceID || gotChild.ParentID != gotRoot.SpanID {
+		t.Errorf("child = %+v, want a child of %s in trace %s", gotChild, gotRoot.SpanID, gotRoot.TraceID)
+	}
+	if gotChild.Attributes["tool"] != "file_read" || gotChild.Attributes["args_size"] != float64(12) || gotChild.Error != "file not found" {
+		t.Errorf("child attributes = %v, error = %q", gotChild.Attributes, gotChild.Error)
+	}
+	if gotChild.EndTime.Before(gotChild.StartTime) || gotRoot.EndTime.Before(gotChild.EndTime) {
+		t.Errorf("times: child %v-%v, root %v-%v", gotChild.StartTime, gotChild.EndTime, gotRoot.StartTime, gotRoot.EndTime)
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/memory"
+	"github.com/santiagocorredoira/agent/agent/planner"
 )
 
 // WebSocketMessage represents messages sent over WebSocket
@@ -28,8 +30,14 @@ type WebSocketHandler struct {
 	agent    *V3Agent
 	upgrader websocket.Upgrader
 	sessions sync.Map // sessionID -> *memory.ConversationMemory
+
+	confirmations sync.Map // requestID -> chan *ConfirmationResponse
 }
 
+// confirmationTimeout is how long a tool call waits for the browser to answer
+// a confirm_request before it is treated as denied
+const confirmationTimeout = 2 * time.Minute
+
 // NewWebSocketHandler creates a new WebSocket handler
 func NewWebSocketHandler(agent *V3Agent) *WebSocketHandler {
 	return &WebSocketHandler{
@@ -59,6 +67,11 @@ func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
+	// Report the connection and the sessions it uses until it closes
+	h.agent.metrics.wsConns.Inc()
+	defer h.agent.metrics.wsConns.Dec()
+	defer h.releaseSessions()
+
 	// Set up ping/pong to keep connection alive
 	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	conn.SetPongHandler(func(string) error {
@@ -81,6 +94,22 @@ func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.handleIncoming(conn, messageChan, done)
 }
 
+// trackSession stores a session used by this connection
+func (h *WebSocketHandler) trackSession(sessionID string, session *memory.ConversationMemory) {
+	if _, loaded := h.sessions.Swap(sessionID, session); !loaded {
+		h.agent.metrics.wsSessions.Inc()
+	}
+}
+
+// releaseSessions stops reporting the sessions of a closed connection
+func (h *WebSocketHandler) releaseSessions() {
+	h.sessions.Range(func(key, _ interface{}) bool {
+		h.sessions.Delete(key)
+		h.agent.metrics.wsSessions.Dec()
+		return true
+	})
+}
+
 // handleIncoming processes incoming WebSocket messages
 func (h *WebSocketHandler) handleIncoming(conn *websocket.Conn, outChan chan<- WebSocketMessage, done chan<- struct{}) {
 	defer close(done)
@@ -112,6 +141,16 @@ func (h *WebSocketHandler) handleIncoming(conn *websocket.Conn, outChan chan<- W
 			h.handleGenerateSummary(msg, outChan)
 		case "delete_session":
 			h.handleDeleteSession(msg, outChan)
+		case "confirm_response":
+			h.handleConfirmResponse(msg, outChan)
+		case "regenerate":
+			h.handleRegenerate(msg, outChan)
+		case "edit_message":
+			h.handleEditMessage(msg, outChan)
+		case "fork_session":
+			h.handleForkSession(msg, outChan)
+		case "switch_branch":
+			h.handleSwitchBranch(msg, outChan)
 		default:
 			outChan <- WebSocketMessage{
 				Type:  "error",
@@ -164,7 +203,7 @@ func (h *WebSocketHandler) handleStartSession(msg WebSocketMessage, outChan chan
 	}
 
 	// Store session
-	h.sessions.Store(session.SessionID, session)
+	h.trackSession(session.SessionID, session)
 
 	// Start logging session for this conversation
 	h.startLoggingSession(session.SessionID)
@@ -174,6 +213,7 @@ func (h *WebSocketHandler) handleStartSession(msg WebSocketMessage, outChan chan
 		SessionID: session.SessionID,
 		Data: map[string]interface{}{
 			"session_id": session.SessionID,
+			"profile":    session.Profile,
 		},
 	}
 }
@@ -200,7 +240,7 @@ func (h *WebSocketHandler) handleMessage(msg WebSocketMessage, outChan chan<- We
 			}
 			return
 		}
-		h.sessions.Store(msg.SessionID, session)
+		h.trackSession(msg.SessionID, session)
 	}
 
 	// Log provider info for debugging
@@ -229,10 +269,14 @@ func (h *WebSocketHandler) handleMessage(msg WebSocketMessage, outChan chan<- We
 
 // processMessageWithStreaming handles message processing with real-time updates
 func (h *WebSocketHandler) processMessageWithStreaming(content, sessionID string, outChan chan<- WebSocketMessage, streamHandler func(string, bool)) {
-	// Log current provider state before sending message
-	log.Printf("🔍 About to send message. Current provider: %s", h.agent.llmProvider.GetName())
-	log.Printf("🔍 Provider available: %t", h.agent.llmProvider.IsAvailable(h.agent.ctx))
-	
+	h.processTurnWithStreaming(sessionID, outChan, streamHandler, func(options ConversationOptions) (*llm.CompletionResponse, error) {
+		return h.agent.SendMessageWithStreaming(content, options)
+	})
+}
+
+// processTurnWithStreaming runs one agent turn (new message, edit or regeneration)
+// and streams status updates and the final response to the client
+func (h *WebSocketHandler) processTurnWithStreaming(sessionID string, outChan chan<- WebSocketMessage, streamHandler func(string, bool), send func(ConversationOptions) (*llm.CompletionResponse, error)) {
 	// Create status callback to send status messages to WebSocket
 	statusCallback := func(message string) {
 		outChan <- WebSocketMessage{
@@ -245,21 +289,27 @@ func (h *WebSocketHandler) processMessageWithStreaming(content, sessionID string
 	// Create options with status callback
 	options := DefaultConversationOptions()
 	options.StatusCallback = statusCallback
+	options.PlanCallback = func(plan *planner.Plan) {
+		outChan <- WebSocketMessage{
+			Type:      "plan",
+			SessionID: sessionID,
+			Data:      map[string]interface{}{"plan": plan},
+		}
+	}
+	options.ConfirmationHandler = h.confirmationHandler(sessionID, outChan)
 	
 	// Send the message to the agent
-	response, err := h.agent.SendMessageWithStreaming(content, options)
+	response, err := send(options)
 	if err != nil {
 		outChan <- WebSocketMessage{
 			Type:      "error",
 			Error:     fmt.Sprintf("Failed to process message: %v", err),
 			SessionID: sessionID,
+			Data:      map[string]interface{}{"code": ErrorCode(err)},
 		}
 		return
 	}
 	
-	// Log what we got back
-	log.Printf("🔍 Response received. Length: %d chars", len(response.Content))
-
 	// Send the complete response
 	streamHandler(response.Content, true)
 
@@ -273,10 +323,79 @@ func (h *WebSocketHandler) processMessageWithStreaming(content, sessionID string
 				"completion": response.Usage.CompletionTokens,
 				"total":      response.Usage.TotalTokens,
 			},
+			"sources": response.Sources,
 		},
 	}
 }
 
+// confirmationHandler returns a handler that asks the browser to confirm tool
+// calls with a confirm_request message and waits for the matching confirm_response
+func (h *WebSocketHandler) confirmationHandler(sessionID string, outChan chan<- WebSocketMessage) ConfirmationHandler {
+	return ConfirmationHandlerFunc(func(ctx context.Context, req ConfirmationRequest) (*ConfirmationResponse, error) {
+		requestID := fmt.Sprintf("confirm_%d", time.Now().UnixNano())
+		respChan := make(chan *ConfirmationResponse, 1)
+		h.confirmations.Store(requestID, respChan)
+		defer h.confirmations.Delete(requestID)
+
+		outChan <- WebSocketMessage{
+			Type:      "confirm_request",
+			SessionID: sessionID,
+			Data: map[string]interface{}{
+				"request_id":     requestID,
+				"tool_call_id":   req.ToolCallID,
+				"tool_name":      req.ToolName,
+				"description":    req.Description,
+				"category":       req.Category,
+				"arguments":      req.Arguments,
+				"estimated_cost": req.EstimatedCost,
+			},
+		}
+
+		timer := time.NewTimer(confirmationTimeout)
+		defer timer.Stop()
+
+		select {
+		case resp := <-respChan:
+			return resp, nil
+		case <-timer.C:
+			return &ConfirmationResponse{Decision: ConfirmationDeny, Reason: "no answer before the confirmation timed out"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// handleConfirmResponse delivers the user's answer to a pending confirm_request
+func (h *WebSocketHandler) handleConfirmResponse(msg WebSocketMessage, outChan chan<- WebSocketMessage) {
+	requestID, _ := msg.Data["request_id"].(string)
+	pending, ok := h.confirmations.Load(requestID)
+	if !ok {
+		outChan <- WebSocketMessage{
+			Type:      "error",
+			Error:     fmt.Sprintf("No pending confirmation: %s", requestID),
+			SessionID: msg.SessionID,
+		}
+		return
+	}
+
+	resp := &ConfirmationResponse{Decision: ConfirmationDeny}
+	if decision, ok := msg.Data["decision"].(string); ok {
+		resp.Decision = ConfirmationDecision(decision)
+	}
+	if reason, ok := msg.Data["reason"].(string); ok {
+		resp.Reason = reason
+	}
+	if args, ok := msg.Data["arguments"].(map[string]interface{}); ok {
+		resp.Arguments = args
+	}
+
+	select {
+	case pending.(chan *ConfirmationResponse) <- resp:
+	default:
+		// Already answered
+	}
+}
+
 // handleLoadSession loads an existing session
 func (h *WebSocketHandler) handleLoadSession(msg WebSocketMessage, outChan chan<- WebSocketMessage) {
 	if msg.SessionID == "" {
@@ -297,31 +416,58 @@ func (h *WebSocketHandler) handleLoadSession(msg WebSocketMessage, outChan chan<
 	}
 
 	// Store in active sessions
-	h.sessions.Store(session.SessionID, session)
+	h.trackSession(session.SessionID, session)
 
 	// Note: No need to start logging session here since it's an existing conversation
 	// Logging should only start for new sessions, not when loading existing ones
 
-	// Get conversation history
-	messages := session.GetRecentMessages(50) // Get last 50 messages
-	history := make([]map[string]interface{}, len(messages))
-	for i, msg := range messages {
-		history[i] = map[string]interface{}{
-			"role":    msg.Role,
-			"content": msg.Content,
-		}
-	}
+	h.sendSessionLoaded(session, outChan)
+}
 
+// sendSessionLoaded sends the active branch of a session to the client
+func (h *WebSocketHandler) sendSessionLoaded(session *memory.ConversationMemory, outChan chan<- WebSocketMessage) {
 	outChan <- WebSocketMessage{
 		Type:      "session_loaded",
 		SessionID: session.SessionID,
 		Data: map[string]interface{}{
 			"session_id": session.SessionID,
-			"history":    history,
+			"history":    sessionHistory(session),
 		},
 	}
 }
 
+// sessionHistory converts the last messages of the active branch to the wire format
+func sessionHistory(session *memory.ConversationMemory) []map[string]interface{} {
+	messages := session.GetRecentMessages(50) // Get last 50 messages
+	history := make([]map[string]interface{}, len(messages))
+	for i, msg := range messages {
+		history[i] = map[string]interface{}{
+			"id":      msg.ID,
+			"role":    msg.Role,
+			"content": msg.Content,
+		}
+		// Tool-call trace entries carry the evidence behind each answer
+		if msg.Trace {
+			history[i]["trace"] = true
+			if len(msg.ToolCalls) > 0 {
+				history[i]["tool_calls"] = msg.ToolCalls
+			}
+			if msg.ToolCallID != "" {
+				history[i]["tool_call_id"] = msg.ToolCallID
+			}
+			continue
+		}
+		if len(msg.Sources) > 0 {
+			history[i]["sources"] = msg.Sources
+		}
+		// Let the client switch between edited or regenerated alternatives
+		if branches, err := session.GetBranches(msg.ID); err == nil && len(branches.Siblings) > 1 {
+			history[i]["branches"] = branches
+		}
+	}
+	return history
+}
+
 // handleListSessions returns available sessions
 func (h *WebSocketHandler) handleListSessions(msg WebSocketMessage, outChan chan<- WebSocketMessage) {
 	sessions, err := h.agent.ListConversations()
@@ -436,6 +582,9 @@ func (h *WebSocketHandler) handleDeleteSession(msg WebSocketMessage, outChan cha
 
 		// End logging session for this conversation
 		h.endLoggingSession(msg.SessionID)
+		if _, loaded := h.sessions.LoadAndDelete(msg.SessionID); loaded {
+			h.agent.metrics.wsSessions.Dec()
+		}
 
 		// Send session deleted notification if successful
 		outChan <- WebSocketMessage{
@@ -528,4 +677,141 @@ func (h *WebSocketHandler) endLoggingSession(sessionID string) {
 			log.Printf("Ended logging session for WebSocket: %s", sessionID)
 		}
 	}
-}
\ No newline at end of file
+}
+// activateSession makes sessionID the agent's current session, loading it from storage if needed
+func (h *WebSocketHandler) activateSession(sessionID string) (*memory.ConversationMemory, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session ID required")
+	}
+
+	if current := h.agent.GetCurrentSession(); current != nil && current.SessionID == sessionID {
+		return current, nil
+	}
+
+	session, err := h.agent.LoadConversation(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	h.trackSession(sessionID, session)
+	return session, nil
+}
+
+// streamTurn runs a branching operation that produces a new answer, streaming it
+// like a regular message and refreshing the history once it completes
+func (h *WebSocketHandler) streamTurn(sessionID string, outChan chan<- WebSocketMessage, send func(ConversationOptions) (*llm.CompletionResponse, error)) {
+	streamHandler := func(chunk string, isComplete bool) {
+		outChan <- WebSocketMessage{
+			Type:      "response",
+			Content:   chunk,
+			SessionID: sessionID,
+			Streaming: !isComplete,
+		}
+	}
+
+	go func() {
+		h.processTurnWithStreaming(sessionID, outChan, streamHandler, send)
+		if session := h.agent.GetCurrentSession(); session != nil && session.SessionID == sessionID {
+			h.sendSessionLoaded(session, outChan)
+		}
+	}()
+}
+
+// handleRegenerate asks for a new answer to the last user message
+func (h *WebSocketHandler) handleRegenerate(msg WebSocketMessage, outChan chan<- WebSocketMessage) {
+	if _, err := h.activateSession(msg.SessionID); err != nil {
+		outChan <- WebSocketMessage{
+			Type:      "error",
+			Error:     fmt.Sprintf("Failed to regenerate: %v", err),
+			SessionID: msg.SessionID,
+		}
+		return
+	}
+
+	h.streamTurn(msg.SessionID, outChan, func(options ConversationOptions) (*llm.CompletionResponse, error) {
+		return h.agent.RegenerateLastResponse(options)
+	})
+}
+
+// handleEditMessage replaces a user message and re-runs the conversation from it
+func (h *WebSocketHandler) handleEditMessage(msg WebSocketMessage, outChan chan<- WebSocketMessage) {
+	messageID, _ := msg.Data["message_id"].(string)
+	content, _ := msg.Data["content"].(string)
+	if messageID == "" || content == "" {
+		outChan <- WebSocketMessage{
+			Type:      "error",
+			Error:     "message_id and content required",
+			SessionID: msg.SessionID,
+		}
+		return
+	}
+
+	if _, err := h.activateSession(msg.SessionID); err != nil {
+		outChan <- WebSocketMessage{
+			Type:      "error",
+			Error:     fmt.Sprintf("Failed to edit message: %v", err),
+			SessionID: msg.SessionID,
+		}
+		return
+	}
+
+	h.streamTurn(msg.SessionID, outChan, func(options ConversationOptions) (*llm.CompletionResponse, error) {
+		return h.agent.EditMessage(messageID, content, options)
+	})
+}
+
+// handleForkSession copies the active branch up to a message into a new session
+func (h *WebSocketHandler) handleForkSession(msg WebSocketMessage, outChan chan<- WebSocketMessage) {
+	messageID, _ := msg.Data["message_id"].(string)
+
+	if _, err := h.activateSession(msg.SessionID); err != nil {
+		outChan <- WebSocketMessage{
+			Type:      "error",
+			Error:     fmt.Sprintf("Failed to fork session: %v", err),
+			SessionID: msg.SessionID,
+		}
+		return
+	}
+
+	fork, err := h.agent.ForkConversation(messageID)
+	if err != nil {
+		outChan <- WebSocketMessage{
+			Type:      "error",
+			Error:     err.Error(),
+			SessionID: msg.SessionID,
+		}
+		return
+	}
+
+	h.trackSession(fork.SessionID, fork)
+	h.startLoggingSession(fork.SessionID)
+
+	outChan <- WebSocketMessage{
+		Type:      "session_forked",
+		SessionID: fork.SessionID,
+		Data: map[string]interface{}{
+			"session_id":  fork.SessionID,
+			"forked_from": msg.SessionID,
+			"history":     sessionHistory(fork),
+		},
+	}
+}
+
+// handleSwitchBranch activates the branch containing a message
+func (h *WebSocketHandler) handleSwitchBranch(msg WebSocketMessage, outChan chan<- WebSocketMessage) {
+	messageID, _ := msg.Data["message_id"].(string)
+
+	session, err := h.activateSession(msg.SessionID)
+	if err == nil {
+		err = h.agent.SwitchBranch(messageID)
+	}
+	if err != nil {
+		outChan <- WebSocketMessage{
+			Type:      "error",
+			Error:     fmt.Sprintf("Failed to switch branch: %v", err),
+			SessionID: msg.SessionID,
+		}
+		return
+	}
+
+	h.sendSessionLoaded(session, outChan)
+}
@@ -91,6 +91,7 @@ func main() {
 
 	// Set up HTTP routes
 	http.HandleFunc("/ws", agentInstance.ServeWebSocket)
+	http.Handle("/metrics", agentInstance.Metrics().Handler())
 	
 	// Chat configuration endpoint
 	http.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +128,7 @@ func main() {
 	addr := fmt.Sprintf(":%s", *port)
 	log.Printf("Starting chat server on http://localhost%s", addr)
 	log.Printf("WebSocket endpoint: ws://localhost%s/ws", addr)
+	log.Printf("Metrics endpoint: http://localhost%s/metrics", addr)
 	log.Printf("Serving static files from: %s", staticDir)
 
 	if err := http.ListenAndServe(addr, nil); err != nil {
@@ -153,6 +153,14 @@ function handleWebSocketMessage(message) {
             setTimeout(() => chatInput.focus(), 100);
             break;
 
+        case 'session_forked':
+            currentSessionId = message.session_id;
+            localStorage.setItem('currentSessionId', currentSessionId);
+            displayConversationHistory(message.data.history);
+            loadSessions();
+            setTimeout(() => updateActiveSession(currentSessionId), 100);
+            break;
+
         case 'sessions_list':
             displaySessions(message.data.sessions);
             break;
@@ -161,6 +169,10 @@ function handleWebSocketMessage(message) {
             showStatus(message.content);
             break;
 
+        case 'plan':
+            showPlanStatus(message.data.plan);
+            break;
+
         case 'response':
             if (message.streaming) {
                 appendToStreamingMessage(message.content);
@@ -171,6 +183,7 @@ function handleWebSocketMessage(message) {
 
         case 'complete':
             hideStatus();
+            addSources(message.data && message.data.sources);
             // Auto-generate title after first response if this is a new conversation
             autoGenerateTitle();
             break;
@@ -183,12 +196,40 @@ function handleWebSocketMessage(message) {
             // Session deleted successfully, already removed from UI
             break;
 
+        case 'confirm_request':
+            handleConfirmRequest(message);
+            break;
+
         case 'error':
             showError(message.error);
             break;
     }
 }
 
+// Ask the user to approve a tool call that requires confirmation
+function handleConfirmRequest(message) {
+    const data = message.data || {};
+    const args = JSON.stringify(data.arguments || {}, null, 2);
+    const approved = window.confirm(
+        `The assistant wants to run "${data.tool_name}" (estimated cost ${data.estimated_cost}).\n\n` +
+        `Arguments:\n${args}\n\nAllow this action?`
+    );
+
+    const response = {
+        request_id: data.request_id,
+        decision: approved ? 'approve' : 'deny'
+    };
+    if (!approved) {
+        response.reason = window.prompt('Reason (optional):', '') || '';
+    }
+
+    ws.send(JSON.stringify({
+        type: 'confirm_response',
+        session_id: message.session_id,
+        data: response
+    }));
+}
+
 // Send a message
 function sendMessage(content) {
     if (!content.trim() || isProcessing) {
@@ -449,13 +490,151 @@ function removeSessionTitle(sessionId) {
 function displayConversationHistory(history) {
     clearChat();
 
+    const lastAssistant = history.filter(msg => msg.role === 'assistant' && !msg.trace).pop();
+
     history.forEach(msg => {
-        if (msg.role !== 'system') {
+        if (msg.trace) {
+            addTraceMessage(msg);
+        } else if (msg.role !== 'system') {
             addMessage(msg.role, msg.content, false);
+            addSources(msg.sources);
+            addBranchControls(msg, msg === lastAssistant);
         }
     });
 }
 
+// Add edit / regenerate / fork / branch switching controls to the last rendered message
+function addBranchControls(msg, isLastAssistant) {
+    const messageEl = chatMessages.querySelector('.chat-content').lastElementChild;
+    if (!messageEl || !msg.id) {
+        return;
+    }
+
+    const controls = document.createElement('div');
+    controls.className = 'message-actions';
+
+    const addAction = (label, title, onClick) => {
+        const button = document.createElement('button');
+        button.textContent = label;
+        button.title = title;
+        button.addEventListener('click', onClick);
+        controls.appendChild(button);
+    };
+
+    if (msg.branches && msg.branches.siblings.length > 1) {
+        const { index, siblings } = msg.branches;
+        if (index > 0) {
+            addAction('‹', 'Previous version', () => sendBranchAction('switch_branch', { message_id: siblings[index - 1] }));
+        }
+        const position = document.createElement('span');
+        position.textContent = `${index + 1}/${siblings.length}`;
+        controls.appendChild(position);
+        if (index < siblings.length - 1) {
+            addAction('›', 'Next version', () => sendBranchAction('switch_branch', { message_id: siblings[index + 1] }));
+        }
+    }
+
+    if (msg.role === 'user') {
+        addAction('Edit', 'Edit this message and re-run from here', () => {
+            const content = window.prompt('Edit message:', msg.content);
+            if (content && content.trim() && content !== msg.content) {
+                sendBranchAction('edit_message', { message_id: msg.id, content: content }, true);
+            }
+        });
+    } else {
+        if (isLastAssistant) {
+            addAction('Regenerate', 'Ask for another answer', () => sendBranchAction('regenerate', {}, true));
+        }
+        addAction('Fork', 'Start a new conversation from this point', () => sendBranchAction('fork_session', { message_id: msg.id }));
+    }
+
+    messageEl.querySelector('.message-content').appendChild(controls);
+}
+
+// Send a branching operation for the current session
+function sendBranchAction(type, data, producesAnswer = false) {
+    if (!isConnected || !currentSessionId || isProcessing) {
+        return;
+    }
+
+    if (producesAnswer) {
+        setProcessingState(true);
+    }
+
+    ws.send(JSON.stringify({
+        type: type,
+        session_id: currentSessionId,
+        data: data
+    }));
+}
+
+// Add a collapsed tool-call trace entry (tool call or tool result) to the chat
+function addTraceMessage(msg) {
+    const chatContent = chatMessages.querySelector('.chat-content');
+    if (!chatContent) {
+        return;
+    }
+
+    const traceEl = document.createElement('details');
+    traceEl.className = 'message-trace';
+
+    const summary = document.createElement('summary');
+    const body = document.createElement('pre');
+    if (msg.tool_calls) {
+        summary.textContent = '🔧 ' + msg.tool_calls.map(call => call.function.name).join(', ');
+        body.textContent = msg.tool_calls
+            .map(call => `${call.function.name}(${call.function.arguments})`)
+            .join('\n');
+    } else {
+        summary.textContent = '↳ Tool result';
+        body.textContent = msg.content;
+    }
+
+    traceEl.appendChild(summary);
+    traceEl.appendChild(body);
+    chatContent.appendChild(traceEl);
+}
+
+// List the documents behind the last assistant answer
+function addSources(sources) {
+    if (!sources || sources.length === 0) {
+        return;
+    }
+    const messages = chatMessages.querySelectorAll('.message.assistant');
+    const messageEl = messages[messages.length - 1];
+    if (!messageEl) {
+        return;
+    }
+
+    const sourcesEl = document.createElement('details');
+    sourcesEl.className = 'message-sources';
+
+    const summary = document.createElement('summary');
+    summary.textContent = `📎 ${sources.length} source${sources.length === 1 ? '' : 's'}`;
+    sourcesEl.appendChild(summary);
+
+    const list = document.createElement('ul');
+    sources.forEach(source => {
+        const item = document.createElement('li');
+        const path = document.createElement('code');
+        path.textContent = source.path;
+        item.appendChild(path);
+        if (source.title) {
+            item.appendChild(document.createTextNode(' — ' + source.title));
+        }
+        if (source.score) {
+            item.appendChild(document.createTextNode(` (${source.score.toFixed(2)})`));
+        }
+        if (source.snippet) {
+            item.title = source.snippet;
+        }
+        list.appendChild(item);
+    });
+    sourcesEl.appendChild(list);
+
+    messageEl.querySelector('.message-content').appendChild(sourcesEl);
+}
+
 // Add a message to the chat
 function addMessage(role, content, animate = true) {
     // Ensure chat-content container exists
@@ -566,6 +745,17 @@ function completeStreamingMessage(content) {
     scrollToBottom();
 }
 
+// Show the progress of a plan-and-execute turn in the status indicator
+function showPlanStatus(plan) {
+    if (!plan || !plan.steps || plan.steps.length === 0) {
+        return;
+    }
+    const finished = plan.steps.filter(step => step.status === 'done' || step.status === 'failed').length;
+    const running = plan.steps.find(step => step.status === 'running');
+    const label = running ? running.description : 'Writing answer...';
+    showStatus(`Plan ${finished}/${plan.steps.filter(step => step.status !== 'skipped').length}: ${label}`);
+}
+
 // Show status message
 function showStatus(message) {
     // Update status indicator text if it exists
@@ -89,6 +89,8 @@ type CLI struct {
 	sessionID   string
 	interactive bool // Track if we're in interactive mode
 	context     *agent.ConversationContext // User context for personalization
+	input       *bufio.Scanner             // Shared stdin reader for chat input and confirmations
+	stdin       *stdinReader               // The only reader of stdin, behind input and the ESC watcher
 }
 
 // NewCLI creates a new CLI instance
@@ -152,6 +154,7 @@ func NewCLI(configPath string, enableInteractionLog bool, logDir string, interac
 		logVerbose("Interaction logging enabled on agent\n")
 	}
 
+	stdin := newStdinReader()
 	cli := &CLI{
 		agent:       v3agent,
 		ctx:         ctx,
@@ -160,13 +163,23 @@ func NewCLI(configPath string, enableInteractionLog bool, logDir string, interac
 		sessionID:   sessionID,
 		interactive: interactive,
 		context:     convContext,
+		input:       bufio.NewScanner(stdin),
+		stdin:       stdin,
 	}
 
+	// Ask on the terminal before running tools that require confirmation
+	v3agent.SetConfirmationHandler(agent.ConfirmationHandlerFunc(cli.confirmToolCall))
+
+	// Show agent events (guardrail verdicts...) in verbose mode
+	v3agent.OnEvent(func(event agent.Event) {
+		logVerbose("Event %s: %v\n", event.Type, event.Data)
+	})
+
 	return cli, nil
 }
 
 // runSingleQuery processes a single query and exits
-func runSingleQuery(query, configPath string, enableInteractionLog bool, logDir string, contextFile string) {
+func runSingleQuery(query, configPath string, enableInteractionLog bool, logDir string, contextFile string, profile string) {
 	// Load conversation context if provided or auto-detect context.json
 	contextPath := contextFile
 	if contextPath == "" && fileExists("context.json") {
@@ -178,6 +191,7 @@ func runSingleQuery(query, configPath string, enableInteractionLog bool, logDir
 		fmt.Printf("❌ Failed to load context: %v\n", err)
 		os.Exit(1)
 	}
+	convContext = withProfile(convContext, profile)
 	
 	// Create CLI for single query (not interactive)
 	cli, err := NewCLI(configPath, enableInteractionLog, logDir, false, convContext)
@@ -208,6 +222,27 @@ func runSingleQuery(query, configPath string, enableInteractionLog bool, logDir
 	// Output the response
 	cleanedContent := cleanContent(resp.Content)
 	fmt.Println(cleanedContent)
+	fmt.Print(formatSources(resp.Sources))
+}
+
+// formatSources lists the documents behind an answer, or "" when there are none
+func formatSources(sources []llm.Source) string {
+	if len(sources) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n📎 Sources:\n")
+	for _, source := range sources {
+		b.WriteString("   - " + source.Path)
+		if source.Title != "" {
+			b.WriteString(" — " + source.Title)
+		}
+		if source.Score > 0 {
+			b.WriteString(fmt.Sprintf(" (score %.2f)", source.Score))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
 }
 
 func main() {
@@ -221,6 +256,7 @@ func main() {
 	var logDir = flag.String("log-dir", "./logs", "Directory for interaction logs")
 	var interactive = flag.Bool("interactive", false, "Force interactive mode even when query is provided")
 	var contextFile = flag.String("context", "", "Path to context JSON file for personalization")
+	var profile = flag.String("profile", "", "Agent profile to use (defaults to agent.profile in the config)")
 	flag.Parse()
 
 	// Handle version flag
@@ -243,7 +279,7 @@ func main() {
 	if len(args) > 0 && !*interactive {
 		// Single query mode - process query and exit
 		query := strings.Join(args, " ")
-		runSingleQuery(query, *configPath, *enableInteractionLog && !*disableLogs, *logDir, *contextFile)
+		runSingleQuery(query, *configPath, *enableInteractionLog && !*disableLogs, *logDir, *contextFile, *profile)
 		return
 	}
 
@@ -262,6 +298,7 @@ func main() {
 		fmt.Printf("❌ Failed to load context: %v\n", err)
 		os.Exit(1)
 	}
+	convContext = withProfile(convContext, *profile)
 	
 	// Debug: show context info in verbose mode
 	if convContext != nil {
@@ -330,7 +367,7 @@ func (c *CLI) StartInteractiveSession(initialQuery string) error {
 	}
 
 	// Main conversation loop
-	scanner := bufio.NewScanner(os.Stdin)
+	scanner := c.input
 	for {
 		if logLevel >= LogLevelVerbose {
 			fmt.Print("\n🤖 You: ")
@@ -362,10 +399,17 @@ func (c *CLI) StartInteractiveSession(initialQuery string) error {
 }
 
 func (c *CLI) processUserMessage(input string) error {
+	return c.processTurn(input, func() (*llm.CompletionResponse, error) {
+		return c.agent.SendMessageWithStreaming(input)
+	})
+}
+
+// processTurn runs one agent turn (new message, edit or regeneration) and prints the answer
+func (c *CLI) processTurn(input string, send func() (*llm.CompletionResponse, error)) error {
 	logDebug("User input: %s\n", input)
 
 	// Send message to agent with progress indicator
-	resp, duration, err := c.completeWithProgress(input)
+	resp, duration, err := c.completeTurnWithProgress(input, send)
 	if err != nil {
 		// Don't fail the CLI, show error but continue
 		logNormal("⚠️  Error: %v\n", err)
@@ -389,6 +433,7 @@ func (c *CLI) processUserMessage(input string) error {
 	} else {
 		logNormal("Agent: %s\n", cleanedContent)
 	}
+	logNormal("%s", formatSources(resp.Sources))
 
 	// Show timing info
 	stats := c.agent.GetStats()
@@ -429,6 +474,67 @@ func (c *CLI) handleCommand(input string) bool {
 		c.showSessions()
 		return true
 
+	case "history", "/history":
+		c.showHistory(len(args) > 1 && args[1] == "--trace")
+		return true
+
+	case "regenerate", "/regenerate":
+		c.processTurn("(regenerate)", func() (*llm.CompletionResponse, error) {
+			return c.agent.RegenerateLastResponse()
+		})
+		return true
+
+	case "edit", "/edit":
+		if len(args) < 3 {
+			fmt.Println("Usage: edit <n> <new message>")
+			return true
+		}
+		messageID, ok := c.messageIDAt(args[1])
+		if !ok {
+			return true
+		}
+		content := strings.Join(args[2:], " ")
+		c.processTurn(content, func() (*llm.CompletionResponse, error) {
+			return c.agent.EditMessage(messageID, content)
+		})
+		return true
+
+	case "fork", "/fork":
+		if len(args) < 2 {
+			fmt.Println("Usage: fork <n>")
+			return true
+		}
+		c.forkSession(args[1])
+		return true
+
+	case "branches", "/branches":
+		if len(args) < 2 {
+			fmt.Println("Usage: branches <n>")
+			return true
+		}
+		c.showBranches(args[1])
+		return true
+
+	case "switch", "/switch":
+		if len(args) < 2 {
+			fmt.Println("Usage: switch <message_id>")
+			return true
+		}
+		if err := c.agent.SwitchBranch(args[1]); err != nil {
+			fmt.Printf("❌ Failed to switch branch: %v\n", err)
+			return true
+		}
+		c.showHistory(false)
+		return true
+
+	case "load", "/load":
+		if len(args) < 2 {
+			fmt.Println("Usage: load <session_id>")
+			return true
+		}
+		c.loadSession(args[1])
+		return true
+
 	case "clear", "/clear":
 		c.clearScreen()
 		return true
@@ -460,6 +566,13 @@ func (c *CLI) showHelp() {
 	fmt.Println("stats      - Show system statistics")
 	fmt.Println("memory     - Show memory information")
 	fmt.Println("sessions   - List conversation sessions")
+	fmt.Println("load <id>  - Load a previous session and show its history")
+	fmt.Println("history    - Show the current conversation (--trace adds tool calls)")
+	fmt.Println("regenerate - Ask for another answer to the last message")
+	fmt.Println("edit <n> <text> - Replace message n and re-run from there")
+	fmt.Println("fork <n>   - Start a new session from message n")
+	fmt.Println("branches <n> - List the alternative versions of message n")
+	fmt.Println("switch <id> - Switch to the branch containing a message")
 	fmt.Println("config     - Show current configuration")
 	fmt.Println("clear      - Clear screen")
 	fmt.Println("version    - Show version information")
@@ -578,6 +691,112 @@ func (c *CLI) showSessions() {
 	}
 }
 
+func (c *CLI) loadSession(sessionID string) {
+	if _, err := c.agent.LoadConversation(sessionID); err != nil {
+		fmt.Printf("❌ Failed to load session: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Loaded session %s\n", sessionID)
+	c.showHistory(false)
+}
+
+func (c *CLI) showHistory(withTrace bool) {
+	currentSession := c.agent.GetCurrentSession()
+	if currentSession == nil {
+		fmt.Println("❌ No active session")
+		return
+	}
+
+	fmt.Println("\n📜 Conversation History:")
+	fmt.Println("═════════════════════════")
+
+	n := 0
+	for _, msg := range currentSession.Messages {
+		if msg.Trace {
+			if !withTrace {
+				continue
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Printf("   🔧 %s(%s)\n", call.Function.Name, call.Function.Arguments)
+			}
+			if msg.Role == "tool" {
+				fmt.Printf("   ↳ %.200s\n", strings.Join(strings.Fields(msg.Content), " "))
+			}
+			continue
+		}
+
+		n++
+		branchInfo := ""
+		if branches, err := currentSession.GetBranches(msg.ID); err == nil && len(branches.Siblings) > 1 {
+			branchInfo = fmt.Sprintf(" (version %d/%d)", branches.Index+1, len(branches.Siblings))
+		}
+
+		switch msg.Role {
+		case "user":
+			fmt.Printf("\n[%d]%s 🧑 You: %s\n", n, branchInfo, msg.Content)
+		case "assistant":
+			fmt.Printf("\n[%d]%s Agent: %s\n", n, branchInfo, cleanContent(msg.Content))
+		}
+	}
+	fmt.Println()
+}
+
+// messageIDAt resolves a 1-based message number from the history listing
+func (c *CLI) messageIDAt(position string) (string, bool) {
+	currentSession := c.agent.GetCurrentSession()
+	if currentSession == nil {
+		fmt.Println("❌ No active session")
+		return "", false
+	}
+
+	var n int
+	messages := currentSession.ConversationMessages()
+	if _, err := fmt.Sscanf(position, "%d", &n); err != nil || n < 1 || n > len(messages) {
+		fmt.Printf("❌ Invalid message number %s (use 'history' to list messages)\n", position)
+		return "", false
+	}
+	return messages[n-1].ID, true
+}
+
+func (c *CLI) forkSession(position string) {
+	messageID, ok := c.messageIDAt(position)
+	if !ok {
+		return
+	}
+
+	fork, err := c.agent.ForkConversation(messageID)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Forked into new session %s\n", fork.SessionID)
+}
+
+func (c *CLI) showBranches(position string) {
+	messageID, ok := c.messageIDAt(position)
+	if !ok {
+		return
+	}
+
+	branches, err := c.agent.GetBranches(messageID)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	currentSession := c.agent.GetCurrentSession()
+	fmt.Printf("\n🌿 Versions of message %s:\n", position)
+	for i, id := range branches.Siblings {
+		marker := "  "
+		if i == branches.Index {
+			marker = "→ "
+		}
+		msg, _ := currentSession.GetMessage(id)
+		fmt.Printf("%s%s  %.80s\n", marker, id, strings.Join(strings.Fields(msg.Content), " "))
+	}
+	fmt.Println("\nUse 'switch <id>' to activate a version.")
+}
+
 func (c *CLI) showConfig() {
 	fmt.Println("\n⚙️ Configuration:")
 	fmt.Println("═══════════════════")
@@ -647,6 +866,18 @@ func loadContextFromFile(filePath string) (*agent.ConversationContext, error) {
 	return &context, nil
 }
 
+// withProfile sets the agent profile of the conversation context, if any
+func withProfile(context *agent.ConversationContext, profile string) *agent.ConversationContext {
+	if profile == "" {
+		return context
+	}
+	if context == nil {
+		context = &agent.ConversationContext{}
+	}
+	context.Profile = profile
+	return context
+}
+
 // fileExists checks if a file exists
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
@@ -675,8 +906,57 @@ func setupSignalHandling(cli *CLI) {
 	}()
 }
 
+// confirmToolCall prompts the user to approve, deny or edit a tool call
+func (c *CLI) confirmToolCall(ctx context.Context, req agent.ConfirmationRequest) (*agent.ConfirmationResponse, error) {
+	args, _ := json.MarshalIndent(req.Arguments, "   ", "  ")
+
+	fmt.Printf("\n⚠️  The agent wants to run %s (%s, estimated cost %d)\n", req.ToolName, req.Category, req.EstimatedCost)
+	fmt.Printf("   Arguments: %s\n", args)
+
+	// Read the answer in line mode even while the request watches for ESC
+	resume := c.stdin.suspendEscape()
+	defer resume()
+
+	for {
+		fmt.Print("   Approve? [y]es / [n]o / [e]dit: ")
+		if !c.input.Scan() {
+			return &agent.ConfirmationResponse{Decision: agent.ConfirmationDeny, Reason: "no input available"}, nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(c.input.Text())) {
+		case "y", "yes":
+			return &agent.ConfirmationResponse{Decision: agent.ConfirmationApprove}, nil
+		case "n", "no":
+			fmt.Print("   Reason (optional): ")
+			reason := ""
+			if c.input.Scan() {
+				reason = strings.TrimSpace(c.input.Text())
+			}
+			return &agent.ConfirmationResponse{Decision: agent.ConfirmationDeny, Reason: reason}, nil
+		case "e", "edit":
+			fmt.Print("   New arguments (JSON, single line): ")
+			if !c.input.Scan() {
+				return &agent.ConfirmationResponse{Decision: agent.ConfirmationDeny, Reason: "no input available"}, nil
+			}
+			var edited map[string]interface{}
+			if err := json.Unmarshal([]byte(c.input.Text()), &edited); err != nil {
+				fmt.Printf("   ❌ Invalid JSON: %v\n", err)
+				continue
+			}
+			return &agent.ConfirmationResponse{Decision: agent.ConfirmationEdit, Arguments: edited}, nil
+		}
+	}
+}
+
 // completeWithProgress shows a thinking indicator while waiting for LLM response
 func (c *CLI) completeWithProgress(input string) (*llm.CompletionResponse, time.Duration, error) {
+	return c.completeTurnWithProgress(input, func() (*llm.CompletionResponse, error) {
+		return c.agent.SendMessageWithStreaming(input)
+	})
+}
+
+// completeTurnWithProgress runs send in the background while allowing cancellation
+func (c *CLI) completeTurnWithProgress(input string, send func() (*llm.CompletionResponse, error)) (*llm.CompletionResponse, time.Duration, error) {
 	// Channel for LLM response
 	respChan := make(chan *llm.CompletionResponse, 1)
 	errChan := make(chan error, 1)
@@ -697,7 +977,7 @@ func (c *CLI) completeWithProgress(input string) (*llm.CompletionResponse, time.
 			logDebug("Sending message to LLM: %s\n", input)
 		}
 
-		resp, err := c.agent.SendMessageWithStreaming(input)
+		resp, err := send()
 		if err != nil {
 			logDebug("LLM error: %v\n", err)
 			errChan <- err
@@ -707,9 +987,10 @@ func (c *CLI) completeWithProgress(input string) (*llm.CompletionResponse, time.
 		}
 	}()
 
-	// Start keyboard monitoring in goroutine (only in verbose mode to avoid terminal issues)
+	// Watch for ESC while the request runs (only in verbose mode to avoid terminal issues)
 	if logLevel >= LogLevelVerbose {
-		go c.monitorKeyboard(cancelChan)
+		stop := c.stdin.watchEscape(cancelChan)
+		defer stop()
 	}
 
 	// Show thinking indicator (disabled when using streaming)
@@ -770,40 +1051,3 @@ func (c *CLI) showThinkingIndicator(start time.Time, cancel <-chan bool) {
 		}
 	}
 }
-
-// monitorKeyboard watches for ESC key to cancel request
-func (c *CLI) monitorKeyboard(cancel chan<- bool) {
-	// Set terminal to raw mode to catch individual keystrokes
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		return // Can't monitor keyboard, continue without cancellation
-	}
-
-	// Ensure terminal is always restored
-	defer func() {
-		term.Restore(int(os.Stdin.Fd()), oldState)
-	}()
-
-	buf := make([]byte, 1)
-	for {
-		// Read with a timeout to periodically check if we should exit
-		n, err := os.Stdin.Read(buf)
-		if err != nil {
-			// If we get an error, just exit gracefully
-			return
-		}
-		if n == 0 {
-			continue
-		}
-
-		// Check for ESC key (ASCII 27)
-		if buf[0] == 27 {
-			select {
-			case cancel <- true:
-			default:
-				// If can't send to cancel channel, just return
-			}
-			return
-		}
-	}
-}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// stdinReader is the only reader of stdin. Chat input and confirmations read
+// lines from it; while a request runs in verbose mode it switches the terminal
+// to raw mode and watches the keystrokes for ESC instead. Having one reader
+// keeps the two from racing for the same bytes.
+type stdinReader struct {
+	chunks  chan []byte
+	pending []byte
+
+	mu        sync.Mutex
+	escape    chan<- bool // Receives ESC while watching
+	suspended bool        // Watching is paused for a prompt, the terminal is in line mode
+	rawState  *term.State // Terminal state to restore when leaving raw mode
+}
+
+func newStdinReader() *stdinReader {
+	r := &stdinReader{chunks: make(chan []byte, 64)}
+	go r.run()
+	return r
+}
+
+// run reads stdin until it ends, handing the bytes to Read or to the ESC watcher
+func (r *stdinReader) run() {
+	for {
+		buf := make([]byte, 4096)
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			r.mu.Lock()
+			escape := r.escape
+			if r.suspended {
+				escape = nil
+			}
+			r.mu.Unlock()
+
+			if escape == nil {
+				r.chunks <- buf[:n]
+			} else if bytes.IndexByte(buf[:n], 27) >= 0 {
+				select {
+				case escape <- true:
+				default:
+				}
+			}
+		}
+		if err != nil {
+			close(r.chunks)
+			return
+		}
+	}
+}
+
+// Read returns the bytes typed while no request watches for ESC
+func (r *stdinReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		r.pending = chunk
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// watchEscape puts the terminal in raw mode and sends ESC keystrokes to cancel
+// until the returned function is called. Without a terminal it does nothing.
+func (r *stdinReader) watchEscape(cancel chan<- bool) (stop func()) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return func() {}
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return func() {}
+	}
+
+	r.mu.Lock()
+	r.escape = cancel
+	r.suspended = false
+	r.rawState = state
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if !r.suspended {
+			term.Restore(fd, r.rawState)
+		}
+		r.escape = nil
+		r.suspended = false
+		r.rawState = nil
+	}
+}
+
+// suspendEscape restores line mode so a prompt can be answered in the middle
+// of a request. The returned function goes back to watching for ESC, unless the
+// request has ended meanwhile.
+func (r *stdinReader) suspendEscape() (resume func()) {
+	fd := int(os.Stdin.Fd())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.escape == nil || r.suspended {
+		return func() {}
+	}
+	term.Restore(fd, r.rawState)
+	r.suspended = true
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.escape == nil || !r.suspended {
+			return
+		}
+		if state, err := term.MakeRaw(fd); err == nil {
+			r.rawState = state
+			r.suspended = false
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Command eval runs a suite of questions against the agent and reports which
+// answers meet their expectations, with the tokens, latency and tool calls of
+// each case. Reports saved as JSON can be compared to catch regressions after
+// changing prompts or loop heuristics.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santiagocorredoira/agent/agent"
+	"github.com/santiagocorredoira/agent/agent/config"
+	"github.com/santiagocorredoira/agent/agent/llm"
+)
+
+func main() {
+	var suitePath = flag.String("suite", "", "Path to the suite JSON file")
+	var configPath = flag.String("config", "config.json", "Path to configuration file")
+	var providerName = flag.String("provider", "", "LLM provider to evaluate (anthropic, openai, gemini, mock); defaults to the configured fallback order")
+	var replayPath = flag.String("replay", "", "Answer from a cassette recorded with -record instead of calling an LLM")
+	var replayLenient = flag.Bool("replay-lenient", false, "Answer requests missing from the cassette with the next recorded response instead of failing the case")
+	var recordPath = flag.String("record", "", "Record the LLM interactions of the run to a cassette")
+	var profile = flag.String("profile", "", "Agent profile for cases that do not set one")
+	var reportPath = flag.String("json", "", "Write the report as JSON to this file")
+	var comparePath = flag.String("compare", "", "Compare with a JSON report of a previous run")
+	var toolsOnly = flag.Bool("tools-only", true, "Only answer questions that require tools, like the CLI")
+	var verbose = flag.Bool("v", false, "Show agent logs")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  eval -suite suite.json [flags]           run a suite\n")
+		fmt.Fprintf(os.Stderr, "  eval -compare old.json new.json          compare two saved reports\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	// Compare two saved reports without running anything
+	if *suitePath == "" {
+		if *comparePath == "" || flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		baseline, err := loadReport(*comparePath)
+		exitOnError(err)
+		current, err := loadReport(flag.Arg(0))
+		exitOnError(err)
+		compare(os.Stdout, baseline, current)
+		return
+	}
+
+	suite, err := loadSuite(*suitePath)
+	exitOnError(err)
+
+	provider, label, err := buildProvider(*configPath, *providerName, *replayPath, *replayLenient)
+	exitOnError(err)
+	if *recordPath != "" {
+		if provider == nil {
+			exitOnError(fmt.Errorf("-record requires -provider"))
+		}
+		recorder, err := llm.NewRecordingProvider(provider, *recordPath)
+		exitOnError(err)
+		defer recorder.Close()
+		provider = recorder
+	}
+
+	if *profile != "" && suite.Profile == "" {
+		suite.Profile = *profile
+	}
+
+	report, err := run(suite, *configPath, provider, label, *toolsOnly)
+	exitOnError(err)
+
+	report.print(os.Stdout)
+	if replay, ok := provider.(*llm.ReplayProvider); ok && replay.Mismatches() > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d requests were not in the cassette and got the next recorded response\n", replay.Mismatches())
+	}
+	if *reportPath != "" {
+		exitOnError(report.save(*reportPath))
+		fmt.Printf("Report written to %s\n", *reportPath)
+	}
+	if *comparePath != "" {
+		baseline, err := loadReport(*comparePath)
+		exitOnError(err)
+		fmt.Println()
+		compare(os.Stdout, baseline, report)
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// buildProvider returns the provider selected by the flags and its label for the
+// report. A nil provider means the configured fallback order. Replay fails
+// requests missing from the cassette unless lenient is set.
+func buildProvider(configPath, name, replayPath string, lenient bool) (llm.Provider, string, error) {
+	if replayPath != "" {
+		provider, err := llm.NewReplayProvider(replayPath)
+		if err != nil {
+			return nil, "", err
+		}
+		provider.SetStrict(!lenient)
+		return provider, "replay:" + replayPath, nil
+	}
+	if name == "" {
+		return nil, "config", nil
+	}
+
+	cfg := config.LoadConfigOrDefault(configPath)
+	llmConfig := cfg.GetLLMConfig(name)
+	if llmConfig == nil && name != "mock" {
+		return nil, "", fmt.Errorf("provider %s is not configured in %s", name, configPath)
+	}
+	provider, err := llm.NewProvider(name, llmConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	return provider, name, nil
+}
+
+// run answers every case in a fresh session and checks the expectations
+func run(suite *Suite, configPath string, provider llm.Provider, label string, toolsOnly bool) (*Report, error) {
+	storageDir, err := os.MkdirTemp("", "agent-eval-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session storage: %w", err)
+	}
+	defer os.RemoveAll(storageDir)
+
+	recorder := &toolRecorder{}
+	agentInstance, err := agent.NewV3Agent(agent.AgentConfig{
+		ConfigPath:    configPath,
+		StorageDir:    storageDir,
+		ToolsOnlyMode: toolsOnly,
+		Hooks:         []agent.Hook{recorder},
+		Provider:      provider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+	defer agentInstance.Shutdown()
+
+	report := &Report{Suite: suite.Name, Provider: label, StartedAt: time.Now()}
+	for i, c := range suite.Cases {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", i+1, len(suite.Cases), c.ID)
+		result := runCase(agentInstance, recorder, suite, c)
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, result)
+	}
+	report.DurationMS = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+// runCase asks the question of a case in a new session
+func runCase(agentInstance *agent.V3Agent, recorder *toolRecorder, suite *Suite, c Case) CaseResult {
+	result := CaseResult{ID: c.ID, Question: c.Question}
+
+	profile := c.Profile
+	if profile == "" {
+		profile = suite.Profile
+	}
+	session, err := agentInstance.StartConversationWithContext(&agent.ConversationContext{Profile: profile})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	opts := agent.DefaultConversationOptions()
+	opts.ErrorPolicy = agent.ErrorPolicyStrict // A failed turn is a failed case, not an apology to check
+
+	recorder.reset()
+	start := time.Now()
+	resp, err := agentInstance.SendMessage(c.Question, opts)
+	result.LatencyMS = time.Since(start).Milliseconds()
+
+	usage := session.Usage
+	result.PromptTokens = usage.PromptTokens
+	result.CompletionTokens = usage.CompletionTokens
+	result.TotalTokens = usage.TotalTokens
+	result.Cost = usage.Cost
+	result.Tools = recorder.counts()
+	for _, n := range result.Tools {
+		result.ToolCalls += n
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer = strings.TrimSpace(resp.Content)
+	result.Failures = c.Expect.check(result.Answer, result.ToolCalls)
+	result.Passed = len(result.Failures) == 0
+	return result
+}
+
+// toolRecorder is a hook that counts the tool calls of the current case,
+// including those of sub-agents
+type toolRecorder struct {
+	agent.BaseHook
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (r *toolRecorder) AfterToolCall(hc *agent.HookContext, call *agent.HookToolCall, result string, toolErr error) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls[call.Name]++
+	return result, nil
+}
+
+func (r *toolRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = make(map[string]int)
+}
+
+func (r *toolRecorder) counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int, len(r.calls))
+	for name, n := range r.calls {
+		counts[name] = n
+	}
+	return counts
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+}
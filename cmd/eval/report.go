@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Report is the result of running a suite, saved as JSON to compare runs
+type Report struct {
+	Suite      string       `json:"suite"`
+	Provider   string       `json:"provider"`
+	StartedAt  time.Time    `json:"started_at"`
+	DurationMS int64        `json:"duration_ms"`
+	Passed     int          `json:"passed"`
+	Failed     int          `json:"failed"`
+	Cases      []CaseResult `json:"cases"`
+}
+
+// CaseResult is the outcome of one case
+type CaseResult struct {
+	ID               string         `json:"id"`
+	Question         string         `json:"question"`
+	Passed           bool           `json:"passed"`
+	Failures         []string       `json:"failures,omitempty"`
+	Error            string         `json:"error,omitempty"`
+	Answer           string         `json:"answer"`
+	PromptTokens     int            `json:"prompt_tokens"`
+	CompletionTokens int            `json:"completion_tokens"`
+	TotalTokens      int            `json:"total_tokens"`
+	Cost             float64        `json:"cost"`
+	LatencyMS        int64          `json:"latency_ms"`
+	ToolCalls        int            `json:"tool_calls"`
+	Tools            map[string]int `json:"tools,omitempty"` // Calls by tool name
+}
+
+// totals sums the usage of every case
+func (r *Report) totals() (tokens int, cost float64, latency int64, toolCalls int) {
+	for _, c := range r.Cases {
+		tokens += c.TotalTokens
+		cost += c.Cost
+		latency += c.LatencyMS
+		toolCalls += c.ToolCalls
+	}
+	return
+}
+
+// loadReport reads a JSON report written by a previous run
+func loadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// save writes the report as indented JSON
+func (r *Report) save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// print writes the pass/fail table with the usage of each case
+func (r *Report) print(w io.Writer) {
+	fmt.Fprintf(w, "Suite %s (provider %s)\n\n", r.Suite, r.Provider)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tRESULT\tTOKENS\tLATENCY\tTOOLS")
+	for _, c := range r.Cases {
+		result := "PASS"
+		if !c.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d %s\n", c.ID, result, c.TotalTokens,
+			formatLatency(c.LatencyMS), c.ToolCalls, formatTools(c.Tools))
+	}
+	tw.Flush()
+
+	for _, c := range r.Cases {
+		if c.Passed {
+			continue
+		}
+		fmt.Fprintf(w, "\n✗ %s: %s\n", c.ID, c.Question)
+		if c.Error != "" {
+			fmt.Fprintf(w, "    error: %s\n", c.Error)
+		}
+		for _, failure := range c.Failures {
+			fmt.Fprintf(w, "    - %s\n", failure)
+		}
+	}
+
+	tokens, cost, latency, toolCalls := r.totals()
+	fmt.Fprintf(w, "\n%d passed, %d failed | %d tokens, $%.4f, %s, %d tool calls\n",
+		r.Passed, r.Failed, tokens, cost, formatLatency(latency), toolCalls)
+}
+
+// compare prints the changes from a baseline run: cases that changed result
+// and the usage deltas of the cases present in both runs
+func compare(w io.Writer, baseline, current *Report) {
+	fmt.Fprintf(w, "Comparison with baseline (%s, %s)\n\n", baseline.Provider, baseline.StartedAt.Format(time.RFC3339))
+
+	previous := make(map[string]CaseResult, len(baseline.Cases))
+	for _, c := range baseline.Cases {
+		previous[c.ID] = c
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tRESULT\tTOKENS\tLATENCY\tTOOL CALLS")
+	for _, c := range current.Cases {
+		old, ok := previous[c.ID]
+		if !ok {
+			fmt.Fprintf(tw, "%s\tnew (%s)\t%d\t%s\t%d\n", c.ID, passLabel(c.Passed), c.TotalTokens, formatLatency(c.LatencyMS), c.ToolCalls)
+			continue
+		}
+		delete(previous, c.ID)
+
+		result := passLabel(c.Passed)
+		if c.Passed != old.Passed {
+			result = passLabel(old.Passed) + " → " + result
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.ID, result,
+			formatDelta(int64(c.TotalTokens), int64(old.TotalTokens), ""),
+			formatDelta(c.LatencyMS, old.LatencyMS, "ms"),
+			formatDelta(int64(c.ToolCalls), int64(old.ToolCalls), ""))
+	}
+
+	removed := make([]string, 0, len(previous))
+	for id := range previous {
+		removed = append(removed, id)
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		fmt.Fprintf(tw, "%s\tremoved\t\t\t\n", id)
+	}
+	tw.Flush()
+
+	oldTokens, oldCost, oldLatency, oldTools := baseline.totals()
+	tokens, cost, latency, toolCalls := current.totals()
+	fmt.Fprintf(w, "\npassed %d → %d | tokens %s | cost $%.4f → $%.4f | latency %s | tool calls %s\n",
+		baseline.Passed, current.Passed,
+		formatDelta(int64(tokens), int64(oldTokens), ""),
+		oldCost, cost,
+		formatDelta(latency, oldLatency, "ms"),
+		formatDelta(int64(toolCalls), int64(oldTools), ""))
+}
+
+func passLabel(passed bool) string {
+	if passed {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+func formatLatency(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(10 * time.Millisecond).String()
+}
+
+// formatDelta shows a value with its change from the baseline, e.g. "1200 (+150)"
+func formatDelta(current, previous int64, unit string) string {
+	diff := current - previous
+	if diff == 0 {
+		return fmt.Sprintf("%d%s", current, unit)
+	}
+	return fmt.Sprintf("%d%s (%+d)", current, unit, diff)
+}
+
+// formatTools lists tool calls by name, e.g. "(kbase×3, delegate×1)"
+func formatTools(tools map[string]int) string {
+	if len(tools) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s×%d", name, tools[name]))
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Suite is a set of evaluation cases loaded from a JSON file
+type Suite struct {
+	Name    string `json:"name"`
+	Profile string `json:"profile,omitempty"` // Default profile of the cases
+	Cases   []Case `json:"cases"`
+}
+
+// Case is a question and the expectations its answer must meet
+type Case struct {
+	ID       string      `json:"id"`
+	Question string      `json:"question"`
+	Profile  string      `json:"profile,omitempty"`
+	Expect   Expectation `json:"expect"`
+}
+
+// Expectation lists the checks of a case. Text checks are case-insensitive.
+type Expectation struct {
+	Mention      []string `json:"mention,omitempty"`        // Text the answer must contain
+	Cite         []string `json:"cite,omitempty"`           // Files the answer must cite, by path or base name
+	NotContain   []string `json:"not_contain,omitempty"`    // Text the answer must not contain
+	MaxToolCalls *int     `json:"max_tool_calls,omitempty"` // Upper bound of tool calls in the turn
+	MinToolCalls int      `json:"min_tool_calls,omitempty"` // Lower bound of tool calls in the turn
+}
+
+// loadSuite reads and validates a suite file
+func loadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+
+	var suite Suite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse suite: %w", err)
+	}
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("suite %s has no cases", suite.Name)
+	}
+
+	seen := make(map[string]bool)
+	for i, c := range suite.Cases {
+		if c.ID == "" {
+			return nil, fmt.Errorf("case %d has no id", i+1)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("duplicate case id %q", c.ID)
+		}
+		seen[c.ID] = true
+		if strings.TrimSpace(c.Question) == "" {
+			return nil, fmt.Errorf("case %s has no question", c.ID)
+		}
+	}
+	return &suite, nil
+}
+
+// check returns the expectations the answer and tool usage fail
+func (e Expectation) check(answer string, toolCalls int) []string {
+	var failures []string
+	lower := strings.ToLower(answer)
+
+	for _, text := range e.Mention {
+		if !strings.Contains(lower, strings.ToLower(text)) {
+			failures = append(failures, fmt.Sprintf("does not mention %q", text))
+		}
+	}
+	for _, file := range e.Cite {
+		if !strings.Contains(lower, strings.ToLower(file)) &&
+			!strings.Contains(lower, strings.ToLower(filepath.Base(file))) {
+			failures = append(failures, fmt.Sprintf("does not cite %s", file))
+		}
+	}
+	for _, text := range e.NotContain {
+		if strings.Contains(lower, strings.ToLower(text)) {
+			failures = append(failures, fmt.Sprintf("contains %q", text))
+		}
+	}
+	if e.MaxToolCalls != nil && toolCalls > *e.MaxToolCalls {
+		failures = append(failures, fmt.Sprintf("%d tool calls, max %d", toolCalls, *e.MaxToolCalls))
+	}
+	if toolCalls < e.MinToolCalls {
+		failures = append(failures, fmt.Sprintf("%d tool calls, min %d", toolCalls, e.MinToolCalls))
+	}
+	return failures
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/santiagocorredoira/agent/agent"
+	"github.com/santiagocorredoira/agent/agent/llm"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+// askAgentTool answers a question with a full agent turn. Questions share one
+// session, so follow-ups keep their context, until a call asks for a new one.
+type askAgentTool struct {
+	*tools.BaseTool
+	agent   *agent.V3Agent
+	profile string
+
+	mu      sync.Mutex // The agent runs one turn at a time
+	started bool
+}
+
+func newAskAgentTool(agentInstance *agent.V3Agent, profile string) *askAgentTool {
+	tool := &askAgentTool{
+		BaseTool: tools.NewBaseTool(
+			"ask_agent",
+			"Asks the documentation agent a question. It searches the knowledge base on its own, possibly several times, and returns a written answer with the documents it used. Prefer the search tools for a single lookup.",
+			tools.CategoryCustom,
+			false,
+			60,
+		),
+		agent:   agentInstance,
+		profile: profile,
+	}
+
+	tool.SetParameterSchema(&tools.ParameterSchema{
+		Type:        "object",
+		Description: "Parameters for asking the agent",
+		Properties: map[string]tools.PropertySchema{
+			"question": {
+				Type:        "string",
+				Description: "Question for the agent, in natural language",
+			},
+			"new_session": {
+				Type:        "boolean",
+				Description: "Start a new conversation instead of continuing the previous questions",
+				Default:     false,
+			},
+		},
+		Required: []string{"question"},
+	})
+
+	return tool
+}
+
+func (t *askAgentTool) GetFunctionDefinition() llm.FunctionDefinition {
+	return tools.DefaultGetFunctionDefinition(t)
+}
+
+func (t *askAgentTool) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+func (t *askAgentTool) Execute(ctx context.Context, params map[string]interface{}) (*tools.ToolResult, error) {
+	question, ok := params["question"].(string)
+	if !ok || strings.TrimSpace(question) == "" {
+		return t.CreateErrorResult(
+			&tools.ToolError{Type: "parameter_error", Message: "question must be a non-empty string", Code: "INVALID_QUESTION"},
+			"Invalid question parameter",
+		), nil
+	}
+	newSession, _ := params["new_session"].(bool)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if newSession || !t.started {
+		if _, err := t.agent.StartConversationWithContext(&agent.ConversationContext{Profile: t.profile}); err != nil {
+			return t.CreateErrorResult(err, "Failed to start a session"), nil
+		}
+		t.started = true
+	}
+
+	opts := agent.DefaultConversationOptions()
+	opts.ErrorPolicy = agent.ErrorPolicyStrict // Report failed turns as tool errors, not as apologies
+	resp, err := t.agent.SendMessage(question, opts)
+	if err != nil {
+		return t.CreateErrorResult(err, "The agent could not answer"), nil
+	}
+
+	result := t.CreateSuccessResult(map[string]interface{}{
+		"answer":  resp.Content,
+		"sources": resp.Sources,
+	}, resp.Content)
+	result.Sources = resp.Sources
+	return result, nil
+}
@@ -0,0 +1,88 @@
+// Command mcp serves the agent tools, including the knowledge base search, to
+// MCP clients such as IDE assistants over the stdio transport. Knowledge base
+// documents are exposed as resources, and -ask adds an ask_agent tool that
+// answers with a full agent turn.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/santiagocorredoira/agent/agent"
+	"github.com/santiagocorredoira/agent/agent/mcp"
+	"github.com/santiagocorredoira/agent/agent/tools"
+)
+
+const version = "0.2.0"
+
+func main() {
+	var configPath = flag.String("config", "config.json", "Path to configuration file")
+	var storageDir = flag.String("storage", "./agent_memory", "Directory for the sessions of ask_agent")
+	var toolList = flag.String("tools", "", "Comma-separated agent tools to serve (default: all that need no confirmation)")
+	var resources = flag.Bool("resources", true, "Serve knowledge base documents as resources")
+	var ask = flag.Bool("ask", false, "Serve the ask_agent tool, which answers questions with a full agent turn")
+	var profile = flag.String("profile", "", "Agent profile for ask_agent sessions")
+	var toolsOnly = flag.Bool("tools-only", false, "Make ask_agent only answer questions that require tools")
+	flag.Parse()
+
+	// Stdout carries the protocol: anything else the agent prints goes to stderr
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+	log.SetOutput(os.Stderr)
+
+	agentInstance, err := agent.NewV3Agent(agent.AgentConfig{
+		ConfigPath:    *configPath,
+		StorageDir:    *storageDir,
+		AutoSave:      true,
+		ToolsOnlyMode: *toolsOnly,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create agent: %v\n", err)
+		os.Exit(1)
+	}
+	defer agentInstance.Shutdown()
+
+	server := mcp.NewServer("agent", version, agentInstance.GetToolRegistry())
+	if *toolList != "" {
+		var names []string
+		for _, name := range strings.Split(*toolList, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		server.AllowTools(names)
+	}
+	if *resources {
+		if kbPath := agentInstance.GetConfig().KnowledgeBase.Path; kbPath != "" {
+			rfs, err := tools.NewRestrictedFS(kbPath)
+			if err != nil {
+				log.Printf("Warning: knowledge base resources disabled: %v", err)
+			} else {
+				server.SetResources(rfs)
+			}
+		}
+	}
+	if *ask {
+		server.AddTool(newAskAgentTool(agentInstance, *profile))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx, os.Stdin, protocolOut) }()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+	}
+	if err != nil {
+		log.Printf("MCP server stopped: %v", err)
+	}
+}
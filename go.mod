@@ -3,13 +3,11 @@ module github.com/santiagocorredoira/agent
 go 1.24.4
 
 require (
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/sys v0.34.0
 	golang.org/x/term v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 	textSearch v0.0.0-00010101000000-000000000000
 )
 
 replace textSearch => github.com/scorredoira/textSearch v0.0.0-20250726160725-f2cb17ee03e1
-
-require (
-	github.com/gorilla/websocket v1.5.3 // indirect
-	golang.org/x/sys v0.34.0 // indirect
-)